@@ -265,6 +265,10 @@ type RowChangedEvent struct {
 	// ApproximateDataSize is the approximate size of protobuf binary
 	// representation of this event.
 	ApproximateDataSize int64 `json:"-" msg:"-"`
+
+	// TableInfo is the schema the row is mounted with, it's only available before the row is
+	// persisted or sent, e.g. for the encoders of the MQ sinks to format ENUM and SET values.
+	TableInfo *TableInfo `json:"-" msg:"-"`
 }
 
 // IsDelete returns true if the row is a delete event
@@ -449,6 +453,9 @@ type DDLEvent struct {
 	PreTableInfo *SimpleTableInfo `msg:"pre-table-info"`
 	Query        string           `msg:"query"`
 	Type         model.ActionType `msg:"-"`
+	// TiTableInfo is the table info after the DDL, it's only available when the event is created from the job,
+	// and it's nil for the DDLs which update multiple tables.
+	TiTableInfo *model.TableInfo `msg:"-" json:"-"`
 }
 
 // RedoDDLEvent represents DDL event used in redo log persistent
@@ -488,6 +495,7 @@ func (d *DDLEvent) FromJob(job *model.Job, preTableInfo *TableInfo) {
 
 		d.TableInfo.Table = tableName
 		d.TableInfo.TableID = job.TableID
+		d.TiTableInfo = tableInfo
 	}
 }
 
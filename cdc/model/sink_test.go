@@ -223,6 +223,7 @@ func TestDDLEventFromJob(t *testing.T) {
 	event.FromJob(job, preTableInfo)
 	require.Equal(t, uint64(420536581131337731), event.StartTs)
 	require.Equal(t, event.TableInfo.TableID, int64(49))
+	require.Equal(t, job.BinlogInfo.TableInfo, event.TiTableInfo)
 	require.Equal(t, 1, len(event.PreTableInfo.ColumnInfo))
 
 	event = &DDLEvent{}
@@ -115,6 +115,7 @@ func TestBuildDDLEvent(t *testing.T) {
 			ColumnInfo: []*model.ColumnInfo{{Name: "id", Type: mysql.TypeLong}},
 		},
 		PreTableInfo: nil,
+		TiTableInfo:  job.BinlogInfo.TableInfo,
 	})
 	require.Nil(t, schema.HandleDDL(job))
 	job = helper.DDL2Job("ALTER TABLE test.t1 ADD COLUMN c1 CHAR(16) NOT NULL")
@@ -137,6 +138,7 @@ func TestBuildDDLEvent(t *testing.T) {
 			TableID:    job.TableID,
 			ColumnInfo: []*model.ColumnInfo{{Name: "id", Type: mysql.TypeLong}},
 		},
+		TiTableInfo: job.BinlogInfo.TableInfo,
 	})
 }
 
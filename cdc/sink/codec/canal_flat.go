@@ -14,32 +14,260 @@
 package codec
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"path"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/benbjohnson/clock"
+	"github.com/golang/snappy"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
+	timodel "github.com/pingcap/tidb/parser/model"
+	"github.com/pingcap/tidb/parser/mysql"
 	"github.com/pingcap/tidb/parser/types"
+	tidbtypes "github.com/pingcap/tidb/types"
 	"github.com/pingcap/tiflow/cdc/model"
 	"github.com/pingcap/tiflow/pkg/config"
 	cerrors "github.com/pingcap/tiflow/pkg/errors"
 	canal "github.com/pingcap/tiflow/proto/canal"
+	"github.com/tikv/client-go/v2/oracle"
 	"go.uber.org/zap"
 )
 
-const tidbWaterMarkType = "TIDB_WATERMARK"
+const (
+	tidbWaterMarkType = "TIDB_WATERMARK"
+	tidbHeartbeatType = "TIDB_HEARTBEAT"
+
+	// defaultCanalFlatDecoderMaxColumns is the default maximum number of columns
+	// in a decoded row, it's the same as the maximum column count of a TiDB table.
+	defaultCanalFlatDecoderMaxColumns = 4096
+)
 
 // CanalFlatEventBatchEncoder encodes Canal flat messages in JSON format
 type CanalFlatEventBatchEncoder struct {
 	builder    *canalEntryBuilder
 	messageBuf []canalFlatMessageInterface
+	// the bytes of the messages and keys in messageBuf, measured when they're appended, see `Size`.
+	size int
+	// row changed events encoded into messages longer than it are rejected if it's positive, see `MQMessage.Length`.
+	maxMessageBytes int
+	// When it is true, consecutive row messages with the same topic and key are packed into JSON arrays,
+	// each of which is no longer than `maxMessageBytes`, instead of one message per row.
+	packMessages bool
+	// When it is true, the row messages are packed by transaction, so each array contains the messages of exactly
+	// one commitTs, and a transaction is only split if it exceeds `maxMessageBytes`. It implies `packMessages`.
+	splitByTransaction bool
 	// When it is true, canal-json would generate TiDB extension information
 	// which, at the moment, only includes `tidbWaterMarkType` and `_tidb` fields.
 	enableTiDBExtension bool
+	// When it is true, checkpoints are emitted as `tidbWaterMarkType` messages even if the TiDB extension is
+	// disabled, the watermark is carried by `es` in milliseconds instead of `watermarkTs` of the extension,
+	// so consumers of the plain format only learn the physical time of the checkpoint, see `EncodeCheckpointEvent`.
+	plainWatermark bool
+	// When it is true, null columns are omitted from `data` and `old` instead of
+	// being encoded as explicit `null`, primary key columns are always kept.
+	omitNulls bool
+	// schemaVersions records the schema version of each table, which is increased by every DDL on the table,
+	// it's shared by all encoders built by the same builder, as the DDLs and the rows are encoded by different ones.
+	schemaVersions *schemaVersions
+	// When it is true, each message is assigned a unique and increasing `id`
+	// derived from its commitTs, instead of the constant 0.
+	// the last ID is shared by all encoders built by the same builder, see `nextMessageID`.
+	emitMessageID bool
+	lastMessageID *int64
+	// the serialization of messages, it's `canalFlatEnvelopeJSON` by default.
+	envelope string
+	// the compression of the message values, they're not compressed if it's empty or `canalFlatCompressionNone`.
+	compression string
+	// messages are nested under the key if it's not empty, e.g. `{"payload": {...}}`.
+	wrapperKey string
+	// When it is true, row changed events are dropped and only DDL events are emitted.
+	ddlOnly bool
+	// When it is true, the implicit `_tidb_rowid` of tables without primary key
+	// is emitted in `data` and `old`, and is used as the key in `pkNames`.
+	emitRowID bool
+	// whether to format FLOAT and DOUBLE values at the precision of their column types, see `formatFloatColumns`.
+	floatAsString bool
+	// When it is true, DECIMAL values are rounded to at most `decimalScaleLimit` fractional digits, for sinks which
+	// can't store the full precision, and the rounded columns are noted in the TiDB extension, see `roundDecimalColumns`.
+	roundDecimals     bool
+	decimalScaleLimit int
+	// the glob patterns of the lowercase column names emitted in row messages, all columns are included if
+	// `columnInclude` is empty, and the primary key columns are always emitted, see `isColumnSelected`.
+	columnInclude []string
+	columnExclude []string
+	// When it is true, only the primary key columns are emitted for DELETE events, which are enough to remove the rows.
+	deleteKeyOnly bool
+	// When it is true, only the primary key columns and the columns whose values are changed are emitted in `old` of
+	// UPDATE events, as the official Canal-JSON does, the absent columns are unchanged. see `omitUnchangedColumns`.
+	onlyOutputUpdatedColumns bool
+	// When it is true, the schema of the columns is inlined in `columnSchema` of each row message, including the flags
+	// of the columns, so that schemaless consumers can decode the message by itself, see `canalFlatColumnSchema`.
+	inlineSchema bool
+	// When it is true, the commitTs of each row changed or DDL event is emitted in `commitTs` of the message
+	// if the TiDB extension is disabled, so that the events can still be ordered precisely by consumers.
+	emitCommitTs bool
+	// the maximum nesting depth of the values of JSON columns, it's unlimited if it's 0,
+	// the deeper values are handled by `jsonDepthOverflow`, see `limitJSONDepth`.
+	maxJSONDepth      int
+	jsonDepthOverflow string
+	// enumSetColumns records the SET and ENUM columns of the registered tables, keyed by the quoted table name,
+	// their values are encoded as the string representations instead of the numeric ones, see `SetTableInfo`.
+	enumSetColumns map[string]map[string]enumSetColumn
+	// columnDefaults records the default expressions of the columns of the registered tables, keyed by the
+	// quoted table name, they're emitted with DDLs so that consumers can recreate the tables, see `SetTableInfo`.
+	columnDefaults map[string]map[string]string
+	// autoIncrements records the auto-increment offsets of the registered tables with auto-increment columns,
+	// keyed by the quoted table name, they're emitted with DDLs as hints to avoid key collisions, see `SetTableInfo`.
+	autoIncrements map[string]int64
+	// tableInfos records the table info each table is registered with by its events, keyed by the quoted table name,
+	// so a table is only registered again after its schema changes, see `registerTableInfo`.
+	tableInfos map[string]*timodel.TableInfo
+	// When it is true, each change event is assigned a sequence in the TiDB extension when it's appended,
+	// the sequence is shared by all encoders built by the same builder, so it spans all tables of the changefeed.
+	emitSequence bool
+	sequence     *uint64
+	// the schemas of tables idle for the interval are re-emitted as bootstrap DDLs when it's positive,
+	// the heartbeats are shared by all encoders built by the same builder, see `EncodeSchemaHeartbeats`.
+	schemaHeartbeatInterval time.Duration
+	heartbeats              *schemaHeartbeats
+	// When it is true, the key of each row message is the hash of its table and primary key, which has a fixed length,
+	// and the raw primary key is emitted in the TiDB extension, see `hashCanalFlatKey`.
+	hashedKey bool
+	keys      [][]byte
+	// When it is true, each row message carries an idempotency key in the TiDB extension, which is derived from
+	// the event only, so re-encoding the same event yields the same key, see `canalFlatIdempotencyKey`.
+	idempotencyKey bool
+	// `es` and `ts` are in milliseconds since the custom epoch, which is the offset since Epoch, 0 by default.
+	epochOffsetMs int64
+	// the unit of the precise `es` and `ts` emitted in the TiDB extension, e.g. `us`, they're not emitted if it's empty
+	// or `canalFlatTimePrecisionMs`, as `es` and `ts` themselves are kept in milliseconds for the compatibility with Canal.
+	timePrecision string
+	// the behavior of `Build` for an empty batch, it's `canalFlatEmptyBatchNil` by default.
+	emptyBatch string
+	// the position after the last row changed event built, see `Checkpoint`.
+	checkpoint CanalFlatCheckpoint
+	// the row changed events up to the checkpoint are skipped if it's not nil, see `ResumeFrom`.
+	resume        *CanalFlatCheckpoint
+	resumeSkipped int
+	// the clock to timestamp messages, nil means the wall clock. it's mocked to make the output stable in tests.
+	clock clock.Clock
+}
+
+// schemaVersions tracks the schema version of each table, keyed by the quoted table name.
+type schemaVersions struct {
+	mu     sync.Mutex
+	tables map[string]uint64
+}
+
+// get returns the schema version of the table, it's 0 if there is no DDL on the table yet.
+func (v *schemaVersions) get(tableName string) uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.tables[tableName]
+}
+
+// increase increases the schema version of the table, and returns the new version.
+func (v *schemaVersions) increase(tableName string) uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.tables == nil {
+		v.tables = make(map[string]uint64)
+	}
+	v.tables[tableName]++
+	return v.tables[tableName]
+}
+
+// schemaHeartbeats tracks the last DDL and the last activity of each table, keyed by the quoted table name.
+type schemaHeartbeats struct {
+	mu     sync.Mutex
+	tables map[string]*schemaHeartbeat
+}
+
+type schemaHeartbeat struct {
+	ddl           *model.DDLEvent
+	schemaVersion uint64
+	lastActive    time.Time
+}
+
+// enumSetColumn is a SET or ENUM column with its elements.
+type enumSetColumn struct {
+	tp    byte
+	elems []string
+}
+
+// format returns the string representation of the numeric value of the column, e.g. `a,c` for the SET value `5`.
+func (col enumSetColumn) format(value string) (string, error) {
+	number, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return "", err
+	}
+	if col.tp == mysql.TypeEnum {
+		enum, err := tidbtypes.ParseEnumValue(col.elems, number)
+		return enum.Name, err
+	}
+	set, err := tidbtypes.ParseSetValue(col.elems, number)
+	return set.Name, err
+}
+
+const (
+	// `Build` returns nil for an empty batch, it's the default behavior.
+	canalFlatEmptyBatchNil = "nil"
+	// `Build` returns an empty slice for an empty batch.
+	canalFlatEmptyBatchEmptySlice = "empty-slice"
+	// `Build` returns a single heartbeat message of the unknown type for an empty batch,
+	// which is skipped by the decoder but tells consumers the changefeed is alive.
+	canalFlatEmptyBatchHeartbeat = "heartbeat"
+)
+
+const (
+	// JSON values deeper than `max-json-depth` are truncated with `canalFlatJSONTruncatedMarker`, it's the default behavior.
+	canalFlatJSONDepthTruncate = "truncate"
+	// row changed events with JSON values deeper than `max-json-depth` fail to be encoded.
+	canalFlatJSONDepthError = "error"
+
+	// canalFlatJSONTruncatedMarker replaces the JSON objects and arrays deeper than `max-json-depth`.
+	canalFlatJSONTruncatedMarker = "..."
+)
+
+const (
+	canalFlatEnvelopeJSON = "json"
+	// messages in the CBOR envelope have the same schema as in JSON, but are much smaller.
+	canalFlatEnvelopeCBOR = "cbor"
+)
+
+const (
+	canalFlatCompressionNone = "none"
+	// the message values are compressed after they're serialized, and the decoder should be set to the same compression.
+	canalFlatCompressionGzip   = "gzip"
+	canalFlatCompressionSnappy = "snappy"
+)
+
+const (
+	// `es` and `ts` are always in milliseconds, no precise times are emitted.
+	canalFlatTimePrecisionMs = "ms"
+	canalFlatTimePrecisionUs = "us"
+	canalFlatTimePrecisionNs = "ns"
+)
+
+// canalFlatTimePrecisionUnits are the units of the precise times in the TiDB extension keyed by `time-precision`.
+var canalFlatTimePrecisionUnits = map[string]time.Duration{
+	canalFlatTimePrecisionMs: time.Millisecond,
+	canalFlatTimePrecisionUs: time.Microsecond,
+	canalFlatTimePrecisionNs: time.Nanosecond,
 }
 
 // NewCanalFlatEventBatchEncoder creates a new CanalFlatEventBatchEncoder
@@ -48,11 +276,20 @@ func NewCanalFlatEventBatchEncoder() EventBatchEncoder {
 		builder:             NewCanalEntryBuilder(),
 		messageBuf:          make([]canalFlatMessageInterface, 0),
 		enableTiDBExtension: false,
+		schemaVersions:      &schemaVersions{},
 	}
 }
 
 type canalFlatEventBatchEncoderBuilder struct {
 	opts map[string]string
+	// the sequence shared by all built encoders, see `emit-sequence`.
+	sequence uint64
+	// the last message ID shared by all built encoders, see `emit-message-id`.
+	lastMessageID int64
+	// the schema heartbeats shared by all built encoders, see `schema-heartbeat-interval`.
+	heartbeats schemaHeartbeats
+	// the schema versions shared by all built encoders.
+	schemaVersions schemaVersions
 }
 
 // Build a `CanalFlatEventBatchEncoder`
@@ -61,6 +298,10 @@ func (b *canalFlatEventBatchEncoderBuilder) Build(_ context.Context) (EventBatch
 	if err := encoder.SetParams(b.opts); err != nil {
 		return nil, cerrors.WrapError(cerrors.ErrKafkaInvalidConfig, err)
 	}
+	encoder.(*CanalFlatEventBatchEncoder).sequence = &b.sequence
+	encoder.(*CanalFlatEventBatchEncoder).lastMessageID = &b.lastMessageID
+	encoder.(*CanalFlatEventBatchEncoder).heartbeats = &b.heartbeats
+	encoder.(*CanalFlatEventBatchEncoder).schemaVersions = &b.schemaVersions
 
 	return encoder, nil
 }
@@ -76,16 +317,33 @@ type canalFlatMessageInterface interface {
 	getSchema() *string
 	getTable() *string
 	getCommitTs() uint64
+	getSchemaVersion() uint64
 	getQuery() string
+	getEventType() string
 	getOld() map[string]interface{}
 	getData() map[string]interface{}
+	getPKNames() []string
+	getPrimaryKey() map[string]string
+	getExtensionRaw() map[string]json.RawMessage
 	getMySQLType() map[string]string
 	getJavaSQLType() map[string]int32
+	getColumnSchema() []canalFlatColumnSchema
+	getProducerTs() int64
+	getExecutionTime() int64
+	getBuildTime() int64
+	setBuildTime(ts int64)
+	setProducerTs(ts int64)
+	setSequence(seq uint64)
+	setPrimaryKey(pk map[string]string)
+	getIdempotencyKey() string
+	setIdempotencyKey(key string)
+	getPreciseTimes() (precision string, executionTime int64, buildTime int64)
+	setPreciseBuildTime(ts int64)
 }
 
 // adapted from https://github.com/alibaba/canal/blob/b54bea5e3337c9597c427a53071d214ff04628d1/protocol/src/main/java/com/alibaba/otter/canal/protocol/FlatMessage.java#L1
 type canalFlatMessage struct {
-	// ignored by consumers
+	// it's 0 unless `emit-message-id` is enabled, then it's unique in one run of the changefeed, see `nextMessageID`.
 	ID        int64    `json:"id"`
 	Schema    string   `json:"database"`
 	Table     string   `json:"table"`
@@ -96,15 +354,21 @@ type canalFlatMessage struct {
 	ExecutionTime int64 `json:"es"`
 	// officially the timestamp of building the MQ message, in milliseconds since Epoch.
 	BuildTime int64 `json:"ts"`
-	// SQL that generated the change event, DDL or Query
+	// SQL that generated the change event, DDL or Query.
+	// it's always empty for DML events, as TiCDC replicates the row changes from TiKV, where the statements are unknown.
 	Query string `json:"sql"`
 	// only works for INSERT / UPDATE / DELETE events, records each column's java representation type.
 	SQLType map[string]int32 `json:"sqlType"`
 	// only works for INSERT / UPDATE / DELETE events, records each column's mysql representation type.
 	MySQLType map[string]string `json:"mysqlType"`
-	// A Datum should be a string or nil
+	// A Datum should be a string or nil.
+	// the columns are emitted in the order of their names, as the map keys are sorted when marshaled in both envelopes.
 	Data []map[string]interface{} `json:"data"`
 	Old  []map[string]interface{} `json:"old"`
+	// the TSO of the event without the TiDB extension, it's only emitted with `emit-commit-ts`.
+	CommitTs uint64 `json:"commitTs,omitempty"`
+	// the schema of the columns in `sqlType` and `mysqlType` sorted by their names, it's only emitted with `inline-schema`.
+	ColumnSchema []canalFlatColumnSchema `json:"columnSchema,omitempty"`
 	// Used internally by CanalFlatEventBatchEncoder
 	tikvTs uint64
 }
@@ -121,8 +385,13 @@ func (c *canalFlatMessage) getTable() *string {
 	return &c.Table
 }
 
-// for canalFlatMessage, we lost the commitTs.
+// for canalFlatMessage, the commitTs is lost unless it's emitted with `emit-commit-ts`.
 func (c *canalFlatMessage) getCommitTs() uint64 {
+	return c.CommitTs
+}
+
+// for canalFlatMessage, we lost the schema version.
+func (c *canalFlatMessage) getSchemaVersion() uint64 {
 	return 0
 }
 
@@ -130,6 +399,10 @@ func (c *canalFlatMessage) getQuery() string {
 	return c.Query
 }
 
+func (c *canalFlatMessage) getEventType() string {
+	return c.EventType
+}
+
 func (c *canalFlatMessage) getOld() map[string]interface{} {
 	if c.Old == nil {
 		return nil
@@ -152,9 +425,216 @@ func (c *canalFlatMessage) getJavaSQLType() map[string]int32 {
 	return c.SQLType
 }
 
+func (c *canalFlatMessage) getColumnSchema() []canalFlatColumnSchema {
+	return c.ColumnSchema
+}
+
+// for canalFlatMessage, we lost the producer timestamp.
+func (c *canalFlatMessage) getProducerTs() int64 {
+	return 0
+}
+
+func (c *canalFlatMessage) getExecutionTime() int64 {
+	return c.ExecutionTime
+}
+
+func (c *canalFlatMessage) getBuildTime() int64 {
+	return c.BuildTime
+}
+
+func (c *canalFlatMessage) setBuildTime(ts int64) {
+	c.BuildTime = ts
+}
+
+// the producer timestamp is only carried by the TiDB extension.
+func (c *canalFlatMessage) setProducerTs(ts int64) {}
+
+// the sequence is only carried by the TiDB extension.
+func (c *canalFlatMessage) setSequence(seq uint64) {}
+
+func (c *canalFlatMessage) getPKNames() []string {
+	return c.PKNames
+}
+
+// the raw primary key is only carried by the TiDB extension.
+func (c *canalFlatMessage) getPrimaryKey() map[string]string {
+	return nil
+}
+
+func (c *canalFlatMessage) setPrimaryKey(pk map[string]string) {}
+
+// the idempotency key is only carried by the TiDB extension.
+func (c *canalFlatMessage) getIdempotencyKey() string {
+	return ""
+}
+
+func (c *canalFlatMessage) setIdempotencyKey(key string) {}
+
+// the precise times are only carried by the TiDB extension.
+func (c *canalFlatMessage) getPreciseTimes() (string, int64, int64) {
+	return "", 0, 0
+}
+
+func (c *canalFlatMessage) setPreciseBuildTime(ts int64) {}
+
+func (c *canalFlatMessage) getExtensionRaw() map[string]json.RawMessage {
+	return nil
+}
+
+// canalFlatColumnSchema is the inline schema of a column, it takes precedence over `sqlType` and `mysqlType` when decoded,
+// so the message is self-described even if they're stripped by consumers.
+type canalFlatColumnSchema struct {
+	Name      string               `json:"name"`
+	MySQLType string               `json:"mysqlType"`
+	SQLType   int32                `json:"sqlType"`
+	Flag      model.ColumnFlagType `json:"flag,omitempty"`
+}
+
+// newCanalFlatColumnSchema returns the inline schema of the columns in the types, sorted by their names,
+// the flags are taken from the columns of the same names.
+func newCanalFlatColumnSchema(sqlType map[string]int32, mysqlType map[string]string, cols []*model.Column) []canalFlatColumnSchema {
+	flags := make(map[string]model.ColumnFlagType, len(cols))
+	for _, col := range cols {
+		if col != nil {
+			flags[col.Name] = col.Flag
+		}
+	}
+	schema := make([]canalFlatColumnSchema, 0, len(sqlType))
+	for name, tp := range sqlType {
+		schema = append(schema, canalFlatColumnSchema{Name: name, MySQLType: mysqlType[name], SQLType: tp, Flag: flags[name]})
+	}
+	sort.Slice(schema, func(i, j int) bool {
+		return schema[i].Name < schema[j].Name
+	})
+	return schema
+}
+
 type tidbExtension struct {
 	CommitTs    uint64 `json:"commitTs,omitempty"`
 	WatermarkTs uint64 `json:"watermarkTs,omitempty"`
+	// SchemaVersion is increased by each DDL on the table,
+	// it tells which schema a DML is produced under.
+	SchemaVersion uint64 `json:"schemaVersion,omitempty"`
+	// SchemaChange summarizes the columns changed by a DDL,
+	// it's only available if both table infos before and after the DDL are known.
+	SchemaChange *schemaChange `json:"schemaChange,omitempty"`
+	// ProducerTs is the time when the message is marshaled to be sent, in milliseconds since Epoch,
+	// it's set as late as possible so that consumers can measure the end-to-end latency.
+	ProducerTs int64 `json:"producerTs,omitempty"`
+	// Sequence is increased by each change event of the changefeed across all tables in the order of appending,
+	// consumers can reconstruct the global order by it, see `emit-sequence`.
+	Sequence uint64 `json:"sequence,omitempty"`
+	// ColumnDefaults is the default expression of each column of the table after a DDL,
+	// e.g. `'foo'` or `CURRENT_TIMESTAMP`, columns without default values are absent.
+	ColumnDefaults map[string]string `json:"columnDefaults,omitempty"`
+	// Bootstrap marks a DDL re-emitted to keep the downstream schema caches warm,
+	// it doesn't change the schema and should not be executed, see `schema-heartbeat-interval`.
+	Bootstrap bool `json:"bootstrap,omitempty"`
+	// AutoIncrement is the auto-increment offset of the table known by the upstream schema, it's only a hint
+	// for consumers recreating the table, as the values allocated by TiDB may be larger than it.
+	AutoIncrement int64 `json:"autoIncrement,omitempty"`
+	// PrimaryKey is the raw primary key of the row, which the hashed message key is computed from, see `hashed-key`.
+	PrimaryKey map[string]string `json:"primaryKey,omitempty"`
+	// IdempotencyKey identifies the row changed event deterministically, so sinks can dedupe the redelivered
+	// events by it, see `idempotency-key`.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	// RoundedColumns are the DECIMAL columns of the row whose values are rounded, sorted by their names,
+	// so the values are known to be lossy, see `decimal-scale-limit`.
+	RoundedColumns []string `json:"roundedColumns,omitempty"`
+	// TimePrecision is the unit of ExecutionTime and BuildTime, which are `es` and `ts` at a finer precision
+	// than milliseconds since the same epoch, see `time-precision`. ExecutionTime is derived from the physical
+	// time of the commitTs, so it's no finer than milliseconds in fact, while BuildTime is at the full precision.
+	TimePrecision string `json:"timePrecision,omitempty"`
+	ExecutionTime int64  `json:"executionTime,omitempty"`
+	BuildTime     int64  `json:"buildTime,omitempty"`
+
+	// the fields unknown to the decoder keyed by their names, e.g. custom extensions added by other producers,
+	// they're kept when decoded but never encoded, see `UnmarshalJSON`.
+	raw map[string]json.RawMessage
+}
+
+// tidbExtensionFields are the names of the known fields of tidbExtension in JSON.
+var tidbExtensionFields = func() map[string]struct{} {
+	fields := make(map[string]struct{})
+	t := reflect.TypeOf(tidbExtension{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			fields[name] = struct{}{}
+		}
+	}
+	return fields
+}()
+
+// UnmarshalJSON implements the json.Unmarshaler interface, the unknown fields are kept instead of being discarded.
+func (e *tidbExtension) UnmarshalJSON(data []byte) error {
+	// the alias has no methods, so it's unmarshaled as usual without the recursion.
+	type extension tidbExtension
+	if err := json.Unmarshal(data, (*extension)(e)); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for name := range fields {
+		if _, ok := tidbExtensionFields[name]; ok {
+			delete(fields, name)
+		}
+	}
+	e.raw = nil
+	if len(fields) > 0 {
+		e.raw = fields
+	}
+	return nil
+}
+
+// Raw returns the fields unknown to the decoder keyed by their names, it's nil if there are none.
+func (e *tidbExtension) Raw() map[string]json.RawMessage {
+	return e.raw
+}
+
+// schemaChange is the structured diff between the table infos before and after a DDL.
+type schemaChange struct {
+	AddedColumns    []string `json:"addedColumns,omitempty"`
+	DroppedColumns  []string `json:"droppedColumns,omitempty"`
+	ModifiedColumns []string `json:"modifiedColumns,omitempty"`
+}
+
+// newSchemaChange computes the schema change of the DDL event,
+// it returns nil if the table infos are not available or no column changed.
+func newSchemaChange(e *model.DDLEvent) *schemaChange {
+	if e.PreTableInfo == nil || e.TableInfo == nil ||
+		len(e.PreTableInfo.ColumnInfo) == 0 || len(e.TableInfo.ColumnInfo) == 0 {
+		return nil
+	}
+
+	// column names are case-insensitive.
+	preColumns := make(map[string]*model.ColumnInfo, len(e.PreTableInfo.ColumnInfo))
+	for _, col := range e.PreTableInfo.ColumnInfo {
+		preColumns[strings.ToLower(col.Name)] = col
+	}
+	columns := make(map[string]struct{}, len(e.TableInfo.ColumnInfo))
+	change := &schemaChange{}
+	for _, col := range e.TableInfo.ColumnInfo {
+		name := strings.ToLower(col.Name)
+		columns[name] = struct{}{}
+		preCol, ok := preColumns[name]
+		if !ok {
+			change.AddedColumns = append(change.AddedColumns, col.Name)
+		} else if preCol.Type != col.Type {
+			change.ModifiedColumns = append(change.ModifiedColumns, col.Name)
+		}
+	}
+	for _, col := range e.PreTableInfo.ColumnInfo {
+		if _, ok := columns[strings.ToLower(col.Name)]; !ok {
+			change.DroppedColumns = append(change.DroppedColumns, col.Name)
+		}
+	}
+
+	if len(change.AddedColumns) == 0 && len(change.DroppedColumns) == 0 && len(change.ModifiedColumns) == 0 {
+		return nil
+	}
+	return change
 }
 
 type canalFlatMessageWithTiDBExtension struct {
@@ -167,10 +647,214 @@ type canalFlatMessageWithTiDBExtension struct {
 }
 
 func (c *canalFlatMessageWithTiDBExtension) getCommitTs() uint64 {
-	return c.Extensions.CommitTs
+	if c.Extensions != nil && c.Extensions.CommitTs != 0 {
+		return c.Extensions.CommitTs
+	}
+	// the message may be encoded without the TiDB extension.
+	return c.canalFlatMessage.getCommitTs()
+}
+
+func (c *canalFlatMessageWithTiDBExtension) getSchemaVersion() uint64 {
+	return c.Extensions.SchemaVersion
+}
+
+func (c *canalFlatMessageWithTiDBExtension) getProducerTs() int64 {
+	return c.Extensions.ProducerTs
+}
+
+func (c *canalFlatMessageWithTiDBExtension) setProducerTs(ts int64) {
+	c.Extensions.ProducerTs = ts
+}
+
+func (c *canalFlatMessageWithTiDBExtension) setSequence(seq uint64) {
+	c.Extensions.Sequence = seq
+}
+
+func (c *canalFlatMessageWithTiDBExtension) getPrimaryKey() map[string]string {
+	return c.Extensions.PrimaryKey
+}
+
+func (c *canalFlatMessageWithTiDBExtension) setPrimaryKey(pk map[string]string) {
+	c.Extensions.PrimaryKey = pk
+}
+
+func (c *canalFlatMessageWithTiDBExtension) getIdempotencyKey() string {
+	return c.Extensions.IdempotencyKey
+}
+
+func (c *canalFlatMessageWithTiDBExtension) setIdempotencyKey(key string) {
+	c.Extensions.IdempotencyKey = key
+}
+
+func (c *canalFlatMessageWithTiDBExtension) getPreciseTimes() (string, int64, int64) {
+	return c.Extensions.TimePrecision, c.Extensions.ExecutionTime, c.Extensions.BuildTime
+}
+
+func (c *canalFlatMessageWithTiDBExtension) setPreciseBuildTime(ts int64) {
+	c.Extensions.BuildTime = ts
+}
+
+func (c *canalFlatMessageWithTiDBExtension) getExtensionRaw() map[string]json.RawMessage {
+	return c.Extensions.Raw()
+}
+
+// omitUnchangedColumns removes the columns whose values are not changed by the UPDATE from the old row, except the
+// primary key columns. The changed columns are always kept, including the null ones omitted by `omit-nulls`,
+// so the absent columns are known to be unchanged. The types of the columns are kept for the new row.
+func omitUnchangedColumns(sqlType map[string]int32, pkNames []string, oldData, data map[string]interface{}) {
+	pks := make(map[string]struct{}, len(pkNames))
+	for _, name := range pkNames {
+		pks[name] = struct{}{}
+	}
+	for name := range sqlType {
+		if _, ok := pks[name]; ok {
+			continue
+		}
+		// the absent columns are null.
+		oldValue, oldOk := oldData[name]
+		newValue, newOk := data[name]
+		if oldOk == newOk && reflect.DeepEqual(oldValue, newValue) {
+			delete(oldData, name)
+		} else if !oldOk {
+			oldData[name] = nil
+		}
+	}
+}
+
+// canalFlatPrimaryKey returns the raw primary key of the row message, it's the new one for UPDATE events.
+func canalFlatPrimaryKey(msg canalFlatMessageInterface) map[string]string {
+	data := msg.getData()
+	pk := make(map[string]string, len(msg.getPKNames()))
+	for _, name := range msg.getPKNames() {
+		value, _ := data[name].(string)
+		pk[name] = value
+	}
+	return pk
+}
+
+// hashCanalFlatKey returns the fixed-length message key of the row, which is the hex encoded
+// FNV-1a hash of the quoted table name and the primary key, so rows with the same primary key share the key.
+func hashCanalFlatKey(tableName string, pk map[string]string) []byte {
+	names := make([]string, 0, len(pk))
+	for name := range pk {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	hasher := fnv.New64a()
+	hasher.Write([]byte(tableName))
+	for _, name := range names {
+		hasher.Write([]byte{0})
+		hasher.Write([]byte(name))
+		hasher.Write([]byte{0})
+		hasher.Write([]byte(pk[name]))
+	}
+	return []byte(fmt.Sprintf("%016x", hasher.Sum64()))
+}
+
+// canalFlatIdempotencyKey returns the idempotency key of the row message, which is the hex encoded FNV-1a hash of
+// the quoted table name, the event type, the commitTs and the primary key of the row, or all of its columns if the
+// table has no primary key. It depends on nothing but the event, so it's stable across encoders and re-encodes.
+func canalFlatIdempotencyKey(tableName string, commitTs uint64, msg canalFlatMessageInterface) string {
+	data := msg.getData()
+	names := msg.getPKNames()
+	if len(names) == 0 {
+		names = make([]string, 0, len(data))
+		for name := range data {
+			names = append(names, name)
+		}
+	}
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	hasher := fnv.New128a()
+	hasher.Write([]byte(tableName))
+	hasher.Write([]byte{0})
+	hasher.Write([]byte(msg.getEventType()))
+	hasher.Write([]byte{0})
+	hasher.Write([]byte(strconv.FormatUint(commitTs, 10)))
+	for _, name := range names {
+		hasher.Write([]byte{0})
+		hasher.Write([]byte(name))
+		// nulls are distinguished from the strings.
+		if value, ok := data[name]; ok && value != nil {
+			hasher.Write([]byte{1})
+			hasher.Write([]byte(fmt.Sprint(value)))
+		} else {
+			hasher.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// nextSequence returns the next sequence of the change events, it's 0 if `emitSequence` is false.
+func (c *CanalFlatEventBatchEncoder) nextSequence() uint64 {
+	if !c.emitSequence {
+		return 0
+	}
+	if c.sequence == nil {
+		c.sequence = new(uint64)
+	}
+	return atomic.AddUint64(c.sequence, 1)
+}
+
+// now returns the current time of the clock of the encoder.
+func (c *CanalFlatEventBatchEncoder) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
+
+// toEpoch converts the milliseconds since Epoch to the ones since the custom epoch, see `epoch-offset-ms`.
+func (c *CanalFlatEventBatchEncoder) toEpoch(ms int64) int64 {
+	return ms - c.epochOffsetMs
+}
+
+// preciseTimePrecision returns the precision of the precise times emitted in the TiDB extension,
+// it's empty if they're not emitted.
+func (c *CanalFlatEventBatchEncoder) preciseTimePrecision() string {
+	if c.timePrecision == canalFlatTimePrecisionMs {
+		return ""
+	}
+	return c.timePrecision
+}
+
+// toPreciseEpoch converts the time to the units of `time-precision` since the custom epoch, see `epoch-offset-ms`.
+// it's 0 if the precise times are not emitted.
+func (c *CanalFlatEventBatchEncoder) toPreciseEpoch(t time.Time) int64 {
+	if c.preciseTimePrecision() == "" {
+		return 0
+	}
+	return (t.UnixNano() - c.epochOffsetMs*int64(time.Millisecond)) / int64(canalFlatTimePrecisionUnits[c.timePrecision])
+}
+
+// nextMessageID returns the ID of the next message with the commitTs, it's 0 if `emitMessageID` is false.
+// IDs start from the commitTs and keep increasing among all encoders built by the same builder, so they're unique
+// and ordered in all partitions of the changefeed. NOTE: they're only unique in one run of the changefeed,
+// IDs may be reused after it restarts, as the events are emitted again from the checkpoint,
+// and by other changefeeds, so consumers should not deduplicate messages across them by IDs.
+func (c *CanalFlatEventBatchEncoder) nextMessageID(commitTs uint64) int64 {
+	if !c.emitMessageID {
+		return 0
+	}
+	if c.lastMessageID == nil {
+		c.lastMessageID = new(int64)
+	}
+	for {
+		last := atomic.LoadInt64(c.lastMessageID)
+		id := int64(commitTs)
+		if id <= last {
+			id = last + 1
+		}
+		if atomic.CompareAndSwapInt64(c.lastMessageID, last, id) {
+			return id
+		}
+	}
 }
 
 func (c *CanalFlatEventBatchEncoder) newFlatMessageForDML(e *model.RowChangedEvent) (canalFlatMessageInterface, error) {
+	if e.TableInfo != nil {
+		c.registerTableInfo(*e.Table, e.TableInfo.TableInfo)
+	}
 	eventType := convertRowEventType(e)
 	header := c.builder.buildHeader(e.CommitTs, e.Table.Schema, e.Table.Table, eventType, 1)
 	rowData, err := c.builder.buildRowData(e)
@@ -208,7 +892,7 @@ func (c *CanalFlatEventBatchEncoder) newFlatMessageForDML(e *model.RowChangedEve
 		for i := range rowData.BeforeColumns {
 			if !rowData.BeforeColumns[i].GetIsNull() {
 				oldData[rowData.BeforeColumns[i].Name] = rowData.BeforeColumns[i].Value
-			} else {
+			} else if !c.omitNulls || rowData.BeforeColumns[i].GetIsKey() {
 				oldData[rowData.BeforeColumns[i].Name] = nil
 			}
 		}
@@ -219,28 +903,117 @@ func (c *CanalFlatEventBatchEncoder) newFlatMessageForDML(e *model.RowChangedEve
 		for i := range rowData.AfterColumns {
 			if !rowData.AfterColumns[i].GetIsNull() {
 				data[rowData.AfterColumns[i].Name] = rowData.AfterColumns[i].Value
-			} else {
+			} else if !c.omitNulls || rowData.AfterColumns[i].GetIsKey() {
 				data[rowData.AfterColumns[i].Name] = nil
 			}
 		}
 	}
 
+	for name, col := range c.enumSetColumns[e.Table.QuoteString()] {
+		if _, ok := sqlType[name]; !ok {
+			continue
+		}
+		for _, row := range []map[string]interface{}{oldData, data} {
+			value, ok := row[name].(string)
+			if !ok {
+				continue
+			}
+			if row[name], err = col.format(value); err != nil {
+				return nil, cerrors.WrapError(cerrors.ErrCanalEncodeFailed, err)
+			}
+		}
+		// the same as other string columns.
+		sqlType[name] = int32(JavaSQLTypeCHAR)
+	}
+
+	if c.floatAsString {
+		formatFloatColumns(e.PreColumns, oldData)
+		formatFloatColumns(e.Columns, data)
+	}
+
+	if err = formatBitColumns(e.PreColumns, oldData); err != nil {
+		return nil, err
+	}
+	if err = formatBitColumns(e.Columns, data); err != nil {
+		return nil, err
+	}
+
+	if c.maxJSONDepth > 0 {
+		if err = c.limitJSONDepth(e.PreColumns, oldData); err != nil {
+			return nil, err
+		}
+		if err = c.limitJSONDepth(e.Columns, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.emitRowID && len(pkCols) == 0 && e.RowID != 0 {
+		name := timodel.ExtraHandleName.O
+		rowID := strconv.FormatInt(e.RowID, 10)
+		pkNames = []string{name}
+		sqlType[name] = int32(JavaSQLTypeBIGINT)
+		mysqlType[name] = "bigint"
+		if oldData != nil {
+			oldData[name] = rowID
+		}
+		if data != nil {
+			data[name] = rowID
+		}
+	}
+
+	// the rows of tables without keys are always deleted by the full before-images.
+	deleteKeyOnly := c.deleteKeyOnly && e.IsDelete() && len(pkNames) > 0
+	if deleteKeyOnly || len(c.columnInclude) > 0 || len(c.columnExclude) > 0 {
+		pks := make(map[string]struct{}, len(pkNames))
+		for _, name := range pkNames {
+			pks[name] = struct{}{}
+		}
+		for name := range sqlType {
+			if _, ok := pks[name]; ok || (!deleteKeyOnly && c.isColumnSelected(name)) {
+				continue
+			}
+			delete(sqlType, name)
+			delete(mysqlType, name)
+			delete(oldData, name)
+			delete(data, name)
+		}
+	}
+
+	if c.onlyOutputUpdatedColumns && e.IsUpdate() {
+		omitUnchangedColumns(sqlType, pkNames, oldData, data)
+	}
+
+	var roundedColumns []string
+	if c.roundDecimals {
+		roundedColumns, err = roundDecimalColumns(c.decimalScaleLimit, e.PreColumns, oldData, e.Columns, data)
+		if err != nil {
+			return nil, cerrors.WrapError(cerrors.ErrCanalEncodeFailed, err)
+		}
+	}
+
 	flatMessage := &canalFlatMessage{
-		ID:            0, // ignored by both Canal Adapter and Flink
+		ID:            c.nextMessageID(e.CommitTs), // ignored by both Canal Adapter and Flink
 		Schema:        header.SchemaName,
 		Table:         header.TableName,
 		PKNames:       pkNames,
 		IsDDL:         false,
 		EventType:     header.GetEventType().String(),
-		ExecutionTime: header.ExecuteTime,
-		BuildTime:     time.Now().UnixNano() / 1e6, // ignored by both Canal Adapter and Flink
-		Query:         "",
+		ExecutionTime: c.toEpoch(header.ExecuteTime),
+		BuildTime:     c.toEpoch(c.now().UnixNano() / 1e6), // ignored by both Canal Adapter and Flink
+		Query:         "",                                  // not available for row changes
 		SQLType:       sqlType,
 		MySQLType:     mysqlType,
 		Data:          make([]map[string]interface{}, 0),
 		Old:           nil,
 		tikvTs:        e.CommitTs,
 	}
+	if c.inlineSchema {
+		cols := e.Columns
+		if e.IsDelete() {
+			cols = e.PreColumns
+		}
+		flatMessage.ColumnSchema = newCanalFlatColumnSchema(sqlType, mysqlType, cols)
+	}
 
 	if e.IsDelete() {
 		flatMessage.Data = append(flatMessage.Data, oldData)
@@ -254,128 +1027,1082 @@ func (c *CanalFlatEventBatchEncoder) newFlatMessageForDML(e *model.RowChangedEve
 	}
 
 	if !c.enableTiDBExtension {
+		if c.emitCommitTs {
+			flatMessage.CommitTs = e.CommitTs
+		}
 		return flatMessage, nil
 	}
 
 	return &canalFlatMessageWithTiDBExtension{
 		canalFlatMessage: flatMessage,
-		Extensions:       &tidbExtension{CommitTs: e.CommitTs},
+		Extensions: &tidbExtension{
+			CommitTs:       e.CommitTs,
+			SchemaVersion:  c.schemaVersion(e.Table.QuoteString()),
+			RoundedColumns: roundedColumns,
+			TimePrecision:  c.preciseTimePrecision(),
+			ExecutionTime:  c.toPreciseEpoch(time.Unix(0, header.ExecuteTime*int64(time.Millisecond))),
+			// the build time is set when the message is built.
+		},
 	}, nil
 }
 
-func (c *CanalFlatEventBatchEncoder) newFlatMessageForDDL(e *model.DDLEvent) canalFlatMessageInterface {
-	header := c.builder.buildHeader(e.CommitTs, e.TableInfo.Schema, e.TableInfo.Table, convertDdlEventType(e), 1)
-	flatMessage := &canalFlatMessage{
-		ID:            0, // ignored by both Canal Adapter and Flink
-		Schema:        header.SchemaName,
-		Table:         header.TableName,
-		IsDDL:         true,
-		EventType:     header.GetEventType().String(),
-		ExecutionTime: header.ExecuteTime,
-		BuildTime:     time.Now().UnixNano() / 1e6, // timestamp
-		Query:         e.Query,
-		tikvTs:        e.CommitTs,
+// isColumnSelected returns whether the column is selected by `column-include` and `column-exclude`.
+func (c *CanalFlatEventBatchEncoder) isColumnSelected(name string) bool {
+	name = strings.ToLower(name)
+	if len(c.columnInclude) > 0 && !matchColumnPatterns(c.columnInclude, name) {
+		return false
 	}
+	return !matchColumnPatterns(c.columnExclude, name)
+}
 
-	if !c.enableTiDBExtension {
-		return flatMessage
+func matchColumnPatterns(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		// the patterns have been validated by `parseColumnPatterns`.
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
 	}
+	return false
+}
 
-	return &canalFlatMessageWithTiDBExtension{
-		canalFlatMessage: flatMessage,
-		Extensions:       &tidbExtension{CommitTs: e.CommitTs},
+// parseColumnPatterns parses the comma-separated glob patterns of column names, which are case-insensitive.
+func parseColumnPatterns(s string) ([]string, error) {
+	var patterns []string
+	for _, pattern := range strings.Split(s, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, cerrors.ErrSinkInvalidConfig.GenWithStack("invalid column pattern %s: %v", pattern, err)
+		}
+		patterns = append(patterns, pattern)
 	}
+	return patterns, nil
 }
 
-func (c *CanalFlatEventBatchEncoder) newFlatMessage4CheckpointEvent(ts uint64) *canalFlatMessageWithTiDBExtension {
-	return &canalFlatMessageWithTiDBExtension{
-		canalFlatMessage: &canalFlatMessage{
-			ID:            0,
-			IsDDL:         false,
-			EventType:     tidbWaterMarkType,
-			ExecutionTime: convertToCanalTs(ts),
-			BuildTime:     time.Now().UnixNano() / int64(time.Millisecond), // converts to milliseconds
-		},
-		Extensions: &tidbExtension{WatermarkTs: ts},
+// limitJSONDepth truncates the values of the JSON columns of the row nested deeper than `maxJSONDepth`,
+// or returns an error if `jsonDepthOverflow` is `canalFlatJSONDepthError`.
+func (c *CanalFlatEventBatchEncoder) limitJSONDepth(cols []*model.Column, row map[string]interface{}) error {
+	for _, col := range cols {
+		if col == nil || col.Type != mysql.TypeJSON {
+			continue
+		}
+		value, ok := row[col.Name].(string)
+		if !ok {
+			continue
+		}
+		decoder := json.NewDecoder(strings.NewReader(value))
+		decoder.UseNumber()
+		var v interface{}
+		if err := decoder.Decode(&v); err != nil {
+			return cerrors.WrapError(cerrors.ErrCanalEncodeFailed, err)
+		}
+		if jsonDepth(v) <= c.maxJSONDepth {
+			continue
+		}
+		if c.jsonDepthOverflow == canalFlatJSONDepthError {
+			return cerrors.ErrCanalEncodeFailed.GenWithStack(
+				"the value of JSON column %s is nested deeper than max-json-depth %d", col.Name, c.maxJSONDepth)
+		}
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(truncateJSON(v, c.maxJSONDepth)); err != nil {
+			return cerrors.WrapError(cerrors.ErrCanalEncodeFailed, err)
+		}
+		row[col.Name] = strings.TrimSuffix(buf.String(), "\n")
 	}
+	return nil
 }
 
-// EncodeCheckpointEvent implements the EventBatchEncoder interface
-func (c *CanalFlatEventBatchEncoder) EncodeCheckpointEvent(ts uint64) (*MQMessage, error) {
-	if !c.enableTiDBExtension {
-		return nil, nil
+// jsonDepth returns the nesting depth of the JSON value, scalars have the depth 0.
+func jsonDepth(v interface{}) int {
+	depth := 0
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, elem := range v {
+			if d := jsonDepth(elem); d > depth {
+				depth = d
+			}
+		}
+	case []interface{}:
+		for _, elem := range v {
+			if d := jsonDepth(elem); d > depth {
+				depth = d
+			}
+		}
+	default:
+		return 0
 	}
+	return depth + 1
+}
 
-	msg := c.newFlatMessage4CheckpointEvent(ts)
-	value, err := json.Marshal(msg)
-	if err != nil {
-		return nil, cerrors.WrapError(cerrors.ErrCanalEncodeFailed, err)
+// truncateJSON replaces the objects and arrays of the JSON value nested deeper than the depth with the marker.
+func truncateJSON(v interface{}, depth int) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if depth <= 0 {
+			return canalFlatJSONTruncatedMarker
+		}
+		for key, elem := range v {
+			v[key] = truncateJSON(elem, depth-1)
+		}
+	case []interface{}:
+		if depth <= 0 {
+			return canalFlatJSONTruncatedMarker
+		}
+		for i, elem := range v {
+			v[i] = truncateJSON(elem, depth-1)
+		}
 	}
-	return newResolvedMQMessage(config.ProtocolCanalJSON, nil, value, ts), nil
+	return v
 }
 
-// AppendRowChangedEvent implements the interface EventBatchEncoder
-func (c *CanalFlatEventBatchEncoder) AppendRowChangedEvent(e *model.RowChangedEvent) error {
-	message, err := c.newFlatMessageForDML(e)
-	if err != nil {
+// formatFloatColumns formats the FLOAT and DOUBLE values of the row as the shortest texts which are parsed
+// back to the same values at the precision of the column types, so that values don't drift through float64.
+func formatFloatColumns(cols []*model.Column, row map[string]interface{}) {
+	for _, col := range cols {
+		if col == nil || row[col.Name] == nil {
+			continue
+		}
+		var value float64
+		switch v := col.Value.(type) {
+		case float32:
+			value = float64(v)
+		case float64:
+			value = v
+		default:
+			continue
+		}
+		bitSize := 64
+		if col.Type == mysql.TypeFloat {
+			bitSize = 32
+		}
+		row[col.Name] = strconv.FormatFloat(value, 'f', -1, bitSize)
+	}
+}
+
+// formatBitColumns formats the BIT values of the row in big-endian binary literals as numbers, the same as
+// the `uint64` ones, so they're decoded back to `uint64` as the mounter does, see `decodeCanalJSONColumn`.
+func formatBitColumns(cols []*model.Column, row map[string]interface{}) error {
+	for _, col := range cols {
+		if col == nil || col.Type != mysql.TypeBit || row[col.Name] == nil {
+			continue
+		}
+		v, ok := col.Value.([]byte)
+		if !ok {
+			continue
+		}
+		if len(v) > 8 {
+			return cerrors.ErrCanalEncodeFailed.GenWithStack("unexpected length for bit value: %d", len(v))
+		}
+		var number uint64
+		for _, b := range v {
+			number = number<<8 | uint64(b)
+		}
+		row[col.Name] = strconv.FormatUint(number, 10)
+	}
+	return nil
+}
+
+// roundDecimalColumns rounds the DECIMAL values of the old and new rows with more than `scale` fractional digits
+// to `scale` digits, half away from zero, and returns the names of the rounded columns sorted.
+func roundDecimalColumns(scale int, preCols []*model.Column, oldData map[string]interface{}, cols []*model.Column, data map[string]interface{}) ([]string, error) {
+	rounded := make(map[string]struct{})
+	round := func(cols []*model.Column, row map[string]interface{}) error {
+		for _, col := range cols {
+			if col == nil || col.Type != mysql.TypeNewDecimal {
+				continue
+			}
+			value, ok := row[col.Name].(string)
+			if !ok {
+				continue
+			}
+			dec := new(tidbtypes.MyDecimal)
+			if err := dec.FromString([]byte(value)); err != nil {
+				return errors.Trace(err)
+			}
+			if int(dec.GetDigitsFrac()) <= scale {
+				continue
+			}
+			to := new(tidbtypes.MyDecimal)
+			if err := dec.Round(to, scale, tidbtypes.ModeHalfEven); err != nil {
+				return errors.Trace(err)
+			}
+			row[col.Name] = to.String()
+			rounded[col.Name] = struct{}{}
+		}
+		return nil
+	}
+	if err := round(preCols, oldData); err != nil {
+		return nil, err
+	}
+	if err := round(cols, data); err != nil {
+		return nil, err
+	}
+	if len(rounded) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(rounded))
+	for name := range rounded {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// schemaVersion returns the schema version of the table.
+func (c *CanalFlatEventBatchEncoder) schemaVersion(tableName string) uint64 {
+	if c.schemaVersions == nil {
+		return 0
+	}
+	return c.schemaVersions.get(tableName)
+}
+
+func (c *CanalFlatEventBatchEncoder) newFlatMessageForDDL(e *model.DDLEvent) canalFlatMessageInterface {
+	if c.schemaVersions == nil {
+		c.schemaVersions = &schemaVersions{}
+	}
+	tableName := model.TableName{Schema: e.TableInfo.Schema, Table: e.TableInfo.Table}.QuoteString()
+	return c.newFlatMessageForDDLWithVersion(e, c.schemaVersions.increase(tableName), false)
+}
+
+// newFlatMessageForDDLWithVersion creates the message of the DDL under the schema version,
+// `bootstrap` marks the DDL is re-emitted by the schema heartbeat.
+func (c *CanalFlatEventBatchEncoder) newFlatMessageForDDLWithVersion(e *model.DDLEvent, schemaVersion uint64, bootstrap bool) canalFlatMessageInterface {
+	c.registerTableInfo(model.TableName{Schema: e.TableInfo.Schema, Table: e.TableInfo.Table}, e.TiTableInfo)
+	header := c.builder.buildHeader(e.CommitTs, e.TableInfo.Schema, e.TableInfo.Table, convertDdlEventType(e), 1)
+	now := c.now()
+	flatMessage := &canalFlatMessage{
+		ID:            c.nextMessageID(e.CommitTs), // ignored by both Canal Adapter and Flink
+		Schema:        header.SchemaName,
+		Table:         header.TableName,
+		IsDDL:         true,
+		EventType:     header.GetEventType().String(),
+		ExecutionTime: c.toEpoch(header.ExecuteTime),
+		BuildTime:     c.toEpoch(now.UnixNano() / 1e6), // timestamp
+		Query:         e.Query,
+		tikvTs:        e.CommitTs,
+	}
+
+	if !c.enableTiDBExtension {
+		if c.emitCommitTs {
+			flatMessage.CommitTs = e.CommitTs
+		}
+		return flatMessage
+	}
+
+	return &canalFlatMessageWithTiDBExtension{
+		canalFlatMessage: flatMessage,
+		Extensions: &tidbExtension{
+			CommitTs:       e.CommitTs,
+			SchemaVersion:  schemaVersion,
+			SchemaChange:   newSchemaChange(e),
+			ColumnDefaults: c.columnDefaults[model.TableName{Schema: e.TableInfo.Schema, Table: e.TableInfo.Table}.QuoteString()],
+			Bootstrap:      bootstrap,
+			AutoIncrement:  c.autoIncrements[model.TableName{Schema: e.TableInfo.Schema, Table: e.TableInfo.Table}.QuoteString()],
+			TimePrecision:  c.preciseTimePrecision(),
+			ExecutionTime:  c.toPreciseEpoch(time.Unix(0, header.ExecuteTime*int64(time.Millisecond))),
+			BuildTime:      c.toPreciseEpoch(now),
+		},
+	}
+}
+
+func (c *CanalFlatEventBatchEncoder) newFlatMessage4CheckpointEvent(ts uint64) *canalFlatMessageWithTiDBExtension {
+	return &canalFlatMessageWithTiDBExtension{
+		canalFlatMessage: &canalFlatMessage{
+			ID:            0,
+			IsDDL:         false,
+			EventType:     tidbWaterMarkType,
+			ExecutionTime: c.toEpoch(convertToCanalTs(ts)),
+			BuildTime:     c.toEpoch(c.now().UnixNano() / int64(time.Millisecond)), // converts to milliseconds
+		},
+		Extensions: &tidbExtension{WatermarkTs: ts},
+	}
+}
+
+// EncodeCheckpointEvent implements the EventBatchEncoder interface
+// The checkpoint is only emitted if the TiDB extension is enabled, with the full ts in `watermarkTs`,
+// or `plain-watermark` is enabled, with only the physical time of the ts in `es`, otherwise it returns nil.
+func (c *CanalFlatEventBatchEncoder) EncodeCheckpointEvent(ts uint64) (*MQMessage, error) {
+	if !c.enableTiDBExtension && !c.plainWatermark {
+		return nil, nil
+	}
+
+	checkpoint := c.newFlatMessage4CheckpointEvent(ts)
+	var msg canalFlatMessageInterface = checkpoint
+	if !c.enableTiDBExtension {
+		msg = checkpoint.canalFlatMessage
+	}
+	value, err := c.marshal(msg)
+	if err != nil {
+		return nil, cerrors.WrapError(cerrors.ErrCanalEncodeFailed, err)
+	}
+	if value, err = c.compress(value); err != nil {
+		return nil, err
+	}
+	return newResolvedMQMessage(config.ProtocolCanalJSON, nil, value, ts), nil
+}
+
+// AppendRowChangedEvent implements the interface EventBatchEncoder
+func (c *CanalFlatEventBatchEncoder) AppendRowChangedEvent(e *model.RowChangedEvent) error {
+	if c.ddlOnly {
+		return nil
+	}
+	if c.skipResumed(e.CommitTs) {
+		return nil
+	}
+	message, err := c.newFlatMessageForDML(e)
+	if err != nil {
 		return errors.Trace(err)
 	}
+	message.setSequence(c.nextSequence())
+	var key []byte
+	if c.hashedKey {
+		pk := canalFlatPrimaryKey(message)
+		message.setPrimaryKey(pk)
+		key = hashCanalFlatKey(e.Table.QuoteString(), pk)
+	}
+	if c.idempotencyKey {
+		message.setIdempotencyKey(canalFlatIdempotencyKey(e.Table.QuoteString(), e.CommitTs, message))
+	}
+	// the message is timestamped as if it's built, so it's measured in the length it's built,
+	// it's timestamped again when built, see `BuildWithError`.
+	now := c.now()
+	message.setBuildTime(c.toEpoch(now.UnixNano() / int64(time.Millisecond)))
+	message.setPreciseBuildTime(c.toPreciseEpoch(now))
+	message.setProducerTs(now.UnixNano() / int64(time.Millisecond))
+	value, err := c.marshal(message)
+	if err != nil {
+		return cerrors.WrapError(cerrors.ErrCanalEncodeFailed, err)
+	}
+	length := len(key) + len(value) + maximumRecordOverhead
+	if c.packMessages {
+		length += len("[]")
+	}
+	if c.maxMessageBytes > 0 && length > c.maxMessageBytes {
+		log.Warn("the row changed event does not fit into max-message-bytes, adjust the configurations to avoid service interruptions",
+			zap.Int("length", length), zap.Int("max-message-bytes", c.maxMessageBytes), zap.Stringer("table", e.Table))
+		return cerrors.ErrCanalMessageTooLarge.GenWithStackByArgs(length, c.maxMessageBytes, e.Table.QuoteString())
+	}
 	c.messageBuf = append(c.messageBuf, message)
+	if c.hashedKey {
+		c.keys = append(c.keys, key)
+	}
+	c.size += len(key) + len(value)
+	c.touchSchemaHeartbeat(e.Table.QuoteString(), nil)
 	return nil
 }
 
 // EncodeDDLEvent encodes DDL events
 func (c *CanalFlatEventBatchEncoder) EncodeDDLEvent(e *model.DDLEvent) (*MQMessage, error) {
 	message := c.newFlatMessageForDDL(e)
-	value, err := json.Marshal(message)
+	message.setSequence(c.nextSequence())
+	message.setProducerTs(c.now().UnixNano() / int64(time.Millisecond))
+	value, err := c.marshal(message)
 	if err != nil {
 		return nil, cerrors.WrapError(cerrors.ErrCanalEncodeFailed, err)
 	}
+	if value, err = c.compress(value); err != nil {
+		return nil, err
+	}
+	c.touchSchemaHeartbeat(model.TableName{Schema: e.TableInfo.Schema, Table: e.TableInfo.Table}.QuoteString(), e)
 	return newDDLMQMessage(config.ProtocolCanalJSON, nil, value, e), nil
 }
 
+// touchSchemaHeartbeat records the activity of the table, and its last DDL if `ddl` is not nil.
+func (c *CanalFlatEventBatchEncoder) touchSchemaHeartbeat(tableName string, ddl *model.DDLEvent) {
+	if c.schemaHeartbeatInterval <= 0 || c.heartbeats == nil {
+		return
+	}
+	c.heartbeats.mu.Lock()
+	defer c.heartbeats.mu.Unlock()
+	if c.heartbeats.tables == nil {
+		c.heartbeats.tables = make(map[string]*schemaHeartbeat)
+	}
+	heartbeat, ok := c.heartbeats.tables[tableName]
+	if !ok {
+		heartbeat = &schemaHeartbeat{}
+		c.heartbeats.tables[tableName] = heartbeat
+	}
+	if ddl != nil {
+		heartbeat.ddl = ddl
+		heartbeat.schemaVersion = c.schemaVersion(tableName)
+	}
+	heartbeat.lastActive = c.now()
+}
+
+// EncodeSchemaHeartbeats re-emits the last DDL of each table which has no change events for
+// `schema-heartbeat-interval` as a bootstrap DDL, to keep the downstream schema caches warm.
+// the bootstrap DDLs don't increase the schema versions, and are marked in the TiDB extension.
+func (c *CanalFlatEventBatchEncoder) EncodeSchemaHeartbeats() ([]*MQMessage, error) {
+	if c.schemaHeartbeatInterval <= 0 || c.heartbeats == nil {
+		return nil, nil
+	}
+	c.heartbeats.mu.Lock()
+	defer c.heartbeats.mu.Unlock()
+
+	tableNames := make([]string, 0, len(c.heartbeats.tables))
+	for tableName := range c.heartbeats.tables {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Strings(tableNames)
+	now := c.now()
+	var msgs []*MQMessage
+	for _, tableName := range tableNames {
+		heartbeat := c.heartbeats.tables[tableName]
+		if heartbeat.ddl == nil || now.Sub(heartbeat.lastActive) < c.schemaHeartbeatInterval {
+			continue
+		}
+		message := c.newFlatMessageForDDLWithVersion(heartbeat.ddl, heartbeat.schemaVersion, true)
+		message.setProducerTs(now.UnixNano() / int64(time.Millisecond))
+		value, err := c.marshal(message)
+		if err != nil {
+			return nil, cerrors.WrapError(cerrors.ErrCanalEncodeFailed, err)
+		}
+		if value, err = c.compress(value); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, newDDLMQMessage(config.ProtocolCanalJSON, nil, value, heartbeat.ddl))
+		heartbeat.lastActive = now
+	}
+	return msgs, nil
+}
+
 // Build implements the EventBatchEncoder interface
+// The batch is kept and nil is returned if it fails to be built, see `BuildWithError`.
 func (c *CanalFlatEventBatchEncoder) Build() []*MQMessage {
-	if len(c.messageBuf) == 0 {
+	ret, err := c.BuildWithError()
+	if err != nil {
+		log.Error("CanalFlatEventBatchEncoder fails to build the batch", zap.Error(err))
 		return nil
 	}
-	ret := make([]*MQMessage, len(c.messageBuf))
-	for i, msg := range c.messageBuf {
-		value, err := json.Marshal(msg)
+	return ret
+}
+
+// BuildWithError implements the FallibleEventBatchEncoder interface
+// The batch is kept as if it's not built if any message fails to be serialized, so the sink can fail gracefully
+// without losing the events.
+func (c *CanalFlatEventBatchEncoder) BuildWithError() ([]*MQMessage, error) {
+	if len(c.messageBuf) == 0 {
+		return c.buildEmptyBatch()
+	}
+	// all messages in the batch share the same build time.
+	now := c.now()
+	buildTime := c.toEpoch(now.UnixNano() / int64(time.Millisecond))
+	preciseBuildTime := c.toPreciseEpoch(now)
+	ret := make([]*MQMessage, 0, len(c.messageBuf))
+	for i, msg := range c.messageBuf {
+		msg.setBuildTime(buildTime)
+		msg.setPreciseBuildTime(preciseBuildTime)
+		msg.setProducerTs(c.now().UnixNano() / int64(time.Millisecond))
+		value, err := c.marshal(msg)
+		if err != nil {
+			return nil, cerrors.WrapError(cerrors.ErrCanalEncodeFailed, err)
+		}
+		var key []byte
+		if c.hashedKey {
+			key = c.keys[i]
+		}
+		if c.packMessages {
+			if len(ret) > 0 && c.packMessage(ret[len(ret)-1], key, value, msg.getTikvTs()) {
+				continue
+			}
+			value = append(append([]byte{'['}, value...), ']')
+		}
+		m := NewMQMessage(config.ProtocolCanalJSON, key, value, msg.getTikvTs(), model.MqMessageTypeRow, msg.getSchema(), msg.getTable())
+		m.IncRowsCount()
+		ret = append(ret, m)
+	}
+	// the packed messages are compressed as a whole.
+	for _, m := range ret {
+		value, err := c.compress(m.Value)
+		if err != nil {
+			return nil, cerrors.WrapError(cerrors.ErrCanalEncodeFailed, err)
+		}
+		m.Value = value
+	}
+	for _, msg := range c.messageBuf {
+		c.checkpoint.advance(msg.getTikvTs())
+	}
+	c.messageBuf = make([]canalFlatMessageInterface, 0)
+	c.size = 0
+	c.keys = nil
+	return ret, nil
+}
+
+// packMessage appends the row message to the packed JSON array if they have the same key, and also the same
+// commitTs if split by transaction, and the array is still no longer than `maxMessageBytes` after that,
+// it returns whether the message is packed.
+func (c *CanalFlatEventBatchEncoder) packMessage(packed *MQMessage, key, value []byte, commitTs uint64) bool {
+	if !bytes.Equal(packed.Key, key) {
+		return false
+	}
+	if c.splitByTransaction && packed.Ts != commitTs {
+		return false
+	}
+	if c.maxMessageBytes > 0 && packed.Length()+len(",")+len(value) > c.maxMessageBytes {
+		return false
+	}
+	packed.Value[len(packed.Value)-1] = ','
+	packed.Value = append(append(packed.Value, value...), ']')
+	packed.IncRowsCount()
+	return true
+}
+
+// CanalFlatCheckpoint is the position of the row changed events built by the encoder,
+// the events with the same commitTs are identified by their order, which is kept when they're replayed.
+type CanalFlatCheckpoint struct {
+	CommitTs uint64 `json:"commit-ts"`
+	// Offset is the number of the row changed events with the CommitTs built.
+	Offset int `json:"offset"`
+}
+
+func (cp *CanalFlatCheckpoint) advance(commitTs uint64) {
+	if commitTs != cp.CommitTs {
+		cp.CommitTs, cp.Offset = commitTs, 0
+	}
+	cp.Offset++
+}
+
+// Checkpoint returns the position after the last row changed event built by `Build`, the events appended but not
+// built yet are not included. Once the built messages are flushed, the checkpoint can be persisted and passed to
+// `ResumeFrom` after a restart, so the replayed events are neither duplicated nor lost.
+func (c *CanalFlatEventBatchEncoder) Checkpoint() CanalFlatCheckpoint {
+	return c.checkpoint
+}
+
+// ResumeFrom resumes the encoding from the checkpoint returned by `Checkpoint` before a restart,
+// the row changed events appended up to the checkpoint are skipped as they have been built.
+func (c *CanalFlatEventBatchEncoder) ResumeFrom(cp CanalFlatCheckpoint) {
+	c.checkpoint = cp
+	c.resume = &cp
+	c.resumeSkipped = 0
+}
+
+// skipResumed returns whether the row changed event with the commitTs has been built before the checkpoint resumed from.
+func (c *CanalFlatEventBatchEncoder) skipResumed(commitTs uint64) bool {
+	if c.resume == nil {
+		return false
+	}
+	switch {
+	case commitTs < c.resume.CommitTs:
+		return true
+	case commitTs == c.resume.CommitTs && c.resumeSkipped < c.resume.Offset:
+		c.resumeSkipped++
+		return true
+	}
+	// all events up to the checkpoint have been skipped.
+	c.resume = nil
+	return false
+}
+
+// CanalFlatManifest describes the row changed events in a batch built by `BuildManifest`, for the file-based sinks.
+type CanalFlatManifest struct {
+	Count       int    `json:"count"`
+	MinCommitTs uint64 `json:"min-commit-ts"`
+	MaxCommitTs uint64 `json:"max-commit-ts"`
+	// the quoted names of the tables of the events, sorted.
+	Tables []string `json:"tables"`
+}
+
+// BuildManifest builds the buffered row changed events as `Build`, but returns the messages as a newline-delimited
+// JSON payload along with the manifest describing the events in it, the payload is nil for an empty batch.
+func (c *CanalFlatEventBatchEncoder) BuildManifest() ([]byte, CanalFlatManifest, error) {
+	if c.envelope == canalFlatEnvelopeCBOR {
+		return nil, CanalFlatManifest{}, cerrors.ErrSinkInvalidConfig.GenWithStack("the manifest is only supported by the json envelope")
+	}
+	if c.compression != "" && c.compression != canalFlatCompressionNone {
+		return nil, CanalFlatManifest{}, cerrors.ErrSinkInvalidConfig.GenWithStack("the manifest is not supported with compression")
+	}
+	manifest := CanalFlatManifest{Count: len(c.messageBuf), Tables: make([]string, 0)}
+	if len(c.messageBuf) == 0 {
+		return nil, manifest, nil
+	}
+	tables := make(map[string]struct{})
+	for i, msg := range c.messageBuf {
+		ts := msg.getTikvTs()
+		if i == 0 || ts < manifest.MinCommitTs {
+			manifest.MinCommitTs = ts
+		}
+		if ts > manifest.MaxCommitTs {
+			manifest.MaxCommitTs = ts
+		}
+		table := model.TableName{Schema: *msg.getSchema(), Table: *msg.getTable()}.QuoteString()
+		if _, ok := tables[table]; !ok {
+			tables[table] = struct{}{}
+			manifest.Tables = append(manifest.Tables, table)
+		}
+	}
+	sort.Strings(manifest.Tables)
+
+	msgs, err := c.BuildWithError()
+	if err != nil {
+		return nil, CanalFlatManifest{}, err
+	}
+	var payload bytes.Buffer
+	for _, msg := range msgs {
+		payload.Write(msg.Value)
+		payload.WriteByte('\n')
+	}
+	return payload.Bytes(), manifest, nil
+}
+
+// buildEmptyBatch builds the messages for an empty batch according to the `empty-batch` parameter.
+func (c *CanalFlatEventBatchEncoder) buildEmptyBatch() ([]*MQMessage, error) {
+	switch c.emptyBatch {
+	case canalFlatEmptyBatchEmptySlice:
+		return []*MQMessage{}, nil
+	case canalFlatEmptyBatchHeartbeat:
+		msg := &canalFlatMessage{
+			EventType: tidbHeartbeatType,
+			BuildTime: c.toEpoch(c.now().UnixNano() / int64(time.Millisecond)),
+		}
+		value, err := c.marshal(msg)
+		if err == nil {
+			value, err = c.compress(value)
+		}
+		if err != nil {
+			return nil, cerrors.WrapError(cerrors.ErrCanalEncodeFailed, err)
+		}
+		return []*MQMessage{NewMQMessage(config.ProtocolCanalJSON, nil, value, 0, model.MqMessageTypeUnknown, nil, nil)}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// marshal serializes the message in the configured envelope.
+func (c *CanalFlatEventBatchEncoder) marshal(msg interface{}) ([]byte, error) {
+	if c.wrapperKey != "" {
+		msg = wrapUnderKey(c.wrapperKey, msg)
+	}
+	if c.envelope == canalFlatEnvelopeCBOR {
+		return cborMarshal(msg)
+	}
+	return jsonMarshaler.Marshal(msg)
+}
+
+// compress compresses the serialized message value with the configured compression.
+func (c *CanalFlatEventBatchEncoder) compress(value []byte) ([]byte, error) {
+	switch c.compression {
+	case canalFlatCompressionGzip:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(value); err != nil {
+			return nil, cerrors.WrapError(cerrors.ErrCanalEncodeFailed, err)
+		}
+		if err := writer.Close(); err != nil {
+			return nil, cerrors.WrapError(cerrors.ErrCanalEncodeFailed, err)
+		}
+		return buf.Bytes(), nil
+	case canalFlatCompressionSnappy:
+		return snappy.Encode(nil, value), nil
+	default:
+		return value, nil
+	}
+}
+
+// decompressCanalFlatValue reverses the compression of the message value, see `compression` of the encoder.
+func decompressCanalFlatValue(compression string, value []byte) ([]byte, error) {
+	switch compression {
+	case "", canalFlatCompressionNone:
+		return value, nil
+	case canalFlatCompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(value))
+		if err != nil {
+			return nil, cerrors.WrapError(cerrors.ErrCanalDecodeFailed, err)
+		}
+		defer reader.Close()
+		decompressed, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, cerrors.WrapError(cerrors.ErrCanalDecodeFailed, err)
+		}
+		return decompressed, nil
+	case canalFlatCompressionSnappy:
+		decompressed, err := snappy.Decode(nil, value)
+		if err != nil {
+			return nil, cerrors.WrapError(cerrors.ErrCanalDecodeFailed, err)
+		}
+		return decompressed, nil
+	default:
+		return nil, cerrors.ErrCanalDecodeFailed.GenWithStack("unsupported compression %s", compression)
+	}
+}
+
+// wrapUnderKey returns a value which marshals v, or unmarshals into v, nested under the key.
+func wrapUnderKey(key string, v interface{}) interface{} {
+	t := reflect.StructOf([]reflect.StructField{{
+		Name: "Payload",
+		Type: reflect.TypeOf(v),
+		Tag:  reflect.StructTag(fmt.Sprintf("json:%q", key)),
+	}})
+	wrapper := reflect.New(t)
+	wrapper.Elem().Field(0).Set(reflect.ValueOf(v))
+	return wrapper.Interface()
+}
+
+// Size implements the EventBatchEncoder interface, it returns the bytes of the messages buffered since the last `Build`.
+// NOTE: the messages are measured when they're appended, they may differ slightly from the built ones in size,
+// as they're timestamped again when built.
+func (c *CanalFlatEventBatchEncoder) Size() int {
+	return c.size
+}
+
+// SetTableInfo registers the table info of the table, values of its SET and ENUM columns are encoded as
+// the string representations instead of the numeric ones, and the default expressions of its columns
+// are emitted with its DDLs. a nil table info unregisters the table.
+// the tables are also registered by the table infos carried by their events, see `registerTableInfo`.
+func (c *CanalFlatEventBatchEncoder) SetTableInfo(table model.TableName, tableInfo *timodel.TableInfo) {
+	if c.enumSetColumns == nil {
+		c.enumSetColumns = make(map[string]map[string]enumSetColumn)
+	}
+	if c.columnDefaults == nil {
+		c.columnDefaults = make(map[string]map[string]string)
+	}
+	if c.autoIncrements == nil {
+		c.autoIncrements = make(map[string]int64)
+	}
+	if tableInfo == nil {
+		delete(c.enumSetColumns, table.QuoteString())
+		delete(c.columnDefaults, table.QuoteString())
+		delete(c.autoIncrements, table.QuoteString())
+		delete(c.tableInfos, table.QuoteString())
+		return
+	}
+	cols := make(map[string]enumSetColumn)
+	defaults := make(map[string]string)
+	for _, colInfo := range tableInfo.Columns {
+		if colInfo.Tp == mysql.TypeEnum || colInfo.Tp == mysql.TypeSet {
+			cols[colInfo.Name.O] = enumSetColumn{tp: colInfo.Tp, elems: colInfo.Elems}
+		}
+		if def, ok := formatColumnDefault(colInfo); ok {
+			defaults[colInfo.Name.O] = def
+		}
+	}
+	c.enumSetColumns[table.QuoteString()] = cols
+	c.columnDefaults[table.QuoteString()] = defaults
+	if tableInfo.GetAutoIncrementColInfo() != nil && tableInfo.AutoIncID > 0 {
+		c.autoIncrements[table.QuoteString()] = tableInfo.AutoIncID
+	} else {
+		delete(c.autoIncrements, table.QuoteString())
+	}
+}
+
+// registerTableInfo registers the table info carried by the events, e.g. the schema the row is mounted with,
+// or the table info after the DDL, it's skipped if the table is already registered with the same table info.
+func (c *CanalFlatEventBatchEncoder) registerTableInfo(table model.TableName, tableInfo *timodel.TableInfo) {
+	if tableInfo == nil {
+		return
+	}
+	if c.tableInfos == nil {
+		c.tableInfos = make(map[string]*timodel.TableInfo)
+	}
+	if c.tableInfos[table.QuoteString()] == tableInfo {
+		return
+	}
+	c.tableInfos[table.QuoteString()] = tableInfo
+	c.SetTableInfo(table, tableInfo)
+}
+
+// formatColumnDefault returns the default expression of the column as it's written in `CREATE TABLE`,
+// string literals are quoted while `CURRENT_TIMESTAMP` is kept as it is.
+func formatColumnDefault(colInfo *timodel.ColumnInfo) (string, bool) {
+	def := colInfo.GetDefaultValue()
+	if def == nil {
+		return "", false
+	}
+	value, ok := def.(string)
+	if !ok {
+		return fmt.Sprint(def), true
+	}
+	if strings.HasPrefix(strings.ToUpper(value), "CURRENT_TIMESTAMP") {
+		return value, true
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'", true
+}
+
+// SetParams sets the encoding parameters for the canal flat protocol.
+func (c *CanalFlatEventBatchEncoder) SetParams(params map[string]string) error {
+	if s, ok := params["enable-tidb-extension"]; ok {
+		a, err := strconv.ParseBool(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.enableTiDBExtension = a
+	}
+	if s, ok := params["plain-watermark"]; ok {
+		a, err := strconv.ParseBool(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.plainWatermark = a
+	}
+	if s, ok := params["omit-nulls"]; ok {
+		a, err := strconv.ParseBool(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.omitNulls = a
+	}
+	if s, ok := params["emit-message-id"]; ok {
+		a, err := strconv.ParseBool(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.emitMessageID = a
+	}
+	if s, ok := params["ddl-only"]; ok {
+		a, err := strconv.ParseBool(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.ddlOnly = a
+	}
+	if s, ok := params["emit-sequence"]; ok {
+		a, err := strconv.ParseBool(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.emitSequence = a
+	}
+	if s, ok := params["emit-commit-ts"]; ok {
+		a, err := strconv.ParseBool(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.emitCommitTs = a
+	}
+	if s, ok := params["emit-row-id"]; ok {
+		a, err := strconv.ParseBool(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.emitRowID = a
+	}
+	if s, ok := params["hashed-key"]; ok {
+		a, err := strconv.ParseBool(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.hashedKey = a
+	}
+	if s, ok := params["idempotency-key"]; ok {
+		a, err := strconv.ParseBool(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.idempotencyKey = a
+	}
+	if s, ok := params["delete-key-only"]; ok {
+		a, err := strconv.ParseBool(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.deleteKeyOnly = a
+	}
+	if s, ok := params["float-as-string"]; ok {
+		a, err := strconv.ParseBool(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.floatAsString = a
+	}
+	if s, ok := params["schema-heartbeat-interval"]; ok {
+		interval, err := time.ParseDuration(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		if interval < 0 {
+			return cerrors.ErrSinkInvalidConfig.GenWithStack("invalid schema-heartbeat-interval %s, it should not be negative", s)
+		}
+		c.schemaHeartbeatInterval = interval
+	}
+	if s, ok := params["wrapper-key"]; ok {
+		c.wrapperKey = s
+	}
+	if s, ok := params["epoch-offset-ms"]; ok {
+		offset, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.epochOffsetMs = offset
+	}
+	if s, ok := params["time-precision"]; ok {
+		if _, ok := canalFlatTimePrecisionUnits[s]; !ok {
+			return cerrors.ErrSinkInvalidConfig.GenWithStack("unsupported time-precision %s, only ms, us and ns are supported", s)
+		}
+		c.timePrecision = s
+	}
+	if s, ok := params["column-include"]; ok {
+		patterns, err := parseColumnPatterns(s)
+		if err != nil {
+			return err
+		}
+		c.columnInclude = patterns
+	}
+	if s, ok := params["column-exclude"]; ok {
+		patterns, err := parseColumnPatterns(s)
+		if err != nil {
+			return err
+		}
+		c.columnExclude = patterns
+	}
+	if s, ok := params["max-json-depth"]; ok {
+		depth, err := strconv.Atoi(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		if depth < 0 {
+			return cerrors.ErrSinkInvalidConfig.GenWithStack("invalid max-json-depth %s, it should not be negative", s)
+		}
+		c.maxJSONDepth = depth
+	}
+	if s, ok := params["decimal-scale-limit"]; ok {
+		scale, err := strconv.Atoi(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		if scale < 0 {
+			return cerrors.ErrSinkInvalidConfig.GenWithStack("invalid decimal-scale-limit %s, it should not be negative", s)
+		}
+		c.roundDecimals = true
+		c.decimalScaleLimit = scale
+	}
+	if s, ok := params["json-depth-overflow"]; ok {
+		switch s {
+		case canalFlatJSONDepthTruncate, canalFlatJSONDepthError:
+			c.jsonDepthOverflow = s
+		default:
+			return cerrors.ErrSinkInvalidConfig.GenWithStack("unsupported json-depth-overflow %s, only truncate and error are supported", s)
+		}
+	}
+	if s, ok := params["only-output-updated-columns"]; ok {
+		a, err := strconv.ParseBool(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.onlyOutputUpdatedColumns = a
+	}
+	if s, ok := params["inline-schema"]; ok {
+		a, err := strconv.ParseBool(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		c.inlineSchema = a
+	}
+	if s, ok := params["max-message-bytes"]; ok {
+		maxMessageBytes, err := strconv.Atoi(s)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+		}
+		if maxMessageBytes <= 0 {
+			return cerrors.ErrSinkInvalidConfig.GenWithStack("invalid max-message-bytes %s, it should be positive", s)
+		}
+		c.maxMessageBytes = maxMessageBytes
+	}
+	if s, ok := params["pack-messages"]; ok {
+		a, err := strconv.ParseBool(s)
 		if err != nil {
-			log.Panic("CanalFlatEventBatchEncoder", zap.Error(err))
-			return nil
+			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
 		}
-		m := NewMQMessage(config.ProtocolCanalJSON, nil, value, msg.getTikvTs(), model.MqMessageTypeRow, msg.getSchema(), msg.getTable())
-		m.IncRowsCount()
-		ret[i] = m
+		c.packMessages = a
 	}
-	c.messageBuf = make([]canalFlatMessageInterface, 0)
-	return ret
-}
-
-// Size implements the EventBatchEncoder interface
-func (c *CanalFlatEventBatchEncoder) Size() int {
-	return -1
-}
-
-// SetParams sets the encoding parameters for the canal flat protocol.
-func (c *CanalFlatEventBatchEncoder) SetParams(params map[string]string) error {
-	if s, ok := params["enable-tidb-extension"]; ok {
+	if s, ok := params["split-by-transaction"]; ok {
 		a, err := strconv.ParseBool(s)
 		if err != nil {
 			return cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
 		}
-		c.enableTiDBExtension = a
+		c.splitByTransaction = a
+		if a {
+			c.packMessages = true
+		}
+	}
+	if s, ok := params["empty-batch"]; ok {
+		switch s {
+		case canalFlatEmptyBatchNil, canalFlatEmptyBatchEmptySlice, canalFlatEmptyBatchHeartbeat:
+			c.emptyBatch = s
+		default:
+			return cerrors.ErrSinkInvalidConfig.GenWithStack("unsupported empty-batch %s, only nil, empty-slice and heartbeat are supported", s)
+		}
+	}
+	if s, ok := params["envelope"]; ok {
+		switch s {
+		case canalFlatEnvelopeJSON, canalFlatEnvelopeCBOR:
+			c.envelope = s
+		default:
+			return cerrors.ErrSinkInvalidConfig.GenWithStack("unsupported envelope %s, only json and cbor are supported", s)
+		}
+	}
+	if s, ok := params["compression"]; ok {
+		switch s {
+		case canalFlatCompressionNone, canalFlatCompressionGzip, canalFlatCompressionSnappy:
+			c.compression = s
+		default:
+			return cerrors.ErrSinkInvalidConfig.GenWithStack("unsupported compression %s, only none, gzip and snappy are supported", s)
+		}
+	}
+	if c.packMessages && c.envelope == canalFlatEnvelopeCBOR {
+		return cerrors.ErrSinkInvalidConfig.GenWithStack("pack-messages is only supported by the json envelope")
 	}
 	return nil
 }
 
 // CanalFlatEventBatchDecoder decodes the byte into the original message.
 type CanalFlatEventBatchDecoder struct {
-	data                []byte
+	data []byte
+	// messages are read lazily from the stream instead of the data if it's not nil, see `NewCanalFlatStreamDecoder`.
+	stream *json.Decoder
+	// the messages read but not returned by `HasNext` yet, e.g. the elements of a JSON array, see `enqueue`.
+	pending             []*MQMessage
 	msg                 *MQMessage
 	enableTiDBExtension bool
+	// the maximum number of columns in a row, messages with more columns are rejected
+	// to avoid huge allocations caused by malformed messages.
+	maxColumns int
+	// whether to normalize the column names to lowercase.
+	lowercaseColumnNames bool
+	// the producer timestamp of the last decoded row or DDL event.
+	producerTs int64
+	// the unknown fields of the TiDB extension of the last decoded row or DDL event, see `Raw`.
+	extensionRaw map[string]json.RawMessage
+	// the idempotency key of the last decoded row, see `idempotency-key` of the encoder.
+	idempotencyKey string
+	// `es` and `ts` of the last decoded row or DDL event, in milliseconds since Epoch.
+	executionTime int64
+	buildTime     int64
+	// `es` and `ts` of the last decoded row or DDL event, in nanoseconds since Epoch, see `time-precision` of the encoder.
+	executionTimeNs int64
+	buildTimeNs     int64
+	// the offset of the custom epoch of `es` and `ts`, see `epoch-offset-ms` of the encoder.
+	epochOffsetMs int64
+	// the raw primary keys of the decoded rows keyed by their hashed message keys, see `hashed-key` of the encoder.
+	primaryKeys map[string]map[string]string
+	// decoded rows are enforced against the schema if it's not nil, see `DecodeWithSchema`.
+	schema      *timodel.TableInfo
+	coerceTypes bool
+	// messages are unwrapped from the key if it's not empty, see `wrapper-key` of the encoder.
+	wrapperKey string
+	// whether to parse FLOAT and DOUBLE values back into floats, see `float-as-string` of the encoder.
+	floatAsString bool
+	// whether the columns absent from `old` of UPDATE events are unchanged, see `only-output-updated-columns` of the encoder.
+	onlyUpdatedColumns bool
+	// the message values are decompressed with it, see `compression` of the encoder.
+	compression string
+	// the statistics accumulated over the lifetime of the decoder.
+	stats CanalFlatDecodeStats
+}
+
+// CanalFlatDecodeStats is the statistics of a CanalFlatEventBatchDecoder, it can be used to monitor the consumer.
+type CanalFlatDecodeStats struct {
+	// the number of the decoded row changed events.
+	Rows uint64
+	// the number of the decoded DDL events.
+	DDLs uint64
+	// the number of the decoded resolved events.
+	Resolved uint64
+	// the number of the errors returned by the decoder.
+	Errors uint64
 }
 
 func newCanalFlatEventBatchDecoder(data []byte, enableTiDBExtension bool) EventBatchDecoder {
@@ -383,29 +2110,288 @@ func newCanalFlatEventBatchDecoder(data []byte, enableTiDBExtension bool) EventB
 		data:                data,
 		msg:                 nil,
 		enableTiDBExtension: enableTiDBExtension,
+		maxColumns:          defaultCanalFlatDecoderMaxColumns,
+	}
+}
+
+// NewCanalFlatStreamDecoder creates a decoder reading the messages lazily from the reader, one JSON-encoded message per line,
+// so that a large file of messages can be decoded without loading it entirely. Heartbeats in the stream are skipped.
+func NewCanalFlatStreamDecoder(r io.Reader, enableTiDBExtension bool) EventBatchDecoder {
+	return &CanalFlatEventBatchDecoder{
+		stream:              json.NewDecoder(r),
+		enableTiDBExtension: enableTiDBExtension,
+		maxColumns:          defaultCanalFlatDecoderMaxColumns,
+	}
+}
+
+// Reset resets the decoder to decode the data, the settings and the statistics of the decoder are kept,
+// so that one decoder can be used for the whole stream of messages. The stream of the decoder is dropped if any.
+func (b *CanalFlatEventBatchDecoder) Reset(data []byte) {
+	b.data = data
+	b.stream = nil
+	b.pending = nil
+	b.msg = nil
+}
+
+// Stats returns the statistics accumulated over the lifetime of the decoder.
+func (b *CanalFlatEventBatchDecoder) Stats() CanalFlatDecodeStats {
+	return b.stats
+}
+
+// countDecoded increases the counter if the event is decoded, otherwise increases the errors.
+func (b *CanalFlatEventBatchDecoder) countDecoded(err error, counter *uint64) {
+	if err != nil {
+		b.stats.Errors++
+		return
+	}
+	if counter != nil {
+		*counter++
+	}
+}
+
+// SetMaxColumns sets the maximum number of columns in a decoded row,
+// a non-positive value resets it to the default one.
+func (b *CanalFlatEventBatchDecoder) SetMaxColumns(maxColumns int) {
+	if maxColumns <= 0 {
+		maxColumns = defaultCanalFlatDecoderMaxColumns
+	}
+	b.maxColumns = maxColumns
+}
+
+// SetLowercaseColumnNames sets whether to normalize the column names of decoded rows to lowercase,
+// an error is returned when decoding if two columns of a row have the same lowercase name.
+func (b *CanalFlatEventBatchDecoder) SetLowercaseColumnNames(lowercase bool) {
+	b.lowercaseColumnNames = lowercase
+}
+
+// SetWrapperKey sets the key which messages are nested under, an empty key means messages are not wrapped.
+func (b *CanalFlatEventBatchDecoder) SetWrapperKey(key string) {
+	b.wrapperKey = key
+}
+
+// SetFloatAsString sets whether to parse the values of FLOAT and DOUBLE columns into float32 and float64
+// as the mounter does, instead of keeping them as strings.
+func (b *CanalFlatEventBatchDecoder) SetFloatAsString(enabled bool) {
+	b.floatAsString = enabled
+}
+
+// SetOnlyUpdatedColumns sets whether the columns absent from `old` of UPDATE events are unchanged, instead of null,
+// it should be the same as `only-output-updated-columns` of the encoder.
+func (b *CanalFlatEventBatchDecoder) SetOnlyUpdatedColumns(enabled bool) {
+	b.onlyUpdatedColumns = enabled
+}
+
+// SetCompression sets the compression of the message values, it should be the same as `compression` of the encoder,
+// messages compressed otherwise fail to be decoded.
+func (b *CanalFlatEventBatchDecoder) SetCompression(compression string) {
+	b.compression = compression
+}
+
+// SetEpochOffset sets the offset in milliseconds of the custom epoch of `es` and `ts` since Epoch,
+// it should be the same as `epoch-offset-ms` of the encoder.
+func (b *CanalFlatEventBatchDecoder) SetEpochOffset(offsetMs int64) {
+	b.epochOffsetMs = offsetMs
+}
+
+// unmarshal unmarshals the message value, which is unwrapped from the wrapper key if it's set.
+func (b *CanalFlatEventBatchDecoder) unmarshal(data []byte, v interface{}) error {
+	if b.wrapperKey != "" {
+		v = wrapUnderKey(b.wrapperKey, v)
+	}
+	return unmarshalEnvelope(data, v)
+}
+
+// DecodeWithSchema makes the decoder enforce the decoded rows against the table info, columns not in the
+// table info are rejected, and missing ones are filled with their default values. Columns of a different type
+// are coerced to the type in the table info if `coerceTypes` is true, otherwise they are rejected.
+// Values of SET and ENUM columns are reconstructed as the numeric ones.
+// A nil table info disables the enforcement.
+func (b *CanalFlatEventBatchDecoder) DecodeWithSchema(tableInfo *timodel.TableInfo, coerceTypes bool) {
+	b.schema = tableInfo
+	b.coerceTypes = coerceTypes
+}
+
+// ProducerTs returns the time when the last decoded row or DDL event was sent by the producer,
+// in milliseconds since Epoch, it's 0 if unknown, e.g. the TiDB extension is not enabled.
+func (b *CanalFlatEventBatchDecoder) ProducerTs() int64 {
+	return b.producerTs
+}
+
+// PrimaryKey returns the raw primary key of the rows decoded with the hashed message key, see `hashed-key` of the encoder.
+// The mapping is kept over the lifetime of the decoder, it's only available if the TiDB extension is enabled.
+func (b *CanalFlatEventBatchDecoder) PrimaryKey(key []byte) (map[string]string, bool) {
+	pk, ok := b.primaryKeys[string(key)]
+	return pk, ok
+}
+
+// Raw returns the fields of the TiDB extension of the last decoded row or DDL event unknown to the decoder, keyed by
+// their names, so the custom extensions added by other producers can be read. It's nil if there are no such fields,
+// or the TiDB extension is not enabled.
+func (b *CanalFlatEventBatchDecoder) Raw() map[string]json.RawMessage {
+	return b.extensionRaw
+}
+
+// IdempotencyKey returns the idempotency key of the last decoded row, see `idempotency-key` of the encoder.
+// It's empty if unknown, e.g. the TiDB extension is not enabled.
+func (b *CanalFlatEventBatchDecoder) IdempotencyKey() string {
+	return b.idempotencyKey
+}
+
+// ExecutionTime returns `es` of the last decoded row or DDL event, in milliseconds since Epoch.
+func (b *CanalFlatEventBatchDecoder) ExecutionTime() int64 {
+	return b.executionTime
+}
+
+// BuildTime returns `ts` of the last decoded row or DDL event, in milliseconds since Epoch.
+func (b *CanalFlatEventBatchDecoder) BuildTime() int64 {
+	return b.buildTime
+}
+
+// ExecutionTimeNs returns `es` of the last decoded row or DDL event, in nanoseconds since Epoch, it's at the precision
+// of `time-precision` of the encoder if the precise time is carried by the TiDB extension, or in milliseconds otherwise.
+func (b *CanalFlatEventBatchDecoder) ExecutionTimeNs() int64 {
+	return b.executionTimeNs
+}
+
+// BuildTimeNs returns `ts` of the last decoded row or DDL event, in nanoseconds since Epoch, it's at the precision
+// of `time-precision` of the encoder if the precise time is carried by the TiDB extension, or in milliseconds otherwise.
+func (b *CanalFlatEventBatchDecoder) BuildTimeNs() int64 {
+	return b.buildTimeNs
+}
+
+// commitTsOrFromExecutionTime returns the commitTs if it's carried by the message, otherwise it's reconstructed
+// from `es` of the message, which is the physical time of the commitTs, so the logical time is lost.
+func (b *CanalFlatEventBatchDecoder) commitTsOrFromExecutionTime(commitTs uint64) uint64 {
+	if commitTs != 0 || b.executionTime <= 0 {
+		return commitTs
+	}
+	return oracle.ComposeTS(b.executionTime, 0)
+}
+
+// setEventTimes records the timestamps, including the precise ones, the idempotency key and the unknown extension fields of the last decoded row or DDL event.
+func (b *CanalFlatEventBatchDecoder) setEventTimes(data canalFlatMessageInterface) {
+	b.producerTs = data.getProducerTs()
+	b.extensionRaw = data.getExtensionRaw()
+	b.idempotencyKey = data.getIdempotencyKey()
+	b.executionTime = data.getExecutionTime() + b.epochOffsetMs
+	b.buildTime = data.getBuildTime() + b.epochOffsetMs
+
+	// fall back to `es` and `ts` if the precise times are absent, e.g. the encoder is at the precision of milliseconds.
+	b.executionTimeNs = b.executionTime * int64(time.Millisecond)
+	b.buildTimeNs = b.buildTime * int64(time.Millisecond)
+	precision, executionTime, buildTime := data.getPreciseTimes()
+	unit, ok := canalFlatTimePrecisionUnits[precision]
+	if !ok {
+		return
+	}
+	offsetNs := b.epochOffsetMs * int64(time.Millisecond)
+	if executionTime != 0 {
+		b.executionTimeNs = executionTime*int64(unit) + offsetNs
+	}
+	if buildTime != 0 {
+		b.buildTimeNs = buildTime*int64(unit) + offsetNs
 	}
 }
 
 // HasNext implements the EventBatchDecoder interface
-func (b *CanalFlatEventBatchDecoder) HasNext() (model.MqMessageType, bool, error) {
-	if len(b.data) == 0 {
-		return model.MqMessageTypeUnknown, false, nil
+// The data may be either a single message or a JSON array of messages, and the value of a row message may be
+// either a single flat message or a JSON array of them, e.g. packed by `pack-messages` of the encoder,
+// the messages in the arrays are returned one by one in order.
+func (b *CanalFlatEventBatchDecoder) HasNext() (tp model.MqMessageType, hasNext bool, err error) {
+	defer func() { b.countDecoded(err, nil) }()
+	for len(b.pending) == 0 {
+		msgs, err := b.readMessages()
+		if err != nil {
+			return model.MqMessageTypeUnknown, false, err
+		}
+		if msgs == nil {
+			return model.MqMessageTypeUnknown, false, nil
+		}
+		if err := b.enqueue(msgs); err != nil {
+			return model.MqMessageTypeUnknown, false, err
+		}
 	}
-	msg := &MQMessage{}
-	if err := json.Unmarshal(b.data, msg); err != nil {
-		return model.MqMessageTypeUnknown, false, err
+	b.msg, b.pending = b.pending[0], b.pending[1:]
+	return b.msg.Type, true, nil
+}
+
+// readMessages reads the next messages from the stream or the data, it returns nil if there are no more messages.
+func (b *CanalFlatEventBatchDecoder) readMessages() ([]*MQMessage, error) {
+	if b.stream != nil {
+		msg, err := b.nextFromStream()
+		if err != nil || msg == nil {
+			return nil, err
+		}
+		return []*MQMessage{msg}, nil
+	}
+	data := bytes.TrimSpace(b.data)
+	if len(data) == 0 {
+		return nil, nil
 	}
-	b.msg = msg
 	b.data = nil
-	if b.msg.Type == model.MqMessageTypeUnknown {
-		return model.MqMessageTypeUnknown, false, nil
+	if data[0] == '[' {
+		var msgs []*MQMessage
+		if err := jsonMarshaler.Unmarshal(data, &msgs); err != nil {
+			return nil, err
+		}
+		return msgs, nil
+	}
+	msg := &MQMessage{}
+	if err := jsonMarshaler.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return []*MQMessage{msg}, nil
+}
+
+// enqueue decompresses the messages and appends them to the pending ones, the row messages whose values are
+// JSON arrays are unpacked into one message per element, and the messages of the unknown type, e.g. heartbeats, are skipped.
+func (b *CanalFlatEventBatchDecoder) enqueue(msgs []*MQMessage) error {
+	for _, msg := range msgs {
+		if msg == nil || msg.Type == model.MqMessageTypeUnknown {
+			continue
+		}
+		value, err := decompressCanalFlatValue(b.compression, msg.Value)
+		if err != nil {
+			return err
+		}
+		msg.Value = value
+		if msg.Type != model.MqMessageTypeRow || !bytes.HasPrefix(bytes.TrimSpace(value), []byte{'['}) {
+			b.pending = append(b.pending, msg)
+			continue
+		}
+		var elems []json.RawMessage
+		if err := json.Unmarshal(value, &elems); err != nil {
+			return cerrors.WrapError(cerrors.ErrCanalDecodeFailed, err)
+		}
+		for _, elem := range elems {
+			unpacked := *msg
+			unpacked.Value = elem
+			b.pending = append(b.pending, &unpacked)
+		}
+	}
+	return nil
+}
+
+// nextFromStream reads the next message from the stream, heartbeats are skipped. It returns nil at the end of the stream.
+func (b *CanalFlatEventBatchDecoder) nextFromStream() (*MQMessage, error) {
+	for {
+		msg := &MQMessage{}
+		if err := b.stream.Decode(msg); err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, errors.Trace(err)
+		}
+		if msg.Type != model.MqMessageTypeUnknown {
+			return msg, nil
+		}
 	}
-	return b.msg.Type, true, nil
 }
 
 // NextRowChangedEvent implements the EventBatchDecoder interface
 // `HasNext` should be called before this.
-func (b *CanalFlatEventBatchDecoder) NextRowChangedEvent() (*model.RowChangedEvent, error) {
+func (b *CanalFlatEventBatchDecoder) NextRowChangedEvent() (event *model.RowChangedEvent, err error) {
+	defer func() { b.countDecoded(err, &b.stats.Rows) }()
 	if b.msg == nil || b.msg.Type != model.MqMessageTypeRow {
 		return nil, cerrors.ErrCanalDecodeFailed.GenWithStack("not found row changed event message")
 	}
@@ -415,16 +2401,188 @@ func (b *CanalFlatEventBatchDecoder) NextRowChangedEvent() (*model.RowChangedEve
 		data = &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}, Extensions: &tidbExtension{}}
 	}
 
-	if err := json.Unmarshal(b.msg.Value, data); err != nil {
+	// the columns are counted before unmarshalled, so the oversized rows are rejected without allocating them,
+	// the CBOR envelope is only checked after unmarshalled, see `canalFlatMessage2RowChangedEvent`.
+	if !bytes.HasPrefix(b.msg.Value, cborMarker) {
+		if err := checkCanalFlatColumnCount(b.msg.Value, b.maxColumns); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.unmarshal(b.msg.Value, data); err != nil {
 		return nil, errors.Trace(err)
 	}
+	if pk := data.getPrimaryKey(); len(b.msg.Key) > 0 && pk != nil {
+		if b.primaryKeys == nil {
+			b.primaryKeys = make(map[string]map[string]string)
+		}
+		b.primaryKeys[string(b.msg.Key)] = pk
+	}
 	b.msg = nil
-	return canalFlatMessage2RowChangedEvent(data)
+	b.setEventTimes(data)
+	if b.onlyUpdatedColumns && data.getEventType() == canal.EventType_UPDATE.String() {
+		// the unchanged columns are restored from the new row.
+		if old := data.getOld(); old != nil {
+			for name, value := range data.getData() {
+				if _, ok := old[name]; !ok {
+					old[name] = value
+				}
+			}
+		}
+	}
+	row, err := canalFlatMessage2RowChangedEvent(data, b.maxColumns)
+	if err != nil {
+		return nil, err
+	}
+	row.CommitTs = b.commitTsOrFromExecutionTime(row.CommitTs)
+	if b.lowercaseColumnNames {
+		if err := lowercaseColumnNames(row.Columns); err != nil {
+			return nil, err
+		}
+		if err := lowercaseColumnNames(row.PreColumns); err != nil {
+			return nil, err
+		}
+	}
+	if b.schema != nil {
+		if row.Columns, err = b.enforceSchema(row.Columns); err != nil {
+			return nil, err
+		}
+		if row.PreColumns, err = b.enforceSchema(row.PreColumns); err != nil {
+			return nil, err
+		}
+	}
+	if b.floatAsString {
+		if err := parseFloatColumns(row.Columns); err != nil {
+			return nil, err
+		}
+		if err := parseFloatColumns(row.PreColumns); err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
+// parseFloatColumns parses the values of FLOAT and DOUBLE columns into float32 and float64 respectively.
+func parseFloatColumns(cols []*model.Column) error {
+	for _, col := range cols {
+		value, ok := col.Value.(string)
+		if !ok {
+			continue
+		}
+		switch col.Type {
+		case mysql.TypeFloat:
+			f, err := strconv.ParseFloat(value, 32)
+			if err != nil {
+				return cerrors.WrapError(cerrors.ErrCanalDecodeFailed, err)
+			}
+			col.Value = float32(f)
+		case mysql.TypeDouble:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return cerrors.WrapError(cerrors.ErrCanalDecodeFailed, err)
+			}
+			col.Value = f
+		}
+	}
+	return nil
+}
+
+// enforceSchema validates and coerces the decoded columns against the schema, see `DecodeWithSchema`.
+func (b *CanalFlatEventBatchDecoder) enforceSchema(cols []*model.Column) ([]*model.Column, error) {
+	if cols == nil {
+		return nil, nil
+	}
+	decoded := make(map[string]struct{}, len(cols))
+	for _, col := range cols {
+		colInfo := timodel.FindColumnInfo(b.schema.Columns, strings.ToLower(col.Name))
+		if colInfo == nil {
+			return nil, cerrors.ErrCanalDecodeFailed.GenWithStack(
+				"unexpected column %s, which is not in table %s", col.Name, b.schema.Name.O)
+		}
+		decoded[colInfo.Name.L] = struct{}{}
+		if col.Type != colInfo.Tp {
+			if !b.coerceTypes {
+				return nil, cerrors.ErrCanalDecodeFailed.GenWithStack(
+					"column %s is %s, but it's %s in table %s",
+					col.Name, types.TypeStr(col.Type), types.TypeStr(colInfo.Tp), b.schema.Name.O)
+			}
+			if err := coerceColumn(col, colInfo.Tp); err != nil {
+				return nil, err
+			}
+		}
+		if err := decodeEnumSetColumn(col, colInfo); err != nil {
+			return nil, err
+		}
+	}
+	for _, colInfo := range b.schema.Columns {
+		if _, ok := decoded[colInfo.Name.L]; ok {
+			continue
+		}
+		col := &model.Column{Name: colInfo.Name.O, Type: colInfo.Tp}
+		if def := colInfo.GetDefaultValue(); def != nil {
+			// values are decoded as strings, see `decodeCanalJSONColumn`.
+			col.Value = fmt.Sprint(def)
+		}
+		if err := decodeEnumSetColumn(col, colInfo); err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	// in the same order as `canalFlatJSONColumnMap2SinkColumns`.
+	sort.Slice(cols, func(i, j int) bool {
+		return cols[i].Name < cols[j].Name
+	})
+	return cols, nil
+}
+
+// decodeEnumSetColumn reconstructs the numeric value of the SET or ENUM column as the mounter does,
+// the value may be either the string representation or the numeric one, see `SetTableInfo` of the encoder.
+func decodeEnumSetColumn(col *model.Column, colInfo *timodel.ColumnInfo) error {
+	value, ok := col.Value.(string)
+	if !ok {
+		return nil
+	}
+	switch colInfo.Tp {
+	case mysql.TypeEnum:
+		enum, err := tidbtypes.ParseEnumName(colInfo.Elems, value, colInfo.Collate)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrCanalDecodeFailed, err)
+		}
+		col.Value = enum.Value
+	case mysql.TypeSet:
+		set, err := tidbtypes.ParseSetName(colInfo.Elems, value, colInfo.Collate)
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrCanalDecodeFailed, err)
+		}
+		col.Value = set.Value
+	}
+	return nil
+}
+
+// coerceColumn converts the decoded column to the type, all values are decoded as strings except `BIT`.
+func coerceColumn(col *model.Column, tp byte) error {
+	col.Type = tp
+	switch v := col.Value.(type) {
+	case uint64:
+		if tp != mysql.TypeBit {
+			col.Value = strconv.FormatUint(v, 10)
+		}
+	case string:
+		if tp == mysql.TypeBit {
+			number, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return cerrors.ErrCanalDecodeFailed.GenWithStack(
+					"cannot coerce value %s of column %s to bit", v, col.Name)
+			}
+			col.Value = number
+		}
+	}
+	return nil
 }
 
 // NextDDLEvent implements the EventBatchDecoder interface
 // `HasNext` should be called before this.
-func (b *CanalFlatEventBatchDecoder) NextDDLEvent() (*model.DDLEvent, error) {
+func (b *CanalFlatEventBatchDecoder) NextDDLEvent() (event *model.DDLEvent, err error) {
+	defer func() { b.countDecoded(err, &b.stats.DDLs) }()
 	if b.msg == nil || b.msg.Type != model.MqMessageTypeDDL {
 		return nil, cerrors.ErrCanalDecodeFailed.GenWithStack("not found ddl event message")
 	}
@@ -434,16 +2592,22 @@ func (b *CanalFlatEventBatchDecoder) NextDDLEvent() (*model.DDLEvent, error) {
 		data = &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}, Extensions: &tidbExtension{}}
 	}
 
-	if err := json.Unmarshal(b.msg.Value, data); err != nil {
+	if err := b.unmarshal(b.msg.Value, data); err != nil {
 		return nil, errors.Trace(err)
 	}
 	b.msg = nil
-	return canalFlatMessage2DDLEvent(data), nil
+	b.setEventTimes(data)
+	ddl := canalFlatMessage2DDLEvent(data)
+	ddl.CommitTs = b.commitTsOrFromExecutionTime(ddl.CommitTs)
+	return ddl, nil
 }
 
 // NextResolvedEvent implements the EventBatchDecoder interface
+// It returns `watermarkTs` of the TiDB extension if present, otherwise the ts is reconstructed from `es` of the
+// plain watermark, whose logical time is lost, so it may be a little less than the checkpoint emitted.
 // `HasNext` should be called before this.
-func (b *CanalFlatEventBatchDecoder) NextResolvedEvent() (uint64, error) {
+func (b *CanalFlatEventBatchDecoder) NextResolvedEvent() (ts uint64, err error) {
+	defer func() { b.countDecoded(err, &b.stats.Resolved) }()
 	if b.msg == nil || b.msg.Type != model.MqMessageTypeResolved {
 		return 0, cerrors.ErrCanalDecodeFailed.GenWithStack("not found resolved event message")
 	}
@@ -451,35 +2615,243 @@ func (b *CanalFlatEventBatchDecoder) NextResolvedEvent() (uint64, error) {
 	message := &canalFlatMessageWithTiDBExtension{
 		canalFlatMessage: &canalFlatMessage{},
 	}
-	if err := json.Unmarshal(b.msg.Value, message); err != nil {
+	if err := b.unmarshal(b.msg.Value, message); err != nil {
 		return 0, errors.Trace(err)
 	}
 	b.msg = nil
-	return message.Extensions.WatermarkTs, nil
+	if message.Extensions != nil && message.Extensions.WatermarkTs != 0 {
+		return message.Extensions.WatermarkTs, nil
+	}
+	// the watermark emitted without the TiDB extension only carries the physical time in `es`,
+	// see `plain-watermark` of the encoder.
+	if message.EventType == tidbWaterMarkType && message.ExecutionTime > 0 {
+		return oracle.ComposeTS(message.ExecutionTime+b.epochOffsetMs, 0), nil
+	}
+	return 0, nil
+}
+
+// CanalFlatEventHandlers are the callbacks invoked by `DecodeAll` for the decoded events,
+// events are decoded and dropped if the handlers of their types are nil.
+type CanalFlatEventHandlers struct {
+	OnRow      func(event *model.RowChangedEvent) error
+	OnDDL      func(event *model.DDLEvent) error
+	OnResolved func(ts uint64) error
+}
+
+// DecodeAll decodes all the remaining events and pushes them to the handlers of their types,
+// it stops on the first error returned by the decoding or the handlers.
+func (b *CanalFlatEventBatchDecoder) DecodeAll(handlers CanalFlatEventHandlers) error {
+	for {
+		tp, hasNext, err := b.HasNext()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if !hasNext {
+			return nil
+		}
+		switch tp {
+		case model.MqMessageTypeRow:
+			event, err := b.NextRowChangedEvent()
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if handlers.OnRow != nil {
+				if err := handlers.OnRow(event); err != nil {
+					return errors.Trace(err)
+				}
+			}
+		case model.MqMessageTypeDDL:
+			event, err := b.NextDDLEvent()
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if handlers.OnDDL != nil {
+				if err := handlers.OnDDL(event); err != nil {
+					return errors.Trace(err)
+				}
+			}
+		case model.MqMessageTypeResolved:
+			ts, err := b.NextResolvedEvent()
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if handlers.OnResolved != nil {
+				if err := handlers.OnResolved(ts); err != nil {
+					return errors.Trace(err)
+				}
+			}
+		default:
+			return cerrors.ErrCanalDecodeFailed.GenWithStack("unknown message type %d", tp)
+		}
+	}
+}
+
+// checkCanalFlatColumnCount scans the JSON value of a row message and rejects it if any of `data`, `old`, `mysqlType`
+// and `sqlType` has more than `maxColumns` columns. It's done on the raw bytes without allocating the objects.
+func checkCanalFlatColumnCount(value []byte, maxColumns int) error {
+	type frame struct {
+		// for an object, whether its members are columns; for an array, whether its elements are.
+		columns bool
+		array   bool
+		count   int
+		// the key of the last member of an object.
+		key []byte
+	}
+	var (
+		frames                 []frame
+		inString, escaped      bool
+		stringStart, stringEnd int
+	)
+	for i, ch := range value {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case ch == '\\':
+				escaped = true
+			case ch == '"':
+				inString, stringEnd = false, i
+			}
+			continue
+		}
+		switch ch {
+		case '"':
+			inString, stringStart = true, i+1
+		case ':':
+			if len(frames) > 0 && !frames[len(frames)-1].array {
+				top := &frames[len(frames)-1]
+				top.key = value[stringStart:stringEnd]
+				if top.columns {
+					top.count++
+				}
+			}
+		case '{', '[':
+			f := frame{array: ch == '['}
+			if len(frames) > 0 {
+				parent := frames[len(frames)-1]
+				switch {
+				case parent.array:
+					f.columns = parent.columns && !f.array
+				case f.array:
+					f.columns = bytes.Equal(parent.key, []byte("data")) || bytes.Equal(parent.key, []byte("old"))
+				default:
+					f.columns = bytes.Equal(parent.key, []byte("mysqlType")) || bytes.Equal(parent.key, []byte("sqlType"))
+				}
+			}
+			frames = append(frames, f)
+		case '}', ']':
+			if len(frames) == 0 {
+				// the malformed value is left to the unmarshaler to report.
+				return nil
+			}
+			if n := frames[len(frames)-1].count; n > maxColumns {
+				return cerrors.ErrCanalDecodeFailed.GenWithStack(
+					"too many columns, count: %d, max-columns: %d", n, maxColumns)
+			}
+			frames = frames[:len(frames)-1]
+		}
+	}
+	return nil
 }
 
-func canalFlatMessage2RowChangedEvent(flatMessage canalFlatMessageInterface) (*model.RowChangedEvent, error) {
+func canalFlatMessage2RowChangedEvent(flatMessage canalFlatMessageInterface, maxColumns int) (*model.RowChangedEvent, error) {
 	result := new(model.RowChangedEvent)
 	result.CommitTs = flatMessage.getCommitTs()
+	result.TableInfoVersion = flatMessage.getSchemaVersion()
 	result.Table = &model.TableName{
 		Schema: *flatMessage.getSchema(),
 		Table:  *flatMessage.getTable(),
 	}
 
+	mysqlType, javaSQLType := flatMessage.getMySQLType(), flatMessage.getJavaSQLType()
+	var flags map[string]model.ColumnFlagType
+	if schema := flatMessage.getColumnSchema(); len(schema) > 0 {
+		// the inline schema takes precedence, see `inline-schema` of the encoder.
+		mysqlType = make(map[string]string, len(schema))
+		javaSQLType = make(map[string]int32, len(schema))
+		flags = make(map[string]model.ColumnFlagType, len(schema))
+		for _, col := range schema {
+			mysqlType[col.Name] = col.MySQLType
+			javaSQLType[col.Name] = col.SQLType
+			flags[col.Name] = col.Flag
+		}
+	}
+
+	for _, n := range []int{len(flatMessage.getData()), len(flatMessage.getOld()), len(mysqlType)} {
+		if n > maxColumns {
+			return nil, cerrors.ErrCanalDecodeFailed.GenWithStack(
+				"too many columns, count: %d, max-columns: %d", n, maxColumns)
+		}
+	}
+
 	var err error
-	result.Columns, err = canalFlatJSONColumnMap2SinkColumns(flatMessage.getData(), flatMessage.getMySQLType(), flatMessage.getJavaSQLType())
+	result.RowID, err = extractRowID(flatMessage, mysqlType, javaSQLType)
+	if err != nil {
+		return nil, err
+	}
+	result.Columns, err = canalFlatJSONColumnMap2SinkColumns(flatMessage.getData(), mysqlType, javaSQLType, flatMessage.getPKNames())
 	if err != nil {
 		return nil, err
 	}
-	result.PreColumns, err = canalFlatJSONColumnMap2SinkColumns(flatMessage.getOld(), flatMessage.getMySQLType(), flatMessage.getJavaSQLType())
+	result.PreColumns, err = canalFlatJSONColumnMap2SinkColumns(flatMessage.getOld(), mysqlType, javaSQLType, flatMessage.getPKNames())
 	if err != nil {
 		return nil, err
 	}
+	for _, cols := range [][]*model.Column{result.Columns, result.PreColumns} {
+		for _, col := range cols {
+			col.Flag |= flags[col.Name]
+		}
+	}
+	if flatMessage.getEventType() == canal.EventType_DELETE.String() {
+		// the deleted row is carried by `data`, see `newFlatMessageForDML`.
+		result.PreColumns, result.Columns = result.Columns, nil
+	}
 
 	return result, nil
 }
 
-func canalFlatJSONColumnMap2SinkColumns(cols map[string]interface{}, mysqlType map[string]string, javaSQLType map[string]int32) ([]*model.Column, error) {
+// extractRowID removes the implicit `_tidb_rowid` emitted by `emit-row-id` from the rows and the types
+// of the message and returns its value, it's 0 if absent.
+func extractRowID(flatMessage canalFlatMessageInterface, mysqlType map[string]string, javaSQLType map[string]int32) (int64, error) {
+	name := timodel.ExtraHandleName.O
+	if _, ok := mysqlType[name]; !ok {
+		return 0, nil
+	}
+	delete(mysqlType, name)
+	delete(javaSQLType, name)
+
+	var rowID int64
+	for _, row := range []map[string]interface{}{flatMessage.getOld(), flatMessage.getData()} {
+		value, ok := row[name]
+		if !ok {
+			continue
+		}
+		delete(row, name)
+		s, ok := value.(string)
+		if !ok {
+			return 0, cerrors.ErrCanalDecodeFailed.GenWithStack("invalid %s: %v", name, value)
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, cerrors.WrapError(cerrors.ErrCanalDecodeFailed, err)
+		}
+		rowID = id
+	}
+	return rowID, nil
+}
+
+// canalFlatJSONColumnMap2SinkColumns decodes the columns of a row, the columns in `pkNames` are flagged as
+// both the handle key and the primary key, so the decoded row can be located by them, e.g. a DELETE emitted
+// with `delete-key-only` of the encoder.
+func canalFlatJSONColumnMap2SinkColumns(cols map[string]interface{}, mysqlType map[string]string, javaSQLType map[string]int32, pkNames []string) ([]*model.Column, error) {
+	if cols == nil {
+		// the row is absent, e.g. `old` of an INSERT, keep it nil so that `IsInsert` and `IsDelete` work.
+		return nil, nil
+	}
+	pks := make(map[string]struct{}, len(pkNames))
+	for _, name := range pkNames {
+		pks[name] = struct{}{}
+	}
 	result := make([]*model.Column, 0, len(cols))
 	for name, value := range cols {
 		javaType, ok := javaSQLType[name]
@@ -496,18 +2868,61 @@ func canalFlatJSONColumnMap2SinkColumns(cols map[string]interface{}, mysqlType m
 		}
 		mysqlTypeStr = trimUnsignedFromMySQLType(mysqlTypeStr)
 		mysqlType := types.StrToType(mysqlTypeStr)
-		col := newColumn(value, mysqlType).decodeCanalJSONColumn(name, JavaSQLType(javaType))
+		col, err := newColumn(value, mysqlType).decodeCanalJSONColumn(name, JavaSQLType(javaType))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, col)
+	}
+	// columns declared in `mysqlType` but absent from the row were omitted
+	// by the encoder because they are null, see `omit-nulls`.
+	for name, mysqlTypeStr := range mysqlType {
+		if _, ok := cols[name]; ok {
+			continue
+		}
+		mysqlType := types.StrToType(trimUnsignedFromMySQLType(mysqlTypeStr))
+		col, err := newColumn(nil, mysqlType).decodeCanalJSONColumn(name, JavaSQLType(javaSQLType[name]))
+		if err != nil {
+			return nil, err
+		}
 		result = append(result, col)
 	}
 	if len(result) == 0 {
 		return nil, nil
 	}
+	for _, col := range result {
+		if _, ok := pks[col.Name]; ok {
+			col.Flag.SetIsHandleKey()
+			col.Flag.SetIsPrimaryKey()
+		}
+	}
+	// the columns are sorted by their names, which is the order they're emitted in by the encoder.
 	sort.Slice(result, func(i, j int) bool {
-		return strings.Compare(result[i].Name, result[j].Name) > 0
+		return result[i].Name < result[j].Name
 	})
 	return result, nil
 }
 
+// lowercaseColumnNames converts the column names to lowercase,
+// it returns an error if two columns have the same name after converted.
+func lowercaseColumnNames(cols []*model.Column) error {
+	names := make(map[string]string, len(cols))
+	for _, col := range cols {
+		name := strings.ToLower(col.Name)
+		if origin, ok := names[name]; ok {
+			return cerrors.ErrCanalDecodeFailed.GenWithStack(
+				"columns %s and %s have the same lowercase name", origin, col.Name)
+		}
+		names[name] = col.Name
+		col.Name = name
+	}
+	// in the same order as `canalFlatJSONColumnMap2SinkColumns`.
+	sort.Slice(cols, func(i, j int) bool {
+		return cols[i].Name < cols[j].Name
+	})
+	return nil
+}
+
 func canalFlatMessage2DDLEvent(flatDDL canalFlatMessageInterface) *model.DDLEvent {
 	result := new(model.DDLEvent)
 	// we lost the startTs from kafka message
@@ -517,8 +2932,32 @@ func canalFlatMessage2DDLEvent(flatDDL canalFlatMessageInterface) *model.DDLEven
 	result.TableInfo.Schema = *flatDDL.getSchema()
 	result.TableInfo.Table = *flatDDL.getTable()
 
-	// we lost DDL type from canal flat json format, only got the DDL SQL.
 	result.Query = flatDDL.getQuery()
+	result.Type = canalDDLEventType2Action(flatDDL.getEventType())
 
 	return result
 }
+
+// canalDDLEventType2Action maps the canal event type of a DDL back to a representative action of it,
+// as `convertDdlEventType` is lossy, consumers should only rely on the category of the action,
+// e.g. all ALTER TABLE are decoded as `ActionAddColumn`. It's `ActionNone` for QUERY and unknown event types.
+func canalDDLEventType2Action(eventType string) timodel.ActionType {
+	switch eventType {
+	case canal.EventType_CREATE.String():
+		return timodel.ActionCreateTable
+	case canal.EventType_RENAME.String():
+		return timodel.ActionRenameTable
+	case canal.EventType_CINDEX.String():
+		return timodel.ActionAddIndex
+	case canal.EventType_DINDEX.String():
+		return timodel.ActionDropIndex
+	case canal.EventType_ALTER.String():
+		return timodel.ActionAddColumn
+	case canal.EventType_ERASE.String():
+		return timodel.ActionDropTable
+	case canal.EventType_TRUNCATE.String():
+		return timodel.ActionTruncateTable
+	default:
+		return timodel.ActionNone
+	}
+}
@@ -14,12 +14,29 @@
 package codec
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
 	"github.com/pingcap/check"
+	"github.com/pingcap/errors"
 	mm "github.com/pingcap/tidb/parser/model"
+	"github.com/pingcap/tidb/parser/mysql"
+	"github.com/pingcap/tidb/parser/types"
 	"github.com/pingcap/tiflow/cdc/model"
 	"github.com/pingcap/tiflow/pkg/util/testleak"
+	"github.com/tikv/client-go/v2/oracle"
 	"golang.org/x/text/encoding/charmap"
 )
 
@@ -70,6 +87,61 @@ var testCaseDDL = &model.DDLEvent{
 	Type:  mm.ActionCreateTable,
 }
 
+// encodeCanalFlatRow encodes the row into one message by the encoder with the params.
+func encodeCanalFlatRow(c *check.C, params map[string]string, event *model.RowChangedEvent) *MQMessage {
+	encoder := NewCanalFlatEventBatchEncoder()
+	c.Assert(encoder.SetParams(params), check.IsNil)
+	c.Assert(encoder.AppendRowChangedEvent(event), check.IsNil)
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+	return msgs[0]
+}
+
+// newCanalFlatTestDecoder creates the decoder of the message, which is marshalled as the consumers receive it.
+func newCanalFlatTestDecoder(c *check.C, msg *MQMessage, enableTiDBExtension bool) *CanalFlatEventBatchDecoder {
+	rawBytes, err := json.Marshal(msg)
+	c.Assert(err, check.IsNil)
+	return newCanalFlatEventBatchDecoder(rawBytes, enableTiDBExtension).(*CanalFlatEventBatchDecoder)
+}
+
+// nextCanalFlatRow decodes the next event of the decoder, which must be a row.
+func nextCanalFlatRow(c *check.C, decoder EventBatchDecoder) (*model.RowChangedEvent, error) {
+	ty, hasNext, err := decoder.HasNext()
+	c.Assert(err, check.IsNil)
+	c.Assert(hasNext, check.IsTrue)
+	c.Assert(ty, check.Equals, model.MqMessageTypeRow)
+	return decoder.NextRowChangedEvent()
+}
+
+// decodeCanalFlatRow decodes the first row of the message.
+func decodeCanalFlatRow(c *check.C, msg *MQMessage, enableTiDBExtension bool) *model.RowChangedEvent {
+	row, err := nextCanalFlatRow(c, newCanalFlatTestDecoder(c, msg, enableTiDBExtension))
+	c.Assert(err, check.IsNil)
+	return row
+}
+
+// nextCanalFlatDDL decodes the next event of the decoder, which must be a DDL.
+func nextCanalFlatDDL(c *check.C, decoder EventBatchDecoder) (*model.DDLEvent, error) {
+	ty, hasNext, err := decoder.HasNext()
+	c.Assert(err, check.IsNil)
+	c.Assert(hasNext, check.IsTrue)
+	c.Assert(ty, check.Equals, model.MqMessageTypeDDL)
+	return decoder.NextDDLEvent()
+}
+
+// decodeCanalFlatDDL decodes the DDL of the message.
+func decodeCanalFlatDDL(c *check.C, msg *MQMessage, enableTiDBExtension bool) *model.DDLEvent {
+	ddl, err := nextCanalFlatDDL(c, newCanalFlatTestDecoder(c, msg, enableTiDBExtension))
+	c.Assert(err, check.IsNil)
+	return ddl
+}
+
+// encodeDecodeRow encodes the row by the encoder with the params and decodes it back,
+// the TiDB extension is decoded if it's enabled by the params.
+func encodeDecodeRow(c *check.C, params map[string]string, event *model.RowChangedEvent) *model.RowChangedEvent {
+	return decodeCanalFlatRow(c, encodeCanalFlatRow(c, params, event), params["enable-tidb-extension"] == "true")
+}
+
 func (s *canalFlatSuite) TestSetParams(c *check.C) {
 	defer testleak.AfterTest(c)()
 	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
@@ -183,14 +255,21 @@ func (s *canalFlatSuite) TestNewCanalFlatEventBatchDecoder4RowMessage(c *check.C
 			if encodeEnable && decodeEnable {
 				c.Assert(consumed.CommitTs, check.Equals, testCaseInsert.CommitTs)
 			} else {
-				c.Assert(consumed.CommitTs, check.Equals, uint64(0))
+				// reconstructed from `es` without the logical time.
+				c.Assert(consumed.CommitTs, check.Equals, oracle.ComposeTS(convertToCanalTs(testCaseInsert.CommitTs), 0))
 			}
 
 			for _, col := range consumed.Columns {
 				expected, ok := expectedDecodedValues[col.Name]
 				c.Assert(ok, check.IsTrue)
 
-				c.Assert(col.Value, check.Equals, expected)
+				if col.Type == mysql.TypeBit {
+					// `BIT` is decoded as `uint64`.
+					c.Assert(col.Value, check.FitsTypeOf, uint64(0))
+					c.Assert(fmt.Sprint(col.Value), check.Equals, expected)
+				} else {
+					c.Assert(col.Value, check.Equals, expected)
+				}
 				for _, item := range testCaseInsert.Columns {
 					if item.Name == col.Name {
 						c.Assert(col.Type, check.Equals, item.Type)
@@ -266,7 +345,8 @@ func (s *canalFlatSuite) TestNewCanalFlatEventBatchDecoder4DDLMessage(c *check.C
 			if encodeEnable && decodeEnable {
 				c.Assert(consumed.CommitTs, check.Equals, testCaseDDL.CommitTs)
 			} else {
-				c.Assert(consumed.CommitTs, check.Equals, uint64(0))
+				// reconstructed from `es` without the logical time.
+				c.Assert(consumed.CommitTs, check.Equals, oracle.ComposeTS(convertToCanalTs(testCaseDDL.CommitTs), 0))
 			}
 
 			c.Assert(consumed.TableInfo, check.DeepEquals, testCaseDDL.TableInfo)
@@ -443,3 +523,2684 @@ func (s *canalFlatSuite) TestDDLEventWithExtensionValueMarshal(c *check.C) {
 }`
 	c.Assert(string(rawBytes), check.Equals, expectedJSON)
 }
+
+func (s *canalFlatSuite) TestOmitNulls(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	columns := []*model.Column{
+		{Name: "id", Type: mysql.TypeLong, Flag: model.PrimaryKeyFlag | model.HandleKeyFlag, Value: nil},
+		{Name: "name", Type: mysql.TypeVarchar, Value: "tidb"},
+		{Name: "age", Type: mysql.TypeLong, Value: nil},
+		{Name: "email", Type: mysql.TypeVarchar, Value: nil},
+		{Name: "score", Type: mysql.TypeDouble, Value: nil},
+	}
+	event := &model.RowChangedEvent{
+		CommitTs:   417318403368288260,
+		Table:      &model.TableName{Schema: "cdc", Table: "person"},
+		Columns:    columns,
+		PreColumns: columns,
+	}
+	nullColumns := []string{"age", "email", "score"}
+
+	for _, omitNulls := range []bool{false, true} {
+		encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), omitNulls: omitNulls}
+		message, err := encoder.newFlatMessageForDML(event)
+		c.Assert(err, check.IsNil)
+
+		for _, row := range []map[string]interface{}{message.getData(), message.getOld()} {
+			// PK columns are never omitted.
+			value, ok := row["id"]
+			c.Assert(ok, check.IsTrue)
+			c.Assert(value, check.IsNil)
+			c.Assert(row["name"], check.Equals, "tidb")
+			for _, name := range nullColumns {
+				value, ok := row[name]
+				c.Assert(ok, check.Equals, !omitNulls)
+				c.Assert(value, check.IsNil)
+			}
+		}
+		c.Assert(message.getMySQLType(), check.HasLen, len(columns))
+
+		consumed := encodeDecodeRow(c, map[string]string{"omit-nulls": strconv.FormatBool(omitNulls)}, event)
+
+		// absent-but-declared columns are decoded as null.
+		for _, cols := range [][]*model.Column{consumed.Columns, consumed.PreColumns} {
+			c.Assert(cols, check.HasLen, len(columns))
+			for _, col := range cols {
+				if col.Name == "name" {
+					c.Assert(col.Value, check.Equals, "tidb")
+				} else {
+					c.Assert(col.Value, check.IsNil)
+				}
+			}
+		}
+	}
+}
+
+func (s *canalFlatSuite) TestDecoderMaxColumns(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	newRow := func(columnCount int) *model.RowChangedEvent {
+		columns := make([]*model.Column, 0, columnCount)
+		for i := 0; i < columnCount; i++ {
+			columns = append(columns, &model.Column{Name: fmt.Sprintf("c%d", i), Type: mysql.TypeLong, Value: int64(i)})
+		}
+		return &model.RowChangedEvent{
+			CommitTs: 417318403368288260,
+			Table:    &model.TableName{Schema: "cdc", Table: "person"},
+			Columns:  columns,
+		}
+	}
+
+	msg := encodeCanalFlatRow(c, nil, newRow(5))
+	decoder := newCanalFlatTestDecoder(c, msg, false)
+	decoder.SetMaxColumns(5)
+	row, err := nextCanalFlatRow(c, decoder)
+	c.Assert(err, check.IsNil)
+	c.Assert(row.Columns, check.HasLen, 5)
+	decoder = newCanalFlatTestDecoder(c, msg, false)
+	decoder.SetMaxColumns(4)
+	_, err = nextCanalFlatRow(c, decoder)
+	c.Assert(err, check.ErrorMatches, ".*too many columns, count: 5, max-columns: 4.*")
+
+	// the default limit.
+	_, err = nextCanalFlatRow(c, newCanalFlatTestDecoder(c, encodeCanalFlatRow(c, nil, newRow(defaultCanalFlatDecoderMaxColumns+1)), false))
+	c.Assert(err, check.ErrorMatches, fmt.Sprintf(".*too many columns, count: %d, max-columns: %d.*",
+		defaultCanalFlatDecoderMaxColumns+1, defaultCanalFlatDecoderMaxColumns))
+}
+
+func (s *canalFlatSuite) TestCheckCanalFlatColumnCount(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	for _, tc := range []struct {
+		value string
+		count int
+	}{
+		// only the columns are counted, not the fields of the message or the extension.
+		{`{"id":0,"database":"a","table":"b","pkNames":null,"isDdl":false,"type":"INSERT","_tidb":{"commitTs":1,"schemaVersion":2,"producerTs":3}}`, 0},
+		{`{"sqlType":{"a":4,"b":4},"mysqlType":{"a":"int","b":"int"},"data":[{"a":"1","b":"2"}],"old":null}`, 2},
+		{`{"data":[{"a":"1"},{"a":"1","b":"{\"x\":1,\"y\":2,\"z\":3}","c":null}]}`, 3},
+		{`{"old":[{"a":"1","b":"2","c":"3","d":"4"}]}`, 4},
+		{`{"mysqlType":{"a":"int","b":"int","c":"int"}}`, 3},
+		// the values under the other keys are not columns.
+		{`{"columnSchema":[{"name":"a","sqlType":4,"mysqlType":"int","flag":0}],"extra":{"a":1,"b":2,"c":3}}`, 0},
+		// the wrapper key.
+		{`{"payload":{"data":[{"a":"1","b":"2"}]}}`, 2},
+	} {
+		c.Assert(checkCanalFlatColumnCount([]byte(tc.value), tc.count), check.IsNil, check.Commentf("%s", tc.value))
+		if tc.count > 0 {
+			err := checkCanalFlatColumnCount([]byte(tc.value), tc.count-1)
+			c.Assert(err, check.ErrorMatches, fmt.Sprintf(".*too many columns, count: %d, max-columns: %d.*", tc.count, tc.count-1))
+		}
+	}
+
+	// malformed values are left to the unmarshaler.
+	c.Assert(checkCanalFlatColumnCount([]byte(`}}{"data":[`), 0), check.IsNil)
+}
+
+func canalFlatMessagesForMarshalerTest() []interface{} {
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), enableTiDBExtension: true}
+	messages := make([]interface{}, 0, 5)
+	for _, e := range []*model.RowChangedEvent{testCaseInsert, testCaseUpdate, testCaseDelete} {
+		message, err := encoder.newFlatMessageForDML(e)
+		if err != nil {
+			panic(err)
+		}
+		messages = append(messages, message)
+	}
+	messages = append(messages, encoder.newFlatMessageForDDL(testCaseDDL), encoder.newFlatMessage4CheckpointEvent(417318403368288260))
+	return messages
+}
+
+func (s *canalFlatSuite) TestJSONMarshaler(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer SetJSONMarshaler(nil)
+
+	c.Assert(jsonMarshaler, check.Equals, StdJSONMarshaler)
+	for _, message := range canalFlatMessagesForMarshalerTest() {
+		expected, err := json.Marshal(message)
+		c.Assert(err, check.IsNil)
+		for _, m := range []JSONMarshaler{StdJSONMarshaler, JSONIterMarshaler} {
+			obtained, err := m.Marshal(message)
+			c.Assert(err, check.IsNil)
+			c.Assert(string(obtained), check.Equals, string(expected))
+		}
+	}
+
+	// the decoder works with jsoniter too.
+	SetJSONMarshaler(JSONIterMarshaler)
+	row := encodeDecodeRow(c, map[string]string{"enable-tidb-extension": "true"}, testCaseUpdate)
+	c.Assert(row.CommitTs, check.Equals, testCaseUpdate.CommitTs)
+	c.Assert(row.Columns, check.HasLen, len(testCaseUpdate.Columns))
+}
+
+func benchmarkCanalFlatMarshaler(b *testing.B, m JSONMarshaler) {
+	messages := canalFlatMessagesForMarshalerTest()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, message := range messages {
+			if _, err := m.Marshal(message); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+func BenchmarkCanalFlatStdJSONMarshaler(b *testing.B) {
+	benchmarkCanalFlatMarshaler(b, StdJSONMarshaler)
+}
+
+func BenchmarkCanalFlatJSONIterMarshaler(b *testing.B) {
+	benchmarkCanalFlatMarshaler(b, JSONIterMarshaler)
+}
+
+func (s *canalFlatSuite) TestDecoderLowercaseColumnNames(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	decodeRow := func(columns []*model.Column) (*model.RowChangedEvent, error) {
+		decoder := newCanalFlatTestDecoder(c, encodeCanalFlatRow(c, nil, &model.RowChangedEvent{
+			CommitTs:   417318403368288260,
+			Table:      &model.TableName{Schema: "cdc", Table: "person"},
+			Columns:    columns,
+			PreColumns: columns,
+		}), false)
+		decoder.SetLowercaseColumnNames(true)
+		return nextCanalFlatRow(c, decoder)
+	}
+
+	_, err := decodeRow([]*model.Column{
+		{Name: "Col", Type: mysql.TypeLong, Value: int64(1)},
+		{Name: "col", Type: mysql.TypeLong, Value: int64(2)},
+	})
+	c.Assert(err, check.ErrorMatches, ".*columns col and Col have the same lowercase name.*")
+
+	row, err := decodeRow([]*model.Column{
+		{Name: "ID", Type: mysql.TypeLong, Flag: model.PrimaryKeyFlag | model.HandleKeyFlag, Value: int64(1)},
+		{Name: "UserName", Type: mysql.TypeVarchar, Value: "tidb"},
+		{Name: "age", Type: mysql.TypeLong, Value: int64(18)},
+	})
+	c.Assert(err, check.IsNil)
+	for _, cols := range [][]*model.Column{row.Columns, row.PreColumns} {
+		names := make([]string, 0, len(cols))
+		for _, col := range cols {
+			names = append(names, col.Name)
+		}
+		c.Assert(names, check.DeepEquals, []string{"age", "id", "username"})
+	}
+}
+
+func (s *canalFlatSuite) TestBitColumnRoundTrip(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	testCases := []struct {
+		name     string
+		value    interface{}
+		expected uint64
+	}{
+		// BIT(8)
+		{name: "bit8", value: uint64(0xa5), expected: 0xa5},
+		{name: "bit8_bytes", value: []byte{0xff}, expected: 0xff},
+		// BIT(64)
+		{name: "bit64", value: uint64(math.MaxUint64), expected: math.MaxUint64},
+		{name: "bit64_bytes", value: []byte{0x80, 0, 0, 0, 0, 0, 0, 0x01}, expected: 1<<63 | 1},
+	}
+	columns := make([]*model.Column, 0, len(testCases))
+	for _, tc := range testCases {
+		columns = append(columns, &model.Column{
+			Name: tc.name, Type: mysql.TypeBit, Flag: model.UnsignedFlag | model.BinaryFlag, Value: tc.value,
+		})
+	}
+
+	msg := encodeCanalFlatRow(c, nil, &model.RowChangedEvent{
+		CommitTs: 417318403368288260,
+		Table:    &model.TableName{Schema: "cdc", Table: "person"},
+		Columns:  columns,
+	})
+
+	var message canalFlatMessage
+	c.Assert(json.Unmarshal(msg.Value, &message), check.IsNil)
+	for _, tc := range testCases {
+		c.Assert(message.Data[0][tc.name], check.Equals, strconv.FormatUint(tc.expected, 10))
+		c.Assert(message.MySQLType[tc.name], check.Equals, "bit")
+	}
+
+	row := decodeCanalFlatRow(c, msg, false)
+	c.Assert(row.Columns, check.HasLen, len(testCases))
+	for _, col := range row.Columns {
+		c.Assert(col.Type, check.Equals, mysql.TypeBit)
+		for _, tc := range testCases {
+			if tc.name == col.Name {
+				c.Assert(col.Value, check.Equals, tc.expected)
+			}
+		}
+	}
+
+	// an invalid `BIT` value fails the decoding instead of panicking.
+	_, err := canalFlatJSONColumnMap2SinkColumns(map[string]interface{}{"bit8": "0xff"},
+		map[string]string{"bit8": "bit"}, map[string]int32{"bit8": int32(JavaSQLTypeBIT)}, nil)
+	c.Assert(err, check.ErrorMatches, ".*ErrCanalDecodeFailed.*")
+}
+
+func (s *canalFlatSuite) TestDecodeNonStringColumn(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	// the values which are neither strings nor numbers fail the decoding instead of panicking,
+	// e.g. the ones unmarshalled by a custom JSON marshaler.
+	for _, value := range []interface{}{true, float64(1.5)} {
+		_, err := canalFlatJSONColumnMap2SinkColumns(map[string]interface{}{"name": value},
+			map[string]string{"name": "varchar"}, map[string]int32{"name": int32(JavaSQLTypeVARCHAR)}, nil)
+		c.Assert(err, check.ErrorMatches, fmt.Sprintf(".*value of column name should be a string, but it's %T.*", value))
+	}
+}
+
+func (s *canalFlatSuite) TestSchemaVersion(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), enableTiDBExtension: true}
+	decodeVersion := func() uint64 {
+		c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+		msgs := encoder.Build()
+		c.Assert(msgs, check.HasLen, 1)
+		return decodeCanalFlatRow(c, msgs[0], true).TableInfoVersion
+	}
+
+	// no DDL has been seen for the table yet.
+	c.Assert(decodeVersion(), check.Equals, uint64(0))
+
+	for i := uint64(1); i <= 3; i++ {
+		msg, err := encoder.EncodeDDLEvent(testCaseDDL)
+		c.Assert(err, check.IsNil)
+		flatMsg := &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}}
+		c.Assert(json.Unmarshal(msg.Value, flatMsg), check.IsNil)
+		c.Assert(flatMsg.Extensions.SchemaVersion, check.Equals, i)
+		c.Assert(decodeVersion(), check.Equals, i)
+		c.Assert(decodeVersion(), check.Equals, i)
+	}
+
+	// DDLs on other tables do not change the version.
+	_, err := encoder.EncodeDDLEvent(&model.DDLEvent{
+		CommitTs:  417318403368288260,
+		TableInfo: &model.SimpleTableInfo{Schema: "cdc", Table: "person2"},
+		Query:     "create table person2(id int primary key)",
+		Type:      mm.ActionCreateTable,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(decodeVersion(), check.Equals, uint64(3))
+
+	// the version is lost without the TiDB extension.
+	encoder.enableTiDBExtension = false
+	c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+	msgs := encoder.Build()
+	var message map[string]interface{}
+	c.Assert(json.Unmarshal(msgs[0].Value, &message), check.IsNil)
+	c.Assert(message, check.Not(check.HasKey), "_tidb")
+}
+
+func (s *canalFlatSuite) TestSchemaVersionSharedByBuilder(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	// as the MQ sink does, each DDL is encoded by a new encoder, and the rows by the encoders of the partitions.
+	builder := newCanalFlatEventBatchEncoderBuilder(map[string]string{"enable-tidb-extension": "true"})
+	rowEncoder, err := builder.Build(context.Background())
+	c.Assert(err, check.IsNil)
+	versionOf := func(msg *MQMessage) uint64 {
+		message := &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}, Extensions: &tidbExtension{}}
+		c.Assert(json.Unmarshal(msg.Value, message), check.IsNil)
+		return message.Extensions.SchemaVersion
+	}
+
+	for i := uint64(1); i <= 3; i++ {
+		ddlEncoder, err := builder.Build(context.Background())
+		c.Assert(err, check.IsNil)
+		msg, err := ddlEncoder.EncodeDDLEvent(testCaseDDL)
+		c.Assert(err, check.IsNil)
+		c.Assert(versionOf(msg), check.Equals, i)
+
+		c.Assert(rowEncoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+		msgs, err := BuildEventBatch(rowEncoder)
+		c.Assert(err, check.IsNil)
+		c.Assert(msgs, check.HasLen, 1)
+		c.Assert(versionOf(msgs[0]), check.Equals, i)
+	}
+
+	// the encoders built by another builder, e.g. of another changefeed, have their own versions.
+	encoder, err := newCanalFlatEventBatchEncoderBuilder(map[string]string{"enable-tidb-extension": "true"}).Build(context.Background())
+	c.Assert(err, check.IsNil)
+	msg, err := encoder.EncodeDDLEvent(testCaseDDL)
+	c.Assert(err, check.IsNil)
+	c.Assert(versionOf(msg), check.Equals, uint64(1))
+}
+
+func (s *canalFlatSuite) TestDDLSchemaChange(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	preTableInfo := &model.SimpleTableInfo{
+		Schema: "cdc", Table: "person",
+		ColumnInfo: []*model.ColumnInfo{
+			{Name: "id", Type: mysql.TypeLong},
+			{Name: "name", Type: mysql.TypeVarchar},
+			{Name: "comment", Type: mysql.TypeBlob},
+		},
+	}
+	ddl := &model.DDLEvent{
+		CommitTs:     417318403368288260,
+		PreTableInfo: preTableInfo,
+		TableInfo: &model.SimpleTableInfo{
+			Schema: "cdc", Table: "person",
+			ColumnInfo: []*model.ColumnInfo{
+				{Name: "id", Type: mysql.TypeLong},
+				{Name: "name", Type: mysql.TypeVarchar},
+				{Name: "comment", Type: mysql.TypeBlob},
+				{Name: "age", Type: mysql.TypeLong},
+			},
+		},
+		Query: "alter table person add column age int",
+		Type:  mm.ActionAddColumn,
+	}
+
+	encodeDDL := func(encoder *CanalFlatEventBatchEncoder, e *model.DDLEvent) map[string]interface{} {
+		msg, err := encoder.EncodeDDLEvent(e)
+		c.Assert(err, check.IsNil)
+		var message map[string]interface{}
+		c.Assert(json.Unmarshal(msg.Value, &message), check.IsNil)
+		return message
+	}
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), enableTiDBExtension: true}
+	flatMsg := &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}}
+	msg, err := encoder.EncodeDDLEvent(ddl)
+	c.Assert(err, check.IsNil)
+	c.Assert(json.Unmarshal(msg.Value, flatMsg), check.IsNil)
+	c.Assert(flatMsg.Extensions.SchemaChange, check.DeepEquals, &schemaChange{AddedColumns: []string{"age"}})
+
+	// drop and modify columns.
+	ddl.TableInfo.ColumnInfo = []*model.ColumnInfo{
+		{Name: "id", Type: mysql.TypeLonglong},
+		{Name: "name", Type: mysql.TypeVarchar},
+	}
+	c.Assert(newSchemaChange(ddl), check.DeepEquals, &schemaChange{
+		DroppedColumns:  []string{"comment"},
+		ModifiedColumns: []string{"id"},
+	})
+
+	// no summary without the table info before the DDL.
+	c.Assert(encodeDDL(encoder, testCaseDDL)["_tidb"], check.Not(check.HasKey), "schemaChange")
+
+	// no summary without the TiDB extension.
+	encoder = &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encodeDDL(encoder, ddl), check.Not(check.HasKey), "_tidb")
+}
+
+func (s *canalFlatSuite) TestBuildTimePerBatch(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), enableTiDBExtension: true}
+	for _, e := range []*model.RowChangedEvent{testCaseInsert, testCaseUpdate, testCaseDelete} {
+		c.Assert(encoder.AppendRowChangedEvent(e), check.IsNil)
+		// make sure rows are appended in different milliseconds.
+		time.Sleep(2 * time.Millisecond)
+	}
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 3)
+
+	var buildTime int64
+	for i, msg := range msgs {
+		message := &canalFlatMessage{}
+		c.Assert(json.Unmarshal(msg.Value, message), check.IsNil)
+		if i == 0 {
+			buildTime = message.BuildTime
+			c.Assert(buildTime, check.Greater, int64(0))
+		}
+		c.Assert(message.BuildTime, check.Equals, buildTime)
+	}
+}
+
+func (s *canalFlatSuite) TestTimestampAtBuild(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Unix(1640995200, 0))
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), enableTiDBExtension: true, clock: mockClock}
+	c.Assert(encoder.SetParams(map[string]string{"time-precision": canalFlatTimePrecisionNs}), check.IsNil)
+	c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+	// the delay between appending and building the batch shows up in the timestamps.
+	mockClock.Add(3 * time.Second)
+	built := mockClock.Now()
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+
+	message := &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}}
+	c.Assert(json.Unmarshal(msgs[0].Value, message), check.IsNil)
+	c.Assert(message.BuildTime, check.Equals, built.UnixNano()/int64(time.Millisecond))
+	c.Assert(message.Extensions.BuildTime, check.Equals, built.UnixNano())
+	c.Assert(message.Extensions.ProducerTs, check.Equals, built.UnixNano()/int64(time.Millisecond))
+}
+
+func (s *canalFlatSuite) TestEmitMessageID(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"emit-message-id": "true"}), check.IsNil)
+	c.Assert(encoder.emitMessageID, check.IsTrue)
+	c.Assert(encoder.SetParams(map[string]string{"emit-message-id": "foo"}), check.NotNil)
+
+	// all rows share the same commitTs.
+	for _, e := range []*model.RowChangedEvent{testCaseInsert, testCaseUpdate, testCaseDelete} {
+		c.Assert(encoder.AppendRowChangedEvent(e), check.IsNil)
+	}
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 3)
+
+	var lastID int64
+	for _, msg := range msgs {
+		message := &canalFlatMessage{}
+		c.Assert(json.Unmarshal(msg.Value, message), check.IsNil)
+		c.Assert(message.ID, check.Greater, lastID)
+		c.Assert(message.ID >= int64(testCaseInsert.CommitTs), check.IsTrue)
+		lastID = message.ID
+	}
+
+	// IDs are unique among the encoders of all partitions built by the same builder.
+	builder := newCanalFlatEventBatchEncoderBuilder(map[string]string{"emit-message-id": "true"})
+	ids := make(map[int64]struct{})
+	for i := 0; i < 2; i++ {
+		partition, err := builder.Build(context.Background())
+		c.Assert(err, check.IsNil)
+		for _, e := range []*model.RowChangedEvent{testCaseInsert, testCaseUpdate} {
+			c.Assert(partition.AppendRowChangedEvent(e), check.IsNil)
+		}
+		for _, msg := range partition.Build() {
+			message := &canalFlatMessage{}
+			c.Assert(json.Unmarshal(msg.Value, message), check.IsNil)
+			ids[message.ID] = struct{}{}
+		}
+	}
+	c.Assert(ids, check.HasLen, 4)
+
+	// IDs are still 0 if the option is not enabled.
+	encoder = &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+	msgs = encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+	message := &canalFlatMessage{}
+	c.Assert(json.Unmarshal(msgs[0].Value, message), check.IsNil)
+	c.Assert(message.ID, check.Equals, int64(0))
+}
+
+func (s *canalFlatSuite) TestDecodeAbsentRowsAsNil(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	for _, e := range []*model.RowChangedEvent{testCaseInsert, testCaseDelete} {
+		c.Assert(encoder.AppendRowChangedEvent(e), check.IsNil)
+	}
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 2)
+
+	for i, msg := range msgs {
+		consumed := decodeCanalFlatRow(c, msg, false)
+		if i == 0 {
+			c.Assert(consumed.IsInsert(), check.IsTrue)
+			c.Assert(consumed.PreColumns == nil, check.IsTrue)
+			c.Assert(consumed.Columns, check.Not(check.HasLen), 0)
+		} else {
+			c.Assert(consumed.IsDelete(), check.IsTrue)
+			c.Assert(consumed.Columns == nil, check.IsTrue)
+			c.Assert(consumed.PreColumns, check.Not(check.HasLen), 0)
+		}
+	}
+}
+
+func (s *canalFlatSuite) TestProducerTs(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	for _, enable := range []bool{false, true} {
+		encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), enableTiDBExtension: enable}
+		c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+		before := time.Now().UnixNano() / int64(time.Millisecond)
+		msgs := encoder.Build()
+		after := time.Now().UnixNano() / int64(time.Millisecond)
+		c.Assert(msgs, check.HasLen, 1)
+
+		decoder := newCanalFlatTestDecoder(c, msgs[0], enable)
+		_, err := nextCanalFlatRow(c, decoder)
+		c.Assert(err, check.IsNil)
+
+		producerTs := decoder.ProducerTs()
+		if !enable {
+			c.Assert(producerTs, check.Equals, int64(0))
+			continue
+		}
+		c.Assert(producerTs >= before && producerTs <= after, check.IsTrue)
+
+		msg, err := encoder.EncodeDDLEvent(testCaseDDL)
+		c.Assert(err, check.IsNil)
+		decoder = newCanalFlatTestDecoder(c, msg, enable)
+		_, err = nextCanalFlatDDL(c, decoder)
+		c.Assert(err, check.IsNil)
+		c.Assert(decoder.ProducerTs() >= producerTs, check.IsTrue)
+	}
+}
+
+func (s *canalFlatSuite) TestCBOREnvelope(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"envelope": "xml"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"envelope": "cbor"}), check.IsNil)
+	c.Assert(encoder.envelope, check.Equals, canalFlatEnvelopeCBOR)
+
+	// the CBOR envelope has the same schema as JSON.
+	for _, message := range canalFlatMessagesForMarshalerTest() {
+		jsonValue, err := json.Marshal(message)
+		c.Assert(err, check.IsNil)
+		cborValue, err := cborMarshal(message)
+		c.Assert(err, check.IsNil)
+		c.Assert(cborValue[:len(cborMarker)], check.DeepEquals, cborMarker)
+		c.Assert(len(cborValue), check.Less, len(jsonValue))
+
+		fromJSON := &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}, Extensions: &tidbExtension{}}
+		c.Assert(unmarshalEnvelope(jsonValue, fromJSON), check.IsNil)
+		fromCBOR := &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}, Extensions: &tidbExtension{}}
+		c.Assert(unmarshalEnvelope(cborValue, fromCBOR), check.IsNil)
+		c.Assert(fromCBOR, check.DeepEquals, fromJSON)
+	}
+
+	// rows and DDLs round trip in the CBOR envelope, the decoder detects it automatically.
+	decode := func(envelope string, enable bool) ([]*model.RowChangedEvent, *model.DDLEvent) {
+		encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), enableTiDBExtension: enable}
+		c.Assert(encoder.SetParams(map[string]string{"envelope": envelope}), check.IsNil)
+		for _, e := range []*model.RowChangedEvent{testCaseInsert, testCaseUpdate, testCaseDelete} {
+			c.Assert(encoder.AppendRowChangedEvent(e), check.IsNil)
+		}
+		msgs := encoder.Build()
+		ddlMsg, err := encoder.EncodeDDLEvent(testCaseDDL)
+		c.Assert(err, check.IsNil)
+
+		rows := make([]*model.RowChangedEvent, 0, len(msgs))
+		for _, msg := range msgs {
+			rows = append(rows, decodeCanalFlatRow(c, msg, enable))
+		}
+		return rows, decodeCanalFlatDDL(c, ddlMsg, enable)
+	}
+	for _, enable := range []bool{false, true} {
+		jsonRows, jsonDDL := decode(canalFlatEnvelopeJSON, enable)
+		cborRows, cborDDL := decode(canalFlatEnvelopeCBOR, enable)
+		c.Assert(cborRows, check.DeepEquals, jsonRows)
+		c.Assert(cborDDL, check.DeepEquals, jsonDDL)
+	}
+}
+
+func BenchmarkCanalFlatEnvelopeSize(b *testing.B) {
+	messages := canalFlatMessagesForMarshalerTest()
+	for _, envelope := range []string{canalFlatEnvelopeJSON, canalFlatEnvelopeCBOR} {
+		b.Run(envelope, func(b *testing.B) {
+			encoder := &CanalFlatEventBatchEncoder{envelope: envelope}
+			size := 0
+			for i := 0; i < b.N; i++ {
+				size = 0
+				for _, message := range messages {
+					value, err := encoder.marshal(message)
+					if err != nil {
+						panic(err)
+					}
+					size += len(value)
+				}
+			}
+			b.ReportMetric(float64(size)/float64(len(messages)), "bytes/msg")
+		})
+	}
+}
+
+func (s *canalFlatSuite) TestDecodeWithSchema(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	msg := encodeCanalFlatRow(c, nil, &model.RowChangedEvent{
+		CommitTs: 417318403368288260,
+		Table:    &model.TableName{Schema: "cdc", Table: "person"},
+		Columns: []*model.Column{
+			{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: int64(1)},
+			{Name: "name", Type: mysql.TypeVarchar, Value: []byte("Bob")},
+		},
+	})
+
+	newColumnInfo := func(name string, tp byte, def interface{}) *mm.ColumnInfo {
+		return &mm.ColumnInfo{Name: mm.NewCIStr(name), FieldType: *types.NewFieldType(tp), DefaultValue: def}
+	}
+	decodeWithSchema := func(tableInfo *mm.TableInfo, coerceTypes bool) (*model.RowChangedEvent, error) {
+		decoder := newCanalFlatTestDecoder(c, msg, false)
+		decoder.DecodeWithSchema(tableInfo, coerceTypes)
+		return nextCanalFlatRow(c, decoder)
+	}
+
+	// an extra column is rejected.
+	_, err := decodeWithSchema(&mm.TableInfo{
+		Name:    mm.NewCIStr("person"),
+		Columns: []*mm.ColumnInfo{newColumnInfo("id", mysql.TypeLong, nil)},
+	}, false)
+	c.Assert(err, check.ErrorMatches, ".*unexpected column name.*")
+
+	// a missing column is filled with the default value.
+	row, err := decodeWithSchema(&mm.TableInfo{
+		Name: mm.NewCIStr("person"),
+		Columns: []*mm.ColumnInfo{
+			newColumnInfo("id", mysql.TypeLong, nil),
+			newColumnInfo("name", mysql.TypeVarchar, nil),
+			newColumnInfo("age", mysql.TypeLong, "18"),
+			newColumnInfo("email", mysql.TypeVarchar, nil),
+		},
+	}, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(row.PreColumns, check.IsNil)
+	c.Assert(row.Columns, check.HasLen, 4)
+	values := make(map[string]interface{}, len(row.Columns))
+	for _, col := range row.Columns {
+		values[col.Name] = col.Value
+	}
+	c.Assert(values, check.DeepEquals, map[string]interface{}{"id": "1", "name": "Bob", "age": "18", "email": nil})
+	// the filled columns are sorted with the decoded ones.
+	names := make([]string, 0, len(row.Columns))
+	for _, col := range row.Columns {
+		names = append(names, col.Name)
+	}
+	c.Assert(names, check.DeepEquals, []string{"age", "email", "id", "name"})
+
+	// a type mismatch is rejected, or coerced if enabled.
+	tableInfo := &mm.TableInfo{
+		Name: mm.NewCIStr("person"),
+		Columns: []*mm.ColumnInfo{
+			newColumnInfo("id", mysql.TypeLonglong, nil),
+			newColumnInfo("name", mysql.TypeVarchar, nil),
+		},
+	}
+	_, err = decodeWithSchema(tableInfo, false)
+	c.Assert(err, check.ErrorMatches, ".*column id is int, but it's bigint in table person.*")
+	row, err = decodeWithSchema(tableInfo, true)
+	c.Assert(err, check.IsNil)
+	c.Assert(row.Columns, check.HasLen, 2)
+	c.Assert(row.Columns[0].Name, check.Equals, "id")
+	c.Assert(row.Columns[0].Type, check.Equals, mysql.TypeLonglong)
+	c.Assert(row.Columns[0].Value, check.Equals, "1")
+}
+
+func (s *canalFlatSuite) TestWrapperKey(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	roundTrip := func(wrapperKey string) (*model.RowChangedEvent, uint64) {
+		encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), enableTiDBExtension: true}
+		c.Assert(encoder.SetParams(map[string]string{"wrapper-key": wrapperKey}), check.IsNil)
+		c.Assert(encoder.AppendRowChangedEvent(testCaseUpdate), check.IsNil)
+		msgs := encoder.Build()
+		c.Assert(msgs, check.HasLen, 1)
+		checkpoint, err := encoder.EncodeCheckpointEvent(417318403368288260)
+		c.Assert(err, check.IsNil)
+
+		for _, msg := range []*MQMessage{msgs[0], checkpoint} {
+			var value map[string]interface{}
+			c.Assert(json.Unmarshal(msg.Value, &value), check.IsNil)
+			if wrapperKey == "" {
+				c.Assert(value, check.HasKey, "_tidb")
+			} else {
+				c.Assert(value, check.HasLen, 1)
+				c.Assert(value, check.HasKey, wrapperKey)
+			}
+		}
+
+		decoder := newCanalFlatTestDecoder(c, msgs[0], true)
+		decoder.SetWrapperKey(wrapperKey)
+		row, err := nextCanalFlatRow(c, decoder)
+		c.Assert(err, check.IsNil)
+
+		decoder = newCanalFlatTestDecoder(c, checkpoint, true)
+		decoder.SetWrapperKey(wrapperKey)
+		_, hasNext, err := decoder.HasNext()
+		c.Assert(err, check.IsNil)
+		c.Assert(hasNext, check.IsTrue)
+		ts, err := decoder.NextResolvedEvent()
+		c.Assert(err, check.IsNil)
+		return row, ts
+	}
+
+	expectedRow, expectedTs := roundTrip("")
+	c.Assert(expectedRow.CommitTs, check.Equals, testCaseUpdate.CommitTs)
+	c.Assert(expectedTs, check.Equals, uint64(417318403368288260))
+	row, ts := roundTrip("payload")
+	c.Assert(row, check.DeepEquals, expectedRow)
+	c.Assert(ts, check.Equals, expectedTs)
+}
+
+func (s *canalFlatSuite) TestDDLOnly(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"ddl-only": "foo"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"ddl-only": "true"}), check.IsNil)
+	c.Assert(encoder.ddlOnly, check.IsTrue)
+
+	// DMLs are dropped.
+	for _, e := range []*model.RowChangedEvent{testCaseInsert, testCaseUpdate, testCaseDelete} {
+		c.Assert(encoder.AppendRowChangedEvent(e), check.IsNil)
+	}
+	c.Assert(encoder.Build(), check.HasLen, 0)
+
+	// DDLs are emitted.
+	msg, err := encoder.EncodeDDLEvent(testCaseDDL)
+	c.Assert(err, check.IsNil)
+	c.Assert(msg, check.NotNil)
+	c.Assert(decodeCanalFlatDDL(c, msg, false).Query, check.Equals, testCaseDDL.Query)
+
+}
+
+func (s *canalFlatSuite) TestEmitRowID(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"emit-row-id": "foo"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"emit-row-id": "true"}), check.IsNil)
+	c.Assert(encoder.emitRowID, check.IsTrue)
+
+	// a table without primary key.
+	update := &model.RowChangedEvent{
+		CommitTs: 417318403368288260,
+		Table:    &model.TableName{Schema: "cdc", Table: "no_pk"},
+		RowID:    42,
+		PreColumns: []*model.Column{
+			{Name: "name", Type: mysql.TypeVarchar, Value: []byte("foo")},
+		},
+		Columns: []*model.Column{
+			{Name: "name", Type: mysql.TypeVarchar, Value: []byte("bar")},
+		},
+	}
+	c.Assert(encoder.AppendRowChangedEvent(update), check.IsNil)
+	// rows of tables with primary key are not affected.
+	c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 2)
+
+	message := &canalFlatMessage{}
+	c.Assert(json.Unmarshal(msgs[0].Value, message), check.IsNil)
+	c.Assert(message.PKNames, check.DeepEquals, []string{"_tidb_rowid"})
+	c.Assert(message.Data[0]["_tidb_rowid"], check.Equals, "42")
+	c.Assert(message.Old[0]["_tidb_rowid"], check.Equals, "42")
+	c.Assert(message.MySQLType["_tidb_rowid"], check.Equals, "bigint")
+	c.Assert(message.SQLType["_tidb_rowid"], check.Equals, int32(JavaSQLTypeBIGINT))
+
+	message = &canalFlatMessage{}
+	c.Assert(json.Unmarshal(msgs[1].Value, message), check.IsNil)
+	c.Assert(message.PKNames, check.Not(check.DeepEquals), []string{"_tidb_rowid"})
+	c.Assert(message.Data[0], check.Not(check.HasKey), "_tidb_rowid")
+
+	// the decoder exposes the row ID, and removes it from the columns.
+	consumed := decodeCanalFlatRow(c, msgs[0], false)
+	c.Assert(consumed.RowID, check.Equals, int64(42))
+	c.Assert(consumed.Columns, check.HasLen, 1)
+	c.Assert(consumed.Columns[0].Name, check.Equals, "name")
+	c.Assert(consumed.PreColumns, check.HasLen, 1)
+	c.Assert(consumed.PreColumns[0].Name, check.Equals, "name")
+}
+
+func (s *canalFlatSuite) TestEnumSetAsString(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	newColumnInfo := func(name string, tp byte, elems []string) *mm.ColumnInfo {
+		ft := types.NewFieldType(tp)
+		ft.Elems = elems
+		return &mm.ColumnInfo{Name: mm.NewCIStr(name), FieldType: *ft}
+	}
+	table := model.TableName{Schema: "cdc", Table: "shirt"}
+	tableInfo := &mm.TableInfo{
+		Name: mm.NewCIStr("shirt"),
+		Columns: []*mm.ColumnInfo{
+			newColumnInfo("id", mysql.TypeLong, nil),
+			newColumnInfo("size", mysql.TypeEnum, []string{"small", "medium", "large"}),
+			newColumnInfo("colors", mysql.TypeSet, []string{"red", "green", "blue"}),
+		},
+	}
+	row := &model.RowChangedEvent{
+		CommitTs: 417318403368288260,
+		Table:    &table,
+		Columns: []*model.Column{
+			{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: int64(1)},
+			{Name: "size", Type: mysql.TypeEnum, Value: uint64(2)},
+			{Name: "colors", Type: mysql.TypeSet, Value: uint64(5)},
+		},
+	}
+	encode := func(encoder *CanalFlatEventBatchEncoder) *MQMessage {
+		c.Assert(encoder.AppendRowChangedEvent(row), check.IsNil)
+		msgs := encoder.Build()
+		c.Assert(msgs, check.HasLen, 1)
+		return msgs[0]
+	}
+	decode := func(msg *MQMessage, tableInfo *mm.TableInfo) map[string]interface{} {
+		decoder := newCanalFlatTestDecoder(c, msg, false)
+		decoder.DecodeWithSchema(tableInfo, false)
+		consumed, err := nextCanalFlatRow(c, decoder)
+		c.Assert(err, check.IsNil)
+		values := make(map[string]interface{}, len(consumed.Columns))
+		for _, col := range consumed.Columns {
+			values[col.Name] = col.Value
+		}
+		return values
+	}
+
+	// values of the registered table are encoded as the string representations.
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	encoder.SetTableInfo(table, tableInfo)
+	msg := encode(encoder)
+	message := &canalFlatMessage{}
+	c.Assert(json.Unmarshal(msg.Value, message), check.IsNil)
+	c.Assert(message.Data[0]["size"], check.Equals, "medium")
+	c.Assert(message.Data[0]["colors"], check.Equals, "red,blue")
+	c.Assert(message.MySQLType["size"], check.Equals, "enum")
+	c.Assert(message.MySQLType["colors"], check.Equals, "set")
+	c.Assert(message.SQLType["size"], check.Equals, int32(JavaSQLTypeCHAR))
+	c.Assert(message.SQLType["colors"], check.Equals, int32(JavaSQLTypeCHAR))
+
+	// the decoder reconstructs the numeric values with the schema, and keeps the strings without it.
+	c.Assert(decode(msg, tableInfo), check.DeepEquals,
+		map[string]interface{}{"id": "1", "size": uint64(2), "colors": uint64(5)})
+	c.Assert(decode(msg, nil), check.DeepEquals,
+		map[string]interface{}{"id": "1", "size": "medium", "colors": "red,blue"})
+
+	// the numeric values are kept after the table is unregistered, and are decoded the same.
+	encoder.SetTableInfo(table, nil)
+	msg = encode(encoder)
+	message = &canalFlatMessage{}
+	c.Assert(json.Unmarshal(msg.Value, message), check.IsNil)
+	c.Assert(message.Data[0]["size"], check.Equals, "2")
+	c.Assert(message.Data[0]["colors"], check.Equals, "5")
+	c.Assert(decode(msg, tableInfo), check.DeepEquals,
+		map[string]interface{}{"id": "1", "size": uint64(2), "colors": uint64(5)})
+}
+
+func (s *canalFlatSuite) TestEmitSequence(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"emit-sequence": "foo"}), check.NotNil)
+
+	// encoders built by the same builder share the sequence, e.g. one encoder for each partition.
+	builder := newCanalFlatEventBatchEncoderBuilder(map[string]string{"enable-tidb-extension": "true", "emit-sequence": "true"})
+	encoder1, err := builder.Build(context.Background())
+	c.Assert(err, check.IsNil)
+	encoder2, err := builder.Build(context.Background())
+	c.Assert(err, check.IsNil)
+
+	table1 := *testCaseInsert
+	table1.Table = &model.TableName{Schema: "cdc", Table: "t1"}
+	table2 := *testCaseInsert
+	table2.Table = &model.TableName{Schema: "cdc", Table: "t2"}
+	// events of the two tables are interleaved.
+	for i := 0; i < 3; i++ {
+		c.Assert(encoder1.AppendRowChangedEvent(&table1), check.IsNil)
+		c.Assert(encoder2.AppendRowChangedEvent(&table2), check.IsNil)
+	}
+
+	sequenceOf := func(msg *MQMessage) uint64 {
+		message := &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}, Extensions: &tidbExtension{}}
+		c.Assert(json.Unmarshal(msg.Value, message), check.IsNil)
+		return message.Extensions.Sequence
+	}
+	msgs1, msgs2 := encoder1.Build(), encoder2.Build()
+	c.Assert(msgs1, check.HasLen, 3)
+	c.Assert(msgs2, check.HasLen, 3)
+	var last uint64
+	for i := 0; i < 3; i++ {
+		for _, seq := range []uint64{sequenceOf(msgs1[i]), sequenceOf(msgs2[i])} {
+			c.Assert(seq, check.Greater, last)
+			last = seq
+		}
+	}
+
+	// DDLs are sequenced too.
+	msg, err := encoder2.EncodeDDLEvent(testCaseDDL)
+	c.Assert(err, check.IsNil)
+	c.Assert(sequenceOf(msg), check.Greater, last)
+
+	// no sequence if the option is not enabled.
+	encoder = &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), enableTiDBExtension: true}
+	c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+	c.Assert(sequenceOf(msgs[0]), check.Equals, uint64(0))
+}
+
+func (s *canalFlatSuite) TestDecodeStats(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), enableTiDBExtension: true}
+	for _, e := range []*model.RowChangedEvent{testCaseInsert, testCaseUpdate, testCaseDelete} {
+		c.Assert(encoder.AppendRowChangedEvent(e), check.IsNil)
+	}
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 3)
+	ddl, err := encoder.EncodeDDLEvent(testCaseDDL)
+	c.Assert(err, check.IsNil)
+	resolved, err := encoder.EncodeCheckpointEvent(417318403368288260)
+	c.Assert(err, check.IsNil)
+
+	// a mixed stream, with a row, a DDL, a resolved event, two rows and a malformed message.
+	stream := make([][]byte, 0, 6)
+	for _, msg := range []*MQMessage{msgs[0], ddl, resolved, msgs[1], msgs[2]} {
+		rawBytes, err := json.Marshal(msg)
+		c.Assert(err, check.IsNil)
+		stream = append(stream, rawBytes)
+	}
+	stream = append(stream, []byte("{"))
+
+	decoder := newCanalFlatEventBatchDecoder(nil, true).(*CanalFlatEventBatchDecoder)
+	c.Assert(decoder.Stats(), check.DeepEquals, CanalFlatDecodeStats{})
+	for _, data := range stream {
+		decoder.Reset(data)
+		tp, hasNext, err := decoder.HasNext()
+		if err != nil {
+			continue
+		}
+		c.Assert(hasNext, check.IsTrue)
+		switch tp {
+		case model.MqMessageTypeRow:
+			_, err = decoder.NextRowChangedEvent()
+		case model.MqMessageTypeDDL:
+			_, err = decoder.NextDDLEvent()
+		case model.MqMessageTypeResolved:
+			_, err = decoder.NextResolvedEvent()
+		}
+		c.Assert(err, check.IsNil)
+	}
+	// decoding a message of the wrong type is an error.
+	decoder.Reset(stream[0])
+	_, _, err = decoder.HasNext()
+	c.Assert(err, check.IsNil)
+	_, err = decoder.NextDDLEvent()
+	c.Assert(err, check.NotNil)
+
+	c.Assert(decoder.Stats(), check.DeepEquals, CanalFlatDecodeStats{Rows: 3, DDLs: 1, Resolved: 1, Errors: 2})
+}
+
+func (s *canalFlatSuite) TestFloatAsString(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"float-as-string": "foo"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"float-as-string": "true"}), check.IsNil)
+	c.Assert(encoder.floatAsString, check.IsTrue)
+
+	a, b := 0.1, 0.2
+	double := a + b
+	insert := &model.RowChangedEvent{
+		CommitTs: 417318403368288260,
+		Table:    &model.TableName{Schema: "cdc", Table: "float"},
+		Columns: []*model.Column{
+			{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: int64(1)},
+			{Name: "f", Type: mysql.TypeFloat, Value: float32(0.1)},
+			// a FLOAT value carried as float64 is formatted at the precision of FLOAT.
+			{Name: "f64", Type: mysql.TypeFloat, Value: float64(float32(0.7))},
+			{Name: "d", Type: mysql.TypeDouble, Value: double},
+		},
+	}
+	c.Assert(encoder.AppendRowChangedEvent(insert), check.IsNil)
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+
+	message := &canalFlatMessage{}
+	c.Assert(json.Unmarshal(msgs[0].Value, message), check.IsNil)
+	c.Assert(message.Data[0]["f"], check.Equals, "0.1")
+	c.Assert(message.Data[0]["f64"], check.Equals, "0.7")
+	c.Assert(message.Data[0]["d"], check.Equals, "0.30000000000000004")
+
+	decoder := newCanalFlatTestDecoder(c, msgs[0], false)
+	decoder.SetFloatAsString(true)
+	consumed, err := nextCanalFlatRow(c, decoder)
+	c.Assert(err, check.IsNil)
+	values := make(map[string]interface{}, len(consumed.Columns))
+
+	for _, col := range consumed.Columns {
+		values[col.Name] = col.Value
+	}
+	// no drift after the round trip.
+	c.Assert(values["f"], check.Equals, float32(0.1))
+	c.Assert(values["f64"], check.Equals, float32(0.7))
+	c.Assert(values["d"], check.Equals, double)
+	c.Assert(values["id"], check.Equals, "1")
+}
+
+func (s *canalFlatSuite) TestSchemaHeartbeat(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"schema-heartbeat-interval": "foo"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"schema-heartbeat-interval": "-1s"}), check.NotNil)
+
+	interval := 100 * time.Millisecond
+	builder := newCanalFlatEventBatchEncoderBuilder(map[string]string{
+		"enable-tidb-extension":     "true",
+		"schema-heartbeat-interval": interval.String(),
+	})
+	ddlEncoder, err := builder.Build(context.Background())
+	c.Assert(err, check.IsNil)
+	_, err = ddlEncoder.EncodeDDLEvent(testCaseDDL)
+	c.Assert(err, check.IsNil)
+
+	// the heartbeats are shared by encoders built by the same builder, e.g. the one for checkpoints.
+	encoder2, err := builder.Build(context.Background())
+	c.Assert(err, check.IsNil)
+	heartbeatEncoder := encoder2.(*CanalFlatEventBatchEncoder)
+	msgs, err := heartbeatEncoder.EncodeSchemaHeartbeats()
+	c.Assert(err, check.IsNil)
+	c.Assert(msgs, check.HasLen, 0)
+
+	// no DML within the interval, the schema is re-emitted as a bootstrap DDL.
+	time.Sleep(2 * interval)
+	msgs, err = heartbeatEncoder.EncodeSchemaHeartbeats()
+	c.Assert(err, check.IsNil)
+	c.Assert(msgs, check.HasLen, 1)
+	c.Assert(msgs[0].Type, check.Equals, model.MqMessageTypeDDL)
+	message := &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}, Extensions: &tidbExtension{}}
+	c.Assert(json.Unmarshal(msgs[0].Value, message), check.IsNil)
+	c.Assert(message.IsDDL, check.IsTrue)
+	c.Assert(message.Query, check.Equals, testCaseDDL.Query)
+	c.Assert(message.Extensions.Bootstrap, check.IsTrue)
+	c.Assert(message.Extensions.SchemaVersion, check.Equals, uint64(1))
+
+	// the heartbeat is not re-emitted until the next interval.
+	msgs, err = heartbeatEncoder.EncodeSchemaHeartbeats()
+	c.Assert(err, check.IsNil)
+	c.Assert(msgs, check.HasLen, 0)
+
+	// DMLs keep the table active.
+	time.Sleep(2 * interval)
+	insert := *testCaseInsert
+	insert.Table = &model.TableName{Schema: testCaseDDL.TableInfo.Schema, Table: testCaseDDL.TableInfo.Table}
+	c.Assert(ddlEncoder.AppendRowChangedEvent(&insert), check.IsNil)
+	msgs, err = heartbeatEncoder.EncodeSchemaHeartbeats()
+	c.Assert(err, check.IsNil)
+	c.Assert(msgs, check.HasLen, 0)
+}
+
+func (s *canalFlatSuite) TestColumnDefaults(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	newColumnInfo := func(name string, tp byte, def interface{}) *mm.ColumnInfo {
+		colInfo := &mm.ColumnInfo{Name: mm.NewCIStr(name), FieldType: *types.NewFieldType(tp)}
+		if def != nil {
+			c.Assert(colInfo.SetDefaultValue(def), check.IsNil)
+		}
+		return colInfo
+	}
+	table := model.TableName{Schema: testCaseDDL.TableInfo.Schema, Table: testCaseDDL.TableInfo.Table}
+	tableInfo := &mm.TableInfo{
+		Name: mm.NewCIStr(table.Table),
+		Columns: []*mm.ColumnInfo{
+			newColumnInfo("id", mysql.TypeLong, nil),
+			newColumnInfo("name", mysql.TypeVarchar, "it's"),
+			newColumnInfo("created", mysql.TypeTimestamp, "CURRENT_TIMESTAMP"),
+		},
+	}
+
+	builder := newCanalFlatEventBatchEncoderBuilder(map[string]string{
+		"enable-tidb-extension":     "true",
+		"schema-heartbeat-interval": "1ns",
+	})
+	encoder, err := builder.Build(context.Background())
+	c.Assert(err, check.IsNil)
+	flatEncoder := encoder.(*CanalFlatEventBatchEncoder)
+	flatEncoder.SetTableInfo(table, tableInfo)
+
+	ddl, err := encoder.EncodeDDLEvent(testCaseDDL)
+	c.Assert(err, check.IsNil)
+	time.Sleep(time.Millisecond)
+	bootstraps, err := flatEncoder.EncodeSchemaHeartbeats()
+	c.Assert(err, check.IsNil)
+	c.Assert(bootstraps, check.HasLen, 1)
+
+	// both the DDL and the bootstrap DDL carry the column defaults.
+	for _, msg := range []*MQMessage{ddl, bootstraps[0]} {
+		message := &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}, Extensions: &tidbExtension{}}
+		c.Assert(json.Unmarshal(msg.Value, message), check.IsNil)
+		c.Assert(message.Extensions.ColumnDefaults, check.DeepEquals, map[string]string{
+			"name":    "'it''s'",
+			"created": "CURRENT_TIMESTAMP",
+		})
+	}
+
+	// unregistered tables have no column defaults.
+	flatEncoder.SetTableInfo(table, nil)
+	ddl, err = encoder.EncodeDDLEvent(testCaseDDL)
+	c.Assert(err, check.IsNil)
+	message := &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}, Extensions: &tidbExtension{}}
+	c.Assert(json.Unmarshal(ddl.Value, message), check.IsNil)
+	c.Assert(message.Extensions.ColumnDefaults, check.IsNil)
+}
+
+func (s *canalFlatSuite) TestTableInfoFromEvents(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	table := model.TableName{Schema: testCaseDDL.TableInfo.Schema, Table: testCaseDDL.TableInfo.Table}
+	id := &mm.ColumnInfo{Name: mm.NewCIStr("id"), FieldType: *types.NewFieldType(mysql.TypeLong)}
+	id.Flag |= mysql.AutoIncrementFlag | mysql.PriKeyFlag
+	size := &mm.ColumnInfo{Name: mm.NewCIStr("size"), FieldType: *types.NewFieldType(mysql.TypeEnum)}
+	size.Elems = []string{"small", "medium", "large"}
+	c.Assert(size.SetDefaultValue("small"), check.IsNil)
+	tableInfo := &mm.TableInfo{Name: mm.NewCIStr(table.Table), Columns: []*mm.ColumnInfo{id, size}, AutoIncID: 100}
+
+	// as the MQ sink does, the DDL and the rows are encoded by different encoders, none of them is set the table info.
+	builder := newCanalFlatEventBatchEncoderBuilder(map[string]string{"enable-tidb-extension": "true"})
+	ddlEncoder, err := builder.Build(context.Background())
+	c.Assert(err, check.IsNil)
+	rowEncoder, err := builder.Build(context.Background())
+	c.Assert(err, check.IsNil)
+
+	// the DDL carries the table info after it, which the column defaults and the auto-increment offset come from.
+	ddl := *testCaseDDL
+	ddl.TiTableInfo = tableInfo
+	msg, err := ddlEncoder.EncodeDDLEvent(&ddl)
+	c.Assert(err, check.IsNil)
+	message := &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}, Extensions: &tidbExtension{}}
+	c.Assert(json.Unmarshal(msg.Value, message), check.IsNil)
+	c.Assert(message.Extensions.ColumnDefaults, check.DeepEquals, map[string]string{"size": "'small'"})
+	c.Assert(message.Extensions.AutoIncrement, check.Equals, int64(100))
+
+	// the row carries the schema it's mounted with, which the ENUM values are formatted by.
+	row := &model.RowChangedEvent{
+		CommitTs: 417318403368288260,
+		Table:    &table,
+		Columns: []*model.Column{
+			{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: int64(1)},
+			{Name: "size", Type: mysql.TypeEnum, Value: uint64(2)},
+		},
+		TableInfo: &model.TableInfo{TableInfo: tableInfo},
+	}
+	c.Assert(rowEncoder.AppendRowChangedEvent(row), check.IsNil)
+	msgs, err := BuildEventBatch(rowEncoder)
+	c.Assert(err, check.IsNil)
+	c.Assert(msgs, check.HasLen, 1)
+	message = &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}, Extensions: &tidbExtension{}}
+	c.Assert(json.Unmarshal(msgs[0].Value, message), check.IsNil)
+	c.Assert(message.Data[0]["size"], check.Equals, "medium")
+
+	// the numeric values are kept for the rows without the schema.
+	row.TableInfo = nil
+	encoder, err := builder.Build(context.Background())
+	c.Assert(err, check.IsNil)
+	c.Assert(encoder.AppendRowChangedEvent(row), check.IsNil)
+	msgs, err = BuildEventBatch(encoder)
+	c.Assert(err, check.IsNil)
+	message = &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}, Extensions: &tidbExtension{}}
+	c.Assert(json.Unmarshal(msgs[0].Value, message), check.IsNil)
+	c.Assert(message.Data[0]["size"], check.Equals, "2")
+}
+
+func (s *canalFlatSuite) TestGoldenOutput(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	table := &model.TableName{Schema: "cdc", Table: "golden"}
+	pre := []*model.Column{
+		{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: int64(1)},
+		{Name: "name", Type: mysql.TypeVarchar, Value: []byte("alice")},
+		{Name: "score", Type: mysql.TypeDouble, Value: 1.5},
+		{Name: "note", Type: mysql.TypeVarchar, Value: nil},
+	}
+	post := []*model.Column{
+		{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: int64(1)},
+		{Name: "name", Type: mysql.TypeVarchar, Value: []byte("bob")},
+		{Name: "score", Type: mysql.TypeDouble, Value: 2.5},
+		{Name: "note", Type: mysql.TypeVarchar, Value: nil},
+	}
+	commitTs := uint64(417318403368288260)
+	rows := []struct {
+		name string
+		row  *model.RowChangedEvent
+	}{
+		{"insert", &model.RowChangedEvent{CommitTs: commitTs, Table: table, Columns: pre}},
+		{"update", &model.RowChangedEvent{CommitTs: commitTs, Table: table, PreColumns: pre, Columns: post}},
+		{"delete", &model.RowChangedEvent{CommitTs: commitTs, Table: table, PreColumns: post}},
+	}
+	ddl := &model.DDLEvent{
+		CommitTs:  commitTs,
+		TableInfo: &model.SimpleTableInfo{Schema: "cdc", Table: "golden"},
+		Query:     "create table golden(id int primary key, name varchar(32), score double, note varchar(32))",
+		Type:      mm.ActionCreateTable,
+	}
+
+	for _, enableTiDBExtension := range []bool{false, true} {
+		suffix := ""
+		if enableTiDBExtension {
+			suffix = "_tidb"
+		}
+		mockClock := clock.NewMock()
+		mockClock.Set(time.Unix(1640995200, 0))
+		newEncoder := func() *CanalFlatEventBatchEncoder {
+			encoder := NewCanalFlatEventBatchEncoder().(*CanalFlatEventBatchEncoder)
+			c.Assert(encoder.SetParams(map[string]string{"enable-tidb-extension": strconv.FormatBool(enableTiDBExtension)}), check.IsNil)
+			encoder.clock = mockClock
+			return encoder
+		}
+
+		for _, r := range rows {
+			encoder := newEncoder()
+			c.Assert(encoder.AppendRowChangedEvent(r.row), check.IsNil)
+			msgs := encoder.Build()
+			c.Assert(msgs, check.HasLen, 1)
+			assertGolden(c, "canal_json", r.name+suffix, msgs[0].Value)
+		}
+
+		msg, err := newEncoder().EncodeDDLEvent(ddl)
+		c.Assert(err, check.IsNil)
+		assertGolden(c, "canal_json", "ddl"+suffix, msg.Value)
+
+		// resolved events are only emitted with the TiDB extension.
+		msg, err = newEncoder().EncodeCheckpointEvent(commitTs)
+		c.Assert(err, check.IsNil)
+		if !enableTiDBExtension {
+			c.Assert(msg, check.IsNil)
+			continue
+		}
+		assertGolden(c, "canal_json", "resolved"+suffix, msg.Value)
+	}
+}
+
+func (s *canalFlatSuite) TestDecodeAll(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), enableTiDBExtension: true}
+	c.Assert(encoder.AppendRowChangedEvent(testCaseUpdate), check.IsNil)
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+	ddl, err := encoder.EncodeDDLEvent(testCaseDDL)
+	c.Assert(err, check.IsNil)
+	resolved, err := encoder.EncodeCheckpointEvent(2333)
+	c.Assert(err, check.IsNil)
+	msgs = append(msgs, ddl, resolved)
+
+	var (
+		rows       []*model.RowChangedEvent
+		ddls       []*model.DDLEvent
+		watermarks []uint64
+	)
+	handlers := CanalFlatEventHandlers{
+		OnRow: func(event *model.RowChangedEvent) error {
+			rows = append(rows, event)
+			return nil
+		},
+		OnDDL: func(event *model.DDLEvent) error {
+			ddls = append(ddls, event)
+			return nil
+		},
+		OnResolved: func(ts uint64) error {
+			watermarks = append(watermarks, ts)
+			return nil
+		},
+	}
+	decoder := newCanalFlatEventBatchDecoder(nil, true).(*CanalFlatEventBatchDecoder)
+	for _, msg := range msgs {
+		rawBytes, err := json.Marshal(msg)
+		c.Assert(err, check.IsNil)
+		decoder.Reset(rawBytes)
+		c.Assert(decoder.DecodeAll(handlers), check.IsNil)
+	}
+	c.Assert(rows, check.HasLen, 1)
+	c.Assert(rows[0].Table.Table, check.Equals, testCaseUpdate.Table.Table)
+	c.Assert(ddls, check.HasLen, 1)
+	c.Assert(ddls[0].Query, check.Equals, testCaseDDL.Query)
+	c.Assert(watermarks, check.DeepEquals, []uint64{2333})
+
+	// events without handlers are dropped.
+	rawBytes, err := json.Marshal(msgs[0])
+	c.Assert(err, check.IsNil)
+	decoder.Reset(rawBytes)
+	c.Assert(decoder.DecodeAll(CanalFlatEventHandlers{}), check.IsNil)
+	_, hasNext, err := decoder.HasNext()
+	c.Assert(err, check.IsNil)
+	c.Assert(hasNext, check.IsFalse)
+
+	// the error of the handler stops the decoding.
+	handlerErr := errors.New("handler error")
+	decoder.Reset(rawBytes)
+	err = decoder.DecodeAll(CanalFlatEventHandlers{OnRow: func(*model.RowChangedEvent) error { return handlerErr }})
+	c.Assert(errors.Cause(err), check.Equals, handlerErr)
+
+	// so does the decoding error.
+	decoder.Reset([]byte("invalid"))
+	c.Assert(decoder.DecodeAll(handlers), check.NotNil)
+	c.Assert(rows, check.HasLen, 1)
+}
+
+func (s *canalFlatSuite) TestAutoIncrement(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	idInfo := &mm.ColumnInfo{Name: mm.NewCIStr("id"), FieldType: *types.NewFieldType(mysql.TypeLong)}
+	idInfo.Flag |= mysql.AutoIncrementFlag | mysql.PriKeyFlag
+	nameInfo := &mm.ColumnInfo{Name: mm.NewCIStr("name"), FieldType: *types.NewFieldType(mysql.TypeVarchar)}
+	table := model.TableName{Schema: testCaseDDL.TableInfo.Schema, Table: testCaseDDL.TableInfo.Table}
+
+	builder := newCanalFlatEventBatchEncoderBuilder(map[string]string{
+		"enable-tidb-extension":     "true",
+		"schema-heartbeat-interval": "1ns",
+	})
+	encoder, err := builder.Build(context.Background())
+	c.Assert(err, check.IsNil)
+	flatEncoder := encoder.(*CanalFlatEventBatchEncoder)
+	flatEncoder.SetTableInfo(table, &mm.TableInfo{
+		Name:      mm.NewCIStr(table.Table),
+		Columns:   []*mm.ColumnInfo{idInfo, nameInfo},
+		AutoIncID: 30001,
+	})
+
+	ddl, err := encoder.EncodeDDLEvent(testCaseDDL)
+	c.Assert(err, check.IsNil)
+	time.Sleep(time.Millisecond)
+	bootstraps, err := flatEncoder.EncodeSchemaHeartbeats()
+	c.Assert(err, check.IsNil)
+	c.Assert(bootstraps, check.HasLen, 1)
+
+	// both the DDL and the bootstrap DDL carry the auto-increment offset.
+	for _, msg := range []*MQMessage{ddl, bootstraps[0]} {
+		message := &canalFlatMessageWithTiDBExtension{canalFlatMessage: &canalFlatMessage{}, Extensions: &tidbExtension{}}
+		c.Assert(json.Unmarshal(msg.Value, message), check.IsNil)
+		c.Assert(message.Extensions.AutoIncrement, check.Equals, int64(30001))
+	}
+
+	// tables without auto-increment columns have no auto-increment offset.
+	flatEncoder.SetTableInfo(table, &mm.TableInfo{
+		Name:      mm.NewCIStr(table.Table),
+		Columns:   []*mm.ColumnInfo{nameInfo},
+		AutoIncID: 30001,
+	})
+	ddl, err = encoder.EncodeDDLEvent(testCaseDDL)
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Contains(string(ddl.Value), "autoIncrement"), check.IsFalse)
+}
+
+func (s *canalFlatSuite) TestDecodeNumericPrimaryKey(c *check.C) {
+	defer testleak.AfterTest(c)()
+	defer SetJSONMarshaler(nil)
+
+	// the primary key is a JSON number beyond the precision of float64, e.g. produced by other producers.
+	value := []byte(`{"id":0,"database":"cdc","table":"person","pkNames":["id"],"isDdl":false,"type":"INSERT",` +
+		`"es":1591943372224,"ts":1591943372224,"sql":"","sqlType":{"id":-5,"name":12},` +
+		`"mysqlType":{"id":"bigint","name":"varchar"},"data":[{"id":9007199254740993,"name":"Bob"}],"old":null}`)
+
+	for _, m := range []JSONMarshaler{StdJSONMarshaler, JSONIterMarshaler} {
+		SetJSONMarshaler(m)
+		consumed := decodeCanalFlatRow(c, &MQMessage{Value: value, Type: model.MqMessageTypeRow}, false)
+
+		var id *model.Column
+		for _, col := range consumed.Columns {
+			if col.Name == "id" {
+				id = col
+			}
+		}
+		c.Assert(id, check.NotNil)
+		c.Assert(id.Value, check.Equals, "9007199254740993")
+		c.Assert(restoreCanalJSONColumnValues([]*model.Column{id}), check.IsNil)
+		c.Assert(id.Value, check.Equals, int64(9007199254740993))
+	}
+}
+
+func (s *canalFlatSuite) TestEmptyBatch(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"empty-batch": "foo"}), check.NotNil)
+
+	// nil by default.
+	c.Assert(encoder.Build(), check.IsNil)
+	c.Assert(encoder.SetParams(map[string]string{"empty-batch": "nil"}), check.IsNil)
+	c.Assert(encoder.Build(), check.IsNil)
+
+	c.Assert(encoder.SetParams(map[string]string{"empty-batch": "empty-slice"}), check.IsNil)
+	msgs := encoder.Build()
+	c.Assert(msgs, check.NotNil)
+	c.Assert(msgs, check.HasLen, 0)
+
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Unix(1640995200, 0))
+	encoder.clock = mockClock
+	c.Assert(encoder.SetParams(map[string]string{"empty-batch": "heartbeat"}), check.IsNil)
+	msgs = encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+	c.Assert(msgs[0].Type, check.Equals, model.MqMessageTypeUnknown)
+	c.Assert(msgs[0].GetRowsCount(), check.Equals, 0)
+	message := &canalFlatMessage{}
+	c.Assert(json.Unmarshal(msgs[0].Value, message), check.IsNil)
+	c.Assert(message.EventType, check.Equals, tidbHeartbeatType)
+	c.Assert(message.BuildTime, check.Equals, int64(1640995200000))
+
+	// the heartbeat is skipped by the decoder.
+	_, hasNext, err := newCanalFlatTestDecoder(c, msgs[0], false).HasNext()
+	c.Assert(err, check.IsNil)
+	c.Assert(hasNext, check.IsFalse)
+
+	// non-empty batches are not affected.
+	c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+	msgs = encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+	c.Assert(msgs[0].Type, check.Equals, model.MqMessageTypeRow)
+}
+
+func (s *canalFlatSuite) TestEpochOffset(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	const offset = int64(1600000000000)
+	buildTime := int64(1640995200000)
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Unix(1640995200, 0))
+	encoder := NewCanalFlatEventBatchEncoder().(*CanalFlatEventBatchEncoder)
+	c.Assert(encoder.SetParams(map[string]string{"epoch-offset-ms": "foo"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"epoch-offset-ms": strconv.FormatInt(offset, 10)}), check.IsNil)
+	encoder.clock = mockClock
+
+	c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+	ddlMsg, err := encoder.EncodeDDLEvent(testCaseDDL)
+	c.Assert(err, check.IsNil)
+
+	for _, tc := range []struct {
+		msg           *MQMessage
+		executionTime int64
+	}{
+		{msgs[0], convertToCanalTs(testCaseInsert.CommitTs)},
+		{ddlMsg, convertToCanalTs(testCaseDDL.CommitTs)},
+	} {
+		// `es` and `ts` are shifted by the offset on the wire.
+		message := &canalFlatMessage{}
+		c.Assert(json.Unmarshal(tc.msg.Value, message), check.IsNil)
+		c.Assert(message.ExecutionTime, check.Equals, tc.executionTime-offset)
+		c.Assert(message.BuildTime, check.Equals, buildTime-offset)
+
+		decoder := newCanalFlatTestDecoder(c, tc.msg, false)
+		decoder.SetEpochOffset(offset)
+		if tc.msg.Type == model.MqMessageTypeRow {
+			_, err = nextCanalFlatRow(c, decoder)
+		} else {
+			_, err = nextCanalFlatDDL(c, decoder)
+		}
+		c.Assert(err, check.IsNil)
+
+		c.Assert(decoder.ExecutionTime(), check.Equals, tc.executionTime)
+		c.Assert(decoder.BuildTime(), check.Equals, buildTime)
+	}
+}
+
+func (s *canalFlatSuite) TestStreamDecoder(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	const n = 10000
+	encoder := NewCanalFlatEventBatchEncoder().(*CanalFlatEventBatchEncoder)
+	c.Assert(encoder.SetParams(map[string]string{"enable-tidb-extension": "true", "empty-batch": "heartbeat"}), check.IsNil)
+	c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+	rowMsgs := encoder.Build()
+	c.Assert(rowMsgs, check.HasLen, 1)
+	heartbeatMsgs := encoder.Build()
+	c.Assert(heartbeatMsgs, check.HasLen, 1)
+	resolvedMsg, err := encoder.EncodeCheckpointEvent(testCaseInsert.CommitTs)
+	c.Assert(err, check.IsNil)
+	var lines [][]byte
+	for _, msg := range []*MQMessage{rowMsgs[0], heartbeatMsgs[0], resolvedMsg} {
+		line, err := json.Marshal(msg)
+		c.Assert(err, check.IsNil)
+		lines = append(lines, append(line, '\n'))
+	}
+
+	// write the rows, a heartbeat and a resolved event to a pipe, the writes block until they're read.
+	r, w := io.Pipe()
+	var written int64
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < n; i++ {
+			if _, err := w.Write(lines[0]); err != nil {
+				done <- err
+				return
+			}
+			atomic.AddInt64(&written, 1)
+		}
+		_, err := w.Write(lines[1])
+		if err == nil {
+			_, err = w.Write(lines[2])
+		}
+		done <- w.CloseWithError(err)
+	}()
+
+	decoder := NewCanalFlatStreamDecoder(r, true).(*CanalFlatEventBatchDecoder)
+	var rows, resolved int
+	for {
+		tp, hasNext, err := decoder.HasNext()
+		c.Assert(err, check.IsNil)
+		if !hasNext {
+			break
+		}
+		switch tp {
+		case model.MqMessageTypeRow:
+			row, err := decoder.NextRowChangedEvent()
+			c.Assert(err, check.IsNil)
+			c.Assert(row.Table.Table, check.Equals, testCaseInsert.Table.Table)
+			if rows == 0 {
+				// the messages are read lazily rather than buffered entirely.
+				c.Assert(atomic.LoadInt64(&written) < n, check.IsTrue)
+			}
+			rows++
+		case model.MqMessageTypeResolved:
+			ts, err := decoder.NextResolvedEvent()
+			c.Assert(err, check.IsNil)
+			c.Assert(ts, check.Equals, testCaseInsert.CommitTs)
+			resolved++
+		default:
+			c.Fatalf("unexpected message type %v", tp)
+		}
+	}
+	c.Assert(<-done, check.IsNil)
+	c.Assert(rows, check.Equals, n)
+	c.Assert(resolved, check.Equals, 1)
+	c.Assert(decoder.Stats(), check.DeepEquals, CanalFlatDecodeStats{Rows: n, Resolved: 1})
+
+	// malformed messages are reported.
+	decoder = NewCanalFlatStreamDecoder(strings.NewReader("{"), true).(*CanalFlatEventBatchDecoder)
+	_, _, err = decoder.HasNext()
+	c.Assert(err, check.NotNil)
+}
+
+func (s *canalFlatSuite) TestHashedKey(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	newRow := func(id int64, name string) *model.RowChangedEvent {
+		return &model.RowChangedEvent{
+			CommitTs: 417318403368288260,
+			Table:    &model.TableName{Schema: "cdc", Table: "person"},
+			Columns: []*model.Column{
+				{Name: "id", Type: mysql.TypeLong, Flag: model.PrimaryKeyFlag | model.HandleKeyFlag, Value: id},
+				{Name: "name", Type: mysql.TypeVarchar, Value: []byte(name)},
+			},
+		}
+	}
+	encoder := NewCanalFlatEventBatchEncoder().(*CanalFlatEventBatchEncoder)
+	c.Assert(encoder.SetParams(map[string]string{"hashed-key": "foo"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"hashed-key": "true", "enable-tidb-extension": "true"}), check.IsNil)
+	for _, row := range []*model.RowChangedEvent{newRow(1, "Alice"), newRow(1, "Bob"), newRow(2, "Alice")} {
+		c.Assert(encoder.AppendRowChangedEvent(row), check.IsNil)
+	}
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 3)
+
+	// rows with the same primary key share the fixed-length key.
+	c.Assert(msgs[0].Key, check.HasLen, 16)
+	c.Assert(msgs[0].Key, check.DeepEquals, msgs[1].Key)
+	c.Assert(msgs[2].Key, check.HasLen, 16)
+	c.Assert(msgs[2].Key, check.Not(check.DeepEquals), msgs[0].Key)
+
+	// the decoder recovers the raw primary keys of the hashed keys.
+	decoder := newCanalFlatEventBatchDecoder(nil, true).(*CanalFlatEventBatchDecoder)
+	for _, msg := range msgs {
+		rawBytes, err := json.Marshal(msg)
+		c.Assert(err, check.IsNil)
+		decoder.Reset(rawBytes)
+		_, err = nextCanalFlatRow(c, decoder)
+		c.Assert(err, check.IsNil)
+	}
+	pk, ok := decoder.PrimaryKey(msgs[0].Key)
+
+	c.Assert(ok, check.IsTrue)
+	c.Assert(pk, check.DeepEquals, map[string]string{"id": "1"})
+	pk, ok = decoder.PrimaryKey(msgs[2].Key)
+	c.Assert(ok, check.IsTrue)
+	c.Assert(pk, check.DeepEquals, map[string]string{"id": "2"})
+	_, ok = decoder.PrimaryKey([]byte("foo"))
+	c.Assert(ok, check.IsFalse)
+
+	// the keys are not hashed by default.
+	encoder = NewCanalFlatEventBatchEncoder().(*CanalFlatEventBatchEncoder)
+	c.Assert(encoder.AppendRowChangedEvent(newRow(1, "Alice")), check.IsNil)
+	msgs = encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+	c.Assert(msgs[0].Key, check.IsNil)
+}
+
+func (s *canalFlatSuite) TestColumnIncludeExclude(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	row := &model.RowChangedEvent{
+		CommitTs: 417318403368288260,
+		Table:    &model.TableName{Schema: "cdc", Table: "person"},
+		Columns: []*model.Column{
+			{Name: "id", Type: mysql.TypeLong, Flag: model.PrimaryKeyFlag | model.HandleKeyFlag, Value: int64(1)},
+			{Name: "name", Type: mysql.TypeVarchar, Value: "tidb"},
+			{Name: "Nickname", Type: mysql.TypeVarchar, Value: "ti"},
+			{Name: "age", Type: mysql.TypeLong, Value: int64(10)},
+			{Name: "email", Type: mysql.TypeVarchar, Value: "tidb@pingcap.com"},
+		},
+	}
+	row.PreColumns = row.Columns
+
+	encoder := NewCanalFlatEventBatchEncoder().(*CanalFlatEventBatchEncoder)
+	c.Assert(encoder.SetParams(map[string]string{"column-include": "a["}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"column-exclude": "a["}), check.NotNil)
+
+	for _, tc := range []struct {
+		params  map[string]string
+		columns []string
+	}{
+		{map[string]string{}, []string{"Nickname", "age", "email", "id", "name"}},
+		// the primary key is kept even though it's not included.
+		{map[string]string{"column-include": "*name, age"}, []string{"Nickname", "age", "id", "name"}},
+		// the primary key is kept even though it's excluded.
+		{map[string]string{"column-exclude": "email,i?"}, []string{"Nickname", "age", "id", "name"}},
+		{map[string]string{"column-include": "*name", "column-exclude": "nick*"}, []string{"id", "name"}},
+	} {
+		encoder := NewCanalFlatEventBatchEncoder().(*CanalFlatEventBatchEncoder)
+		c.Assert(encoder.SetParams(tc.params), check.IsNil)
+		msg, err := encoder.newFlatMessageForDML(row)
+		c.Assert(err, check.IsNil)
+		flatMessage := msg.(*canalFlatMessage)
+		c.Assert(flatMessage.PKNames, check.DeepEquals, []string{"id"})
+
+		// the type maps and the rows have the same columns.
+		for _, columns := range []interface{}{flatMessage.SQLType, flatMessage.MySQLType, flatMessage.Data[0], flatMessage.Old[0]} {
+			keys := reflect.ValueOf(columns).MapKeys()
+			names := make([]string, 0, len(keys))
+			for _, key := range keys {
+				names = append(names, key.String())
+			}
+			sort.Strings(names)
+			c.Assert(names, check.DeepEquals, tc.columns)
+		}
+	}
+}
+
+func (s *canalFlatSuite) TestMaxJSONDepth(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"max-json-depth": "foo"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"max-json-depth": "-1"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"json-depth-overflow": "foo"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"max-json-depth": "2"}), check.IsNil)
+	c.Assert(encoder.maxJSONDepth, check.Equals, 2)
+
+	newInsert := func() *model.RowChangedEvent {
+		return &model.RowChangedEvent{
+			CommitTs: 417318403368288260,
+			Table:    &model.TableName{Schema: "cdc", Table: "json"},
+			Columns: []*model.Column{
+				{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: int64(1)},
+				{Name: "shallow", Type: mysql.TypeJSON, Value: `{"a": [1, 2], "b": "<c>"}`},
+				{Name: "deep", Type: mysql.TypeJSON, Value: `{"a": {"b": {"c": 1}}, "d": [[1], [[2]]], "e": 1.50}`},
+				{Name: "text", Type: mysql.TypeVarchar, Value: `{"a": {"b": {"c": 1}}}`},
+			},
+		}
+	}
+
+	// the deep value is truncated by default.
+	c.Assert(encoder.AppendRowChangedEvent(newInsert()), check.IsNil)
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+	message := &canalFlatMessage{}
+	c.Assert(json.Unmarshal(msgs[0].Value, message), check.IsNil)
+	c.Assert(message.Data[0]["shallow"], check.Equals, `{"a": [1, 2], "b": "<c>"}`)
+	c.Assert(message.Data[0]["deep"], check.Equals, `{"a":{"b":"..."},"d":["...","..."],"e":1.50}`)
+	c.Assert(message.Data[0]["text"], check.Equals, `{"a": {"b": {"c": 1}}}`)
+
+	// the row is rejected if configured.
+	c.Assert(encoder.SetParams(map[string]string{"json-depth-overflow": "error"}), check.IsNil)
+	err := encoder.AppendRowChangedEvent(newInsert())
+	c.Assert(err, check.ErrorMatches, ".*JSON column deep is nested deeper than max-json-depth 2.*")
+	c.Assert(encoder.Build(), check.HasLen, 0)
+
+	// unlimited.
+	c.Assert(encoder.SetParams(map[string]string{"max-json-depth": "0"}), check.IsNil)
+	c.Assert(encoder.AppendRowChangedEvent(newInsert()), check.IsNil)
+	msgs = encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+	message = &canalFlatMessage{}
+	c.Assert(json.Unmarshal(msgs[0].Value, message), check.IsNil)
+	c.Assert(message.Data[0]["deep"], check.Equals, `{"a": {"b": {"c": 1}}, "d": [[1], [[2]]], "e": 1.50}`)
+}
+
+func (s *canalFlatSuite) TestCheckpointResume(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	newRow := func(commitTs uint64, id int64) *model.RowChangedEvent {
+		return &model.RowChangedEvent{
+			CommitTs: commitTs,
+			Table:    &model.TableName{Schema: "cdc", Table: "checkpoint"},
+			Columns: []*model.Column{
+				{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: id},
+			},
+		}
+	}
+	// the events are replayed from the first one after the restart.
+	events := []*model.RowChangedEvent{
+		newRow(417318403368288260, 1),
+		newRow(417318403368288261, 2),
+		newRow(417318403368288261, 3),
+		newRow(417318403368288261, 4),
+		newRow(417318403368288262, 5),
+	}
+	builtIDs := func(msgs []*MQMessage) []string {
+		ids := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			message := &canalFlatMessage{}
+			c.Assert(json.Unmarshal(msg.Value, message), check.IsNil)
+			ids = append(ids, message.Data[0]["id"].(string))
+		}
+		return ids
+	}
+
+	encoder := NewCanalFlatEventBatchEncoder().(*CanalFlatEventBatchEncoder)
+	c.Assert(encoder.Checkpoint(), check.Equals, CanalFlatCheckpoint{})
+	for _, e := range events[:3] {
+		c.Assert(encoder.AppendRowChangedEvent(e), check.IsNil)
+	}
+	c.Assert(builtIDs(encoder.Build()), check.DeepEquals, []string{"1", "2", "3"})
+	cp := encoder.Checkpoint()
+	c.Assert(cp, check.Equals, CanalFlatCheckpoint{CommitTs: 417318403368288261, Offset: 2})
+	// appended but not built before the restart.
+	c.Assert(encoder.AppendRowChangedEvent(events[3]), check.IsNil)
+	c.Assert(encoder.Checkpoint(), check.Equals, cp)
+
+	encoder = NewCanalFlatEventBatchEncoder().(*CanalFlatEventBatchEncoder)
+	encoder.ResumeFrom(cp)
+	c.Assert(encoder.Checkpoint(), check.Equals, cp)
+	for _, e := range events {
+		c.Assert(encoder.AppendRowChangedEvent(e), check.IsNil)
+	}
+	c.Assert(builtIDs(encoder.Build()), check.DeepEquals, []string{"4", "5"})
+	c.Assert(encoder.Checkpoint(), check.Equals, CanalFlatCheckpoint{CommitTs: 417318403368288262, Offset: 1})
+
+	// events after the checkpoint are never skipped.
+	c.Assert(encoder.AppendRowChangedEvent(newRow(417318403368288262, 6)), check.IsNil)
+	c.Assert(builtIDs(encoder.Build()), check.DeepEquals, []string{"6"})
+	c.Assert(encoder.Checkpoint(), check.Equals, CanalFlatCheckpoint{CommitTs: 417318403368288262, Offset: 2})
+}
+
+func (s *canalFlatSuite) TestDeleteKeyOnly(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"delete-key-only": "foo"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"delete-key-only": "true"}), check.IsNil)
+	c.Assert(encoder.deleteKeyOnly, check.IsTrue)
+
+	columns := []*model.Column{
+		{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: int64(1)},
+		{Name: "name", Type: mysql.TypeVarchar, Value: "foo"},
+		{Name: "age", Type: mysql.TypeLong, Value: int64(10)},
+	}
+	table := &model.TableName{Schema: "cdc", Table: "delete"}
+	insert := &model.RowChangedEvent{CommitTs: 417318403368288260, Table: table, Columns: columns}
+	deleted := &model.RowChangedEvent{CommitTs: 417318403368288261, Table: table, PreColumns: columns}
+	// the rows of tables without keys are deleted by the full before-images.
+	noKeyColumns := []*model.Column{
+		{Name: "name", Type: mysql.TypeVarchar, Value: "foo"},
+		{Name: "age", Type: mysql.TypeLong, Value: int64(10)},
+	}
+	noKeyDeleted := &model.RowChangedEvent{
+		CommitTs: 417318403368288262, Table: &model.TableName{Schema: "cdc", Table: "nokey"}, PreColumns: noKeyColumns,
+	}
+	for _, e := range []*model.RowChangedEvent{insert, deleted, noKeyDeleted} {
+		c.Assert(encoder.AppendRowChangedEvent(e), check.IsNil)
+	}
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 3)
+
+	messages := make([]*canalFlatMessage, len(msgs))
+	for i, msg := range msgs {
+		messages[i] = &canalFlatMessage{}
+		c.Assert(json.Unmarshal(msg.Value, messages[i]), check.IsNil)
+	}
+	c.Assert(messages[0].Data[0], check.HasLen, 3)
+	c.Assert(messages[1].EventType, check.Equals, "DELETE")
+	c.Assert(messages[1].Data[0], check.DeepEquals, map[string]interface{}{"id": "1"})
+	c.Assert(messages[1].MySQLType, check.DeepEquals, map[string]string{"id": "int"})
+	c.Assert(messages[1].PKNames, check.DeepEquals, []string{"id"})
+	c.Assert(messages[2].Data[0], check.HasLen, 2)
+
+	for i, msg := range msgs {
+		consumed := decodeCanalFlatRow(c, msg, false)
+		switch i {
+		case 0:
+			c.Assert(consumed.IsInsert(), check.IsTrue)
+			c.Assert(consumed.Columns, check.HasLen, 3)
+		case 1:
+			c.Assert(consumed.IsDelete(), check.IsTrue)
+			c.Assert(consumed.PreColumns, check.HasLen, 1)
+			c.Assert(consumed.PreColumns[0].Name, check.Equals, "id")
+			c.Assert(consumed.PreColumns[0].Value, check.Equals, "1")
+			c.Assert(consumed.PreColumns[0].Flag.IsPrimaryKey(), check.IsTrue)
+			c.Assert(consumed.PreColumns[0].Flag.IsHandleKey(), check.IsTrue)
+		case 2:
+			c.Assert(consumed.IsDelete(), check.IsTrue)
+			c.Assert(consumed.PreColumns, check.HasLen, 2)
+			for _, col := range consumed.PreColumns {
+				c.Assert(col.Flag.IsPrimaryKey(), check.IsFalse)
+			}
+		}
+	}
+}
+
+func (s *canalFlatSuite) TestBuildManifest(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	payload, manifest, err := encoder.BuildManifest()
+	c.Assert(err, check.IsNil)
+	c.Assert(payload, check.IsNil)
+	c.Assert(manifest, check.DeepEquals, CanalFlatManifest{Tables: []string{}})
+
+	newRow := func(commitTs uint64, table string, id int64) *model.RowChangedEvent {
+		return &model.RowChangedEvent{
+			CommitTs: commitTs,
+			Table:    &model.TableName{Schema: "cdc", Table: table},
+			Columns: []*model.Column{
+				{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: id},
+			},
+		}
+	}
+	events := []*model.RowChangedEvent{
+		newRow(417318403368288261, "b", 1),
+		newRow(417318403368288260, "a", 2),
+		newRow(417318403368288263, "b", 3),
+		newRow(417318403368288262, "a", 4),
+	}
+	for _, e := range events {
+		c.Assert(encoder.AppendRowChangedEvent(e), check.IsNil)
+	}
+	payload, manifest, err = encoder.BuildManifest()
+	c.Assert(err, check.IsNil)
+	c.Assert(manifest, check.DeepEquals, CanalFlatManifest{
+		Count:       4,
+		MinCommitTs: 417318403368288260,
+		MaxCommitTs: 417318403368288263,
+		Tables:      []string{"`cdc`.`a`", "`cdc`.`b`"},
+	})
+	// the buffer is flushed.
+	c.Assert(encoder.Build(), check.HasLen, 0)
+
+	lines := strings.Split(strings.TrimSuffix(string(payload), "\n"), "\n")
+	c.Assert(lines, check.HasLen, len(events))
+	for i, line := range lines {
+		message := &canalFlatMessage{}
+		c.Assert(json.Unmarshal([]byte(line), message), check.IsNil)
+		c.Assert(message.Table, check.Equals, events[i].Table.Table)
+		c.Assert(message.Data[0]["id"], check.Equals, strconv.FormatInt(events[i].Columns[0].Value.(int64), 10))
+	}
+
+	c.Assert(encoder.SetParams(map[string]string{"envelope": "cbor"}), check.IsNil)
+	_, _, err = encoder.BuildManifest()
+	c.Assert(err, check.NotNil)
+}
+
+func (s *canalFlatSuite) TestEmitCommitTs(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	invalid := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(invalid.SetParams(map[string]string{"emit-commit-ts": "foo"}), check.NotNil)
+
+	for _, enableTiDBExtension := range []bool{false, true} {
+		for _, emitCommitTs := range []bool{false, true} {
+			encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+			c.Assert(encoder.SetParams(map[string]string{
+				"enable-tidb-extension": strconv.FormatBool(enableTiDBExtension),
+				"emit-commit-ts":        strconv.FormatBool(emitCommitTs),
+			}), check.IsNil)
+			c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+			msgs := encoder.Build()
+			c.Assert(msgs, check.HasLen, 1)
+			ddl, err := encoder.EncodeDDLEvent(testCaseDDL)
+			c.Assert(err, check.IsNil)
+
+			// the top-level `commitTs` is only emitted without the TiDB extension.
+			var raw map[string]interface{}
+			c.Assert(json.Unmarshal(msgs[0].Value, &raw), check.IsNil)
+			_, ok := raw["commitTs"]
+			c.Assert(ok, check.Equals, emitCommitTs && !enableTiDBExtension)
+
+			exact := enableTiDBExtension || emitCommitTs
+			for _, msg := range []*MQMessage{msgs[0], ddl} {
+				var commitTs, expected uint64
+				if msg.Type == model.MqMessageTypeRow {
+					row := decodeCanalFlatRow(c, msg, enableTiDBExtension)
+					commitTs, expected = row.CommitTs, testCaseInsert.CommitTs
+				} else {
+					event := decodeCanalFlatDDL(c, msg, enableTiDBExtension)
+					commitTs, expected = event.CommitTs, testCaseDDL.CommitTs
+				}
+				if !exact {
+					expected = oracle.ComposeTS(convertToCanalTs(expected), 0)
+				}
+				c.Assert(commitTs, check.Equals, expected)
+			}
+		}
+	}
+}
+
+func (s *canalFlatSuite) TestSize(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	for _, enableTiDBExtension := range []bool{false, true} {
+		encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+		c.Assert(encoder.SetParams(map[string]string{
+			"enable-tidb-extension": strconv.FormatBool(enableTiDBExtension),
+		}), check.IsNil)
+		c.Assert(encoder.Size(), check.Equals, 0)
+
+		const count = 100
+		size := 0
+		for i := 0; i < count; i++ {
+			c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+			c.Assert(encoder.Size(), check.Greater, size)
+			size = encoder.Size()
+		}
+
+		msgs := encoder.Build()
+		c.Assert(msgs, check.HasLen, count)
+		c.Assert(encoder.Size(), check.Equals, 0)
+		built := 0
+		for _, msg := range msgs {
+			built += len(msg.Key) + len(msg.Value)
+		}
+		// the messages are timestamped again when built, so the sizes may differ in a few bytes per message.
+		diff := size - built
+		if diff < 0 {
+			diff = -diff
+		}
+		c.Assert(diff <= count*32, check.IsTrue, check.Commentf("size %d, built %d", size, built))
+	}
+}
+
+func (s *canalFlatSuite) TestMaxMessageBytes(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	for _, params := range []map[string]string{
+		{"max-message-bytes": "foo"},
+		{"max-message-bytes": "0"},
+		{"pack-messages": "foo"},
+		{"pack-messages": "true", "envelope": "cbor"},
+	} {
+		encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+		c.Assert(encoder.SetParams(params), check.NotNil)
+	}
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{}), check.IsNil)
+	c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+	length := msgs[0].Length()
+
+	// a row exceeding the limit is rejected.
+	encoder = &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"max-message-bytes": strconv.Itoa(length - 1)}), check.IsNil)
+	err := encoder.AppendRowChangedEvent(testCaseInsert)
+	c.Assert(err, check.ErrorMatches, ".*exceeds max-message-bytes.*")
+	c.Assert(encoder.Build(), check.HasLen, 0)
+
+	encoder = &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"max-message-bytes": strconv.Itoa(length)}), check.IsNil)
+	c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+	c.Assert(encoder.Build(), check.HasLen, 1)
+
+	// the packed arrays are split at the limit, which fits 3 rows in each of them.
+	rowLength := len(msgs[0].Value)
+	maxMessageBytes := length + len("[]") + 2*(len(",")+rowLength)
+	encoder = &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{
+		"max-message-bytes": strconv.Itoa(maxMessageBytes),
+		"pack-messages":     "true",
+	}), check.IsNil)
+	for i := 0; i < 7; i++ {
+		c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+	}
+	msgs = encoder.Build()
+	c.Assert(msgs, check.HasLen, 3)
+	for i, rows := range []int{3, 3, 1} {
+		c.Assert(msgs[i].Length() <= maxMessageBytes, check.IsTrue)
+		c.Assert(msgs[i].GetRowsCount(), check.Equals, rows)
+		var packed []canalFlatMessage
+		c.Assert(json.Unmarshal(msgs[i].Value, &packed), check.IsNil)
+		c.Assert(packed, check.HasLen, rows)
+		for _, msg := range packed {
+			c.Assert(msg.EventType, check.Equals, "INSERT")
+			c.Assert(msg.Table, check.Equals, testCaseInsert.Table.Table)
+		}
+	}
+}
+
+func (s *canalFlatSuite) TestExtensionRaw(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), enableTiDBExtension: true}
+	c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+
+	decode := func(msg *MQMessage) *CanalFlatEventBatchDecoder {
+		decoder := newCanalFlatTestDecoder(c, msg, true)
+		row, err := nextCanalFlatRow(c, decoder)
+		c.Assert(err, check.IsNil)
+		c.Assert(row.CommitTs, check.Equals, testCaseInsert.CommitTs)
+		return decoder
+	}
+	c.Assert(decode(msgs[0]).Raw(), check.IsNil)
+
+	// a custom field added to the extension by another producer.
+	var message map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(msgs[0].Value))
+	d.UseNumber()
+	c.Assert(d.Decode(&message), check.IsNil)
+	message["_tidb"].(map[string]interface{})["custom"] = map[string]interface{}{"foo": "bar"}
+	value, err := json.Marshal(message)
+	c.Assert(err, check.IsNil)
+	msgs[0].Value = value
+
+	raw := decode(msgs[0]).Raw()
+	c.Assert(raw, check.HasLen, 1)
+	c.Assert(string(raw["custom"]), check.Equals, `{"foo":"bar"}`)
+}
+
+func (s *canalFlatSuite) TestDDLEventType(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	for _, cs := range []struct {
+		query    string
+		action   mm.ActionType
+		expected mm.ActionType
+	}{
+		{"create table person(id int primary key)", mm.ActionCreateTable, mm.ActionCreateTable},
+		{"drop table person", mm.ActionDropTable, mm.ActionDropTable},
+		{"truncate table person", mm.ActionTruncateTable, mm.ActionTruncateTable},
+		{"alter table person add index idx(name)", mm.ActionAddIndex, mm.ActionAddIndex},
+		// ALTER TABLE is decoded as the representative action.
+		{"alter table person modify column name varchar(64)", mm.ActionModifyColumn, mm.ActionAddColumn},
+		{"create database cdc", mm.ActionCreateSchema, mm.ActionNone},
+	} {
+		ddl := &model.DDLEvent{
+			CommitTs:  testCaseDDL.CommitTs,
+			TableInfo: &model.SimpleTableInfo{Schema: "cdc", Table: "person"},
+			Query:     cs.query,
+			Type:      cs.action,
+		}
+		msg, err := encoder.EncodeDDLEvent(ddl)
+		c.Assert(err, check.IsNil)
+		decoded := decodeCanalFlatDDL(c, msg, false)
+		c.Assert(decoded.Query, check.Equals, cs.query)
+		c.Assert(decoded.Type, check.Equals, cs.expected, check.Commentf("query %s", cs.query))
+	}
+}
+
+func (s *canalFlatSuite) TestSplitByTransaction(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"split-by-transaction": "foo"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"split-by-transaction": "true", "envelope": "cbor"}), check.NotNil)
+
+	txn2 := *testCaseInsert
+	txn2.CommitTs = testCaseInsert.CommitTs + 1
+	for _, split := range []bool{false, true} {
+		encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+		c.Assert(encoder.SetParams(map[string]string{
+			"pack-messages":        "true",
+			"split-by-transaction": strconv.FormatBool(split),
+		}), check.IsNil)
+		for _, e := range []*model.RowChangedEvent{testCaseInsert, testCaseInsert, &txn2, &txn2} {
+			c.Assert(encoder.AppendRowChangedEvent(e), check.IsNil)
+		}
+		msgs := encoder.Build()
+		if !split {
+			// the transactions are packed together.
+			c.Assert(msgs, check.HasLen, 1)
+			c.Assert(msgs[0].GetRowsCount(), check.Equals, 4)
+			continue
+		}
+		c.Assert(msgs, check.HasLen, 2)
+		for i, commitTs := range []uint64{testCaseInsert.CommitTs, txn2.CommitTs} {
+			c.Assert(msgs[i].Ts, check.Equals, commitTs)
+			c.Assert(msgs[i].GetRowsCount(), check.Equals, 2)
+			var packed []canalFlatMessage
+			c.Assert(json.Unmarshal(msgs[i].Value, &packed), check.IsNil)
+			c.Assert(packed, check.HasLen, 2)
+		}
+	}
+}
+
+func (s *canalFlatSuite) TestDeterministicOutput(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Unix(1640995200, 0))
+	for _, envelope := range []string{canalFlatEnvelopeJSON, canalFlatEnvelopeCBOR} {
+		var expected *MQMessage
+		// the map iteration order is random, so the row is encoded for several times to catch any instability.
+		for i := 0; i < 16; i++ {
+			encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), clock: mockClock}
+			c.Assert(encoder.SetParams(map[string]string{
+				"enable-tidb-extension": "true",
+				"envelope":              envelope,
+			}), check.IsNil)
+			c.Assert(encoder.AppendRowChangedEvent(testCaseUpdate), check.IsNil)
+			msgs := encoder.Build()
+			c.Assert(msgs, check.HasLen, 1)
+			if expected == nil {
+				expected = msgs[0]
+				continue
+			}
+			c.Assert(msgs[0].Value, check.DeepEquals, expected.Value, check.Commentf("envelope %s", envelope))
+		}
+
+		// the decoded columns are in the same order as they're emitted.
+		row := decodeCanalFlatRow(c, expected, true)
+		for _, cols := range [][]*model.Column{row.Columns, row.PreColumns} {
+			c.Assert(cols, check.Not(check.HasLen), 0)
+			c.Assert(sort.SliceIsSorted(cols, func(i, j int) bool { return cols[i].Name < cols[j].Name }), check.IsTrue)
+		}
+	}
+}
+
+func (s *canalFlatSuite) TestDecodedColumnOrder(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	row := encodeDecodeRow(c, nil, &model.RowChangedEvent{
+		CommitTs: 417318403368288260,
+		Table:    &model.TableName{Schema: "cdc", Table: "person"},
+		Columns: []*model.Column{
+			{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: int64(1)},
+			{Name: "name", Type: mysql.TypeVarchar, Value: []byte("Bob")},
+			{Name: "age", Type: mysql.TypeLong, Value: int64(18)},
+		},
+	})
+	// the columns are decoded in ascending order of their names, they were in descending order before.
+	names := make([]string, 0, len(row.Columns))
+	for _, col := range row.Columns {
+		names = append(names, col.Name)
+	}
+	c.Assert(names, check.DeepEquals, []string{"age", "id", "name"})
+}
+
+func (s *canalFlatSuite) TestOnlyOutputUpdatedColumns(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"only-output-updated-columns": "foo"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"only-output-updated-columns": "true"}), check.IsNil)
+	c.Assert(encoder.onlyOutputUpdatedColumns, check.IsTrue)
+
+	table := &model.TableName{Schema: "cdc", Table: "update"}
+	preColumns := []*model.Column{
+		{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: int64(1)},
+		{Name: "name", Type: mysql.TypeVarchar, Value: "foo"},
+		{Name: "age", Type: mysql.TypeLong, Value: int64(10)},
+		{Name: "note", Type: mysql.TypeVarchar, Value: nil},
+	}
+	columns := []*model.Column{
+		{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: int64(1)},
+		{Name: "name", Type: mysql.TypeVarchar, Value: "bar"},
+		{Name: "age", Type: mysql.TypeLong, Value: int64(10)},
+		{Name: "note", Type: mysql.TypeVarchar, Value: nil},
+	}
+	update := &model.RowChangedEvent{CommitTs: 417318403368288260, Table: table, PreColumns: preColumns, Columns: columns}
+	// only the keys are emitted in `old` if no other column is changed.
+	unchanged := &model.RowChangedEvent{CommitTs: 417318403368288261, Table: table, PreColumns: columns, Columns: columns}
+	for _, e := range []*model.RowChangedEvent{update, unchanged} {
+		c.Assert(encoder.AppendRowChangedEvent(e), check.IsNil)
+	}
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 2)
+
+	messages := make([]*canalFlatMessage, len(msgs))
+	for i, msg := range msgs {
+		messages[i] = &canalFlatMessage{}
+		c.Assert(json.Unmarshal(msg.Value, messages[i]), check.IsNil)
+		c.Assert(messages[i].EventType, check.Equals, "UPDATE")
+		// the types of all the columns are kept for the new row.
+		c.Assert(messages[i].Data[0], check.HasLen, 4)
+		c.Assert(messages[i].SQLType, check.HasLen, 4)
+		c.Assert(messages[i].MySQLType, check.HasLen, 4)
+	}
+	c.Assert(messages[0].Old[0], check.DeepEquals, map[string]interface{}{"id": "1", "name": "foo"})
+	c.Assert(messages[1].Old[0], check.DeepEquals, map[string]interface{}{"id": "1"})
+
+	for i, msg := range msgs {
+		decoder := newCanalFlatTestDecoder(c, msg, false)
+		decoder.SetOnlyUpdatedColumns(true)
+		consumed, err := nextCanalFlatRow(c, decoder)
+		c.Assert(err, check.IsNil)
+		c.Assert(consumed.IsUpdate(), check.IsTrue)
+		// the unchanged columns are restored from the new row.
+		c.Assert(consumed.PreColumns, check.HasLen, 4)
+		pre := make(map[string]interface{}, len(consumed.PreColumns))
+		for _, col := range consumed.PreColumns {
+			pre[col.Name] = col.Value
+		}
+		c.Assert(pre["age"], check.Equals, "10")
+		c.Assert(pre["note"], check.IsNil)
+		if i == 0 {
+			c.Assert(pre["name"], check.Equals, "foo")
+		} else {
+			c.Assert(pre["name"], check.Equals, "bar")
+		}
+	}
+}
+
+func (s *canalFlatSuite) TestInlineSchema(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"inline-schema": "foo"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"inline-schema": "true"}), check.IsNil)
+	c.Assert(encoder.inlineSchema, check.IsTrue)
+
+	columns := []*model.Column{
+		{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: int64(1)},
+		{Name: "name", Type: mysql.TypeVarchar, Flag: model.NullableFlag | model.UniqueKeyFlag, Value: "foo"},
+		{Name: "age", Type: mysql.TypeLong, Flag: model.NullableFlag | model.UnsignedFlag, Value: uint64(10)},
+	}
+	e := &model.RowChangedEvent{
+		CommitTs: 417318403368288260, Table: &model.TableName{Schema: "cdc", Table: "inline"}, Columns: columns,
+	}
+	c.Assert(encoder.AppendRowChangedEvent(e), check.IsNil)
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+
+	message := &canalFlatMessage{}
+	c.Assert(json.Unmarshal(msgs[0].Value, message), check.IsNil)
+	c.Assert(message.ColumnSchema, check.HasLen, 3)
+	for i, name := range []string{"age", "id", "name"} {
+		c.Assert(message.ColumnSchema[i].Name, check.Equals, name)
+		c.Assert(message.ColumnSchema[i].MySQLType, check.Equals, message.MySQLType[name])
+		c.Assert(message.ColumnSchema[i].SQLType, check.Equals, message.SQLType[name])
+	}
+
+	// the types are stripped, so the message can only be decoded from the inline schema.
+	var raw map[string]json.RawMessage
+	c.Assert(json.Unmarshal(msgs[0].Value, &raw), check.IsNil)
+	delete(raw, "sqlType")
+	delete(raw, "mysqlType")
+	value, err := json.Marshal(raw)
+	c.Assert(err, check.IsNil)
+	msgs[0].Value = value
+
+	consumed := decodeCanalFlatRow(c, msgs[0], false)
+	c.Assert(consumed.IsInsert(), check.IsTrue)
+	c.Assert(consumed.Columns, check.HasLen, len(columns))
+	expected := make(map[string]*model.Column, len(columns))
+	for _, col := range columns {
+		expected[col.Name] = col
+	}
+	for _, col := range consumed.Columns {
+		c.Assert(col.Type, check.Equals, expected[col.Name].Type)
+		c.Assert(col.Flag, check.Equals, expected[col.Name].Flag)
+		c.Assert(col.Value, check.Equals, fmt.Sprint(expected[col.Name].Value))
+	}
+}
+
+func (s *canalFlatSuite) TestCompression(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"compression": "lz4"}), check.NotNil)
+
+	decode := func(compression string, msg *MQMessage) (*model.RowChangedEvent, error) {
+		decoder := newCanalFlatTestDecoder(c, msg, true)
+		decoder.SetCompression(compression)
+		if _, _, err := decoder.HasNext(); err != nil {
+			return nil, err
+		}
+		return decoder.NextRowChangedEvent()
+	}
+
+	mockClock := clock.NewMock()
+	encode := func(compression string) *MQMessage {
+		encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), clock: mockClock}
+		c.Assert(encoder.SetParams(map[string]string{
+			"enable-tidb-extension": "true",
+			"compression":           compression,
+		}), check.IsNil)
+		c.Assert(encoder.AppendRowChangedEvent(testCaseUpdate), check.IsNil)
+		msgs := encoder.Build()
+		c.Assert(msgs, check.HasLen, 1)
+		return msgs[0]
+	}
+
+	plain := encode("none")
+	expected, err := decode("none", plain)
+	c.Assert(err, check.IsNil)
+	c.Assert(expected.CommitTs, check.Equals, testCaseUpdate.CommitTs)
+	c.Assert(expected.Table, check.DeepEquals, testCaseUpdate.Table)
+
+	for _, compression := range []string{"gzip", "snappy"} {
+		msg := encode(compression)
+		c.Assert(msg.Value, check.Not(check.DeepEquals), plain.Value)
+		consumed, err := decode(compression, msg)
+		c.Assert(err, check.IsNil, check.Commentf("compression %s", compression))
+		c.Assert(consumed, check.DeepEquals, expected, check.Commentf("compression %s", compression))
+	}
+
+	// the messages compressed otherwise fail to be decoded.
+	gzipped, snappied := encode("gzip"), encode("snappy")
+	for _, tc := range []struct {
+		compression string
+		msg         *MQMessage
+	}{
+		{"none", gzipped},
+		{"snappy", gzipped},
+		{"gzip", snappied},
+		{"gzip", plain},
+		{"lz4", gzipped},
+	} {
+		_, err := decode(tc.compression, tc.msg)
+		c.Assert(err, check.NotNil, check.Commentf("compression %s", tc.compression))
+	}
+}
+
+func (s *canalFlatSuite) TestDecodeArray(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	events := []*model.RowChangedEvent{testCaseInsert, testCaseUpdate, testCaseDelete}
+	checkRows := func(decoder EventBatchDecoder) {
+		for _, event := range events {
+			row, err := nextCanalFlatRow(c, decoder)
+			c.Assert(err, check.IsNil)
+			c.Assert(row.CommitTs, check.Equals, event.CommitTs)
+			c.Assert(row.Table.Table, check.Equals, event.Table.Table)
+			c.Assert(len(row.Columns) > 0, check.Equals, len(event.Columns) > 0)
+			c.Assert(len(row.PreColumns) > 0, check.Equals, len(event.PreColumns) > 0)
+		}
+		_, hasNext, err := decoder.HasNext()
+		c.Assert(err, check.IsNil)
+		c.Assert(hasNext, check.IsFalse)
+	}
+
+	// a JSON array of messages, the heartbeats in it are skipped.
+	var msgs []*MQMessage
+	for _, event := range events {
+		msg := encodeCanalFlatRow(c, map[string]string{"enable-tidb-extension": "true"}, event)
+		msgs = append(msgs, msg, &MQMessage{Type: model.MqMessageTypeUnknown})
+	}
+	rawBytes, err := json.Marshal(msgs)
+	c.Assert(err, check.IsNil)
+	checkRows(newCanalFlatEventBatchDecoder(rawBytes, true))
+
+	// a message whose value is a JSON array of flat messages.
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), enableTiDBExtension: true}
+	c.Assert(encoder.SetParams(map[string]string{"pack-messages": "true"}), check.IsNil)
+	for _, event := range events {
+		c.Assert(encoder.AppendRowChangedEvent(event), check.IsNil)
+	}
+	packed := encoder.Build()
+	c.Assert(packed, check.HasLen, 1)
+	checkRows(newCanalFlatTestDecoder(c, packed[0], true))
+
+	// a single message still works.
+	decoder := newCanalFlatTestDecoder(c, msgs[0], true)
+	_, err = nextCanalFlatRow(c, decoder)
+	c.Assert(err, check.IsNil)
+	_, hasNext, err := decoder.HasNext()
+	c.Assert(err, check.IsNil)
+	c.Assert(hasNext, check.IsFalse)
+}
+
+func (s *canalFlatSuite) TestIdempotencyKey(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"idempotency-key": "foo"}), check.NotNil)
+
+	mockClock := clock.NewMock()
+	encode := func(params map[string]string, event *model.RowChangedEvent) (*MQMessage, string) {
+		// the encoders are timestamped differently.
+		mockClock.Add(time.Hour)
+		encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), clock: mockClock}
+		c.Assert(encoder.SetParams(params), check.IsNil)
+		c.Assert(encoder.AppendRowChangedEvent(event), check.IsNil)
+		msgs := encoder.Build()
+		c.Assert(msgs, check.HasLen, 1)
+		var msg canalFlatMessageWithTiDBExtension
+		c.Assert(json.Unmarshal(msgs[0].Value, &msg), check.IsNil)
+		return msgs[0], msg.Extensions.IdempotencyKey
+	}
+	params := map[string]string{"enable-tidb-extension": "true", "idempotency-key": "true"}
+
+	// the same event produces the same key across the encoders.
+	msg, key := encode(params, testCaseUpdate)
+	c.Assert(key, check.Not(check.Equals), "")
+	_, another := encode(params, testCaseUpdate)
+	c.Assert(another, check.Equals, key)
+
+	// the other events produce different keys.
+	for _, event := range []*model.RowChangedEvent{testCaseInsert, testCaseDelete} {
+		_, other := encode(params, event)
+		c.Assert(other, check.Not(check.Equals), key)
+	}
+
+	// the key is read by the decoder.
+	decoder := newCanalFlatTestDecoder(c, msg, true)
+	_, err := nextCanalFlatRow(c, decoder)
+	c.Assert(err, check.IsNil)
+	c.Assert(decoder.IdempotencyKey(), check.Equals, key)
+
+	// the key is absent by default.
+	_, key = encode(map[string]string{"enable-tidb-extension": "true"}, testCaseUpdate)
+	c.Assert(key, check.Equals, "")
+}
+
+func (s *canalFlatSuite) TestDecodePrimaryKeyFlags(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	pkFlag := model.HandleKeyFlag | model.PrimaryKeyFlag
+	event := &model.RowChangedEvent{
+		CommitTs: 417318403368288260,
+		Table:    &model.TableName{Schema: "cdc", Table: "composite"},
+		PreColumns: []*model.Column{
+			{Name: "tenant", Type: mysql.TypeVarchar, Flag: pkFlag, Value: "foo"},
+			{Name: "id", Type: mysql.TypeLong, Flag: pkFlag, Value: int64(1)},
+			{Name: "name", Type: mysql.TypeVarchar, Flag: model.NullableFlag, Value: "bar"},
+		},
+		Columns: []*model.Column{
+			{Name: "tenant", Type: mysql.TypeVarchar, Flag: pkFlag, Value: "foo"},
+			{Name: "id", Type: mysql.TypeLong, Flag: pkFlag, Value: int64(1)},
+			{Name: "name", Type: mysql.TypeVarchar, Flag: model.NullableFlag, Value: "baz"},
+		},
+	}
+
+	consumed := encodeDecodeRow(c, nil, event)
+	for _, cols := range [][]*model.Column{consumed.Columns, consumed.PreColumns} {
+		c.Assert(cols, check.HasLen, 3)
+		for _, col := range cols {
+			isPK := col.Name == "tenant" || col.Name == "id"
+			c.Assert(col.Flag.IsPrimaryKey(), check.Equals, isPK, check.Commentf("column %s", col.Name))
+			c.Assert(col.Flag.IsHandleKey(), check.Equals, isPK, check.Commentf("column %s", col.Name))
+		}
+	}
+}
+
+func (s *canalFlatSuite) TestPlainWatermark(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"plain-watermark": "foo"}), check.NotNil)
+
+	var watermark uint64 = 417318403368288260
+	physical := oracle.ExtractPhysical(watermark)
+	decode := func(msg *MQMessage, enableTiDBExtension bool) uint64 {
+		decoder := newCanalFlatTestDecoder(c, msg, enableTiDBExtension)
+		tp, hasNext, err := decoder.HasNext()
+		c.Assert(err, check.IsNil)
+		c.Assert(hasNext, check.IsTrue)
+		c.Assert(tp, check.Equals, model.MqMessageTypeResolved)
+		ts, err := decoder.NextResolvedEvent()
+		c.Assert(err, check.IsNil)
+		return ts
+	}
+
+	// the plain watermark carries the physical time in `es` without the TiDB extension.
+	encoder = &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"plain-watermark": "true"}), check.IsNil)
+	msg, err := encoder.EncodeCheckpointEvent(watermark)
+	c.Assert(err, check.IsNil)
+	c.Assert(msg, check.NotNil)
+	var value map[string]interface{}
+	c.Assert(json.Unmarshal(msg.Value, &value), check.IsNil)
+	c.Assert(value["type"], check.Equals, tidbWaterMarkType)
+	c.Assert(value["es"], check.Equals, float64(physical))
+	c.Assert(value, check.Not(check.HasKey), "_tidb")
+
+	// the logical time is lost, so the decoded ts doesn't exceed the watermark in both modes.
+	for _, enableTiDBExtension := range []bool{false, true} {
+		ts := decode(msg, enableTiDBExtension)
+		c.Assert(ts, check.Equals, oracle.ComposeTS(physical, 0))
+		c.Assert(ts <= watermark, check.IsTrue)
+	}
+
+	// the full watermark is carried by the TiDB extension if it's enabled.
+	encoder = &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"plain-watermark": "true", "enable-tidb-extension": "true"}), check.IsNil)
+	msg, err = encoder.EncodeCheckpointEvent(watermark)
+	c.Assert(err, check.IsNil)
+	c.Assert(decode(msg, true), check.Equals, watermark)
+}
+
+func (s *canalFlatSuite) TestDecimalScaleLimit(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"decimal-scale-limit": "foo"}), check.NotNil)
+	c.Assert(encoder.SetParams(map[string]string{"decimal-scale-limit": "-1"}), check.NotNil)
+
+	// price is a DECIMAL(20,10), cost fits into the scale limit.
+	event := &model.RowChangedEvent{
+		CommitTs: 417318403368288260,
+		Table:    &model.TableName{Schema: "cdc", Table: "goods"},
+		Columns: []*model.Column{
+			{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: 1},
+			{Name: "price", Type: mysql.TypeNewDecimal, Value: "1234567890.1234567890"},
+			{Name: "cost", Type: mysql.TypeNewDecimal, Value: "1.25"},
+		},
+	}
+	encode := func(params map[string]string) canalFlatMessageWithTiDBExtension {
+		var msg canalFlatMessageWithTiDBExtension
+		c.Assert(json.Unmarshal(encodeCanalFlatRow(c, params, event).Value, &msg), check.IsNil)
+		return msg
+	}
+
+	msg := encode(map[string]string{"enable-tidb-extension": "true", "decimal-scale-limit": "4"})
+	c.Assert(msg.Data[0]["price"], check.Equals, "1234567890.1235")
+	c.Assert(msg.Data[0]["cost"], check.Equals, "1.25")
+	c.Assert(msg.Extensions.RoundedColumns, check.DeepEquals, []string{"price"})
+
+	// the values are rounded even if there is no extension to note it.
+	msg = encode(map[string]string{"decimal-scale-limit": "0"})
+	c.Assert(msg.Data[0]["price"], check.Equals, "1234567890")
+	c.Assert(msg.Data[0]["cost"], check.Equals, "1")
+	c.Assert(msg.Extensions, check.IsNil)
+
+	// the values are kept by default.
+	msg = encode(map[string]string{"enable-tidb-extension": "true"})
+	c.Assert(msg.Data[0]["price"], check.Equals, "1234567890.1234567890")
+	c.Assert(msg.Extensions.RoundedColumns, check.IsNil)
+}
+
+func (s *canalFlatSuite) TestBuildWithError(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), enableTiDBExtension: true}
+	c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+	// the value can't be marshaled.
+	encoder.messageBuf[0].getData()["name"] = math.Inf(1)
+
+	// the failure is returned without panicking, and the batch is kept.
+	msgs, err := encoder.BuildWithError()
+	c.Assert(err, check.ErrorMatches, ".*unsupported value.*")
+	c.Assert(msgs, check.IsNil)
+	c.Assert(encoder.messageBuf, check.HasLen, 1)
+	c.Assert(encoder.Checkpoint(), check.Equals, CanalFlatCheckpoint{})
+	msgs, err = BuildEventBatch(encoder)
+	c.Assert(err, check.NotNil)
+	c.Assert(msgs, check.IsNil)
+	c.Assert(encoder.Build(), check.IsNil)
+	c.Assert(encoder.messageBuf, check.HasLen, 1)
+
+	// the batch is built once the value is fixed.
+	encoder.messageBuf[0].getData()["name"] = "Bob"
+	msgs, err = BuildEventBatch(encoder)
+	c.Assert(err, check.IsNil)
+	c.Assert(msgs, check.HasLen, 1)
+	c.Assert(encoder.messageBuf, check.HasLen, 0)
+	c.Assert(encoder.Checkpoint().CommitTs, check.Equals, testCaseInsert.CommitTs)
+}
+
+func (s *canalFlatSuite) TestTimePrecision(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder()}
+	c.Assert(encoder.SetParams(map[string]string{"time-precision": "s"}), check.NotNil)
+
+	mockClock := clock.NewMock()
+	mockClock.Add(time.Hour + 123456789*time.Nanosecond)
+	now := mockClock.Now().UnixNano()
+	physical := oracle.ExtractPhysical(testCaseInsert.CommitTs)
+
+	encode := func(params map[string]string) *MQMessage {
+		encoder := &CanalFlatEventBatchEncoder{builder: NewCanalEntryBuilder(), clock: mockClock}
+		c.Assert(encoder.SetParams(params), check.IsNil)
+		c.Assert(encoder.AppendRowChangedEvent(testCaseInsert), check.IsNil)
+		msgs := encoder.Build()
+		c.Assert(msgs, check.HasLen, 1)
+		return msgs[0]
+	}
+	decode := func(msg *MQMessage, enableTiDBExtension bool) *CanalFlatEventBatchDecoder {
+		decoder := newCanalFlatTestDecoder(c, msg, enableTiDBExtension)
+		_, err := nextCanalFlatRow(c, decoder)
+		c.Assert(err, check.IsNil)
+		return decoder
+	}
+
+	for _, tc := range []struct {
+		precision string
+		unit      time.Duration
+	}{
+		{precision: "ms", unit: time.Millisecond},
+		{precision: "us", unit: time.Microsecond},
+		{precision: "ns", unit: time.Nanosecond},
+	} {
+		msg := encode(map[string]string{"enable-tidb-extension": "true", "time-precision": tc.precision})
+		var flat canalFlatMessageWithTiDBExtension
+		c.Assert(json.Unmarshal(msg.Value, &flat), check.IsNil)
+		// `es` and `ts` are always in milliseconds.
+		c.Assert(flat.ExecutionTime, check.Equals, physical)
+		c.Assert(flat.BuildTime, check.Equals, now/int64(time.Millisecond))
+		if tc.precision == "ms" {
+			c.Assert(flat.Extensions.TimePrecision, check.Equals, "")
+			c.Assert(flat.Extensions.BuildTime, check.Equals, int64(0))
+		} else {
+			c.Assert(flat.Extensions.TimePrecision, check.Equals, tc.precision)
+			c.Assert(flat.Extensions.ExecutionTime, check.Equals, physical*int64(time.Millisecond/tc.unit))
+			c.Assert(flat.Extensions.BuildTime, check.Equals, now/int64(tc.unit))
+		}
+
+		decoder := decode(msg, true)
+		c.Assert(decoder.ExecutionTimeNs(), check.Equals, physical*int64(time.Millisecond))
+		c.Assert(decoder.BuildTimeNs(), check.Equals, now/int64(tc.unit)*int64(tc.unit))
+		c.Assert(decoder.BuildTime(), check.Equals, now/int64(time.Millisecond))
+	}
+
+	// the decoder falls back to `ts` in milliseconds if the precise time is absent.
+	msg := encode(map[string]string{"time-precision": "ns"})
+	decoder := decode(msg, false)
+	c.Assert(decoder.ExecutionTimeNs(), check.Equals, physical*int64(time.Millisecond))
+	c.Assert(decoder.BuildTimeNs(), check.Equals, now/int64(time.Millisecond)*int64(time.Millisecond))
+}
+
+func (s *canalFlatSuite) TestDMLQuery(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	// the statements of the row changes are not available, so `sql` is always empty for DML events.
+	for _, event := range []*model.RowChangedEvent{testCaseInsert, testCaseUpdate, testCaseDelete} {
+		msg := encodeCanalFlatRow(c, map[string]string{"enable-tidb-extension": "true"}, event)
+		var value map[string]interface{}
+		c.Assert(json.Unmarshal(msg.Value, &value), check.IsNil)
+
+		c.Assert(value, check.HasKey, "sql")
+		c.Assert(value["sql"], check.Equals, "")
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/parser/mysql"
+	"github.com/pingcap/tiflow/cdc/model"
+	"github.com/pingcap/tiflow/pkg/config"
+	cerrors "github.com/pingcap/tiflow/pkg/errors"
+)
+
+// ConvertMessage decodes the message `msg` encoded in the `from` protocol,
+// and re-encodes all events in it in the `to` protocol.
+// Only Open Protocol and Canal-JSON are supported now. `opts` is used to build the encoder,
+// and `enable-tidb-extension` in it is also used by the Canal-JSON decoder.
+//
+// The conversion preserves as much as each format allows, these are lost:
+//   - Canal-JSON carries no StartTs, TableID, RowID and column flags except the binary one,
+//     and the handle key and primary key ones restored from `pkNames`,
+//     column values are restored from strings according to the mysql types,
+//     DDL type is only restored as the category of its event type, e.g. all ALTER TABLE are `ActionAddColumn`,
+//     and the CommitTs is only kept with `enable-tidb-extension` or `emit-commit-ts`.
+//   - Open Protocol carries no `sqlType`, `mysqlType` and `pkNames`,
+//     they are computed from the column types and flags again when encoding Canal-JSON.
+func ConvertMessage(
+	ctx context.Context, msg *MQMessage, from, to config.Protocol, opts map[string]string,
+) ([]*MQMessage, error) {
+	decoder, err := newConvertDecoder(msg, from, opts)
+	if err != nil {
+		return nil, err
+	}
+	switch to {
+	case config.ProtocolDefault, config.ProtocolOpen, config.ProtocolCanalJSON:
+	default:
+		return nil, cerrors.ErrMQSinkUnknownProtocol.GenWithStackByArgs(to.String())
+	}
+	builder, err := NewEventBatchEncoderBuilder(to, nil, opts)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	encoder, err := builder.Build(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var result []*MQMessage
+	for {
+		tp, hasNext, err := decoder.HasNext()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if !hasNext {
+			break
+		}
+		switch tp {
+		case model.MqMessageTypeRow:
+			row, err := decoder.NextRowChangedEvent()
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if from == config.ProtocolCanalJSON {
+				if err := restoreCanalJSONColumnValues(row.Columns); err != nil {
+					return nil, err
+				}
+				if err := restoreCanalJSONColumnValues(row.PreColumns); err != nil {
+					return nil, err
+				}
+			}
+			if err := encoder.AppendRowChangedEvent(row); err != nil {
+				return nil, errors.Trace(err)
+			}
+		case model.MqMessageTypeDDL:
+			ddl, err := decoder.NextDDLEvent()
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			// flush the rows before the DDL to keep the order.
+			msgs, err := BuildEventBatch(encoder)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			result = append(result, msgs...)
+			m, err := encoder.EncodeDDLEvent(ddl)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			result = append(result, m)
+		case model.MqMessageTypeResolved:
+			ts, err := decoder.NextResolvedEvent()
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			msgs, err := BuildEventBatch(encoder)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			result = append(result, msgs...)
+			m, err := encoder.EncodeCheckpointEvent(ts)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			// Canal-JSON without TiDB extension does not output checkpoint events.
+			if m != nil {
+				result = append(result, m)
+			}
+		default:
+			return nil, cerrors.ErrCodecDecode.GenWithStack("unknown message type %d", tp)
+		}
+	}
+	msgs, err := BuildEventBatch(encoder)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return append(result, msgs...), nil
+}
+
+func newConvertDecoder(msg *MQMessage, p config.Protocol, opts map[string]string) (EventBatchDecoder, error) {
+	switch p {
+	case config.ProtocolDefault, config.ProtocolOpen:
+		return NewJSONEventBatchDecoder(msg.Key, msg.Value)
+	case config.ProtocolCanalJSON:
+		enableTiDBExtension := false
+		if s, ok := opts["enable-tidb-extension"]; ok {
+			a, err := strconv.ParseBool(s)
+			if err != nil {
+				return nil, cerrors.WrapError(cerrors.ErrSinkInvalidConfig, err)
+			}
+			enableTiDBExtension = a
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return nil, cerrors.WrapError(cerrors.ErrCanalDecodeFailed, err)
+		}
+		return newCanalFlatEventBatchDecoder(data, enableTiDBExtension), nil
+	default:
+		return nil, cerrors.ErrMQSinkUnknownProtocol.GenWithStackByArgs(p.String())
+	}
+}
+
+// restoreCanalJSONColumnValues restores the string values decoded from Canal-JSON
+// to the value types of the mounter, so they can be encoded by other protocols.
+func restoreCanalJSONColumnValues(cols []*model.Column) error {
+	for _, col := range cols {
+		value, ok := col.Value.(string)
+		if !ok {
+			continue
+		}
+		var err error
+		switch col.Type {
+		case mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong, mysql.TypeYear:
+			// the unsigned flag is lost in Canal-JSON, only use `uint64` if it overflows `int64`.
+			if col.Value, err = strconv.ParseInt(value, 10, 64); err != nil {
+				col.Value, err = strconv.ParseUint(value, 10, 64)
+				col.Flag.SetIsUnsigned()
+			}
+		case mysql.TypeFloat, mysql.TypeDouble:
+			col.Value, err = strconv.ParseFloat(value, 64)
+		case mysql.TypeTinyBlob, mysql.TypeMediumBlob, mysql.TypeLongBlob, mysql.TypeBlob:
+			col.Value = []byte(value)
+		}
+		if err != nil {
+			return cerrors.WrapError(cerrors.ErrCanalDecodeFailed, err)
+		}
+	}
+	return nil
+}
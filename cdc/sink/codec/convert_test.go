@@ -0,0 +1,229 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+
+	"github.com/pingcap/check"
+	"github.com/pingcap/tidb/parser/mysql"
+	"github.com/pingcap/tiflow/cdc/model"
+	"github.com/pingcap/tiflow/pkg/config"
+	"github.com/pingcap/tiflow/pkg/util/testleak"
+)
+
+type convertSuite struct{}
+
+var _ = check.Suite(&convertSuite{})
+
+var (
+	convertTestOpts = map[string]string{
+		"max-message-bytes":     "1048576",
+		"enable-tidb-extension": "true",
+	}
+
+	convertTestColumns = []*model.Column{
+		{Name: "id", Type: mysql.TypeLong, Flag: model.HandleKeyFlag | model.PrimaryKeyFlag, Value: int64(1)},
+		{Name: "name", Type: mysql.TypeVarchar, Value: "tidb"},
+		{Name: "score", Type: mysql.TypeDouble, Value: float64(3.5)},
+		{Name: "big", Type: mysql.TypeLonglong, Flag: model.UnsignedFlag, Value: uint64(math.MaxUint64)},
+		{Name: "payload", Type: mysql.TypeBlob, Flag: model.BinaryFlag, Value: []byte{0x01, 0xff}},
+		{Name: "nullable", Type: mysql.TypeLong, Value: nil},
+	}
+
+	// the values after decoding from Open Protocol.
+	convertTestExpectedValues = map[string]interface{}{
+		"id":       int64(1),
+		"name":     []byte("tidb"),
+		"score":    float64(3.5),
+		"big":      uint64(math.MaxUint64),
+		"payload":  []byte{0x01, 0xff},
+		"nullable": nil,
+	}
+
+	convertTestRows = []*model.RowChangedEvent{
+		{
+			CommitTs: 417318403368288260,
+			Table:    &model.TableName{Schema: "cdc", Table: "person"},
+			Columns:  convertTestColumns,
+		},
+		{
+			CommitTs:   417318403368288260,
+			Table:      &model.TableName{Schema: "cdc", Table: "person"},
+			Columns:    convertTestColumns,
+			PreColumns: convertTestColumns,
+		},
+		{
+			CommitTs:   417318403368288260,
+			Table:      &model.TableName{Schema: "cdc", Table: "person"},
+			PreColumns: convertTestColumns,
+		},
+	}
+)
+
+func encodeRowForConvertTest(c *check.C, p config.Protocol, e *model.RowChangedEvent) *MQMessage {
+	builder, err := NewEventBatchEncoderBuilder(p, nil, convertTestOpts)
+	c.Assert(err, check.IsNil)
+	encoder, err := builder.Build(context.Background())
+	c.Assert(err, check.IsNil)
+	c.Assert(encoder.AppendRowChangedEvent(e), check.IsNil)
+	msgs := encoder.Build()
+	c.Assert(msgs, check.HasLen, 1)
+	return msgs[0]
+}
+
+func decodeOpenRowForConvertTest(c *check.C, msg *MQMessage) *model.RowChangedEvent {
+	decoder, err := NewJSONEventBatchDecoder(msg.Key, msg.Value)
+	c.Assert(err, check.IsNil)
+	tp, hasNext, err := decoder.HasNext()
+	c.Assert(err, check.IsNil)
+	c.Assert(hasNext, check.IsTrue)
+	c.Assert(tp, check.Equals, model.MqMessageTypeRow)
+	row, err := decoder.NextRowChangedEvent()
+	c.Assert(err, check.IsNil)
+	return row
+}
+
+func checkConvertedOpenColumns(c *check.C, cols []*model.Column) {
+	c.Assert(cols, check.HasLen, len(convertTestColumns))
+	for _, col := range cols {
+		expected, ok := convertTestExpectedValues[col.Name]
+		c.Assert(ok, check.IsTrue)
+		c.Assert(col.Value, check.DeepEquals, expected, check.Commentf("column %s", col.Name))
+	}
+}
+
+func (s *convertSuite) TestConvertRowCanalJSONToOpen(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+
+	for _, row := range convertTestRows {
+		canalMsg := encodeRowForConvertTest(c, config.ProtocolCanalJSON, row)
+
+		openMsgs, err := ConvertMessage(ctx, canalMsg, config.ProtocolCanalJSON, config.ProtocolOpen, convertTestOpts)
+		c.Assert(err, check.IsNil)
+		c.Assert(openMsgs, check.HasLen, 1)
+		converted := decodeOpenRowForConvertTest(c, openMsgs[0])
+		c.Assert(converted.CommitTs, check.Equals, row.CommitTs)
+		c.Assert(converted.Table, check.DeepEquals, row.Table)
+		c.Assert(converted.IsInsert(), check.Equals, row.IsInsert())
+		c.Assert(converted.IsUpdate(), check.Equals, row.IsUpdate())
+		c.Assert(converted.IsDelete(), check.Equals, row.IsDelete())
+		if !row.IsDelete() {
+			checkConvertedOpenColumns(c, converted.Columns)
+		}
+		if !row.IsInsert() {
+			checkConvertedOpenColumns(c, converted.PreColumns)
+		}
+
+		// convert back, the Canal-JSON data should be the same.
+		canalMsgs, err := ConvertMessage(ctx, openMsgs[0], config.ProtocolOpen, config.ProtocolCanalJSON, convertTestOpts)
+		c.Assert(err, check.IsNil)
+		c.Assert(canalMsgs, check.HasLen, 1)
+		var expected, obtained canalFlatMessage
+		c.Assert(json.Unmarshal(canalMsg.Value, &expected), check.IsNil)
+		c.Assert(json.Unmarshal(canalMsgs[0].Value, &obtained), check.IsNil)
+		c.Assert(obtained.EventType, check.Equals, expected.EventType)
+		c.Assert(obtained.Data, check.DeepEquals, expected.Data)
+		c.Assert(obtained.Old, check.DeepEquals, expected.Old)
+		c.Assert(obtained.MySQLType, check.DeepEquals, expected.MySQLType)
+		c.Assert(obtained.SQLType, check.DeepEquals, expected.SQLType)
+	}
+}
+
+func (s *convertSuite) TestConvertRowOpenToCanalJSON(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+
+	for _, row := range convertTestRows {
+		openMsg := encodeRowForConvertTest(c, config.ProtocolOpen, row)
+
+		canalMsgs, err := ConvertMessage(ctx, openMsg, config.ProtocolOpen, config.ProtocolCanalJSON, convertTestOpts)
+		c.Assert(err, check.IsNil)
+		c.Assert(canalMsgs, check.HasLen, 1)
+		// the same as encoding the row into Canal-JSON directly except the build time.
+		var expected, obtained canalFlatMessageWithTiDBExtension
+		c.Assert(json.Unmarshal(encodeRowForConvertTest(c, config.ProtocolCanalJSON, row).Value, &expected), check.IsNil)
+		c.Assert(json.Unmarshal(canalMsgs[0].Value, &obtained), check.IsNil)
+		obtained.BuildTime = expected.BuildTime
+		c.Assert(obtained, check.DeepEquals, expected)
+
+		// convert back, the Open Protocol row should be the same.
+		openMsgs, err := ConvertMessage(ctx, canalMsgs[0], config.ProtocolCanalJSON, config.ProtocolOpen, convertTestOpts)
+		c.Assert(err, check.IsNil)
+		c.Assert(openMsgs, check.HasLen, 1)
+		converted := decodeOpenRowForConvertTest(c, openMsgs[0])
+		c.Assert(converted.CommitTs, check.Equals, row.CommitTs)
+		c.Assert(converted.Table, check.DeepEquals, row.Table)
+		c.Assert(converted.IsDelete(), check.Equals, row.IsDelete())
+		if !row.IsDelete() {
+			checkConvertedOpenColumns(c, converted.Columns)
+		}
+		if !row.IsInsert() {
+			checkConvertedOpenColumns(c, converted.PreColumns)
+		}
+	}
+}
+
+func (s *convertSuite) TestConvertDDL(c *check.C) {
+	defer testleak.AfterTest(c)()
+	ctx := context.Background()
+
+	for _, p := range []config.Protocol{config.ProtocolOpen, config.ProtocolCanalJSON} {
+		builder, err := NewEventBatchEncoderBuilder(p, nil, convertTestOpts)
+		c.Assert(err, check.IsNil)
+		encoder, err := builder.Build(ctx)
+		c.Assert(err, check.IsNil)
+		msg, err := encoder.EncodeDDLEvent(testCaseDDL)
+		c.Assert(err, check.IsNil)
+
+		to := config.ProtocolCanalJSON
+		if p == config.ProtocolCanalJSON {
+			to = config.ProtocolOpen
+		}
+		converted, err := ConvertMessage(ctx, msg, p, to, convertTestOpts)
+		c.Assert(err, check.IsNil)
+		c.Assert(converted, check.HasLen, 1)
+		c.Assert(converted[0].Type, check.Equals, model.MqMessageTypeDDL)
+
+		// convert back.
+		msgs, err := ConvertMessage(ctx, converted[0], to, p, convertTestOpts)
+		c.Assert(err, check.IsNil)
+		c.Assert(msgs, check.HasLen, 1)
+
+		decoder, err := newConvertDecoder(msgs[0], p, convertTestOpts)
+		c.Assert(err, check.IsNil)
+		tp, hasNext, err := decoder.HasNext()
+		c.Assert(err, check.IsNil)
+		c.Assert(hasNext, check.IsTrue)
+		c.Assert(tp, check.Equals, model.MqMessageTypeDDL)
+		ddl, err := decoder.NextDDLEvent()
+		c.Assert(err, check.IsNil)
+		c.Assert(ddl.CommitTs, check.Equals, testCaseDDL.CommitTs)
+		c.Assert(ddl.TableInfo, check.DeepEquals, testCaseDDL.TableInfo)
+		c.Assert(ddl.Query, check.Equals, testCaseDDL.Query)
+	}
+}
+
+func (s *convertSuite) TestConvertUnsupportedProtocol(c *check.C) {
+	defer testleak.AfterTest(c)()
+
+	msg := encodeRowForConvertTest(c, config.ProtocolOpen, convertTestRows[0])
+	_, err := ConvertMessage(context.Background(), msg, config.ProtocolOpen, config.ProtocolAvro, convertTestOpts)
+	c.Assert(err, check.ErrorMatches, ".*unknown 'avro' protocol.*")
+	_, err = ConvertMessage(context.Background(), msg, config.ProtocolMaxwell, config.ProtocolOpen, convertTestOpts)
+	c.Assert(err, check.ErrorMatches, ".*unknown 'maxwell' protocol.*")
+}
@@ -0,0 +1,42 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/pingcap/check"
+)
+
+// updateGolden rewrites the golden files with the current outputs instead of comparing against them,
+// run `go test ./cdc/sink/codec/... -update-golden` after an intended change of the wire format.
+var updateGolden = flag.Bool("update-golden", false, "update the golden files of the codecs")
+
+// assertGolden asserts the encoded message equals the golden file `testdata/<protocol>/<name>.golden`,
+// which guards the wire format consumers depend on against accidental changes.
+func assertGolden(c *check.C, protocol, name string, actual []byte) {
+	path := filepath.Join("testdata", protocol, name+".golden")
+	if *updateGolden {
+		c.Assert(os.MkdirAll(filepath.Dir(path), 0o755), check.IsNil)
+		c.Assert(os.WriteFile(path, append(actual, '\n'), 0o644), check.IsNil)
+		return
+	}
+	expected, err := os.ReadFile(path)
+	c.Assert(err, check.IsNil, check.Commentf("golden file %s, run with -update-golden to create it", path))
+	c.Assert(string(actual), check.Equals, string(bytes.TrimSuffix(expected, []byte("\n"))),
+		check.Commentf("the output differs from golden file %s, run with -update-golden if it's intended", path))
+}
@@ -43,6 +43,21 @@ type EventBatchEncoder interface {
 	SetParams(params map[string]string) error
 }
 
+// FallibleEventBatchEncoder is implemented by the encoders which report the failures of building the batch
+// as errors instead of panicking, so the sink can fail gracefully, see `BuildEventBatch`.
+type FallibleEventBatchEncoder interface {
+	// BuildWithError builds the batch as `Build`, but returns the error if the batch fails to be built.
+	BuildWithError() ([]*MQMessage, error)
+}
+
+// BuildEventBatch builds the batch of the encoder, the error is returned if the encoder supports it.
+func BuildEventBatch(encoder EventBatchEncoder) ([]*MQMessage, error) {
+	if e, ok := encoder.(FallibleEventBatchEncoder); ok {
+		return e.BuildWithError()
+	}
+	return encoder.Build(), nil
+}
+
 // MQMessage represents an MQ message to the mqSink
 type MQMessage struct {
 	Key       []byte
@@ -138,6 +153,16 @@ type EventBatchDecoder interface {
 	NextDDLEvent() (*model.DDLEvent, error)
 }
 
+// GroupByTable groups the decoded row changed events by their tables,
+// the order of events within the same table is preserved.
+func GroupByTable(events []*model.RowChangedEvent) map[model.TableName][]*model.RowChangedEvent {
+	groups := make(map[model.TableName][]*model.RowChangedEvent)
+	for _, e := range events {
+		groups[*e.Table] = append(groups[*e.Table], e)
+	}
+	return groups
+}
+
 // EncoderResult indicates an action request by the encoder to the mqSink
 type EncoderResult uint8
 
@@ -119,3 +119,23 @@ func (s *codecInterfaceSuite) TestCreate(c *check.C) {
 	c.Assert(msg.Table, check.IsNil)
 	c.Assert(msg.Protocol, check.Equals, config.ProtocolCanal)
 }
+
+func (s *codecInterfaceSuite) TestGroupByTable(c *check.C) {
+	defer testleak.AfterTest(c)()
+	t1 := &model.TableName{Schema: "test", Table: "t1"}
+	t2 := &model.TableName{Schema: "test", Table: "t2"}
+	events := []*model.RowChangedEvent{
+		{CommitTs: 1, Table: t1},
+		{CommitTs: 2, Table: t2},
+		{CommitTs: 3, Table: &model.TableName{Schema: "test", Table: "t1"}},
+		{CommitTs: 4, Table: t2},
+		{CommitTs: 5, Table: t1},
+	}
+
+	groups := GroupByTable(events)
+	c.Assert(groups, check.HasLen, 2)
+	c.Assert(groups[*t1], check.DeepEquals, []*model.RowChangedEvent{events[0], events[2], events[4]})
+	c.Assert(groups[*t2], check.DeepEquals, []*model.RowChangedEvent{events[1], events[3]})
+
+	c.Assert(GroupByTable(nil), check.HasLen, 0)
+}
@@ -90,24 +90,44 @@ func (c *column) FromSinkColumn(col *model.Column) {
 	}
 }
 
-func (c *column) decodeCanalJSONColumn(name string, javaType JavaSQLType) *model.Column {
+func (c *column) decodeCanalJSONColumn(name string, javaType JavaSQLType) (*model.Column, error) {
 	col := new(model.Column)
 	col.Type = c.Type
 	col.Flag = c.Flag
 	col.Name = name
 	col.Value = c.Value
+	if javaType == JavaSQLTypeBLOB {
+		col.Flag.SetIsBinary()
+	}
 	if c.Value == nil {
-		return col
+		return col, nil
 	}
 
 	value, ok := col.Value.(string)
 	if !ok {
-		log.Panic("canal-json encoded message should have type in `string`")
+		// numbers are tolerated for the messages from other producers, e.g. numeric primary keys,
+		// they're kept as the original tokens so that large integers don't lose precision.
+		number, isNumber := col.Value.(json.Number)
+		if !isNumber {
+			return nil, cerror.ErrCanalDecodeFailed.GenWithStack(
+				"canal-json encoded value of column %s should be a string, but it's %T", name, col.Value)
+		}
+		value = number.String()
+	}
+
+	if col.Type == mysql.TypeBit {
+		// `BIT` is encoded as a number, reconstruct it as `uint64` the same as the mounter does.
+		number, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, cerror.WrapError(cerror.ErrCanalDecodeFailed, err)
+		}
+		col.Value = number
+		return col, nil
 	}
 
 	if javaType != JavaSQLTypeBLOB {
 		col.Value = value
-		return col
+		return col, nil
 	}
 
 	// when encoding the `JavaSQLTypeBLOB`, use `ISO8859_1` decoder, now reverse it back.
@@ -118,7 +138,7 @@ func (c *column) decodeCanalJSONColumn(name string, javaType JavaSQLType) *model
 	}
 
 	col.Value = value
-	return col
+	return col, nil
 }
 
 func (c *column) ToSinkColumn(name string) *model.Column {
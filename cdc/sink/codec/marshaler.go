@@ -0,0 +1,119 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+
+	jsoniter "github.com/json-iterator/go"
+	ugorji "github.com/ugorji/go/codec"
+)
+
+// JSONMarshaler marshals and unmarshals JSON, it's used by the Canal-JSON encoder and decoder.
+type JSONMarshaler interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type stdJSONMarshaler struct{}
+
+func (stdJSONMarshaler) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (stdJSONMarshaler) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (stdJSONMarshaler) unmarshalUseNumber(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+type jsonIterMarshaler struct {
+	jsoniter.API
+	useNumber jsoniter.API
+}
+
+func (m jsonIterMarshaler) unmarshalUseNumber(data []byte, v interface{}) error {
+	return m.useNumber.Unmarshal(data, v)
+}
+
+// numberUnmarshaler is implemented by the JSONMarshalers which can unmarshal numbers into `interface{}`
+// as `json.Number`, so that large integers don't lose precision as `float64`.
+type numberUnmarshaler interface {
+	unmarshalUseNumber(data []byte, v interface{}) error
+}
+
+var (
+	// StdJSONMarshaler is the JSONMarshaler backed by `encoding/json`, it's the default one.
+	StdJSONMarshaler JSONMarshaler = stdJSONMarshaler{}
+	// JSONIterMarshaler is the JSONMarshaler backed by jsoniter,
+	// it's faster than `encoding/json` and compatible with it.
+	JSONIterMarshaler JSONMarshaler = jsonIterMarshaler{
+		API: jsoniter.ConfigCompatibleWithStandardLibrary,
+		useNumber: jsoniter.Config{
+			EscapeHTML:             true,
+			SortMapKeys:            true,
+			ValidateJsonRawMessage: true,
+			UseNumber:              true,
+		}.Froze(),
+	}
+
+	jsonMarshaler = StdJSONMarshaler
+)
+
+// SetJSONMarshaler sets the JSONMarshaler used by the whole package, nil resets it to the default one.
+// It should be called before any encoder or decoder is used, it's not safe to call it concurrently.
+func SetJSONMarshaler(m JSONMarshaler) {
+	if m == nil {
+		m = StdJSONMarshaler
+	}
+	jsonMarshaler = m
+}
+
+// cborMarker is the self-described CBOR tag (RFC 8949, Section 3.4.6) prepended to the CBOR envelope,
+// it never starts a JSON text, so decoders can detect the serialization by it.
+var cborMarker = []byte{0xd9, 0xd9, 0xf7}
+
+// cborHandle encodes structs by their `json` tags, so the CBOR envelope has the same schema as JSON.
+// map keys are sorted as in JSON, so the same value is always encoded into the same bytes.
+var cborHandle = func() *ugorji.CborHandle {
+	h := &ugorji.CborHandle{}
+	h.Canonical = true
+	return h
+}()
+
+// cborMarshal marshals v in the CBOR envelope.
+func cborMarshal(v interface{}) ([]byte, error) {
+	var data []byte
+	if err := ugorji.NewEncoderBytes(&data, cborHandle).Encode(v); err != nil {
+		return nil, err
+	}
+	return append(append(make([]byte, 0, len(cborMarker)+len(data)), cborMarker...), data...), nil
+}
+
+// unmarshalEnvelope unmarshals the data in CBOR if it's in the CBOR envelope, otherwise in JSON,
+// JSON numbers are unmarshaled as `json.Number` if it's supported by the JSONMarshaler.
+func unmarshalEnvelope(data []byte, v interface{}) error {
+	if bytes.HasPrefix(data, cborMarker) {
+		return ugorji.NewDecoderBytes(data[len(cborMarker):], cborHandle).Decode(v)
+	}
+	if m, ok := jsonMarshaler.(numberUnmarshaler); ok {
+		return m.unmarshalUseNumber(data, v)
+	}
+	return jsonMarshaler.Unmarshal(data, v)
+}
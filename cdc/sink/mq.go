@@ -274,11 +274,25 @@ func (k *mqSink) EmitCheckpointTs(ctx context.Context, ts uint64) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
-	if msg == nil {
-		return nil
+	if msg != nil {
+		if err := k.writeToProducer(ctx, msg, codec.EncoderNeedSyncWrite, -1); err != nil {
+			return errors.Trace(err)
+		}
 	}
-	err = k.writeToProducer(ctx, msg, codec.EncoderNeedSyncWrite, -1)
-	return errors.Trace(err)
+	// the checkpoint is emitted periodically, re-emit the schemas of idle tables along with it.
+	if canalFlat, ok := encoder.(*codec.CanalFlatEventBatchEncoder); ok {
+		heartbeats, err := canalFlat.EncodeSchemaHeartbeats()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, msg := range heartbeats {
+			// the same partition as other DDLs of Canal-JSON.
+			if err := k.writeToProducer(ctx, msg, codec.EncoderNeedSyncWrite, 0); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	return nil
 }
 
 func (k *mqSink) EmitDDLEvent(ctx context.Context, ddl *model.DDLEvent) error {
@@ -362,7 +376,10 @@ func (k *mqSink) runWorker(ctx context.Context, partition int32) error {
 
 	flushToProducer := func() error {
 		return k.statistics.RecordBatchExecution(func() (int, error) {
-			messages := encoder.Build()
+			messages, err := codec.BuildEventBatch(encoder)
+			if err != nil {
+				return 0, errors.Trace(err)
+			}
 			thisBatchSize := 0
 			if len(messages) == 0 {
 				return 0, nil
@@ -95,6 +95,22 @@ var (
 	// tb2:                       +a +b +c
 	// tb3:          +a +b +c
 	ShardDDLOptimismDroppedColumnsKeyAdapter KeyAdapter = keyHexEncoderDecoder("/dm-master/shardddl-optimism/dropped-columns/")
+	// ShardDDLOptimismLockHeartbeatKeyAdapter is used to store the heartbeat of the active shard DDL lock,
+	// the key is attached with a lease which is refreshed by DM-master until the lock is removed.
+	// k/v: Encode(lock-id) -> the time when the heartbeat started.
+	ShardDDLOptimismLockHeartbeatKeyAdapter KeyAdapter = keyHexEncoderDecoder("/dm-master/shardddl-optimism/lock-heartbeat/")
+	// ShardDDLOptimismLockNoteKeyAdapter is used to store the note attached to the shard DDL lock by operators,
+	// it's deleted with the lock.
+	// k/v: Encode(lock-id) -> the note.
+	ShardDDLOptimismLockNoteKeyAdapter KeyAdapter = keyHexEncoderDecoder("/dm-master/shardddl-optimism/lock-note/")
+	// ShardDDLOptimismLockSeedKeyAdapter is used to store the joined schema seeded to the shard DDL lock by operators,
+	// it's deleted with the lock.
+	// k/v: Encode(lock-id) -> the CREATE TABLE statement.
+	ShardDDLOptimismLockSeedKeyAdapter KeyAdapter = keyHexEncoderDecoder("/dm-master/shardddl-optimism/lock-seed/")
+	// ShardDDLOptimismLeaderEpochKey is used to store the epoch of the DM-master leader coordinating shard DDL locks,
+	// it's increased by each new leader so that lock operations put by the old leaders are fenced.
+	// k/v: the key -> the epoch.
+	ShardDDLOptimismLeaderEpochKey = "/dm-master/shardddl-optimism/leader-epoch"
 
 	// OpenAPITaskTemplateKeyAdapter is used to store the openapi task-config-template (openapi.Task), now it's only used for WebUI.
 	// openapi.Task is a struct that can be converted to config.StubTaskConfig so if any field of openapi.Task updated
@@ -113,7 +129,8 @@ func keyAdapterKeysLen(s KeyAdapter) int {
 	switch s {
 	case WorkerRegisterKeyAdapter, UpstreamConfigKeyAdapter, UpstreamBoundWorkerKeyAdapter,
 		WorkerKeepAliveKeyAdapter, StageRelayKeyAdapter,
-		UpstreamLastBoundWorkerKeyAdapter, UpstreamRelayWorkerKeyAdapter, OpenAPITaskTemplateKeyAdapter:
+		UpstreamLastBoundWorkerKeyAdapter, UpstreamRelayWorkerKeyAdapter, OpenAPITaskTemplateKeyAdapter,
+		ShardDDLOptimismLockHeartbeatKeyAdapter, ShardDDLOptimismLockNoteKeyAdapter, ShardDDLOptimismLockSeedKeyAdapter:
 		return 1
 	case UpstreamSubTaskKeyAdapter, StageSubTaskKeyAdapter, StageValidatorKeyAdapter,
 		ShardDDLPessimismInfoKeyAdapter, ShardDDLPessimismOperationKeyAdapter,
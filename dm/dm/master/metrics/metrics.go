@@ -87,6 +87,32 @@ var (
 			Help:      "number of error related to worker event, during handling or watching",
 		}, []string{"type"})
 
+	infoQueueLength = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "dm",
+			Subsystem: "master",
+			Name:      "shard_ddl_info_queue_length",
+			Help:      "number of shard DDL infos waiting to be handled by the optimist",
+		})
+
+	// ShardDDLEtcdDurationHistogram observes the latency of the etcd operations of the shard DDL optimist.
+	ShardDDLEtcdDurationHistogram = metricsproxy.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "dm",
+			Subsystem: "master",
+			Name:      "shard_ddl_etcd_duration",
+			Help:      "bucketed histogram of the latency (s) of the etcd operations of the shard DDL optimist",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 18),
+		}, []string{"type"})
+
+	shardDDLLaggingSource = metricsproxy.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "dm",
+			Subsystem: "master",
+			Name:      "shard_ddl_lagging_source",
+			Help:      "whether the source has not applied the shard DDL lock operations within the apply timeout, 1 - lagging",
+		}, []string{"task", "source"})
+
 	startLeaderCounter = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Namespace: "dm",
@@ -126,6 +152,9 @@ func RegistryMetrics() {
 	registry.MustRegister(ddlPendingCounter)
 	registry.MustRegister(ddlErrCounter)
 	registry.MustRegister(workerEventErrCounter)
+	registry.MustRegister(infoQueueLength)
+	registry.MustRegister(ShardDDLEtcdDurationHistogram)
+	registry.MustRegister(shardDDLLaggingSource)
 	registry.MustRegister(startLeaderCounter)
 }
 
@@ -164,6 +193,25 @@ func ReportWorkerEventErr(errType string) {
 	workerEventErrCounter.WithLabelValues(errType).Inc()
 }
 
+// ReportInfoQueueLength is a setter for infoQueueLength.
+func ReportInfoQueueLength(length int) {
+	infoQueueLength.Set(float64(length))
+}
+
+// ObserveShardDDLEtcdDuration observes the latency of an etcd operation of the shard DDL optimist.
+func ObserveShardDDLEtcdDuration(opType string, duration time.Duration) {
+	ShardDDLEtcdDurationHistogram.WithLabelValues(opType).Observe(duration.Seconds())
+}
+
+// ReportShardDDLLaggingSource is a setter for shardDDLLaggingSource, the metric is removed if it's not lagging.
+func ReportShardDDLLaggingSource(task, source string, lagging bool) {
+	if lagging {
+		shardDDLLaggingSource.WithLabelValues(task, source).Set(1)
+		return
+	}
+	shardDDLLaggingSource.DeleteAllAboutLabels(prometheus.Labels{"task": task, "source": source})
+}
+
 // ReportStartLeader increases startLeaderCounter by one.
 func ReportStartLeader() {
 	startLeaderCounter.Inc()
@@ -175,4 +223,6 @@ func OnRetireLeader() {
 	ddlErrCounter.Reset()
 	ddlPendingCounter.Reset()
 	workerEventErrCounter.Reset()
+	infoQueueLength.Set(0)
+	shardDDLLaggingSource.Reset()
 }
@@ -17,11 +17,18 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/pingcap/failpoint"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/schemacmp"
+	"github.com/pingcap/tidb/ddl"
+	"github.com/pingcap/tidb/parser"
+	"github.com/pingcap/tidb/parser/ast"
+	"github.com/pingcap/tidb/parser/model"
 	"go.etcd.io/etcd/clientv3"
 	"go.uber.org/zap"
 
@@ -36,6 +43,90 @@ import (
 	"github.com/pingcap/tiflow/dm/pkg/utils"
 )
 
+var (
+	// lockHeartbeatInterval is the interval to refresh the heartbeat of the active shard DDL locks.
+	lockHeartbeatInterval = 10 * time.Second
+	// lockHeartbeatTTL is the TTL (in seconds) of the heartbeat lease of the shard DDL locks.
+	lockHeartbeatTTL int64 = 60
+	// applyTimeoutCheckInterval is the interval to check whether the sources exceed the apply timeout.
+	applyTimeoutCheckInterval = time.Second
+	// infoQueueSize is the size of the queue of shard DDL infos waiting to be handled, see `Optimist.Saturated`.
+	infoQueueSize = 128
+)
+
+// InfoResult represents how a shard DDL info is handled by the optimist.
+type InfoResult string
+
+const (
+	// InfoResultCreated indicates the info created a new lock.
+	InfoResultCreated InfoResult = "created"
+	// InfoResultAdvanced indicates the info advanced an existing lock.
+	InfoResultAdvanced InfoResult = "advanced"
+	// InfoResultNoop indicates the info matched the current state of the lock, e.g. a duplicate info.
+	InfoResultNoop InfoResult = "no-op"
+	// InfoResultConflicted indicates a conflict was detected for the info.
+	InfoResultConflicted InfoResult = "conflicted"
+	// InfoResultRejected indicates the info was rejected because its upstream table is unknown.
+	InfoResultRejected InfoResult = "rejected"
+	// InfoResultQueued indicates the info was queued until its upstream table appears in the source tables.
+	InfoResultQueued InfoResult = "queued"
+)
+
+// UnknownTablePolicy is the policy for shard DDL infos whose upstream tables are not in the source tables.
+type UnknownTablePolicy string
+
+const (
+	// UnknownTableRegister registers the upstream table to the source tables automatically, it's the default policy.
+	UnknownTableRegister UnknownTablePolicy = "register"
+	// UnknownTableReject rejects the info with a conflict operation.
+	UnknownTableReject UnknownTablePolicy = "reject"
+	// UnknownTableQueue queues the info until its upstream table appears in the source tables.
+	UnknownTableQueue UnknownTablePolicy = "queue"
+)
+
+// TruncateTablePolicy is the policy for shard DDL infos of TRUNCATE TABLE, which change the data but not the schema.
+type TruncateTablePolicy string
+
+const (
+	// TruncateTablePassThrough lets the upstream table replicate the TRUNCATE TABLE to the downstream, it's the default policy.
+	TruncateTablePassThrough TruncateTablePolicy = "pass-through"
+	// TruncateTableSkip lets the upstream table skip the TRUNCATE TABLE,
+	// as the downstream table also holds the data of the other upstream tables.
+	TruncateTableSkip TruncateTablePolicy = "skip"
+)
+
+// MixedAlterPolicy is the policy for shard DDL infos of ALTER TABLE which both add and drop columns.
+type MixedAlterPolicy string
+
+const (
+	// MixedAlterSplit splits the ALTER TABLE into statements of single columns, it's the default policy,
+	// see `optimism.SplitMixedAlterDDLs`.
+	MixedAlterSplit MixedAlterPolicy = "split"
+	// MixedAlterReject rejects the ALTER TABLE with a conflict operation,
+	// as the schema becomes neither larger nor smaller after applied it.
+	MixedAlterReject MixedAlterPolicy = "reject"
+)
+
+// InfoEvent represents the result of handling a shard DDL info.
+type InfoEvent struct {
+	LockID string
+	Info   optimism.Info
+	Result InfoResult
+}
+
+// infoEventChanSize is the buffer size of the channel returned by `InfoEvents`.
+const infoEventChanSize = 1024
+
+// defaultResolvedLockAuditSize is the default number of the resolved lock records kept after `Compact`.
+const defaultResolvedLockAuditSize = 1024
+
+// ResolvedLock is the audit record of a resolved shard DDL lock.
+type ResolvedLock struct {
+	ID         string
+	Task       string
+	ResolvedAt time.Time
+}
+
 // Optimist is used to coordinate the shard DDL migration in optimism mode.
 type Optimist struct {
 	mu sync.Mutex
@@ -46,30 +137,252 @@ type Optimist struct {
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
 
-	cli *clientv3.Client
-	lk  *optimism.LockKeeper
-	tk  *optimism.TableKeeper
+	cli   *clientv3.Client
+	store OptimistStore
+	// getDownstreamMeta is kept to rebuild the locks offline, see `VerifyAgainstEtcd`.
+	getDownstreamMeta func(string) (*config.DBConfig, string)
+	// the leader epoch acquired when started, lock operations are fenced on it.
+	epoch int64
+	lk    *optimism.LockKeeper
+	tk    *optimism.TableKeeper
+
+	// in the safe mode, all lock operations are held after started until `ConfirmReady` is called,
+	// lock ID -> source-`schema`.`table` -> held operation.
+	safeMode    bool
+	confirmed   bool
+	unconfirmed map[string]map[string]heldOperation
+
+	// frozen locks still accept infos but hold their operations until unfrozen,
+	// lock ID -> source -> upstream schema name -> upstream table name -> held operation.
+	frozen map[string]map[string]map[string]map[string]heldOperation
+
+	// the notes attached to locks by operators, they're persisted in the store and deleted with the locks,
+	// lock ID -> note.
+	notes map[string]string
+
+	// operations with risky DDLs are held until they're approved by `ApproveOperation`,
+	// lock ID -> source-`schema`.`table` -> held operation.
+	riskyDDL  RiskyDDLFunc
+	approvals map[string]map[string]heldOperation
+
+	// the latest detected conflicts, lock ID -> source-`schema`.`table` -> conflict message.
+	conflicts map[string]map[string]string
+	// conflictResolver rewrites the conflicting shard DDLs, nil means conflicts are never resolved automatically.
+	conflictResolver ConflictResolver
+	// downstreamSchema fetches the schema of the downstream table to resolve the conflicts by,
+	// nil means the downstream table is never consulted.
+	downstreamSchema DownstreamSchemaFunc
+	// locks fall back to the pessimistic coordination once the number of conflicts detected on them reaches
+	// the threshold, see `SetConflictFallback`. lock ID -> the number of conflicts, and -> the fallback engaged.
+	fallbackThreshold int
+	conflictCounts    map[string]int
+	fallbacks         map[string]*pessimisticFallback
+
+	// in the shadow mode, the joined schemas of locks are computed but no operations are emitted,
+	// they're compared with the schemas applied externally instead, lock ID -> applied schema.
+	reportDivergence ReportDivergenceFunc
+	appliedSchemas   map[string]*model.TableInfo
+
+	// a lock is resolved once the fraction of its resolved sources reaches the quorum, see `SetQuorum`,
+	// such locks are kept to reconcile their straggling sources, lock ID -> lock resolved by the quorum.
+	quorum         float64
+	quorumResolved map[string]quorumResolvedLock
+
+	// infos of the unknown upstream tables queued by `UnknownTableQueue`,
+	// task name -> source-`schema`.`table` -> queued info.
+	unknownTablePolicy UnknownTablePolicy
+	queuedInfos        map[string]map[string]queuedInfo
+
+	truncateTablePolicy TruncateTablePolicy
+	mixedAlterPolicy    MixedAlterPolicy
+
+	// the versions of the info keys are consecutive, so infos arriving with a gap in them are held until the missing
+	// ones arrive, see `orderInfo`. info key -> the last handled version, and -> version -> the info held.
+	infoVersions   map[string]int64
+	reorderedInfos map[string]map[int64]optimism.Info
+
+	// the source tables, shard DDL infos and lock operations applied are recorded if it's not nil, see `SetRecorder`.
+	recorder *EventRecorder
+
+	infoEventCh chan InfoEvent
+
+	// audit records of the resolved locks, trimmed to `resolvedAuditSize` by `Compact`.
+	resolved          []ResolvedLock
+	resolvedAuditSize int
+	// tasks which have reported the pending DDL metrics for their resolved locks.
+	resolvedTasks map[string]struct{}
+
+	// operations not done by the sources within the apply timeout are alerted, but never skipped.
+	// it's guarded by its own mutex as it's checked in the background, see `SetApplyTimeout`.
+	applyMu      sync.Mutex
+	applyTimeout time.Duration
+	// lock ID -> source-`schema`.`table` -> the operation put but not done yet.
+	pendingApplies map[string]map[string]pendingApply
+	// lock ID -> source -> the earliest operation not done by the source, updated by each check.
+	laggingSources map[string]map[string]pendingApply
+
+	// the etcd revision of the last watched event applied, either the source tables or the shard DDL info,
+	// `processedRevCh` is closed and renewed when it advances.
+	revMu          sync.Mutex
+	processedRev   int64
+	processedRevCh chan struct{}
+
+	// the queue of shard DDL infos received from etcd but not handled yet, bounded by `infoQueueSize`.
+	queueMu   sync.RWMutex
+	infoQueue chan optimism.Info
+}
+
+// queuedInfo is a shard DDL info queued until its upstream table appears in the source tables.
+type queuedInfo struct {
+	info     optimism.Info
+	skipDone bool
+}
+
+// pendingApply is a shard DDL lock operation put but not done by the source yet.
+type pendingApply struct {
+	task   string
+	source string
+	putAt  time.Time
+}
+
+// quorumResolvedLock is a shard DDL lock resolved by the quorum of its sources before all of them are synced.
+type quorumResolvedLock struct {
+	task   string
+	joined schemacmp.Table
+	// the sources not resolved yet when the lock was resolved.
+	stragglers map[string]struct{}
+}
+
+// pessimisticFallback is the pessimistic coordination a shard DDL lock falls back to on repeated conflicts,
+// the owner executes its DDLs, and the other tables skip theirs once the owner's operation is done.
+type pessimisticFallback struct {
+	// the owner table, in the format of source-`schema`.`table`, and its DDLs.
+	owner     string
+	ddls      []string
+	ownerDone bool
+	// the operations of the other tables held until the owner's operation is done, source-`schema`.`table` -> held operation.
+	held map[string]heldOperation
+}
+
+// heldOperation is a shard DDL lock operation held back by a frozen lock or for the approval.
+type heldOperation struct {
+	op       optimism.Operation
+	skipDone bool
+	infoRev  int64
+}
+
+// RiskyDDLFunc reports whether the shard DDL info contains risky DDLs, e.g. DROP TABLE,
+// which require manual approval before their lock operations are emitted.
+type RiskyDDLFunc func(info optimism.Info) bool
+
+// ConflictResolver resolves the type conflict of a column between two source tables, `a` is the column in another
+// source table and `b` is the column in the table of the shard DDL info. it returns the DDLs to emit instead,
+// e.g. widening the column to a common type, or false if the conflict can't be resolved.
+type ConflictResolver func(a, b optimism.ColumnType) (resolvedDDL []string, ok bool)
+
+// DownstreamSchemaFunc returns the current schema of the downstream table of the shard DDL lock,
+// e.g. `(*optimism.Lock).FetchDownstreamTableInfo`.
+type DownstreamSchemaFunc func(lock *optimism.Lock) (*model.TableInfo, error)
+
+// Divergence is a difference between the joined schema computed by a shard DDL lock
+// and the schema applied externally to its downstream table.
+type Divergence struct {
+	LockID   string
+	Computed string
+	Applied  string
+}
+
+// ReportDivergenceFunc reports the divergence found in the shadow mode.
+type ReportDivergenceFunc func(d Divergence)
+
+// PendingApproval is a shard DDL lock operation waiting for the manual approval.
+type PendingApproval struct {
+	LockID string
+	// Table is the upstream table of the operation, in the format of source-`schema`.`table`.
+	Table string
+	DDLs  []string
 }
 
 // NewOptimist creates a new Optimist instance.
+// only the lock notes and seeds are persisted in etcd, the other state set on the Optimist lives only in memory,
+// including the lock operations held in the safe mode, for frozen locks, for the approval and for the conflict fallback,
+// and the shard DDL infos queued for unknown tables. it's lost when the DM-master restarts or the leader changes,
+// then the new Optimist rebuilds the locks from the shard DDL infos in etcd and emits the operations not put yet,
+// held again only if it's configured before started, e.g. by `SetSafeMode` or `SetRiskyDDLFunc`.
 func NewOptimist(pLogger *log.Logger, getDownstreamMetaFunc func(string) (*config.DBConfig, string)) *Optimist {
 	return &Optimist{
-		logger: pLogger.WithFields(zap.String("component", "shard DDL optimist")),
-		closed: true,
-		lk:     optimism.NewLockKeeper(getDownstreamMetaFunc),
-		tk:     optimism.NewTableKeeper(),
+		logger:      pLogger.WithFields(zap.String("component", "shard DDL optimist")),
+		closed:      true,
+		lk:          optimism.NewLockKeeper(getDownstreamMetaFunc),
+		tk:          optimism.NewTableKeeper(),
+		frozen:      make(map[string]map[string]map[string]map[string]heldOperation),
+		notes:       make(map[string]string),
+		approvals:   make(map[string]map[string]heldOperation),
+		unconfirmed: make(map[string]map[string]heldOperation),
+		conflicts:   make(map[string]map[string]string),
+		infoEventCh: make(chan InfoEvent, infoEventChanSize),
+
+		conflictCounts: make(map[string]int),
+		fallbacks:      make(map[string]*pessimisticFallback),
+
+		getDownstreamMeta: getDownstreamMetaFunc,
+
+		appliedSchemas: make(map[string]*model.TableInfo),
+		quorumResolved: make(map[string]quorumResolvedLock),
+
+		unknownTablePolicy: UnknownTableRegister,
+		queuedInfos:        make(map[string]map[string]queuedInfo),
+
+		infoVersions:   make(map[string]int64),
+		reorderedInfos: make(map[string]map[int64]optimism.Info),
+
+		truncateTablePolicy: TruncateTablePassThrough,
+		mixedAlterPolicy:    MixedAlterSplit,
+
+		pendingApplies: make(map[string]map[string]pendingApply),
+		laggingSources: make(map[string]map[string]pendingApply),
+
+		resolvedAuditSize: defaultResolvedLockAuditSize,
+		resolvedTasks:     make(map[string]struct{}),
+		processedRevCh:    make(chan struct{}),
 	}
 }
 
 // Start starts the shard DDL coordination in optimism mode.
 // NOTE: for logic errors, it should start without returning errors (but report via metrics or log) so that the user can fix them.
 func (o *Optimist) Start(pCtx context.Context, etcdCli *clientv3.Client) error {
+	return o.start(pCtx, etcdCli, newEtcdOptimistStore(etcdCli))
+}
+
+// StartWithStore starts the shard DDL coordination in optimism mode with the specified store instead of etcd.
+// NOTE: the heartbeats and the partially dropped columns of shard DDL locks are only kept in etcd,
+// so they are neither kept nor persisted when starting with this.
+func (o *Optimist) StartWithStore(pCtx context.Context, store OptimistStore) error {
+	return o.start(pCtx, nil, store)
+}
+
+func (o *Optimist) start(pCtx context.Context, etcdCli *clientv3.Client, store OptimistStore) error {
 	o.logger.Info("the shard DDL optimist is starting")
 
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
-	o.cli = etcdCli // o.cli should be set before watching and recover locks because these operations need o.cli
+	// o.cli and o.store should be set before watching and recover locks because these operations need them.
+	o.cli = etcdCli
+	o.store = newInstrumentedOptimistStore(store)
+
+	// take over the coordination from the previous leader, lock operations put by it are fenced since then.
+	epoch, err := o.store.AcquireLeaderEpoch()
+	if err != nil {
+		return err
+	}
+	o.epoch = epoch
+	o.logger.Info("acquired the leader epoch", zap.Int64("epoch", epoch))
+
+	// the state is rebuilt from scratch, so is the confirmation in the safe mode.
+	o.confirmed = false
+	o.unconfirmed = make(map[string]map[string]heldOperation)
+	o.resetApplies()
 
 	revSource, revInfo, revOperation, err := o.rebuildLocks()
 	if err != nil {
@@ -86,6 +399,20 @@ func (o *Optimist) Start(pCtx context.Context, etcdCli *clientv3.Client) error {
 		o.run(ctx, revSource, revInfo, revOperation)
 	}()
 
+	if o.cli != nil {
+		o.wg.Add(1)
+		go func() {
+			defer o.wg.Done()
+			o.heartbeatLocks(ctx)
+		}()
+	}
+
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		o.checkApplyTimeouts(ctx)
+	}()
+
 	o.closed = false // started now, no error will interrupt the start process.
 	o.cancel = cancel
 	o.logger.Info("the shard DDL optimist has started")
@@ -111,54 +438,901 @@ func (o *Optimist) Close() {
 	o.logger.Info("the shard DDL optimist has closed")
 }
 
+// InfoEvents returns the channel of the results of handling shard DDL infos.
+// the events are dropped if the channel is full, so the caller should consume it in time.
+func (o *Optimist) InfoEvents() <-chan InfoEvent {
+	return o.infoEventCh
+}
+
+// SetResolvedLockAuditSize sets the number of the resolved lock records kept after `Compact`.
+func (o *Optimist) SetResolvedLockAuditSize(size int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.resolvedAuditSize = size
+}
+
+// ResolvedLocks returns the audit records of the resolved locks, from the oldest to the newest.
+func (o *Optimist) ResolvedLocks() []ResolvedLock {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]ResolvedLock(nil), o.resolved...)
+}
+
+// Compact trims the audit records of the resolved locks to the configured size,
+// and prunes the pending DDL metrics of the tasks which have no lock and no source table now.
+func (o *Optimist) Compact() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if n := len(o.resolved) - o.resolvedAuditSize; n > 0 {
+		// copy to release the memory of the trimmed records.
+		o.resolved = append(make([]ResolvedLock, 0, o.resolvedAuditSize), o.resolved[n:]...)
+	}
+
+	activeTasks := make(map[string]struct{})
+	for _, lock := range o.lk.Locks() {
+		activeTasks[lock.Task] = struct{}{}
+	}
+	for task := range o.resolvedTasks {
+		if _, ok := activeTasks[task]; ok || o.tk.HasTask(task) {
+			continue
+		}
+		metrics.RemoveDDLPending(task)
+		delete(o.resolvedTasks, task)
+	}
+	o.logger.Info("the shard DDL optimist has compacted", zap.Int("resolved lock records", len(o.resolved)))
+}
+
+// WaitForRevision blocks until the watched events, i.e. the PUT and DELETE of the source tables and the shard DDL infos,
+// up to the etcd revision `rev` have been applied, so the caller can observe the effect of its put without polling.
+// NOTE: the source tables and the shard DDL infos are watched separately, so the events of one kind may be applied
+// after the later events of the other kind, wait for the last revision put if both kinds are put.
+func (o *Optimist) WaitForRevision(ctx context.Context, rev int64) error {
+	for {
+		o.revMu.Lock()
+		processed := o.processedRev
+		ch := o.processedRevCh
+		o.revMu.Unlock()
+
+		// the infos held back by `orderInfo` are not applied yet, neither the revisions after them are.
+		// it's checked after the processed revision is read, as the held ones are always watched before.
+		o.mu.Lock()
+		for _, infos := range o.reorderedInfos {
+			for _, info := range infos {
+				if info.Revision <= processed {
+					processed = info.Revision - 1
+				}
+			}
+		}
+		o.mu.Unlock()
+		if processed >= rev {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ch:
+		}
+	}
+}
+
+// Saturated returns whether the queue of shard DDL infos waiting to be handled is full, e.g. etcd writes are slow,
+// producers of shard DDL infos should throttle `PutInfo` until it's not saturated.
+func (o *Optimist) Saturated() bool {
+	o.queueMu.RLock()
+	defer o.queueMu.RUnlock()
+	return o.infoQueue != nil && len(o.infoQueue) >= cap(o.infoQueue)
+}
+
+// setProcessedRevision advances the revision of the last watched event applied.
+func (o *Optimist) setProcessedRevision(rev int64) {
+	o.revMu.Lock()
+	defer o.revMu.Unlock()
+	if rev <= o.processedRev {
+		return
+	}
+	o.processedRev = rev
+	close(o.processedRevCh)
+	o.processedRevCh = make(chan struct{})
+}
+
+// Epoch returns the leader epoch acquired when the optimist started.
+func (o *Optimist) Epoch() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.epoch
+}
+
 // Locks return all shard DDL locks current exist.
 func (o *Optimist) Locks() map[string]*optimism.Lock {
 	return o.lk.Locks()
 }
 
-// ShowLocks is used by `show-ddl-locks` command.
-func (o *Optimist) ShowLocks(task string, sources []string) []*pb.DDLLock {
-	locks := o.lk.Locks()
-	ret := make([]*pb.DDLLock, 0, len(locks))
-	for _, lock := range locks {
-		if task != "" && task != lock.Task {
-			continue // specify task but mismatch
+// LocksByAge returns all shard DDL locks current exist, ordered by the creation time from the oldest one,
+// locks created at the same time are ordered by ID.
+func (o *Optimist) LocksByAge() []*optimism.Lock {
+	locks := o.lk.Locks()
+	ret := make([]*optimism.Lock, 0, len(locks))
+	for _, lock := range locks {
+		ret = append(ret, lock)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if !ret[i].CreatedAt().Equal(ret[j].CreatedAt()) {
+			return ret[i].CreatedAt().Before(ret[j].CreatedAt())
+		}
+		return ret[i].ID < ret[j].ID
+	})
+	return ret
+}
+
+// ShowLocks is used by `show-ddl-locks` command.
+func (o *Optimist) ShowLocks(task string, sources []string) []*pb.DDLLock {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	locks := o.lk.Locks()
+	ret := make([]*pb.DDLLock, 0, len(locks))
+	for _, lock := range locks {
+		if task != "" && task != lock.Task {
+			continue // specify task but mismatch
+		}
+		ready := lock.Ready()
+		if len(sources) > 0 {
+			for _, source := range sources {
+				if _, ok := ready[source]; ok {
+					goto FOUND // if any source matched, show lock for it.
+				}
+			}
+			continue // specify sources but mismath
+		}
+	FOUND:
+		l := &pb.DDLLock{
+			ID:       lock.ID,
+			Task:     lock.Task,
+			Mode:     config.ShardOptimistic,
+			Owner:    "",  // N/A for the optimistic mode
+			DDLs:     nil, // N/A for the optimistic mode
+			Synced:   make([]string, 0, len(ready)),
+			Unsynced: make([]string, 0, len(ready)),
+		}
+		if fb, ok := o.fallbacks[lock.ID]; ok {
+			l.Mode = config.ShardPessimistic
+			l.Owner = fb.owner
+			l.DDLs = fb.ddls
+		}
+		for source, schemaTables := range ready {
+			for schema, tables := range schemaTables {
+				for table, synced := range tables {
+					if synced {
+						l.Synced = append(l.Synced, fmt.Sprintf("%s-%s", source, dbutil.TableName(schema, table)))
+					} else {
+						l.Unsynced = append(l.Unsynced, fmt.Sprintf("%s-%s", source, dbutil.TableName(schema, table)))
+					}
+				}
+			}
+		}
+		sort.Strings(l.Synced)
+		sort.Strings(l.Unsynced)
+		l.Advisories = lock.Advisories()
+		l.Note = o.notes[lock.ID]
+		ret = append(ret, l)
+	}
+	return ret
+}
+
+// PendingDDLs returns the DDLs not done yet for all shard DDL locks of the task, keyed by lock ID.
+// locks without pending DDLs are not included.
+func (o *Optimist) PendingDDLs(task string) map[string][]string {
+	ret := make(map[string][]string)
+	for lockID, lock := range o.lk.Locks() {
+		if lock.Task != task {
+			continue
+		}
+		if ddls := lock.PendingDDLs(); len(ddls) > 0 {
+			ret[lockID] = ddls
+		}
+	}
+	return ret
+}
+
+// Report returns a human-readable summary of all shard DDL locks for CLI display,
+// including the number of locks, the oldest lock and the detected conflicts.
+func (o *Optimist) Report() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	locks := o.lk.Locks()
+	ids := make([]string, 0, len(locks))
+	var (
+		synced int
+		oldest *optimism.Lock
+	)
+	for id, lock := range locks {
+		ids = append(ids, id)
+		if ok, _ := lock.IsSynced(); ok {
+			synced++
+		}
+		if oldest == nil || lock.CreatedAt().Before(oldest.CreatedAt()) {
+			oldest = lock
+		}
+	}
+	sort.Strings(ids)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d shard DDL lock(s), %d synced, %d unsynced, %d with conflicts\n",
+		len(locks), synced, len(locks)-synced, len(o.conflicts))
+	if oldest != nil {
+		_, remain := oldest.IsSynced()
+		fmt.Fprintf(&b, "oldest lock: %s, created at %s, %d table(s) unsynced\n",
+			oldest.ID, oldest.CreatedAt().Format(time.RFC3339), remain)
+	}
+	o.applyMu.Lock()
+	for _, id := range ids {
+		sources := make([]string, 0, len(o.laggingSources[id]))
+		for source := range o.laggingSources[id] {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+		for _, source := range sources {
+			fmt.Fprintf(&b, "lagging: lock %s, source %s, operations not done since %s\n",
+				id, source, o.laggingSources[id][source].putAt.Format(time.RFC3339))
+		}
+	}
+	o.applyMu.Unlock()
+	for _, id := range ids {
+		if fb, ok := o.fallbacks[id]; ok {
+			fmt.Fprintf(&b, "fallback: lock %s, coordinated pessimistically by owner %s\n", id, fb.owner)
+		}
+	}
+	for _, id := range ids {
+		if note, ok := o.notes[id]; ok {
+			fmt.Fprintf(&b, "note: lock %s: %s\n", id, note)
+		}
+	}
+	for _, id := range ids {
+		tables := o.conflicts[id]
+		tableIDs := make([]string, 0, len(tables))
+		for table := range tables {
+			tableIDs = append(tableIDs, table)
+		}
+		sort.Strings(tableIDs)
+		for _, table := range tableIDs {
+			fmt.Fprintf(&b, "conflict: lock %s, table %s: %s\n", id, table, tables[table])
+		}
+	}
+	return b.String()
+}
+
+// openMetricsLabelEscaper escapes the label values in the OpenMetrics text format.
+var openMetricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// MetricsText returns the state of all shard DDL locks in the OpenMetrics text format computed on demand,
+// for the environments scraping a static text endpoint instead of the Prometheus client.
+func (o *Optimist) MetricsText() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	locks := o.LocksByAge()
+	now := time.Now()
+	var b strings.Builder
+	b.WriteString("# TYPE dm_master_shard_ddl_locks gauge\n")
+	b.WriteString("# HELP dm_master_shard_ddl_locks number of active shard DDL locks\n")
+	fmt.Fprintf(&b, "dm_master_shard_ddl_locks %d\n", len(locks))
+	families := []struct {
+		name, help string
+		value      func(lock *optimism.Lock) float64
+	}{
+		{"dm_master_shard_ddl_lock_unsynced_tables", "number of upstream tables not synced of the shard DDL lock", func(lock *optimism.Lock) float64 {
+			_, remain := lock.IsSynced()
+			return float64(remain)
+		}},
+		{"dm_master_shard_ddl_lock_conflicts", "number of upstream tables in conflict of the shard DDL lock", func(lock *optimism.Lock) float64 {
+			return float64(len(o.conflicts[lock.ID]))
+		}},
+		{"dm_master_shard_ddl_lock_age_seconds", "seconds since the shard DDL lock is created", func(lock *optimism.Lock) float64 {
+			return now.Sub(lock.CreatedAt()).Seconds()
+		}},
+	}
+	for _, family := range families {
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", family.name)
+		fmt.Fprintf(&b, "# HELP %s %s\n", family.name, family.help)
+		for _, lock := range locks {
+			fmt.Fprintf(&b, "%s{task=\"%s\",lock=\"%s\"} %s\n", family.name,
+				openMetricsLabelEscaper.Replace(lock.Task), openMetricsLabelEscaper.Replace(lock.ID),
+				strconv.FormatFloat(family.value(lock), 'g', -1, 64))
+		}
+	}
+	b.WriteString("# EOF\n")
+	return b.String()
+}
+
+// SetApplyTimeout sets the timeout for the sources to apply the shard DDL lock operations, sources which
+// don't mark the operations as done within it are reported by the metrics, `LaggingSources` and `Report`,
+// but the operations are never skipped automatically. 0 disables the timeout.
+func (o *Optimist) SetApplyTimeout(timeout time.Duration) {
+	o.applyMu.Lock()
+	defer o.applyMu.Unlock()
+	o.applyTimeout = timeout
+}
+
+// LaggingSources returns the sources exceeding the apply timeout, lock ID -> sorted sources.
+func (o *Optimist) LaggingSources() map[string][]string {
+	o.applyMu.Lock()
+	defer o.applyMu.Unlock()
+	ret := make(map[string][]string, len(o.laggingSources))
+	for lockID, sources := range o.laggingSources {
+		for source := range sources {
+			ret[lockID] = append(ret[lockID], source)
+		}
+		sort.Strings(ret[lockID])
+	}
+	return ret
+}
+
+// checkApplyTimeouts checks the sources exceeding the apply timeout periodically.
+func (o *Optimist) checkApplyTimeouts(ctx context.Context) {
+	ticker := time.NewTicker(applyTimeoutCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			o.updateLaggingSources(now)
+		}
+	}
+}
+
+// updateLaggingSources recomputes the sources exceeding the apply timeout at the time, and reports the changes.
+func (o *Optimist) updateLaggingSources(now time.Time) {
+	o.applyMu.Lock()
+	defer o.applyMu.Unlock()
+
+	lagging := make(map[string]map[string]pendingApply)
+	if o.applyTimeout > 0 {
+		for lockID, tables := range o.pendingApplies {
+			for _, p := range tables {
+				if now.Sub(p.putAt) < o.applyTimeout {
+					continue
+				}
+				if _, ok := lagging[lockID]; !ok {
+					lagging[lockID] = make(map[string]pendingApply)
+				}
+				if earliest, ok := lagging[lockID][p.source]; !ok || p.putAt.Before(earliest.putAt) {
+					lagging[lockID][p.source] = p
+				}
+			}
+		}
+	}
+
+	oldTasks, newTasks := laggingTasks(o.laggingSources), laggingTasks(lagging)
+	for lockID, sources := range lagging {
+		for source, p := range sources {
+			if _, ok := o.laggingSources[lockID][source]; !ok {
+				o.logger.Warn("the source has not applied the shard DDL lock operations within the apply timeout",
+					zap.String("lock", lockID), zap.String("source", source), zap.Time("since", p.putAt), zap.Duration("timeout", o.applyTimeout))
+			}
+		}
+	}
+	for task, sources := range oldTasks {
+		for source := range sources {
+			if _, ok := newTasks[task][source]; !ok {
+				metrics.ReportShardDDLLaggingSource(task, source, false)
+			}
+		}
+	}
+	for task, sources := range newTasks {
+		for source := range sources {
+			metrics.ReportShardDDLLaggingSource(task, source, true)
+		}
+	}
+	o.laggingSources = lagging
+}
+
+// laggingTasks groups the lagging sources by task, task -> source.
+func laggingTasks(lagging map[string]map[string]pendingApply) map[string]map[string]struct{} {
+	ret := make(map[string]map[string]struct{})
+	for _, sources := range lagging {
+		for source, p := range sources {
+			if _, ok := ret[p.task]; !ok {
+				ret[p.task] = make(map[string]struct{})
+			}
+			ret[p.task][source] = struct{}{}
+		}
+	}
+	return ret
+}
+
+// resetApplies clears the tracked operations and the lagging sources.
+func (o *Optimist) resetApplies() {
+	o.applyMu.Lock()
+	defer o.applyMu.Unlock()
+	for task, sources := range laggingTasks(o.laggingSources) {
+		for source := range sources {
+			metrics.ReportShardDDLLaggingSource(task, source, false)
+		}
+	}
+	o.pendingApplies = make(map[string]map[string]pendingApply)
+	o.laggingSources = make(map[string]map[string]pendingApply)
+}
+
+// trackApply tracks the operation put until it's done by the source.
+func (o *Optimist) trackApply(op optimism.Operation) {
+	if op.Done || op.ConflictStage != optimism.ConflictNone {
+		return
+	}
+	o.applyMu.Lock()
+	defer o.applyMu.Unlock()
+	tableID := fmt.Sprintf("%s-%s", op.Source, dbutil.TableName(op.UpSchema, op.UpTable))
+	if _, ok := o.pendingApplies[op.ID]; !ok {
+		o.pendingApplies[op.ID] = make(map[string]pendingApply)
+	}
+	if _, ok := o.pendingApplies[op.ID][tableID]; !ok {
+		o.pendingApplies[op.ID][tableID] = pendingApply{task: op.Task, source: op.Source, putAt: time.Now()}
+	}
+}
+
+// untrackApply stops tracking the operation of the table, or all operations of the lock if the table is empty.
+func (o *Optimist) untrackApply(lockID, tableID string) {
+	o.applyMu.Lock()
+	defer o.applyMu.Unlock()
+	if tableID == "" {
+		delete(o.pendingApplies, lockID)
+		return
+	}
+	delete(o.pendingApplies[lockID], tableID)
+	if len(o.pendingApplies[lockID]) == 0 {
+		delete(o.pendingApplies, lockID)
+	}
+}
+
+// SetSafeMode sets whether the optimist runs in the safe mode, which holds all lock operations after started
+// until `ConfirmReady` is called, so that an optimist taking over a running cluster doesn't emit operations
+// before the operator has checked its state, the shard DDL infos are still handled in the meantime.
+// the confirmation isn't persisted, enable the safe mode before `Start` to hold all operations rebuilt after
+// a restart until confirmed again, see `NewOptimist`.
+func (o *Optimist) SetSafeMode(enabled bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.safeMode = enabled
+}
+
+// ConfirmReady confirms the optimist is ready to emit lock operations in the safe mode,
+// and puts all lock operations held since started.
+func (o *Optimist) ConfirmReady() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return terror.ErrMasterOptimistNotStarted.Generate()
+	}
+	if o.confirmed {
+		return nil
+	}
+	o.confirmed = true
+	held := o.unconfirmed
+	o.unconfirmed = make(map[string]map[string]heldOperation)
+	o.logger.Info("the shard DDL optimist is confirmed ready", zap.Int("held locks", len(held)))
+
+	for lockID, tables := range held {
+		if o.lk.FindLock(lockID) == nil {
+			continue // the lock has been removed before confirmed.
+		}
+		for _, h := range tables {
+			if o.holdIfFrozen(h) {
+				continue
+			}
+			if err := o.putOperation(h.op, h.skipDone, h.infoRev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FreezeLock freezes the specified lock, a frozen lock still accepts shard DDL infos and updates
+// its synced status, but emits no lock operations until it's unfrozen by `UnfreezeLock`.
+// the lock isn't frozen any more after the DM-master restarts, and the held operations are emitted then.
+func (o *Optimist) FreezeLock(lockID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return terror.ErrMasterOptimistNotStarted.Generate()
+	}
+	if o.lk.FindLock(lockID) == nil {
+		return terror.ErrMasterLockNotFound.Generate(lockID)
+	}
+	if _, ok := o.frozen[lockID]; !ok {
+		o.frozen[lockID] = make(map[string]map[string]map[string]heldOperation)
+	}
+	o.logger.Info("the shard DDL lock has been frozen", zap.String("lock", lockID))
+	return nil
+}
+
+// UnfreezeLock unfreezes the specified lock and puts all lock operations held during it's frozen.
+func (o *Optimist) UnfreezeLock(lockID string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return terror.ErrMasterOptimistNotStarted.Generate()
+	}
+	held, ok := o.frozen[lockID]
+	if !ok {
+		return nil // not frozen
+	}
+	delete(o.frozen, lockID)
+	o.logger.Info("the shard DDL lock has been unfrozen", zap.String("lock", lockID))
+
+	if o.lk.FindLock(lockID) == nil {
+		return nil // the lock has been removed during it's frozen.
+	}
+	for _, schemaTables := range held {
+		for _, tables := range schemaTables {
+			for _, h := range tables {
+				if err := o.putOperation(h.op, h.skipDone, h.infoRev); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SetLockNote attaches the free-text note to the specified lock, e.g. why it's stuck or being held,
+// the note is persisted so it survives the restart of DM-master, and is shown by `ShowLocks` and `Report`.
+// an empty note clears the existing one.
+func (o *Optimist) SetLockNote(lockID, note string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return terror.ErrMasterOptimistNotStarted.Generate()
+	}
+	if o.lk.FindLock(lockID) == nil {
+		return terror.ErrMasterLockNotFound.Generate(lockID)
+	}
+	if _, err := o.store.PutLockNote(lockID, note); err != nil {
+		return err
+	}
+	if note == "" {
+		delete(o.notes, lockID)
+	} else {
+		o.notes[lockID] = note
+	}
+	o.logger.Info("the note of the shard DDL lock has been set", zap.String("lock", lockID), zap.String("note", note))
+	return nil
+}
+
+// SetUnknownTablePolicy sets the policy for shard DDL infos whose upstream tables are not in the source tables.
+// the infos queued by `UnknownTableQueue` are kept in memory, they're queued again from etcd after a restart
+// only if the policy is set before `Start`.
+func (o *Optimist) SetUnknownTablePolicy(policy UnknownTablePolicy) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.unknownTablePolicy = policy
+}
+
+// SetTruncateTablePolicy sets the policy for shard DDL infos of TRUNCATE TABLE.
+func (o *Optimist) SetTruncateTablePolicy(policy TruncateTablePolicy) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.truncateTablePolicy = policy
+}
+
+// SetMixedAlterPolicy sets the policy for shard DDL infos of ALTER TABLE which both add and drop columns.
+func (o *Optimist) SetMixedAlterPolicy(policy MixedAlterPolicy) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.mixedAlterPolicy = policy
+}
+
+// SetConflictResolver sets the resolver consulted when a shard DDL conflict is detected,
+// nil means conflicts are never resolved automatically.
+func (o *Optimist) SetConflictResolver(resolver ConflictResolver) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.conflictResolver = resolver
+}
+
+// SetDownstreamSchemaResolver sets the function fetching the schema of the downstream table, which is consulted
+// when a shard DDL conflict is detected and not resolved by the conflict resolver. the type of the conflicting column
+// in the downstream table wins if it's one of the conflicting types, nil means the downstream table is never consulted.
+func (o *Optimist) SetDownstreamSchemaResolver(fn DownstreamSchemaFunc) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.downstreamSchema = fn
+}
+
+// SetConflictFallback makes a shard DDL lock fall back to the pessimistic coordination once the number of
+// conflicts detected on it reaches the threshold, the table of the conflict reaching the threshold becomes the owner.
+// after that, the conflicts of the lock are resolved by the owner executing its DDLs and the other tables skipping theirs,
+// and the operations of the other tables are held until the owner's operation is done.
+// a non-positive threshold disables the fallback, which is the default.
+// the owners and the held operations aren't persisted, a lock falls back again only after the conflicts
+// detected when rebuilding it from etcd reach the threshold.
+func (o *Optimist) SetConflictFallback(threshold int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.fallbackThreshold = threshold
+}
+
+// SetShadowMode enables the shadow mode with a non-nil `report`, in which the joined schemas of locks are computed
+// but no operations are emitted, and `report` is called when one diverges from the schema recorded by
+// `RecordAppliedSchema`. it's used to validate a migration without acting on it.
+func (o *Optimist) SetShadowMode(report ReportDivergenceFunc) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.reportDivergence = report
+}
+
+// RecordAppliedSchema records the schema applied externally to the downstream table of the lock,
+// and checks it against the joined schema of the lock in the shadow mode.
+func (o *Optimist) RecordAppliedSchema(lockID string, ti *model.TableInfo) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.appliedSchemas[lockID] = ti
+	if lock := o.lk.FindLock(lockID); lock != nil {
+		o.checkDivergence(lock)
+	}
+}
+
+// checkDivergence reports the divergence if the joined schema of the lock differs from the applied one in the shadow mode.
+func (o *Optimist) checkDivergence(lock *optimism.Lock) {
+	applied, ok := o.appliedSchemas[lock.ID]
+	if o.reportDivergence == nil || !ok {
+		return
+	}
+	joined := lock.Joined()
+	appliedTable := schemacmp.Encode(applied)
+	if cmp, err := joined.Compare(appliedTable); err == nil && cmp == 0 {
+		return
+	}
+	d := Divergence{LockID: lock.ID, Computed: joined.String(), Applied: appliedTable.String()}
+	o.logger.Warn("the joined schema of the shard DDL lock diverges from the applied one",
+		zap.String("lock", d.LockID), zap.String("computed", d.Computed), zap.String("applied", d.Applied))
+	o.reportDivergence(d)
+}
+
+// SetQuorum sets the fraction of sources, e.g. 2/3, whose tables must be synced and done to resolve a lock,
+// the straggling sources are deferred, and their shard DDL infos are reconciled later if they reach the joined
+// schema, or reported as conflicts otherwise. a non-positive quorum or not less than 1 requires all sources.
+// the straggling sources are recorded in memory, so they're forgotten when the DM-master restarts.
+func (o *Optimist) SetQuorum(quorum float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.quorum = quorum
+	o.lk.SetQuorum(quorum)
+}
+
+// checkResolved returns whether the lock has resolved, either all tables or the quorum of sources are synced and done,
+// the straggling sources are recorded if it's resolved by the quorum.
+func (o *Optimist) checkResolved(lock *optimism.Lock) bool {
+	if lock.IsResolved() {
+		return true
+	}
+	if o.quorum <= 0 || o.quorum >= 1 {
+		return false
+	}
+	resolved, stragglers := lock.ResolvedSources()
+	if float64(len(resolved))/float64(len(resolved)+len(stragglers)) < o.quorum {
+		return false
+	}
+	q := quorumResolvedLock{task: lock.Task, joined: lock.Joined(), stragglers: make(map[string]struct{}, len(stragglers))}
+	for _, source := range stragglers {
+		q.stragglers[source] = struct{}{}
+	}
+	o.quorumResolved[lock.ID] = q
+	o.logger.Info("the shard DDL lock has been resolved by the quorum of sources",
+		zap.String("lock", lock.ID), zap.Strings("resolved sources", resolved), zap.Strings("straggling sources", stragglers))
+	return true
+}
+
+// handleStraggler handles the shard DDL info from a straggling source of a lock resolved by the quorum,
+// it returns false if the info should be handled as usual.
+func (o *Optimist) handleStraggler(info optimism.Info, skipDone bool) (bool, error) {
+	lockID := utils.GenDDLLockID(info.Task, info.DownSchema, info.DownTable)
+	q, ok := o.quorumResolved[lockID]
+	if !ok {
+		return false, nil
+	}
+	if _, ok = q.stragglers[info.Source]; !ok || info.IsDeleted || len(info.TableInfosAfter) == 0 {
+		return false, nil
+	}
+	delete(q.stragglers, info.Source)
+	if len(q.stragglers) == 0 {
+		delete(o.quorumResolved, lockID)
+	}
+
+	if cmp, err := q.joined.Compare(schemacmp.Encode(info.TableInfosAfter[len(info.TableInfosAfter)-1])); err == nil && cmp == 0 {
+		// the downstream has already reached the schema, no DDLs need to be executed.
+		o.logger.Info("reconcile the straggling source of the shard DDL lock resolved by the quorum",
+			zap.String("lock", lockID), zap.String("info", info.ShortString()))
+		op := optimism.NewOperation(lockID, info.Task, info.Source, info.UpSchema, info.UpTable, nil, optimism.ConflictNone, "", false, nil)
+		return true, o.putOperation(op, skipDone, info.Revision)
+	}
+	if cmp, err := q.joined.Compare(schemacmp.Encode(info.TableInfoBefore)); err == nil && cmp == 0 {
+		// the straggling source has caught up, it's a new shard DDL.
+		return false, nil
+	}
+	cfMsg := fmt.Sprintf("the schema of the straggling source %s diverges from the joined schema %s of the lock resolved by the quorum", info.Source, q.joined)
+	o.logger.Warn("conflict detected for the straggling source of the shard DDL lock resolved by the quorum",
+		zap.String("lock", lockID), zap.String("info", info.ShortString()))
+	op := optimism.NewOperation(lockID, info.Task, info.Source, info.UpSchema, info.UpTable, info.DDLs, optimism.ConflictDetected, cfMsg, false, nil)
+	return true, o.putOperation(op, skipDone, info.Revision)
+}
+
+// SetRiskyDDLFunc sets the predicate of risky DDLs, lock operations of the matched shard DDL infos
+// are held until they're approved by `ApproveOperation`. nil means no DDLs require approval.
+// the pending approvals aren't persisted, set it before `Start` so the rebuilt operations are held again after a restart.
+func (o *Optimist) SetRiskyDDLFunc(fn RiskyDDLFunc) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.riskyDDL = fn
+}
+
+// PendingApprovals returns the lock operations waiting for the manual approval, sorted by lock ID and table.
+func (o *Optimist) PendingApprovals() []PendingApproval {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ret := make([]PendingApproval, 0)
+	for lockID, tables := range o.approvals {
+		for table, h := range tables {
+			ret = append(ret, PendingApproval{LockID: lockID, Table: table, DDLs: h.op.DDLs})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].LockID != ret[j].LockID {
+			return ret[i].LockID < ret[j].LockID
+		}
+		return ret[i].Table < ret[j].Table
+	})
+	return ret
+}
+
+// ApproveOperation approves the lock operation of the table pending approval and emits it,
+// `table` is in the format of source-`schema`.`table` as in `PendingApprovals`.
+func (o *Optimist) ApproveOperation(lockID, table string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return terror.ErrMasterOptimistNotStarted.Generate()
+	}
+	h, ok := o.approvals[lockID][table]
+	if !ok {
+		return terror.ErrMasterOptimisticApprovalNotFound.Generate(lockID, table)
+	}
+	delete(o.approvals[lockID], table)
+	if len(o.approvals[lockID]) == 0 {
+		delete(o.approvals, lockID)
+	}
+	o.logger.Info("the shard DDL lock operation has been approved", zap.String("lock", lockID), zap.Stringer("operation", h.op))
+
+	// the approved operation is still subject to the other holds, as if it's not held for the approval.
+	if o.lk.FindLock(lockID) == nil || o.holdForFallback(table, h) || o.holdIfFrozen(h) {
+		return nil
+	}
+	return o.putOperation(h.op, h.skipDone, h.infoRev)
+}
+
+// PreviewResolution returns the shard DDL lock operations which would be emitted for the specified lock until it's resolved,
+// one for each table not done yet, without emitting them.
+func (o *Optimist) PreviewResolution(lockID string) ([]optimism.Operation, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return nil, terror.ErrMasterOptimistNotStarted.Generate()
+	}
+	lock := o.lk.FindLock(lockID)
+	if lock == nil {
+		return nil, terror.ErrMasterLockNotFound.Generate(lockID)
+	}
+	return lock.PendingOperations(), nil
+}
+
+// TargetSchemaForSource returns the joined schema of the lock, which the tables of the source must converge to,
+// it's used to remediate the lagging sources.
+func (o *Optimist) TargetSchemaForSource(lockID, source string) (*model.TableInfo, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return nil, terror.ErrMasterOptimistNotStarted.Generate()
+	}
+	lock := o.lk.FindLock(lockID)
+	if lock == nil {
+		return nil, terror.ErrMasterLockNotFound.Generate(lockID)
+	}
+	if _, ok := lock.Ready()[source]; !ok {
+		return nil, terror.ErrMasterOptimisticSourceNotInLock.Generate(source, lockID)
+	}
+	return lock.JoinedTableInfo()
+}
+
+// SeedJoinedSchema forcibly sets the joined schema of the lock to the table created by the CREATE TABLE statement,
+// and the schemas of all tables in the lock to it as if they have been synced, so the later shard DDL infos
+// are validated against it. it's used for the disaster recovery when the lock state in etcd is partially lost.
+// the seed is persisted and reapplied when the locks are rebuilt from etcd, e.g. DM-master restarts.
+func (o *Optimist) SeedJoinedSchema(lockID string, createSQL string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return terror.ErrMasterOptimistNotStarted.Generate()
+	}
+	lock := o.lk.FindLock(lockID)
+	if lock == nil {
+		return terror.ErrMasterLockNotFound.Generate(lockID)
+	}
+	ti, err := parseSeedSchema(lockID, createSQL)
+	if err != nil {
+		return err
+	}
+	if _, err = o.store.PutLockSeed(lockID, createSQL); err != nil {
+		return err
+	}
+	lock.SeedJoined(ti)
+	o.logger.Warn("the joined schema of the shard DDL lock has been seeded", zap.String("lock", lockID), zap.String("schema", createSQL))
+	return nil
+}
+
+// parseSeedSchema parses the CREATE TABLE statement seeded to the lock into the table info.
+func parseSeedSchema(lockID, createSQL string) (*model.TableInfo, error) {
+	stmt, err := parser.New().ParseOneStmt(createSQL, "", "")
+	if err != nil {
+		return nil, terror.ErrMasterOptimisticInvalidJoinedSchema.Delegate(err, createSQL, lockID)
+	}
+	createStmt, ok := stmt.(*ast.CreateTableStmt)
+	if !ok {
+		return nil, terror.ErrMasterOptimisticInvalidJoinedSchema.Generate(createSQL, lockID)
+	}
+	ti, err := ddl.BuildTableInfoFromAST(createStmt)
+	if err != nil {
+		return nil, terror.ErrMasterOptimisticInvalidJoinedSchema.Delegate(err, createSQL, lockID)
+	}
+	ti.State = model.StatePublic
+	return ti, nil
+}
+
+// ReemitOperation re-puts the shard DDL lock operations of the specified lock for the source,
+// this is used when a source missed its operation, e.g. the DM-worker restarted after the operation was consumed.
+// the operations are marked not done, so the DM-worker runs their DDLs again, it should only be used when
+// the DDLs are known not executed in the downstream. they're held by the frozen lock, the manual approval
+// and the pessimistic fallback as the newly emitted ones.
+func (o *Optimist) ReemitOperation(lockID, source string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return terror.ErrMasterOptimistNotStarted.Generate()
+	}
+	lock := o.lk.FindLock(lockID)
+	if lock == nil {
+		return terror.ErrMasterLockNotFound.Generate(lockID)
+	}
+
+	infos, ops, _, err := o.store.GetInfosOperationsByTask(lock.Task)
+	if err != nil {
+		return err
+	}
+	reemitted := false
+	for _, op := range ops {
+		if op.ID != lockID || op.Source != source {
+			continue
 		}
-		ready := lock.Ready()
-		if len(sources) > 0 {
-			for _, source := range sources {
-				if _, ok := ready[source]; ok {
-					goto FOUND // if any source matched, show lock for it.
-				}
+		// the DM-worker should handle the operation again.
+		op.Done = false
+		info := optimism.Info{Task: op.Task, Source: op.Source, UpSchema: op.UpSchema, UpTable: op.UpTable, DDLs: op.DDLs}
+		for _, i := range infos {
+			if i.Source == op.Source && i.UpSchema == op.UpSchema && i.UpTable == op.UpTable {
+				info = i
+				break
 			}
-			continue // specify sources but mismath
-		}
-	FOUND:
-		l := &pb.DDLLock{
-			ID:       lock.ID,
-			Task:     lock.Task,
-			Mode:     config.ShardOptimistic,
-			Owner:    "",  // N/A for the optimistic mode
-			DDLs:     nil, // N/A for the optimistic mode
-			Synced:   make([]string, 0, len(ready)),
-			Unsynced: make([]string, 0, len(ready)),
 		}
-		for source, schemaTables := range ready {
-			for schema, tables := range schemaTables {
-				for table, synced := range tables {
-					if synced {
-						l.Synced = append(l.Synced, fmt.Sprintf("%s-%s", source, dbutil.TableName(schema, table)))
-					} else {
-						l.Unsynced = append(l.Unsynced, fmt.Sprintf("%s-%s", source, dbutil.TableName(schema, table)))
-					}
-				}
-			}
+		tableID := fmt.Sprintf("%s-%s", op.Source, dbutil.TableName(op.UpSchema, op.UpTable))
+		if err = o.emitOperation(tableID, info, heldOperation{op: op}); err != nil {
+			return err
 		}
-		sort.Strings(l.Synced)
-		sort.Strings(l.Unsynced)
-		ret = append(ret, l)
+		reemitted = true
 	}
-	return ret
+	if !reemitted {
+		return terror.ErrMasterOptimisticOperationNotFound.Generate(lockID, source)
+	}
+	return nil
 }
 
 // RemoveMetaDataWithTask removes meta data for a specified task
@@ -174,7 +1348,7 @@ func (o *Optimist) RemoveMetaDataWithTask(task string) error {
 
 	lockIDSet := make(map[string]struct{})
 
-	infos, ops, _, err := optimism.GetInfosOperationsByTask(o.cli, task)
+	infos, ops, _, err := o.store.GetInfosOperationsByTask(task)
 	if err != nil {
 		return err
 	}
@@ -185,12 +1359,21 @@ func (o *Optimist) RemoveMetaDataWithTask(task string) error {
 	for _, op := range ops {
 		o.lk.RemoveLock(op.ID)
 	}
+	for lockID := range lockIDSet {
+		delete(o.notes, lockID)
+	}
 
 	o.lk.RemoveDownstreamMeta(task)
 	o.tk.RemoveTableByTask(task)
+	delete(o.queuedInfos, task)
+	for lockID, q := range o.quorumResolved {
+		if q.task == task {
+			delete(o.quorumResolved, lockID)
+		}
+	}
 
 	// clear meta data in etcd
-	_, err = optimism.DeleteInfosOperationsTablesByTask(o.cli, task, lockIDSet)
+	_, err = o.store.DeleteInfosOperationsTablesByTask(task, lockIDSet)
 	return err
 }
 
@@ -220,9 +1403,16 @@ func (o *Optimist) RemoveMetaDataWithTaskAndSources(task string, sources ...stri
 	o.lk.RemoveDownstreamMeta(task)
 	// remove source table in table keeper
 	o.tk.RemoveTableByTaskAndSources(task, sources)
+	for _, source := range sources {
+		for table, q := range o.queuedInfos[task] {
+			if q.info.Source == source {
+				delete(o.queuedInfos[task], table)
+			}
+		}
+	}
 	o.logger.Debug("the tables removed from the table keeper", zap.String("task", task), zap.Strings("source", sources))
 	// clear meta data in etcd
-	_, err := optimism.DeleteInfosOperationsTablesByTaskAndSource(o.cli, task, sources, dropColumns)
+	_, err := o.store.DeleteInfosOperationsTablesByTaskAndSource(task, sources, dropColumns)
 	return err
 }
 
@@ -256,35 +1446,68 @@ func (o *Optimist) run(ctx context.Context, revSource, revInfo, revOperation int
 	}
 }
 
+// heartbeatLocks refreshes the heartbeat of all active shard DDL locks periodically.
+func (o *Optimist) heartbeatLocks(ctx context.Context) {
+	ticker := time.NewTicker(lockHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, lock := range o.lk.Locks() {
+				if err := lock.Heartbeat(lockHeartbeatTTL); err != nil {
+					o.logger.Warn("fail to refresh the heartbeat of the shard DDL lock", zap.String("lock", lock.ID), log.ShortError(err))
+				}
+			}
+		}
+	}
+}
+
 // rebuildLocks rebuilds shard DDL locks from etcd persistent data.
 func (o *Optimist) rebuildLocks() (revSource, revInfo, revOperation int64, err error) {
 	o.lk.Clear() // clear all previous locks to support re-Start.
+	// conflicts are detected again when recovering the locks, so the stale ones are never reported.
+	o.conflicts = make(map[string]map[string]string)
+	o.conflictCounts = make(map[string]int)
+	o.fallbacks = make(map[string]*pessimisticFallback)
 
 	// get the history & initial source tables.
-	stm, revSource, err := optimism.GetAllSourceTables(o.cli)
+	stm, revSource, err := o.store.GetAllSourceTables()
 	if err != nil {
 		return 0, 0, 0, err
 	}
 	// we do not log `stm`, `ifm` and `opm` now, because they may too long in optimism mode.
 	o.logger.Info("get history initial source tables", zap.Int64("revision", revSource))
-	o.tk.Init(stm) // re-initialize again with valid tables.
+	// re-initialize again with valid tables.
+	if err = o.tk.Init(stm); err != nil {
+		// only log the error, and don't return it to forbid the startup of the DM-master leader.
+		// then these misconfigured tasks can be handled by the user.
+		o.logger.Error("inconsistent targets found in source tables", log.ShortError(err))
+	}
 
 	// get the history shard DDL info.
-	ifm, revInfo, err := optimism.GetAllInfo(o.cli)
+	ifm, revInfo, err := o.store.GetAllInfo()
 	if err != nil {
 		return 0, 0, 0, err
 	}
 	o.logger.Info("get history shard DDL info", zap.Int64("revision", revInfo))
+	o.infoVersions = make(map[string]int64)
+	o.reorderedInfos = make(map[string]map[int64]optimism.Info)
+	for _, info := range sortInfos(ifm) {
+		key := common.ShardDDLOptimismInfoKeyAdapter.Encode(info.Task, info.Source, info.UpSchema, info.UpTable)
+		o.infoVersions[key] = info.Version
+	}
 
 	// get the history shard DDL lock operation.
 	// the newly operations after this GET will be received through the WATCH with `revOperation+1`,
-	opm, revOperation, err := optimism.GetAllOperations(o.cli)
+	opm, revOperation, err := o.store.GetAllOperations()
 	if err != nil {
 		return 0, 0, 0, err
 	}
 	o.logger.Info("get history shard DDL lock operation", zap.Int64("revision", revOperation))
 
-	colm, _, err := optimism.GetAllDroppedColumns(o.cli)
+	colm, _, err := o.store.GetAllDroppedColumns()
 	if err != nil {
 		// only log the error, and don't return it to forbid the startup of the DM-master leader.
 		// then these unexpected columns can be handled by the user.
@@ -292,14 +1515,31 @@ func (o *Optimist) rebuildLocks() (revSource, revInfo, revOperation int64, err e
 	}
 	o.lk.SetDropColumns(colm)
 
+	notes, _, err := o.store.GetAllLockNotes()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	o.notes = notes
+
+	seeds, _, err := o.store.GetAllLockSeeds()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
 	// recover the shard DDL lock based on history shard DDL info & lock operation.
-	err = o.recoverLocks(ifm, opm)
+	err = o.recoverLocks(ifm, opm, seeds)
 	if err != nil {
 		// only log the error, and don't return it to forbid the startup of the DM-master leader.
 		// then these unexpected locks can be handled by the user.
 		o.logger.Error("fail to recover locks", log.ShortError(err))
 	}
 	o.lk.SetDropColumns(nil)
+	// the watchers resume from the revisions respectively, the events up to both of them have been applied.
+	if revSource < revInfo {
+		o.setProcessedRevision(revSource)
+	} else {
+		o.setProcessedRevision(revInfo)
+	}
 
 	return revSource, revInfo, revOperation, nil
 }
@@ -318,9 +1558,23 @@ func sortInfos(ifm map[string]map[string]map[string]map[string]optimism.Info) []
 		}
 	}
 
-	// sort according to the Revision
+	// sort according to the Revision, infos with the same revision (e.g. put in one transaction) are sorted by their tables,
+	// so that the locks and the conflict stages of their operations are rebuilt deterministically.
 	sort.Slice(infos, func(i, j int) bool {
-		return infos[i].Revision < infos[j].Revision
+		a, b := infos[i], infos[j]
+		if a.Revision != b.Revision {
+			return a.Revision < b.Revision
+		}
+		if a.Task != b.Task {
+			return a.Task < b.Task
+		}
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.UpSchema != b.UpSchema {
+			return a.UpSchema < b.UpSchema
+		}
+		return a.UpTable < b.UpTable
 	})
 	return infos
 }
@@ -329,6 +1583,7 @@ func sortInfos(ifm map[string]map[string]map[string]map[string]optimism.Info) []
 func (o *Optimist) recoverLocks(
 	ifm map[string]map[string]map[string]map[string]optimism.Info,
 	opm map[string]map[string]map[string]map[string]optimism.Operation,
+	seeds map[string]optimism.LockSeed,
 ) error {
 	// sort infos by revision
 	infos := sortInfos(ifm)
@@ -338,6 +1593,27 @@ func (o *Optimist) recoverLocks(
 			firstErr = err
 		}
 	}
+	// the seeded joined schema is reapplied once the lock is recovered from the infos put before it,
+	// so the infos put after it are synced on top of it as they were. if the infos put before it have been
+	// overwritten, it's dropped as the infos put after it are based on it already.
+	reseed := func(lockID string) {
+		seed, ok := seeds[lockID]
+		if !ok {
+			return
+		}
+		delete(seeds, lockID)
+		lock := o.lk.FindLock(lockID)
+		if lock == nil {
+			return
+		}
+		ti, err := parseSeedSchema(lockID, seed.CreateSQL)
+		if err != nil {
+			o.logger.Error("fail to reapply the seeded joined schema while recovering locks", zap.String("lock", lockID), zap.Error(err))
+			setFirstErr(err)
+			return
+		}
+		lock.SeedJoined(ti)
+	}
 
 	for _, info := range infos {
 		if info.IsDeleted {
@@ -347,6 +1623,10 @@ func (o *Optimist) recoverLocks(
 		if !o.tk.SourceTableExist(info.Task, info.Source, info.UpSchema, info.UpTable, info.DownSchema, info.DownTable) {
 			continue
 		}
+		lockID := utils.GenDDLLockID(info.Task, info.DownSchema, info.DownTable)
+		if seed, ok := seeds[lockID]; ok && seed.Revision < info.Revision {
+			reseed(lockID)
+		}
 		// never mark the lock operation from `done` to `not-done` when recovering.
 		err := o.handleInfo(info, true)
 		if err != nil {
@@ -354,6 +1634,9 @@ func (o *Optimist) recoverLocks(
 			setFirstErr(err)
 		}
 	}
+	for lockID := range seeds {
+		reseed(lockID)
+	}
 
 	// update the done status of the lock.
 	for _, opTask := range opm {
@@ -399,7 +1682,7 @@ func (o *Optimist) watchSourceInfoOperation(
 			wg.Done()
 			close(sourceCh)
 		}()
-		optimism.WatchSourceTables(ctx, o.cli, revSource+1, sourceCh, errCh)
+		o.store.WatchSourceTables(ctx, revSource+1, sourceCh, errCh)
 	}()
 	go func() {
 		defer wg.Done()
@@ -407,14 +1690,17 @@ func (o *Optimist) watchSourceInfoOperation(
 	}()
 
 	// watch for the shard DDL info and handle them.
-	infoCh := make(chan optimism.Info, 10)
+	infoCh := make(chan optimism.Info, infoQueueSize)
+	o.queueMu.Lock()
+	o.infoQueue = infoCh
+	o.queueMu.Unlock()
 	wg.Add(2)
 	go func() {
 		defer func() {
 			wg.Done()
 			close(infoCh)
 		}()
-		optimism.WatchInfo(ctx, o.cli, revInfo+1, infoCh, errCh)
+		o.store.WatchInfo(ctx, revInfo+1, infoCh, errCh)
 	}()
 	go func() {
 		defer wg.Done()
@@ -429,7 +1715,7 @@ func (o *Optimist) watchSourceInfoOperation(
 			wg.Done()
 			close(opCh)
 		}()
-		optimism.WatchOperationPut(ctx, o.cli, "", "", "", "", revOperation+1, opCh, errCh)
+		o.store.WatchOperationPut(ctx, revOperation+1, opCh, errCh)
 	}()
 	go func() {
 		defer wg.Done()
@@ -454,13 +1740,26 @@ func (o *Optimist) handleSourceTables(ctx context.Context, sourceCh <-chan optim
 			if !ok {
 				return
 			}
-			updated := o.tk.Update(st)
-			o.logger.Info("receive source tables", zap.Stringer("source tables", st),
-				zap.Bool("is deleted", st.IsDeleted), zap.Bool("updated", updated))
+			o.applySourceTables(st)
+			o.setProcessedRevision(st.Revision)
 		}
 	}
 }
 
+// applySourceTables applies the source tables received from the store or replayed.
+func (o *Optimist) applySourceTables(st optimism.SourceTables) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.recordEvent(RecordedEvent{SourceTables: &st})
+
+	updated := o.tk.Update(st)
+	o.logger.Info("receive source tables", zap.Stringer("source tables", st),
+		zap.Bool("is deleted", st.IsDeleted), zap.Bool("updated", updated))
+	if updated {
+		o.handleQueuedInfos(st.Task)
+	}
+}
+
 // handleInfoPut handles PUT and DELETE for the shard DDL info.
 func (o *Optimist) handleInfoPut(ctx context.Context, infoCh <-chan optimism.Info) {
 	for {
@@ -471,38 +1770,96 @@ func (o *Optimist) handleInfoPut(ctx context.Context, infoCh <-chan optimism.Inf
 			if !ok {
 				return
 			}
-			o.logger.Info("receive a shard DDL info", zap.Stringer("info", info), zap.Bool("is deleted", info.IsDeleted))
-
-			// avoid new ddl added while previous ddl resolved and remove lock
-			// change lock granularity if needed
-			o.mu.Lock()
-			if info.IsDeleted {
-				lock := o.lk.FindLockByInfo(info)
-				if lock == nil {
-					// this often happen after the lock resolved.
-					o.logger.Debug("lock for info not found", zap.String("info", info.ShortString()))
-					o.mu.Unlock()
-					continue
-				}
-				// handle `DROP TABLE`, need to remove the table schema from the lock,
-				// and remove the table name from table keeper.
-				removed := lock.TryRemoveTable(info.Source, info.UpSchema, info.UpTable)
-				o.logger.Debug("the table name remove from the table keeper", zap.Bool("removed", removed), zap.String("info", info.ShortString()))
-				removed = o.tk.RemoveTable(info.Task, info.Source, info.UpSchema, info.UpTable, info.DownSchema, info.DownTable)
-				o.logger.Debug("a table removed for info from the lock", zap.Bool("removed", removed), zap.String("info", info.ShortString()))
-				o.mu.Unlock()
-				continue
-			}
+			metrics.ReportInfoQueueLength(len(infoCh))
+			o.applyInfo(info)
+			o.setProcessedRevision(info.Revision)
+		}
+	}
+}
+
+// applyInfo applies the shard DDL info received from the store or replayed.
+func (o *Optimist) applyInfo(info optimism.Info) {
+	o.logger.Info("receive a shard DDL info", zap.Stringer("info", info), zap.Bool("is deleted", info.IsDeleted))
+
+	// avoid new ddl added while previous ddl resolved and remove lock
+	// change lock granularity if needed
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.recordEvent(RecordedEvent{Info: &info})
+
+	if info.IsDeleted {
+		// the version of the key restarts from 1 after it's deleted.
+		key := common.ShardDDLOptimismInfoKeyAdapter.Encode(info.Task, info.Source, info.UpSchema, info.UpTable)
+		delete(o.infoVersions, key)
+		delete(o.reorderedInfos, key)
+		lock := o.lk.FindLockByInfo(info)
+		if lock == nil {
+			// this often happen after the lock resolved.
+			o.logger.Debug("lock for info not found", zap.String("info", info.ShortString()))
+			return
+		}
+		// handle `DROP TABLE`, need to remove the table schema from the lock,
+		// and remove the table name from table keeper.
+		removed := lock.TryRemoveTable(info.Source, info.UpSchema, info.UpTable)
+		o.logger.Debug("the table name remove from the table keeper", zap.Bool("removed", removed), zap.String("info", info.ShortString()))
+		removed = o.tk.RemoveTable(info.Task, info.Source, info.UpSchema, info.UpTable, info.DownSchema, info.DownTable)
+		o.logger.Debug("a table removed for info from the lock", zap.Bool("removed", removed), zap.String("info", info.ShortString()))
+		return
+	}
+
+	// put operation for the table. we don't set `skipDone=true` now,
+	// because in optimism mode, one table may execute/done multiple DDLs but other tables may do nothing.
+	for _, ready := range o.orderInfo(info) {
+		_ = o.handleInfo(ready, false)
+	}
+}
+
+// orderInfo returns the infos of the upstream table ready to be handled in order, the info arriving out of order
+// is held until all infos of the table before it arrive, and the stale one is dropped.
+// infos without versions, e.g. constructed manually, are always ready.
+func (o *Optimist) orderInfo(info optimism.Info) []optimism.Info {
+	if info.Version == 0 {
+		return []optimism.Info{info}
+	}
+	key := common.ShardDDLOptimismInfoKeyAdapter.Encode(info.Task, info.Source, info.UpSchema, info.UpTable)
+	last, ok := o.infoVersions[key]
+	switch {
+	case !ok || info.Version == last+1:
+	case info.Version <= last:
+		o.logger.Warn("drop the stale shard DDL info", zap.Int64("version", info.Version),
+			zap.Int64("handled version", last), zap.String("info", info.ShortString()))
+		return nil
+	default:
+		if _, ok := o.reorderedInfos[key]; !ok {
+			o.reorderedInfos[key] = make(map[int64]optimism.Info)
+		}
+		o.reorderedInfos[key][info.Version] = info
+		o.logger.Warn("hold the shard DDL info arriving out of order", zap.Int64("version", info.Version),
+			zap.Int64("handled version", last), zap.String("info", info.ShortString()))
+		return nil
+	}
 
-			// put operation for the table. we don't set `skipDone=true` now,
-			// because in optimism mode, one table may execute/done multiple DDLs but other tables may do nothing.
-			_ = o.handleInfo(info, false)
-			o.mu.Unlock()
+	ready := []optimism.Info{info}
+	for last = info.Version; ; last++ {
+		next, ok := o.reorderedInfos[key][last+1]
+		if !ok {
+			break
 		}
+		delete(o.reorderedInfos[key], last+1)
+		ready = append(ready, next)
 	}
+	if len(o.reorderedInfos[key]) == 0 {
+		delete(o.reorderedInfos, key)
+	}
+	o.infoVersions[key] = last
+	return ready
 }
 
 func (o *Optimist) handleInfo(info optimism.Info, skipDone bool) error {
+	if o.unknownTablePolicy != UnknownTableRegister && o.isUnknownTable(info) {
+		return o.handleUnknownTable(info, skipDone)
+	}
+
 	added := o.tk.AddTable(info.Task, info.Source, info.UpSchema, info.UpTable, info.DownSchema, info.DownTable)
 	o.logger.Debug("a table added for info", zap.Bool("added", added), zap.String("info", info.ShortString()))
 
@@ -511,7 +1868,7 @@ func (o *Optimist) handleInfo(info optimism.Info, skipDone bool) error {
 		// WATCH for SourceTables may fall behind WATCH for Info although PUT earlier,
 		// so we try to get SourceTables again.
 		// NOTE: check SourceTables for `info.Source` if needed later.
-		stm, _, err := optimism.GetAllSourceTables(o.cli)
+		stm, _, err := o.store.GetAllSourceTables()
 		if err != nil {
 			o.logger.Error("fail to get source tables", log.ShortError(err))
 		} else if tts2 := optimism.TargetTablesForTask(info.Task, info.DownSchema, info.DownTable, stm); tts2 != nil {
@@ -526,6 +1883,67 @@ func (o *Optimist) handleInfo(info optimism.Info, skipDone bool) error {
 	return err
 }
 
+// isUnknownTable returns whether the upstream table of the info is not in the source tables.
+func (o *Optimist) isUnknownTable(info optimism.Info) bool {
+	if o.tk.SourceTableExist(info.Task, info.Source, info.UpSchema, info.UpTable, info.DownSchema, info.DownTable) {
+		return false
+	}
+	// WATCH for SourceTables may fall behind WATCH for Info although PUT earlier,
+	// so we try to get SourceTables again.
+	stm, _, err := o.store.GetAllSourceTables()
+	if err != nil {
+		o.logger.Error("fail to get source tables", log.ShortError(err))
+		return true
+	}
+	st, ok := stm[info.Task][info.Source]
+	if !ok {
+		return true
+	}
+	_, ok = st.TargetTable(info.DownSchema, info.DownTable).UpTables[info.UpSchema][info.UpTable]
+	return !ok
+}
+
+// handleUnknownTable handles the info whose upstream table is unknown by the policy.
+func (o *Optimist) handleUnknownTable(info optimism.Info, skipDone bool) error {
+	lockID := utils.GenDDLLockID(info.Task, info.DownSchema, info.DownTable)
+	if o.unknownTablePolicy == UnknownTableQueue {
+		if _, ok := o.queuedInfos[info.Task]; !ok {
+			o.queuedInfos[info.Task] = make(map[string]queuedInfo)
+		}
+		o.queuedInfos[info.Task][fmt.Sprintf("%s-%s", info.Source, dbutil.TableName(info.UpSchema, info.UpTable))] = queuedInfo{info: info, skipDone: skipDone}
+		o.sendInfoEvent(InfoEvent{LockID: lockID, Info: info, Result: InfoResultQueued})
+		o.logger.Info("queue the shard DDL info until its upstream table appears in the source tables", zap.String("info", info.ShortString()))
+		return nil
+	}
+
+	err := terror.ErrMasterOptimisticUnknownSourceTable.Generate(dbutil.TableName(info.UpSchema, info.UpTable), info.Source, info.Task)
+	o.sendInfoEvent(InfoEvent{LockID: lockID, Info: info, Result: InfoResultRejected})
+	o.logger.Warn("reject the shard DDL info of the unknown upstream table", zap.String("info", info.ShortString()), log.ShortError(err))
+	op := optimism.NewOperation(lockID, info.Task, info.Source, info.UpSchema, info.UpTable, []string{}, optimism.ConflictDetected, err.Error(), false, nil)
+	return o.putOperation(op, skipDone, info.Revision)
+}
+
+// handleQueuedInfos handles the queued infos of the task whose upstream tables have appeared in the source tables.
+func (o *Optimist) handleQueuedInfos(task string) {
+	queued := o.queuedInfos[task]
+	tables := make([]string, 0, len(queued))
+	for table, q := range queued {
+		if o.tk.SourceTableExist(q.info.Task, q.info.Source, q.info.UpSchema, q.info.UpTable, q.info.DownSchema, q.info.DownTable) {
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		q := queued[table]
+		delete(queued, table)
+		o.logger.Info("handle the queued shard DDL info", zap.String("info", q.info.ShortString()))
+		_ = o.handleInfo(q.info, q.skipDone)
+	}
+	if len(queued) == 0 {
+		delete(o.queuedInfos, task)
+	}
+}
+
 // handleOperationPut handles PUT for the shard DDL lock operations.
 func (o *Optimist) handleOperationPut(ctx context.Context, opCh <-chan optimism.Operation) {
 	for {
@@ -536,21 +1954,27 @@ func (o *Optimist) handleOperationPut(ctx context.Context, opCh <-chan optimism.
 			if !ok {
 				return
 			}
-			o.logger.Info("receive a shard DDL lock operation", zap.Stringer("operation", op))
-			if !op.Done {
-				o.logger.Info("the shard DDL lock operation has not done", zap.Stringer("operation", op))
-				continue
-			}
-
-			// avoid new ddl added while previous ddl resolved and remove lock
-			// change lock granularity if needed
-			o.mu.Lock()
-			o.handleOperation(op)
-			o.mu.Unlock()
+			o.applyOperation(op)
 		}
 	}
 }
 
+// applyOperation applies the shard DDL lock operation received from the store or replayed.
+func (o *Optimist) applyOperation(op optimism.Operation) {
+	o.logger.Info("receive a shard DDL lock operation", zap.Stringer("operation", op))
+	if !op.Done {
+		o.logger.Info("the shard DDL lock operation has not done", zap.Stringer("operation", op))
+		return
+	}
+
+	// avoid new ddl added while previous ddl resolved and remove lock
+	// change lock granularity if needed
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.recordEvent(RecordedEvent{Operation: &op})
+	o.handleOperation(op)
+}
+
 func (o *Optimist) handleOperation(op optimism.Operation) {
 	lock := o.lk.FindLock(op.ID)
 	if lock == nil {
@@ -565,9 +1989,15 @@ func (o *Optimist) handleOperation(op optimism.Operation) {
 	// in optimistic mode, we always try to mark a table as done after received the `done` status of the DDLs operation.
 	// NOTE: even all tables have done their previous DDLs operations, the lock may still not resolved,
 	// because these tables may have different schemas.
+	if op.Done {
+		o.untrackApply(op.ID, fmt.Sprintf("%s-%s", op.Source, dbutil.TableName(op.UpSchema, op.UpTable)))
+	}
 	done := lock.TryMarkDone(op.Source, op.UpSchema, op.UpTable)
 	o.logger.Info("mark operation for a table as done", zap.Bool("done", done), zap.Stringer("operation", op))
-	if !lock.IsResolved() {
+	if op.Done {
+		o.releaseFallback(op)
+	}
+	if !o.checkResolved(lock) {
 		o.logger.Info("the lock is still not resolved", zap.Stringer("operation", op))
 		return
 	}
@@ -586,9 +2016,58 @@ func (o *Optimist) handleOperation(op optimism.Operation) {
 
 // handleLock handles a single shard DDL lock.
 func (o *Optimist) handleLock(info optimism.Info, tts []optimism.TargetTable, skipDone bool) error {
+	if handled, err := o.handleStraggler(info, skipDone); handled {
+		return err
+	}
+	if o.mixedAlterPolicy == MixedAlterSplit {
+		splitInfo, err := optimism.SplitMixedAlterDDLs(info)
+		if err != nil {
+			// the ALTER TABLE is handled as is, and the conflict is detected by `TrySync` if any.
+			o.logger.Warn("fail to split the mixed ALTER TABLE", zap.String("info", info.ShortString()), log.ShortError(err))
+		} else {
+			info = splitInfo
+		}
+	}
+
 	cfStage := optimism.ConflictNone
 	cfMsg := ""
+	result := InfoResultAdvanced
+	if prevLock := o.lk.FindLockByInfo(info); prevLock == nil {
+		result = InfoResultCreated
+	} else if len(info.TableInfosAfter) > 0 &&
+		prevLock.IsTableInfoSame(info.Source, info.UpSchema, info.UpTable, info.TableInfosAfter[len(info.TableInfosAfter)-1]) {
+		result = InfoResultNoop
+	}
 	lockID, newDDLs, cols, err := o.lk.TrySync(o.cli, info, tts)
+	tableID := fmt.Sprintf("%s-%s", info.Source, dbutil.TableName(info.UpSchema, info.UpTable))
+	if err != nil && !info.IgnoreConflict {
+		if resolvedDDLs, ok := o.resolveConflict(lockID, info); ok {
+			o.logger.Info("shard DDL conflict resolved by the conflict resolver",
+				zap.String("lock", lockID), zap.Strings("resolved ddls", resolvedDDLs), zap.String("info", info.ShortString()), log.ShortError(err))
+			newDDLs, cols, err = resolvedDDLs, nil, nil
+		} else if resolvedDDLs, ok := o.resolveByDownstream(lockID, info); ok {
+			o.logger.Info("shard DDL conflict resolved by the downstream schema",
+				zap.String("lock", lockID), zap.Strings("resolved ddls", resolvedDDLs), zap.String("info", info.ShortString()), log.ShortError(err))
+			newDDLs, cols, err = resolvedDDLs, nil, nil
+		} else if resolvedDDLs, ok := o.resolveByFallback(lockID, tableID, info, tts); ok {
+			o.logger.Info("shard DDL conflict resolved by the pessimistic fallback",
+				zap.String("lock", lockID), zap.Strings("resolved ddls", resolvedDDLs), zap.String("info", info.ShortString()), log.ShortError(err))
+			newDDLs, cols, err = resolvedDDLs, nil, nil
+		} else {
+			result = InfoResultConflicted
+		}
+	}
+	if err == nil && optimism.IsTruncateTableDDLs(info.DDLs) {
+		// TRUNCATE TABLE never changes the joined schema, so it's handled by the policy
+		// no matter whether the table has caught up with the joined schema.
+		newDDLs, cols = info.DDLs, nil
+		if o.truncateTablePolicy == TruncateTableSkip {
+			newDDLs = nil
+		}
+		o.logger.Info("handle TRUNCATE TABLE by the policy", zap.String("lock", lockID),
+			zap.String("policy", string(o.truncateTablePolicy)), zap.String("info", info.ShortString()))
+	}
+	o.sendInfoEvent(InfoEvent{LockID: lockID, Info: info, Result: result})
 	switch {
 	case info.IgnoreConflict:
 		o.logger.Warn("error occur when trying to sync for shard DDL info, this often means shard DDL conflict detected",
@@ -610,7 +2089,7 @@ func (o *Optimist) handleLock(info optimism.Info, tts []optimism.TargetTable, sk
 	}
 
 	// check whether the lock has resolved.
-	if lock.IsResolved() {
+	if o.checkResolved(lock) {
 		// remove all operations for this shard DDL lock.
 		// this is to handle the case where dm-master exit before deleting operations for them.
 		_, err = o.removeLock(lock)
@@ -624,12 +2103,255 @@ func (o *Optimist) handleLock(info optimism.Info, tts []optimism.TargetTable, sk
 		return nil
 	}
 
+	if o.reportDivergence != nil {
+		o.checkDivergence(lock)
+		return nil
+	}
+
 	op := optimism.NewOperation(lockID, lock.Task, info.Source, info.UpSchema, info.UpTable, newDDLs, cfStage, cfMsg, false, cols)
-	rev, succ, err := optimism.PutOperation(o.cli, skipDone, op, info.Revision)
+	if cfStage == optimism.ConflictDetected {
+		if _, ok := o.conflicts[lockID]; !ok {
+			o.conflicts[lockID] = make(map[string]string)
+		}
+		o.conflicts[lockID][tableID] = cfMsg
+	} else if _, ok := o.conflicts[lockID][tableID]; ok {
+		delete(o.conflicts[lockID], tableID)
+		if len(o.conflicts[lockID]) == 0 {
+			delete(o.conflicts, lockID)
+		}
+	}
+
+	return o.emitOperation(tableID, info, heldOperation{op: op, skipDone: skipDone, infoRev: info.Revision})
+}
+
+// emitOperation puts the lock operation of the table for the shard DDL info, unless it's held for the approval,
+// by the pessimistic fallback, or by the frozen lock.
+func (o *Optimist) emitOperation(tableID string, info optimism.Info, h heldOperation) error {
+	lockID := h.op.ID
+	if h.op.ConflictStage == optimism.ConflictNone && o.riskyDDL != nil && o.riskyDDL(info) {
+		if _, ok := o.approvals[lockID]; !ok {
+			o.approvals[lockID] = make(map[string]heldOperation)
+		}
+		o.approvals[lockID][tableID] = h
+		o.logger.Info("hold shard DDL lock operation for the approval", zap.String("lock", lockID), zap.Stringer("operation", h.op))
+		return nil
+	}
+	if o.holdForFallback(tableID, h) || o.holdIfFrozen(h) {
+		return nil
+	}
+	return o.putOperation(h.op, h.skipDone, h.infoRev)
+}
+
+// resolveByFallback counts the conflict of the shard DDL info, and resolves it by the pessimistic fallback of the lock
+// if it's engaged, or engages it if the threshold is reached. it returns the DDLs to emit instead, which are the DDLs
+// of the info for the owner and none for the other tables, or false if the conflict is not resolved.
+func (o *Optimist) resolveByFallback(lockID, tableID string, info optimism.Info, tts []optimism.TargetTable) ([]string, bool) {
+	if o.fallbackThreshold <= 0 {
+		return nil, false
+	}
+	fb, ok := o.fallbacks[lockID]
+	if !ok {
+		o.conflictCounts[lockID]++
+		if o.conflictCounts[lockID] < o.fallbackThreshold {
+			return nil, false
+		}
+		fb = &pessimisticFallback{owner: tableID, ddls: info.DDLs, held: make(map[string]heldOperation)}
+		o.fallbacks[lockID] = fb
+		o.logger.Warn("fall back to the pessimistic coordination for the shard DDL lock with repeated conflicts",
+			zap.String("lock", lockID), zap.Int("conflicts", o.conflictCounts[lockID]), zap.String("owner", tableID))
+	}
+	// record the table info regardless of the conflict, so the lock is synced once all tables have the same schema.
+	info.IgnoreConflict = true
+	if _, _, _, err := o.lk.TrySync(o.cli, info, tts); err != nil {
+		o.logger.Debug("conflict ignored by the pessimistic fallback", zap.String("lock", lockID), log.ShortError(err))
+	}
+	if tableID == fb.owner {
+		return info.DDLs, true
+	}
+	return nil, true
+}
+
+// holdForFallback holds the lock operation of a non-owner table if its lock falls back to the pessimistic coordination
+// and the owner's operation is not done yet, and returns whether it's held.
+func (o *Optimist) holdForFallback(tableID string, h heldOperation) bool {
+	fb, ok := o.fallbacks[h.op.ID]
+	if !ok || fb.ownerDone || tableID == fb.owner {
+		return false
+	}
+	fb.held[tableID] = h
+	o.logger.Info("hold shard DDL lock operation until the owner's operation is done",
+		zap.String("lock", h.op.ID), zap.String("owner", fb.owner), zap.Stringer("operation", h.op))
+	return true
+}
+
+// releaseFallback puts the lock operations held by the pessimistic fallback once the owner's operation is done.
+func (o *Optimist) releaseFallback(op optimism.Operation) {
+	fb, ok := o.fallbacks[op.ID]
+	if !ok || fb.ownerDone || fmt.Sprintf("%s-%s", op.Source, dbutil.TableName(op.UpSchema, op.UpTable)) != fb.owner {
+		return
+	}
+	fb.ownerDone = true
+	held := fb.held
+	fb.held = make(map[string]heldOperation)
+	tableIDs := make([]string, 0, len(held))
+	for tableID := range held {
+		tableIDs = append(tableIDs, tableID)
+	}
+	sort.Strings(tableIDs)
+	for _, tableID := range tableIDs {
+		h := held[tableID]
+		if o.holdIfFrozen(h) {
+			continue
+		}
+		if err := o.putOperation(h.op, h.skipDone, h.infoRev); err != nil {
+			o.logger.Error("fail to put the shard DDL lock operation held by the pessimistic fallback",
+				zap.String("lock", op.ID), zap.Stringer("operation", h.op), log.ShortError(err))
+		}
+	}
+}
+
+// resolveConflict consults the conflict resolver for every column whose type in the shard DDL info
+// conflicts with another source table, and returns the resolved DDLs only if all of them are resolved.
+func (o *Optimist) resolveConflict(lockID string, info optimism.Info) ([]string, bool) {
+	if o.conflictResolver == nil || len(info.TableInfosAfter) == 0 {
+		return nil, false
+	}
+	lock := o.lk.FindLock(lockID)
+	if lock == nil {
+		return nil, false
+	}
+	conflicts := lock.ColumnTypeConflicts(info.Source, info.UpSchema, info.UpTable, info.TableInfosAfter[len(info.TableInfosAfter)-1])
+	if len(conflicts) == 0 {
+		return nil, false
+	}
+	var resolvedDDLs []string
+	for _, conflict := range conflicts {
+		ddls, ok := o.conflictResolver(conflict[0], conflict[1])
+		if !ok {
+			return nil, false
+		}
+		resolvedDDLs = append(resolvedDDLs, ddls...)
+	}
+	return resolvedDDLs, true
+}
+
+// resolveByDownstream resolves the column type conflicts of the shard DDL info by the schema of the downstream table,
+// the downstream type of each conflicting column wins if it's one of the conflicting types, as the data of both types
+// are already replicated to it. it returns the DDLs of the info except those changing the conflicting columns,
+// or false if the conflict is not resolved.
+func (o *Optimist) resolveByDownstream(lockID string, info optimism.Info) ([]string, bool) {
+	if o.downstreamSchema == nil || len(info.TableInfosAfter) == 0 {
+		return nil, false
+	}
+	lock := o.lk.FindLock(lockID)
+	if lock == nil {
+		return nil, false
+	}
+	conflicts := lock.ColumnTypeConflicts(info.Source, info.UpSchema, info.UpTable, info.TableInfosAfter[len(info.TableInfosAfter)-1])
+	if len(conflicts) == 0 {
+		return nil, false
+	}
+	downstream, err := o.downstreamSchema(lock)
+	if err != nil {
+		o.logger.Warn("fail to fetch the downstream schema to resolve the shard DDL conflict", zap.String("lock", lockID), log.ShortError(err))
+		return nil, false
+	}
+	resolvedCols := make(map[string]struct{}, len(conflicts))
+	for _, conflict := range conflicts {
+		col := model.FindColumnInfo(downstream.Columns, strings.ToLower(conflict[1].Name))
+		if col == nil {
+			return nil, false
+		}
+		tp := col.FieldType.CompactStr()
+		if tp != conflict[0].Type.CompactStr() && tp != conflict[1].Type.CompactStr() {
+			return nil, false
+		}
+		resolvedCols[col.Name.L] = struct{}{}
+	}
+	resolvedDDLs := make([]string, 0, len(info.DDLs))
+	for _, sql := range info.DDLs {
+		col, err := alteredColumnName(sql)
+		if err != nil {
+			return nil, false
+		}
+		if _, ok := resolvedCols[strings.ToLower(col)]; !ok {
+			resolvedDDLs = append(resolvedDDLs, sql)
+		}
+	}
+	return resolvedDDLs, true
+}
+
+// alteredColumnName returns the name of the column added or modified by the DDL, or empty for other DDLs.
+func alteredColumnName(sql string) (string, error) {
+	stmt, err := parser.New().ParseOneStmt(sql, "", "")
+	if err != nil {
+		return "", err
+	}
+	alter, ok := stmt.(*ast.AlterTableStmt)
+	if !ok || len(alter.Specs) != 1 {
+		return "", nil
+	}
+	spec := alter.Specs[0]
+	switch spec.Tp {
+	case ast.AlterTableAddColumns, ast.AlterTableModifyColumn:
+		if len(spec.NewColumns) == 1 {
+			return spec.NewColumns[0].Name.Name.O, nil
+		}
+	case ast.AlterTableChangeColumn:
+		if spec.OldColumnName != nil && len(spec.NewColumns) == 1 &&
+			strings.EqualFold(spec.OldColumnName.Name.O, spec.NewColumns[0].Name.Name.O) {
+			return spec.OldColumnName.Name.O, nil
+		}
+	}
+	return "", nil
+}
+
+// holdIfFrozen holds the lock operation if its lock is frozen, and returns whether it's held.
+func (o *Optimist) holdIfFrozen(h heldOperation) bool {
+	held, ok := o.frozen[h.op.ID]
+	if !ok {
+		return false
+	}
+	if _, ok = held[h.op.Source]; !ok {
+		held[h.op.Source] = make(map[string]map[string]heldOperation)
+	}
+	if _, ok = held[h.op.Source][h.op.UpSchema]; !ok {
+		held[h.op.Source][h.op.UpSchema] = make(map[string]heldOperation)
+	}
+	held[h.op.Source][h.op.UpSchema][h.op.UpTable] = h
+	o.logger.Info("hold shard DDL lock operation for the frozen lock", zap.String("lock", h.op.ID), zap.Stringer("operation", h.op))
+	return true
+}
+
+// sendInfoEvent sends the result of handling a shard DDL info without blocking.
+func (o *Optimist) sendInfoEvent(ev InfoEvent) {
+	select {
+	case o.infoEventCh <- ev:
+	default:
+		o.logger.Warn("the channel of info events is full, drop the event",
+			zap.String("lock", ev.LockID), zap.String("info", ev.Info.ShortString()), zap.String("result", string(ev.Result)))
+	}
+}
+
+// putOperation PUTs a shard DDL lock operation into etcd.
+func (o *Optimist) putOperation(op optimism.Operation, skipDone bool, infoRev int64) error {
+	if o.safeMode && !o.confirmed {
+		tableID := fmt.Sprintf("%s-%s", op.Source, dbutil.TableName(op.UpSchema, op.UpTable))
+		if _, ok := o.unconfirmed[op.ID]; !ok {
+			o.unconfirmed[op.ID] = make(map[string]heldOperation)
+		}
+		o.unconfirmed[op.ID][tableID] = heldOperation{op: op, skipDone: skipDone, infoRev: infoRev}
+		o.logger.Info("hold shard DDL lock operation until the optimist is confirmed ready", zap.String("lock", op.ID), zap.Stringer("operation", op))
+		return nil
+	}
+	rev, succ, err := o.store.PutOperation(skipDone, op, infoRev)
 	if err != nil {
 		return err
 	}
-	o.logger.Info("put shard DDL lock operation", zap.String("lock", lockID),
+	if succ {
+		o.trackApply(op)
+	}
+	o.logger.Info("put shard DDL lock operation", zap.String("lock", op.ID),
 		zap.Stringer("operation", op), zap.Bool("already exist", !succ), zap.Int64("revision", rev))
 	return nil
 }
@@ -681,7 +2403,21 @@ func (o *Optimist) removeLock(lock *optimism.Lock) (bool, error) {
 		return false, nil
 	}
 	o.lk.RemoveLock(lock.ID)
+	delete(o.frozen, lock.ID)
+	delete(o.notes, lock.ID)
+	delete(o.approvals, lock.ID)
+	delete(o.unconfirmed, lock.ID)
+	o.untrackApply(lock.ID, "")
+	delete(o.conflicts, lock.ID)
+	delete(o.conflictCounts, lock.ID)
+	delete(o.fallbacks, lock.ID)
+	delete(o.appliedSchemas, lock.ID)
+	if err = lock.StopHeartbeat(); err != nil {
+		o.logger.Warn("fail to stop the heartbeat of the shard DDL lock", zap.String("lock", lock.ID), log.ShortError(err))
+	}
 	metrics.ReportDDLPending(lock.Task, metrics.DDLPendingSynced, metrics.DDLPendingNone)
+	o.resolved = append(o.resolved, ResolvedLock{ID: lock.ID, Task: lock.Task, ResolvedAt: time.Now()})
+	o.resolvedTasks[lock.Task] = struct{}{}
 	return true, nil
 }
 
@@ -701,7 +2437,7 @@ func (o *Optimist) deleteInfosOps(lock *optimism.Lock) (bool, error) {
 		}
 	}
 	// NOTE: we rely on only `task`, `downSchema`, and `downTable` used for deletion.
-	rev, deleted, err := optimism.DeleteInfosOperationsColumns(o.cli, infos, ops, lock.ID)
+	rev, deleted, err := o.store.DeleteInfosOperationsColumns(infos, ops, lock.ID)
 	if err != nil {
 		return deleted, err
 	}
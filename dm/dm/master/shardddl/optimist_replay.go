@@ -0,0 +1,123 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shardddl
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tiflow/dm/pkg/shardddl/optimism"
+	"github.com/pingcap/tiflow/dm/pkg/terror"
+)
+
+// RecordedEvent is the source tables, shard DDL info or lock operation applied by the optimist,
+// exactly one of them is set.
+type RecordedEvent struct {
+	// Delay is the elapsed time since the previous event when recorded, `Replay` waits for it before applying the event,
+	// clear it to replay without timing.
+	Delay time.Duration
+
+	SourceTables *optimism.SourceTables
+	Info         *optimism.Info
+	Operation    *optimism.Operation
+}
+
+// EventRecorder records the events applied by the optimist, see `SetRecorder`.
+type EventRecorder struct {
+	mu     sync.Mutex
+	last   time.Time
+	events []RecordedEvent
+}
+
+// NewEventRecorder creates a new EventRecorder instance.
+func NewEventRecorder() *EventRecorder {
+	return &EventRecorder{}
+}
+
+// Events returns the events recorded so far in the order of applying.
+func (r *EventRecorder) Events() []RecordedEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := make([]RecordedEvent, len(r.events))
+	copy(events, r.events)
+	return events
+}
+
+func (r *EventRecorder) record(ev RecordedEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if !r.last.IsZero() {
+		ev.Delay = now.Sub(r.last)
+	}
+	r.last = now
+	r.events = append(r.events, ev)
+}
+
+// SetRecorder sets the recorder of the source tables, shard DDL infos and lock operations applied by the optimist,
+// they can be replayed against another optimist by `Replay` to reproduce the coordination. nil stops the recording.
+// NOTE: lock operations are only recorded when they're done, as the ones not done are ignored by the optimist.
+// The state recovered when started is not recorded, so the recorder should be set before the optimist is started.
+func (o *Optimist) SetRecorder(recorder *EventRecorder) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.recorder = recorder
+}
+
+// recordEvent records the event if the recorder is set, the caller should hold the lock.
+func (o *Optimist) recordEvent(ev RecordedEvent) {
+	if o.recorder != nil {
+		o.recorder.record(ev)
+	}
+}
+
+// Replay applies the recorded events in order as if they're received from the store, waiting for the delay of each event.
+// The optimist should have been started, usually with an empty store, and lock operations are put into its store as usual.
+func (o *Optimist) Replay(events []RecordedEvent) error {
+	o.mu.Lock()
+	closed := o.closed
+	o.mu.Unlock()
+	if closed {
+		return terror.ErrMasterOptimistNotStarted.Generate()
+	}
+	for i, ev := range events {
+		n := 0
+		for _, set := range []bool{ev.SourceTables != nil, ev.Info != nil, ev.Operation != nil} {
+			if set {
+				n++
+			}
+		}
+		if n != 1 {
+			return terror.ErrMasterOptimisticInvalidRecordedEvent.Generate(i)
+		}
+	}
+
+	o.logger.Info("replay the recorded events", zap.Int("events", len(events)))
+	for _, ev := range events {
+		if ev.Delay > 0 {
+			time.Sleep(ev.Delay)
+		}
+		switch {
+		case ev.SourceTables != nil:
+			o.applySourceTables(*ev.SourceTables)
+		case ev.Info != nil:
+			o.applyInfo(*ev.Info)
+		default:
+			o.applyOperation(*ev.Operation)
+		}
+	}
+	return nil
+}
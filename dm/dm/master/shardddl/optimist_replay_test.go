@@ -0,0 +1,115 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shardddl
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/parser"
+	"github.com/pingcap/tidb/parser/model"
+	"github.com/pingcap/tidb/util/mock"
+
+	"github.com/pingcap/tiflow/dm/pkg/shardddl/optimism"
+	"github.com/pingcap/tiflow/dm/pkg/utils"
+)
+
+func (t *testOptimist) TestOptimistReplay(c *C) {
+	var (
+		backOff          = 30
+		waitTime         = 100 * time.Millisecond
+		o, store         = newMemOptimist()
+		recorder         = NewEventRecorder()
+		task             = "task-test-optimist-replay"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i12              = optimism.NewInfo(task, source1, "foo", "bar-2", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Assert(o.Replay(nil), NotNil) // not started.
+	o.SetRecorder(recorder)
+	startMemOptimist(c, ctx, o, store)
+	defer o.Close()
+
+	// record the lock lifecycle until it's synced.
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+	store.putSourceTables(st1)
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		return len(recorder.Events()) == 1
+	}), IsTrue)
+	rev := store.putInfo(i11)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op11, ok := store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	op11.Done = true
+	_, _, err := store.PutOperation(false, op11, 0)
+	c.Assert(err, IsNil)
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		return o.Locks()[lockID].IsDone(i11.Source, i11.UpSchema, i11.UpTable)
+	}), IsTrue)
+	rev = store.putInfo(i12)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+
+	events := recorder.Events()
+	c.Assert(events, HasLen, 4)
+	c.Assert(events[0].SourceTables, NotNil)
+	c.Assert(events[1].Info.UpTable, Equals, "bar-1")
+	c.Assert(events[2].Operation.Done, IsTrue)
+	c.Assert(events[3].Info.UpTable, Equals, "bar-2")
+
+	// replay against a fresh optimist, the same state is reached.
+	o2, store2 := newMemOptimist()
+	startMemOptimist(c, ctx, o2, store2)
+	defer o2.Close()
+	c.Assert(o2.Replay([]RecordedEvent{{}}), NotNil)
+	c.Assert(o2.Replay(events), IsNil)
+	c.Assert(o2.Locks(), HasKey, lockID)
+	c.Assert(optimism.DiffLockStates(o.lk.LockStates(), o2.lk.LockStates()).Empty(), IsTrue)
+	op12, ok := store2.getOperation(task, source1, "foo", "bar-2")
+	c.Assert(ok, IsTrue)
+	c.Assert(op12.DDLs, DeepEquals, DDLs1)
+
+	// the lock is resolved once the last operation is done, and so is the replayed one.
+	op12, ok = store.getOperation(task, source1, "foo", "bar-2")
+	c.Assert(ok, IsTrue)
+	op12.Done = true
+	_, _, err = store.PutOperation(false, op12, 0)
+	c.Assert(err, IsNil)
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		return len(o.Locks()) == 0
+	}), IsTrue)
+	events = recorder.Events()
+	c.Assert(events[4].Operation.Done, IsTrue)
+	for i := range events {
+		events[i].Delay = 0
+	}
+	c.Assert(o2.Replay(events[4:]), IsNil)
+	c.Assert(o2.Locks(), HasLen, 0)
+	c.Assert(o2.ResolvedLocks(), HasLen, 1)
+}
@@ -0,0 +1,353 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shardddl
+
+import (
+	"context"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+
+	"github.com/pingcap/tiflow/dm/dm/master/metrics"
+	"github.com/pingcap/tiflow/dm/pkg/shardddl/optimism"
+)
+
+// OptimistStore is the storage of the shard DDL infos, lock operations and source tables used by the optimist.
+// Revisions returned by it should increase monotonically, watching from a revision receives all changes since then.
+type OptimistStore interface {
+	// GetAllSourceTables gets all source tables, task-name -> source-ID -> source tables.
+	GetAllSourceTables() (map[string]map[string]optimism.SourceTables, int64, error)
+	// GetAllInfo gets all shard DDL infos, task-name -> source-ID -> upstream-schema-name -> upstream-table-name -> info.
+	GetAllInfo() (map[string]map[string]map[string]map[string]optimism.Info, int64, error)
+	// GetAllOperations gets all shard DDL lock operations, task-name -> source-ID -> upstream-schema-name -> upstream-table-name -> operation.
+	GetAllOperations() (map[string]map[string]map[string]map[string]optimism.Operation, int64, error)
+	// GetAllDroppedColumns gets all partially dropped columns, lock-ID -> column-name -> source-ID -> upstream-schema-name -> upstream-table-name -> stage.
+	GetAllDroppedColumns() (map[string]map[string]map[string]map[string]map[string]optimism.DropColumnStage, int64, error)
+	// GetInfosOperationsByTask gets all shard DDL infos and lock operations of the task.
+	GetInfosOperationsByTask(task string) ([]optimism.Info, []optimism.Operation, int64, error)
+	// GetAllLockNotes gets the notes of all shard DDL locks, lock-ID -> note.
+	GetAllLockNotes() (map[string]string, int64, error)
+	// GetAllLockSeeds gets the seeded joined schemas of all shard DDL locks, lock-ID -> seed.
+	GetAllLockSeeds() (map[string]optimism.LockSeed, int64, error)
+
+	// WatchSourceTables watches PUT and DELETE of source tables since the revision.
+	WatchSourceTables(ctx context.Context, revision int64, outCh chan<- optimism.SourceTables, errCh chan<- error)
+	// WatchInfo watches PUT and DELETE of shard DDL infos since the revision.
+	WatchInfo(ctx context.Context, revision int64, outCh chan<- optimism.Info, errCh chan<- error)
+	// WatchOperationPut watches PUT of shard DDL lock operations since the revision.
+	WatchOperationPut(ctx context.Context, revision int64, outCh chan<- optimism.Operation, errCh chan<- error)
+
+	// AcquireLeaderEpoch acquires a new leader epoch, `PutOperation` of the stores with older epochs are fenced since then,
+	// so no lock operations are put by the old leaders after the coordination is handed off to a new leader.
+	AcquireLeaderEpoch() (int64, error)
+	// PutOperation puts the shard DDL lock operation, see `optimism.PutOperation` for `skipDone` and `infoModRev`.
+	PutOperation(skipDone bool, op optimism.Operation, infoModRev int64) (int64, bool, error)
+	// PutLockNote puts the note of the shard DDL lock, an empty note deletes the existing one.
+	PutLockNote(lockID, note string) (int64, error)
+	// PutLockSeed puts the seeded joined schema of the shard DDL lock, it replaces the existing one.
+	PutLockSeed(lockID, createSQL string) (int64, error)
+	// DeleteInfosOperationsColumns deletes the shard DDL infos, lock operations, dropped columns, the note and the seed of the lock,
+	// only if no newer infos have been put.
+	DeleteInfosOperationsColumns(infos []optimism.Info, ops []optimism.Operation, lockID string) (int64, bool, error)
+	// DeleteInfosOperationsTablesByTask deletes the shard DDL infos, lock operations and source tables of the task.
+	DeleteInfosOperationsTablesByTask(task string, lockIDSet map[string]struct{}) (int64, error)
+	// DeleteInfosOperationsTablesByTaskAndSource deletes the shard DDL infos, lock operations and source tables of the task for sources.
+	DeleteInfosOperationsTablesByTaskAndSource(task string, sources []string, dropColumns map[string][]string) (int64, error)
+}
+
+// etcdOptimistStore is the default OptimistStore backed by etcd.
+type etcdOptimistStore struct {
+	cli *clientv3.Client
+	// the leader epoch acquired by the store, lock operations are put without fence if it's 0.
+	epoch int64
+}
+
+// newEtcdOptimistStore creates a new etcdOptimistStore instance.
+func newEtcdOptimistStore(cli *clientv3.Client) OptimistStore {
+	return &etcdOptimistStore{cli: cli}
+}
+
+// GetAllSourceTables implements OptimistStore.GetAllSourceTables.
+func (s *etcdOptimistStore) GetAllSourceTables() (map[string]map[string]optimism.SourceTables, int64, error) {
+	return optimism.GetAllSourceTables(s.cli)
+}
+
+// GetAllInfo implements OptimistStore.GetAllInfo.
+func (s *etcdOptimistStore) GetAllInfo() (map[string]map[string]map[string]map[string]optimism.Info, int64, error) {
+	return optimism.GetAllInfo(s.cli)
+}
+
+// GetAllOperations implements OptimistStore.GetAllOperations.
+func (s *etcdOptimistStore) GetAllOperations() (map[string]map[string]map[string]map[string]optimism.Operation, int64, error) {
+	return optimism.GetAllOperations(s.cli)
+}
+
+// GetAllDroppedColumns implements OptimistStore.GetAllDroppedColumns.
+func (s *etcdOptimistStore) GetAllDroppedColumns() (map[string]map[string]map[string]map[string]map[string]optimism.DropColumnStage, int64, error) {
+	return optimism.GetAllDroppedColumns(s.cli)
+}
+
+// GetInfosOperationsByTask implements OptimistStore.GetInfosOperationsByTask.
+func (s *etcdOptimistStore) GetInfosOperationsByTask(task string) ([]optimism.Info, []optimism.Operation, int64, error) {
+	return optimism.GetInfosOperationsByTask(s.cli, task)
+}
+
+// GetAllLockNotes implements OptimistStore.GetAllLockNotes.
+func (s *etcdOptimistStore) GetAllLockNotes() (map[string]string, int64, error) {
+	return optimism.GetAllLockNotes(s.cli)
+}
+
+// GetAllLockSeeds implements OptimistStore.GetAllLockSeeds.
+func (s *etcdOptimistStore) GetAllLockSeeds() (map[string]optimism.LockSeed, int64, error) {
+	return optimism.GetAllLockSeeds(s.cli)
+}
+
+// WatchSourceTables implements OptimistStore.WatchSourceTables.
+func (s *etcdOptimistStore) WatchSourceTables(ctx context.Context, revision int64, outCh chan<- optimism.SourceTables, errCh chan<- error) {
+	optimism.WatchSourceTables(ctx, s.cli, revision, outCh, errCh)
+}
+
+// WatchInfo implements OptimistStore.WatchInfo.
+func (s *etcdOptimistStore) WatchInfo(ctx context.Context, revision int64, outCh chan<- optimism.Info, errCh chan<- error) {
+	optimism.WatchInfo(ctx, s.cli, revision, outCh, errCh)
+}
+
+// WatchOperationPut implements OptimistStore.WatchOperationPut.
+func (s *etcdOptimistStore) WatchOperationPut(ctx context.Context, revision int64, outCh chan<- optimism.Operation, errCh chan<- error) {
+	optimism.WatchOperationPut(ctx, s.cli, "", "", "", "", revision, outCh, errCh)
+}
+
+// AcquireLeaderEpoch implements OptimistStore.AcquireLeaderEpoch.
+func (s *etcdOptimistStore) AcquireLeaderEpoch() (int64, error) {
+	epoch, err := optimism.AcquireLeaderEpoch(s.cli)
+	if err != nil {
+		return 0, err
+	}
+	s.epoch = epoch
+	return epoch, nil
+}
+
+// PutOperation implements OptimistStore.PutOperation.
+func (s *etcdOptimistStore) PutOperation(skipDone bool, op optimism.Operation, infoModRev int64) (int64, bool, error) {
+	if s.epoch == 0 {
+		return optimism.PutOperation(s.cli, skipDone, op, infoModRev)
+	}
+	return optimism.PutOperationWithEpoch(s.cli, s.epoch, skipDone, op, infoModRev)
+}
+
+// PutLockNote implements OptimistStore.PutLockNote.
+func (s *etcdOptimistStore) PutLockNote(lockID, note string) (int64, error) {
+	return optimism.PutLockNote(s.cli, lockID, note)
+}
+
+// PutLockSeed implements OptimistStore.PutLockSeed.
+func (s *etcdOptimistStore) PutLockSeed(lockID, createSQL string) (int64, error) {
+	return optimism.PutLockSeed(s.cli, lockID, createSQL)
+}
+
+// DeleteInfosOperationsColumns implements OptimistStore.DeleteInfosOperationsColumns.
+func (s *etcdOptimistStore) DeleteInfosOperationsColumns(infos []optimism.Info, ops []optimism.Operation, lockID string) (int64, bool, error) {
+	return optimism.DeleteInfosOperationsColumns(s.cli, infos, ops, lockID)
+}
+
+// DeleteInfosOperationsTablesByTask implements OptimistStore.DeleteInfosOperationsTablesByTask.
+func (s *etcdOptimistStore) DeleteInfosOperationsTablesByTask(task string, lockIDSet map[string]struct{}) (int64, error) {
+	return optimism.DeleteInfosOperationsTablesByTask(s.cli, task, lockIDSet)
+}
+
+// DeleteInfosOperationsTablesByTaskAndSource implements OptimistStore.DeleteInfosOperationsTablesByTaskAndSource.
+func (s *etcdOptimistStore) DeleteInfosOperationsTablesByTaskAndSource(task string, sources []string, dropColumns map[string][]string) (int64, error) {
+	return optimism.DeleteInfosOperationsTablesByTaskAndSource(s.cli, task, sources, dropColumns)
+}
+
+// used to label the latency of the operations of OptimistStore.
+const (
+	storeOpGetAllSourceTables                         = "get-all-source-tables"
+	storeOpGetAllInfo                                 = "get-all-info"
+	storeOpGetAllOperations                           = "get-all-operations"
+	storeOpGetAllDroppedColumns                       = "get-all-dropped-columns"
+	storeOpGetInfosOperationsByTask                   = "get-infos-operations-by-task"
+	storeOpGetAllLockNotes                            = "get-all-lock-notes"
+	storeOpGetAllLockSeeds                            = "get-all-lock-seeds"
+	storeOpWatchSourceTables                          = "watch-source-tables"
+	storeOpWatchInfo                                  = "watch-info"
+	storeOpWatchOperationPut                          = "watch-operation-put"
+	storeOpAcquireLeaderEpoch                         = "acquire-leader-epoch"
+	storeOpPutOperation                               = "put-operation"
+	storeOpPutLockNote                                = "put-lock-note"
+	storeOpPutLockSeed                                = "put-lock-seed"
+	storeOpDeleteInfosOperationsColumns               = "delete-infos-operations-columns"
+	storeOpDeleteInfosOperationsTablesByTask          = "delete-infos-operations-tables-by-task"
+	storeOpDeleteInfosOperationsTablesByTaskAndSource = "delete-infos-operations-tables-by-task-and-source"
+)
+
+// instrumentedOptimistStore observes the latency of each operation of the underlying OptimistStore.
+// for watches, it's the time each watched event waits until it's received by the optimist.
+type instrumentedOptimistStore struct {
+	OptimistStore
+}
+
+// newInstrumentedOptimistStore creates a new instrumentedOptimistStore instance.
+func newInstrumentedOptimistStore(store OptimistStore) OptimistStore {
+	return &instrumentedOptimistStore{OptimistStore: store}
+}
+
+// observe observes the latency since the start time for the operation type.
+func observe(opType string, start time.Time) {
+	metrics.ObserveShardDDLEtcdDuration(opType, time.Since(start))
+}
+
+// GetAllSourceTables implements OptimistStore.GetAllSourceTables.
+func (s *instrumentedOptimistStore) GetAllSourceTables() (map[string]map[string]optimism.SourceTables, int64, error) {
+	defer observe(storeOpGetAllSourceTables, time.Now())
+	return s.OptimistStore.GetAllSourceTables()
+}
+
+// GetAllInfo implements OptimistStore.GetAllInfo.
+func (s *instrumentedOptimistStore) GetAllInfo() (map[string]map[string]map[string]map[string]optimism.Info, int64, error) {
+	defer observe(storeOpGetAllInfo, time.Now())
+	return s.OptimistStore.GetAllInfo()
+}
+
+// GetAllOperations implements OptimistStore.GetAllOperations.
+func (s *instrumentedOptimistStore) GetAllOperations() (map[string]map[string]map[string]map[string]optimism.Operation, int64, error) {
+	defer observe(storeOpGetAllOperations, time.Now())
+	return s.OptimistStore.GetAllOperations()
+}
+
+// GetAllDroppedColumns implements OptimistStore.GetAllDroppedColumns.
+func (s *instrumentedOptimistStore) GetAllDroppedColumns() (map[string]map[string]map[string]map[string]map[string]optimism.DropColumnStage, int64, error) {
+	defer observe(storeOpGetAllDroppedColumns, time.Now())
+	return s.OptimistStore.GetAllDroppedColumns()
+}
+
+// GetInfosOperationsByTask implements OptimistStore.GetInfosOperationsByTask.
+func (s *instrumentedOptimistStore) GetInfosOperationsByTask(task string) ([]optimism.Info, []optimism.Operation, int64, error) {
+	defer observe(storeOpGetInfosOperationsByTask, time.Now())
+	return s.OptimistStore.GetInfosOperationsByTask(task)
+}
+
+// GetAllLockNotes implements OptimistStore.GetAllLockNotes.
+func (s *instrumentedOptimistStore) GetAllLockNotes() (map[string]string, int64, error) {
+	defer observe(storeOpGetAllLockNotes, time.Now())
+	return s.OptimistStore.GetAllLockNotes()
+}
+
+// GetAllLockSeeds implements OptimistStore.GetAllLockSeeds.
+func (s *instrumentedOptimistStore) GetAllLockSeeds() (map[string]optimism.LockSeed, int64, error) {
+	defer observe(storeOpGetAllLockSeeds, time.Now())
+	return s.OptimistStore.GetAllLockSeeds()
+}
+
+// WatchSourceTables implements OptimistStore.WatchSourceTables.
+func (s *instrumentedOptimistStore) WatchSourceTables(ctx context.Context, revision int64, outCh chan<- optimism.SourceTables, errCh chan<- error) {
+	ch := make(chan optimism.SourceTables)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for st := range ch {
+			start := time.Now()
+			select {
+			case outCh <- st:
+				observe(storeOpWatchSourceTables, start)
+			case <-ctx.Done():
+			}
+		}
+	}()
+	s.OptimistStore.WatchSourceTables(ctx, revision, ch, errCh)
+	close(ch)
+	<-done
+}
+
+// WatchInfo implements OptimistStore.WatchInfo.
+func (s *instrumentedOptimistStore) WatchInfo(ctx context.Context, revision int64, outCh chan<- optimism.Info, errCh chan<- error) {
+	ch := make(chan optimism.Info)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for info := range ch {
+			start := time.Now()
+			select {
+			case outCh <- info:
+				observe(storeOpWatchInfo, start)
+			case <-ctx.Done():
+			}
+		}
+	}()
+	s.OptimistStore.WatchInfo(ctx, revision, ch, errCh)
+	close(ch)
+	<-done
+}
+
+// WatchOperationPut implements OptimistStore.WatchOperationPut.
+func (s *instrumentedOptimistStore) WatchOperationPut(ctx context.Context, revision int64, outCh chan<- optimism.Operation, errCh chan<- error) {
+	ch := make(chan optimism.Operation)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for op := range ch {
+			start := time.Now()
+			select {
+			case outCh <- op:
+				observe(storeOpWatchOperationPut, start)
+			case <-ctx.Done():
+			}
+		}
+	}()
+	s.OptimistStore.WatchOperationPut(ctx, revision, ch, errCh)
+	close(ch)
+	<-done
+}
+
+// AcquireLeaderEpoch implements OptimistStore.AcquireLeaderEpoch.
+func (s *instrumentedOptimistStore) AcquireLeaderEpoch() (int64, error) {
+	defer observe(storeOpAcquireLeaderEpoch, time.Now())
+	return s.OptimistStore.AcquireLeaderEpoch()
+}
+
+// PutOperation implements OptimistStore.PutOperation.
+func (s *instrumentedOptimistStore) PutOperation(skipDone bool, op optimism.Operation, infoModRev int64) (int64, bool, error) {
+	defer observe(storeOpPutOperation, time.Now())
+	return s.OptimistStore.PutOperation(skipDone, op, infoModRev)
+}
+
+// PutLockNote implements OptimistStore.PutLockNote.
+func (s *instrumentedOptimistStore) PutLockNote(lockID, note string) (int64, error) {
+	defer observe(storeOpPutLockNote, time.Now())
+	return s.OptimistStore.PutLockNote(lockID, note)
+}
+
+// PutLockSeed implements OptimistStore.PutLockSeed.
+func (s *instrumentedOptimistStore) PutLockSeed(lockID, createSQL string) (int64, error) {
+	defer observe(storeOpPutLockSeed, time.Now())
+	return s.OptimistStore.PutLockSeed(lockID, createSQL)
+}
+
+// DeleteInfosOperationsColumns implements OptimistStore.DeleteInfosOperationsColumns.
+func (s *instrumentedOptimistStore) DeleteInfosOperationsColumns(infos []optimism.Info, ops []optimism.Operation, lockID string) (int64, bool, error) {
+	defer observe(storeOpDeleteInfosOperationsColumns, time.Now())
+	return s.OptimistStore.DeleteInfosOperationsColumns(infos, ops, lockID)
+}
+
+// DeleteInfosOperationsTablesByTask implements OptimistStore.DeleteInfosOperationsTablesByTask.
+func (s *instrumentedOptimistStore) DeleteInfosOperationsTablesByTask(task string, lockIDSet map[string]struct{}) (int64, error) {
+	defer observe(storeOpDeleteInfosOperationsTablesByTask, time.Now())
+	return s.OptimistStore.DeleteInfosOperationsTablesByTask(task, lockIDSet)
+}
+
+// DeleteInfosOperationsTablesByTaskAndSource implements OptimistStore.DeleteInfosOperationsTablesByTaskAndSource.
+func (s *instrumentedOptimistStore) DeleteInfosOperationsTablesByTaskAndSource(task string, sources []string, dropColumns map[string][]string) (int64, error) {
+	defer observe(storeOpDeleteInfosOperationsTablesByTaskAndSource, time.Now())
+	return s.OptimistStore.DeleteInfosOperationsTablesByTaskAndSource(task, sources, dropColumns)
+}
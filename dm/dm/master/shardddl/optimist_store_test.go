@@ -0,0 +1,518 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shardddl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/parser"
+	"github.com/pingcap/tidb/parser/model"
+	"github.com/pingcap/tidb/util/mock"
+
+	"github.com/pingcap/tiflow/dm/pkg/log"
+	"github.com/pingcap/tiflow/dm/pkg/shardddl/optimism"
+	"github.com/pingcap/tiflow/dm/pkg/utils"
+)
+
+// memOptimistStore is an in-memory OptimistStore used for testing.
+type memOptimistStore struct {
+	mu       sync.Mutex
+	rev      int64
+	sts      map[string]map[string]optimism.SourceTables // task-name -> source-ID -> source tables.
+	infos    map[string]optimism.Info                    // info key -> info.
+	versions map[string]int64                            // info key -> version.
+	ops      map[string]optimism.Operation               // operation key -> operation.
+	opRevs   map[string]int64                            // operation key -> mod revision.
+	notes    map[string]string                           // lock ID -> note.
+	seeds    map[string]optimism.LockSeed                // lock ID -> seed.
+	epoch    int64
+	events   []memStoreEvent
+	notify   chan struct{} // closed and renewed when new events appended.
+}
+
+// memStoreEvent is a change in memOptimistStore,
+// value is one of `optimism.SourceTables`, `optimism.Info` and `optimism.Operation`.
+type memStoreEvent struct {
+	rev   int64
+	value interface{}
+}
+
+func newMemOptimistStore() *memOptimistStore {
+	return &memOptimistStore{
+		sts:      make(map[string]map[string]optimism.SourceTables),
+		infos:    make(map[string]optimism.Info),
+		versions: make(map[string]int64),
+		ops:      make(map[string]optimism.Operation),
+		opRevs:   make(map[string]int64),
+		notes:    make(map[string]string),
+		seeds:    make(map[string]optimism.LockSeed),
+		notify:   make(chan struct{}),
+	}
+}
+
+// newMemOptimist creates an Optimist and an empty in-memory store for it, the
+// Optimist isn't started so the test can configure it first.
+func newMemOptimist() (*Optimist, *memOptimistStore) {
+	logger := log.L()
+	return NewOptimist(&logger, getDownstreamMeta), newMemOptimistStore()
+}
+
+// startMemOptimist puts the source tables into the store and starts the Optimist on it.
+func startMemOptimist(c *C, ctx context.Context, o *Optimist, store *memOptimistStore, sts ...optimism.SourceTables) {
+	for _, st := range sts {
+		store.putSourceTables(st)
+	}
+	c.Assert(o.StartWithStore(ctx, store), IsNil)
+}
+
+// restartMemOptimist closes the Optimist and starts a new one on the same store,
+// as the DM-master does after a restart.
+func restartMemOptimist(c *C, ctx context.Context, o *Optimist, store OptimistStore) *Optimist {
+	o.Close()
+	logger := log.L()
+	o = NewOptimist(&logger, getDownstreamMeta)
+	c.Assert(o.StartWithStore(ctx, store), IsNil)
+	return o
+}
+
+func memStoreKey(task, source, upSchema, upTable string) string {
+	return strings.Join([]string{task, source, upSchema, upTable}, "/")
+}
+
+// appendEvents appends events with a new revision, the caller should hold the lock.
+func (s *memOptimistStore) appendEvents(values ...interface{}) int64 {
+	s.rev++
+	for _, v := range values {
+		// the revisions are reported as the etcd watchers do.
+		switch e := v.(type) {
+		case optimism.Info:
+			e.Revision = s.rev
+			v = e
+		case optimism.SourceTables:
+			e.Revision = s.rev
+			v = e
+		}
+		s.events = append(s.events, memStoreEvent{rev: s.rev, value: v})
+	}
+	close(s.notify)
+	s.notify = make(chan struct{})
+	return s.rev
+}
+
+func (s *memOptimistStore) putSourceTables(st optimism.SourceTables) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sts[st.Task]; !ok {
+		s.sts[st.Task] = make(map[string]optimism.SourceTables)
+	}
+	s.sts[st.Task][st.Source] = st
+	return s.appendEvents(st)
+}
+
+func (s *memOptimistStore) putInfo(info optimism.Info) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memStoreKey(info.Task, info.Source, info.UpSchema, info.UpTable)
+	s.versions[key]++
+	info.Version = s.versions[key]
+	info.Revision = s.rev + 1
+	s.infos[key] = info
+	return s.appendEvents(info)
+}
+
+func (s *memOptimistStore) getOperation(task, source, upSchema, upTable string) (optimism.Operation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.ops[memStoreKey(task, source, upSchema, upTable)]
+	return op, ok
+}
+
+// deleteInfo deletes the info and returns its deletion event, the caller should hold the lock.
+func (s *memOptimistStore) deleteInfo(key string) []interface{} {
+	info, ok := s.infos[key]
+	if !ok {
+		return nil
+	}
+	delete(s.infos, key)
+	delete(s.versions, key)
+	info.IsDeleted = true
+	return []interface{}{info}
+}
+
+func (s *memOptimistStore) GetAllSourceTables() (map[string]map[string]optimism.SourceTables, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stm := make(map[string]map[string]optimism.SourceTables, len(s.sts))
+	for task, sts := range s.sts {
+		stm[task] = make(map[string]optimism.SourceTables, len(sts))
+		for source, st := range sts {
+			stm[task][source] = st
+		}
+	}
+	return stm, s.rev, nil
+}
+
+func (s *memOptimistStore) GetAllInfo() (map[string]map[string]map[string]map[string]optimism.Info, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ifm := make(map[string]map[string]map[string]map[string]optimism.Info)
+	for _, info := range s.infos {
+		if _, ok := ifm[info.Task]; !ok {
+			ifm[info.Task] = make(map[string]map[string]map[string]optimism.Info)
+		}
+		if _, ok := ifm[info.Task][info.Source]; !ok {
+			ifm[info.Task][info.Source] = make(map[string]map[string]optimism.Info)
+		}
+		if _, ok := ifm[info.Task][info.Source][info.UpSchema]; !ok {
+			ifm[info.Task][info.Source][info.UpSchema] = make(map[string]optimism.Info)
+		}
+		ifm[info.Task][info.Source][info.UpSchema][info.UpTable] = info
+	}
+	return ifm, s.rev, nil
+}
+
+func (s *memOptimistStore) GetAllOperations() (map[string]map[string]map[string]map[string]optimism.Operation, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	opm := make(map[string]map[string]map[string]map[string]optimism.Operation)
+	for _, op := range s.ops {
+		if _, ok := opm[op.Task]; !ok {
+			opm[op.Task] = make(map[string]map[string]map[string]optimism.Operation)
+		}
+		if _, ok := opm[op.Task][op.Source]; !ok {
+			opm[op.Task][op.Source] = make(map[string]map[string]optimism.Operation)
+		}
+		if _, ok := opm[op.Task][op.Source][op.UpSchema]; !ok {
+			opm[op.Task][op.Source][op.UpSchema] = make(map[string]optimism.Operation)
+		}
+		opm[op.Task][op.Source][op.UpSchema][op.UpTable] = op
+	}
+	return opm, s.rev, nil
+}
+
+func (s *memOptimistStore) GetAllDroppedColumns() (map[string]map[string]map[string]map[string]map[string]optimism.DropColumnStage, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return make(map[string]map[string]map[string]map[string]map[string]optimism.DropColumnStage), s.rev, nil
+}
+
+func (s *memOptimistStore) GetInfosOperationsByTask(task string) ([]optimism.Info, []optimism.Operation, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := make([]optimism.Info, 0)
+	for _, info := range s.infos {
+		if info.Task == task {
+			infos = append(infos, info)
+		}
+	}
+	ops := make([]optimism.Operation, 0)
+	for _, op := range s.ops {
+		if op.Task == task {
+			ops = append(ops, op)
+		}
+	}
+	return infos, ops, s.rev, nil
+}
+
+func (s *memOptimistStore) GetAllLockNotes() (map[string]string, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	notes := make(map[string]string, len(s.notes))
+	for lockID, note := range s.notes {
+		notes[lockID] = note
+	}
+	return notes, s.rev, nil
+}
+
+func (s *memOptimistStore) GetAllLockSeeds() (map[string]optimism.LockSeed, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seeds := make(map[string]optimism.LockSeed, len(s.seeds))
+	for lockID, seed := range s.seeds {
+		seeds[lockID] = seed
+	}
+	return seeds, s.rev, nil
+}
+
+// watch sends events since the revision until `send` returns false or the context is done.
+func (s *memOptimistStore) watch(ctx context.Context, revision int64, send func(interface{}) bool) {
+	next := 0
+	for {
+		s.mu.Lock()
+		events := append([]memStoreEvent{}, s.events[next:]...)
+		next = len(s.events)
+		notify := s.notify
+		s.mu.Unlock()
+
+		for _, ev := range events {
+			if ev.rev >= revision && !send(ev.value) {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-notify:
+		}
+	}
+}
+
+func (s *memOptimistStore) WatchSourceTables(ctx context.Context, revision int64, outCh chan<- optimism.SourceTables, errCh chan<- error) {
+	s.watch(ctx, revision, func(v interface{}) bool {
+		if st, ok := v.(optimism.SourceTables); ok {
+			select {
+			case outCh <- st:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (s *memOptimistStore) WatchInfo(ctx context.Context, revision int64, outCh chan<- optimism.Info, errCh chan<- error) {
+	s.watch(ctx, revision, func(v interface{}) bool {
+		if info, ok := v.(optimism.Info); ok {
+			select {
+			case outCh <- info:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (s *memOptimistStore) WatchOperationPut(ctx context.Context, revision int64, outCh chan<- optimism.Operation, errCh chan<- error) {
+	s.watch(ctx, revision, func(v interface{}) bool {
+		if op, ok := v.(optimism.Operation); ok {
+			select {
+			case outCh <- op:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (s *memOptimistStore) AcquireLeaderEpoch() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.epoch++
+	return s.epoch, nil
+}
+
+func (s *memOptimistStore) PutOperation(skipDone bool, op optimism.Operation, infoModRev int64) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := memStoreKey(op.Task, op.Source, op.UpSchema, op.UpTable)
+	if old, ok := s.ops[key]; skipDone && ok && old.Done && s.opRevs[key] >= infoModRev {
+		return s.rev, false, nil
+	}
+	s.ops[key] = op
+	s.opRevs[key] = s.appendEvents(op)
+	return s.rev, true, nil
+}
+
+func (s *memOptimistStore) PutLockNote(lockID, note string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if note == "" {
+		delete(s.notes, lockID)
+	} else {
+		s.notes[lockID] = note
+	}
+	return s.appendEvents(), nil
+}
+
+func (s *memOptimistStore) PutLockSeed(lockID, createSQL string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rev := s.appendEvents()
+	s.seeds[lockID] = optimism.LockSeed{CreateSQL: createSQL, Revision: rev}
+	return rev, nil
+}
+
+func (s *memOptimistStore) DeleteInfosOperationsColumns(infos []optimism.Info, ops []optimism.Operation, lockID string) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, info := range infos {
+		if s.versions[memStoreKey(info.Task, info.Source, info.UpSchema, info.UpTable)] > info.Version {
+			return s.rev, false, nil // new info putted.
+		}
+	}
+	events := make([]interface{}, 0, len(infos))
+	for _, info := range infos {
+		events = append(events, s.deleteInfo(memStoreKey(info.Task, info.Source, info.UpSchema, info.UpTable))...)
+	}
+	for _, op := range ops {
+		key := memStoreKey(op.Task, op.Source, op.UpSchema, op.UpTable)
+		delete(s.ops, key)
+		delete(s.opRevs, key)
+	}
+	delete(s.notes, lockID)
+	delete(s.seeds, lockID)
+	return s.appendEvents(events...), true, nil
+}
+
+func (s *memOptimistStore) DeleteInfosOperationsTablesByTask(task string, lockIDSet map[string]struct{}) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for lockID := range lockIDSet {
+		delete(s.notes, lockID)
+		delete(s.seeds, lockID)
+	}
+	return s.deleteByTaskAndSources(task, nil), nil
+}
+
+func (s *memOptimistStore) DeleteInfosOperationsTablesByTaskAndSource(task string, sources []string, dropColumns map[string][]string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteByTaskAndSources(task, sources), nil
+}
+
+// deleteByTaskAndSources deletes all data of the task for sources, or all sources if `sources` is nil.
+// the caller should hold the lock.
+func (s *memOptimistStore) deleteByTaskAndSources(task string, sources []string) int64 {
+	matched := func(t, source string) bool {
+		if t != task {
+			return false
+		}
+		if sources == nil {
+			return true
+		}
+		for _, s := range sources {
+			if s == source {
+				return true
+			}
+		}
+		return false
+	}
+
+	events := make([]interface{}, 0)
+	for key, info := range s.infos {
+		if matched(info.Task, info.Source) {
+			events = append(events, s.deleteInfo(key)...)
+		}
+	}
+	for key, op := range s.ops {
+		if matched(op.Task, op.Source) {
+			delete(s.ops, key)
+			delete(s.opRevs, key)
+		}
+	}
+	for source, st := range s.sts[task] {
+		if matched(task, source) {
+			delete(s.sts[task], source)
+			st.IsDeleted = true
+			events = append(events, st)
+		}
+	}
+	return s.appendEvents(events...)
+}
+
+func (t *testOptimist) TestOptimistInMemoryStore(c *C) {
+	var (
+		backOff          = 30
+		waitTime         = 100 * time.Millisecond
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-in-memory-store"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i12              = optimism.NewInfo(task, source1, "foo", "bar-2", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store, st1)
+	defer o.Close()
+	c.Assert(o.Locks(), HasLen, 0)
+
+	// PUT i11, will create a lock but not synced.
+	rev := store.putInfo(i11)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	c.Assert(o.Locks(), HasKey, lockID)
+	synced, remain := o.Locks()[lockID].IsSynced()
+	c.Assert(synced, IsFalse)
+	c.Assert(remain, Equals, 1)
+	op11, ok := store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op11.DDLs, DeepEquals, DDLs1)
+	c.Assert(op11.Done, IsFalse)
+
+	// the operation is done by the DM-worker.
+	op11.Done = true
+	_, putted, err := store.PutOperation(false, op11, 0)
+	c.Assert(err, IsNil)
+	c.Assert(putted, IsTrue)
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		return o.Locks()[lockID].IsDone(i11.Source, i11.UpSchema, i11.UpTable)
+	}), IsTrue)
+
+	// PUT i12, the lock is synced.
+	rev = store.putInfo(i12)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	synced, remain = o.Locks()[lockID].IsSynced()
+	c.Assert(synced, IsTrue)
+	c.Assert(remain, Equals, 0)
+	op12, ok := store.getOperation(task, source1, "foo", "bar-2")
+	c.Assert(ok, IsTrue)
+	c.Assert(op12.DDLs, DeepEquals, DDLs1)
+
+	// the operation is done, the lock is resolved and removed with its infos and operations.
+	op12.Done = true
+	_, putted, err = store.PutOperation(false, op12, 0)
+	c.Assert(err, IsNil)
+	c.Assert(putted, IsTrue)
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		return len(o.Locks()) == 0
+	}), IsTrue)
+	ifm, _, err := store.GetAllInfo()
+	c.Assert(err, IsNil)
+	c.Assert(ifm, HasLen, 0)
+	opm, _, err := store.GetAllOperations()
+	c.Assert(err, IsNil)
+	c.Assert(opm, HasLen, 0)
+	c.Assert(o.ResolvedLocks(), HasLen, 1)
+
+	// restart the optimist, nothing to recover.
+	o.Close()
+	c.Assert(o.StartWithStore(ctx, store), IsNil)
+	c.Assert(o.Locks(), HasLen, 0)
+
+	// remove the meta data of the task.
+	c.Assert(o.RemoveMetaDataWithTask(task), IsNil)
+	stm, _, err := store.GetAllSourceTables()
+	c.Assert(err, IsNil)
+	c.Assert(stm[task], HasLen, 0)
+}
@@ -16,23 +16,31 @@ package shardddl
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	. "github.com/pingcap/check"
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"github.com/pingcap/tidb-tools/pkg/schemacmp"
 	tiddl "github.com/pingcap/tidb/ddl"
 	"github.com/pingcap/tidb/parser"
 	"github.com/pingcap/tidb/parser/ast"
 	"github.com/pingcap/tidb/parser/model"
+	"github.com/pingcap/tidb/parser/mysql"
 	"github.com/pingcap/tidb/sessionctx"
 	"github.com/pingcap/tidb/util/mock"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"go.etcd.io/etcd/clientv3"
 	"go.etcd.io/etcd/integration"
 
 	"github.com/pingcap/tiflow/dm/dm/config"
+	"github.com/pingcap/tiflow/dm/dm/master/metrics"
 	"github.com/pingcap/tiflow/dm/dm/pb"
 	"github.com/pingcap/tiflow/dm/pkg/log"
 	"github.com/pingcap/tiflow/dm/pkg/shardddl/optimism"
+	"github.com/pingcap/tiflow/dm/pkg/terror"
 	"github.com/pingcap/tiflow/dm/pkg/utils"
 )
 
@@ -1124,7 +1132,7 @@ func (t *testOptimist) TestBuildLockJoinedAndTable(c *C) {
 
 	stm, _, err := optimism.GetAllSourceTables(etcdTestCli)
 	c.Assert(err, IsNil)
-	o.tk.Init(stm)
+	c.Assert(o.tk.Init(stm), IsNil)
 }
 
 func (t *testOptimist) TestBuildLockWithInitSchema(c *C) {
@@ -1173,9 +1181,2296 @@ func (t *testOptimist) TestBuildLockWithInitSchema(c *C) {
 
 	stm, _, err := optimism.GetAllSourceTables(etcdTestCli)
 	c.Assert(err, IsNil)
-	o.tk.Init(stm)
+	c.Assert(o.tk.Init(stm), IsNil)
+}
+
+func (t *testOptimist) TestOptimistFreezeLock(c *C) {
+	defer clearOptimistTestSourceInfoOperation(c)
+
+	var (
+		backOff          = 30
+		waitTime         = 100 * time.Millisecond
+		logger           = log.L()
+		o                = NewOptimist(&logger, getDownstreamMeta)
+		task             = "task-test-optimist-freeze"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i12              = optimism.NewInfo(task, source1, "foo", "bar-2", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+	_, err := optimism.PutSourceTables(etcdTestCli, st1)
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c.Assert(o.FreezeLock(lockID), NotNil) // not started.
+	c.Assert(o.Start(ctx, etcdTestCli), IsNil)
+	defer o.Close()
+	c.Assert(terror.ErrMasterLockNotFound.Equal(o.FreezeLock(lockID)), IsTrue)
+
+	// PUT i11, will create a lock but not synced.
+	rev1, err := optimism.PutInfo(etcdTestCli, i11)
+	c.Assert(err, IsNil)
+	op11, err := watchExactOneOperation(ctx, etcdTestCli, i11.Task, i11.Source, i11.UpSchema, i11.UpTable, rev1)
+	c.Assert(err, IsNil)
+	c.Assert(op11.DDLs, DeepEquals, DDLs1)
+
+	// freeze the lock, then PUT i12, the lock will be synced but no operation emitted.
+	c.Assert(o.FreezeLock(lockID), IsNil)
+	rev2, err := optimism.PutInfo(etcdTestCli, i12)
+	c.Assert(err, IsNil)
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		synced, _ := o.Locks()[lockID].IsSynced()
+		return synced
+	}), IsTrue)
+	ctx2, cancel2 := context.WithTimeout(ctx, time.Second)
+	_, err = watchExactOneOperation(ctx2, etcdTestCli, i12.Task, i12.Source, i12.UpSchema, i12.UpTable, rev2)
+	cancel2()
+	c.Assert(err, Equals, context.DeadlineExceeded)
+
+	// unfreeze the lock, the held operation is emitted.
+	c.Assert(o.UnfreezeLock(lockID), IsNil)
+	op12, err := watchExactOneOperation(ctx, etcdTestCli, i12.Task, i12.Source, i12.UpSchema, i12.UpTable, rev2)
+	c.Assert(err, IsNil)
+	c.Assert(op12.DDLs, DeepEquals, DDLs1)
+	c.Assert(op12.ConflictStage, Equals, optimism.ConflictNone)
+	c.Assert(o.frozen, HasLen, 0)
+}
+
+func (t *testOptimist) TestOptimistShowLocksAdvisories(c *C) {
+	defer clearOptimistTestSourceInfoOperation(c)
+
+	var (
+		logger           = log.L()
+		o                = NewOptimist(&logger, getDownstreamMeta)
+		task             = "task-test-optimist-advisories"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		DDLs2            = []string{"ALTER TABLE bar ADD COLUMN c1 INT DEFAULT 1"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		ti2              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT DEFAULT 1)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i12              = optimism.NewInfo(task, source1, "foo", "bar-2", downSchema, downTable, DDLs2, ti0, []*model.TableInfo{ti2})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+	_, err := optimism.PutSourceTables(etcdTestCli, st1)
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Assert(o.Start(ctx, etcdTestCli), IsNil)
+	defer o.Close()
+
+	// PUT i11, no advisory for only one table has `c1`.
+	rev1, err := optimism.PutInfo(etcdTestCli, i11)
+	c.Assert(err, IsNil)
+	_, err = watchExactOneOperation(ctx, etcdTestCli, i11.Task, i11.Source, i11.UpSchema, i11.UpTable, rev1)
+	c.Assert(err, IsNil)
+	locks := o.ShowLocks("", nil)
+	c.Assert(locks, HasLen, 1)
+	c.Assert(locks[0].ID, Equals, lockID)
+	c.Assert(locks[0].Advisories, HasLen, 0)
+
+	// PUT i12, `c1` only differs in the default value, it's not a conflict but an advisory.
+	rev2, err := optimism.PutInfo(etcdTestCli, i12)
+	c.Assert(err, IsNil)
+	op12, err := watchExactOneOperation(ctx, etcdTestCli, i12.Task, i12.Source, i12.UpSchema, i12.UpTable, rev2)
+	c.Assert(err, IsNil)
+	c.Assert(op12.ConflictStage, Equals, optimism.ConflictNone)
+	locks = o.ShowLocks("", nil)
+	c.Assert(locks, HasLen, 1)
+	c.Assert(locks[0].Advisories, DeepEquals, []string{
+		fmt.Sprintf("column `c1` has different default values in source tables: DEFAULT 1 in %s-%s; no DEFAULT in %s-%s",
+			source1, dbutil.TableName(i12.UpSchema, i12.UpTable), source1, dbutil.TableName(i11.UpSchema, i11.UpTable)),
+	})
+}
+
+func (t *testOptimist) TestOptimistReemitOperation(c *C) {
+	defer clearOptimistTestSourceInfoOperation(c)
+
+	var (
+		backOff          = 30
+		waitTime         = 100 * time.Millisecond
+		logger           = log.L()
+		o                = NewOptimist(&logger, getDownstreamMeta)
+		task             = "task-test-optimist-reemit"
+		source1          = "mysql-replica-1"
+		source2          = "mysql-replica-2"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		st2              = optimism.NewSourceTables(task, source2)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st2.AddTable("foo", "bar-1", downSchema, downTable)
+	_, err := optimism.PutSourceTables(etcdTestCli, st1)
+	c.Assert(err, IsNil)
+	_, err = optimism.PutSourceTables(etcdTestCli, st2)
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c.Assert(o.ReemitOperation(lockID, source1), NotNil) // not started.
+	c.Assert(o.Start(ctx, etcdTestCli), IsNil)
+	defer o.Close()
+	c.Assert(terror.ErrMasterLockNotFound.Equal(o.ReemitOperation(lockID, source1)), IsTrue)
+
+	// PUT i11, will create a lock but not synced.
+	rev1, err := optimism.PutInfo(etcdTestCli, i11)
+	c.Assert(err, IsNil)
+	op11, err := watchExactOneOperation(ctx, etcdTestCli, i11.Task, i11.Source, i11.UpSchema, i11.UpTable, rev1)
+	c.Assert(err, IsNil)
+	c.Assert(op11.DDLs, DeepEquals, DDLs1)
+
+	// the operation is consumed and done by the DM-worker.
+	op11.Done = true
+	_, putted, err := optimism.PutOperation(etcdTestCli, false, op11, 0)
+	c.Assert(err, IsNil)
+	c.Assert(putted, IsTrue)
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		return o.Locks()[lockID].IsDone(i11.Source, i11.UpSchema, i11.UpTable)
+	}), IsTrue)
+
+	// no operation for source2.
+	c.Assert(terror.ErrMasterOptimisticOperationNotFound.Equal(o.ReemitOperation(lockID, source2)), IsTrue)
+
+	// re-emit the operation for source1, it's available again.
+	resp, err := etcdTestCli.Get(ctx, "not-exist-key")
+	c.Assert(err, IsNil)
+	c.Assert(o.ReemitOperation(lockID, source1), IsNil)
+	op11r, err := watchExactOneOperation(ctx, etcdTestCli, i11.Task, i11.Source, i11.UpSchema, i11.UpTable, resp.Header.Revision+1)
+	c.Assert(err, IsNil)
+	c.Assert(op11r.DDLs, DeepEquals, DDLs1)
+	c.Assert(op11r.Done, IsFalse)
+}
+
+func (t *testOptimist) TestOptimistPendingDDLs(c *C) {
+	defer clearOptimistTestSourceInfoOperation(c)
+
+	var (
+		backOff          = 30
+		waitTime         = 100 * time.Millisecond
+		logger           = log.L()
+		o                = NewOptimist(&logger, getDownstreamMeta)
+		task             = "task-test-optimist-pending-ddls"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		lockID1          = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, "bar")
+		lockID2          = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, "baz")
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		DDLs2            = []string{"ALTER TABLE baz ADD COLUMN c2 INT", "ALTER TABLE baz ADD COLUMN c3 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		ti2              = createTableInfo(c, p, se, tblID, `CREATE TABLE baz (id INT PRIMARY KEY, c2 INT)`)
+		ti3              = createTableInfo(c, p, se, tblID, `CREATE TABLE baz (id INT PRIMARY KEY, c2 INT, c3 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, "bar", DDLs1, ti0, []*model.TableInfo{ti1})
+		i21              = optimism.NewInfo(task, source1, "foo", "baz-1", downSchema, "baz", DDLs2, ti0, []*model.TableInfo{ti2, ti3})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, "bar")
+	st1.AddTable("foo", "bar-2", downSchema, "bar")
+	st1.AddTable("foo", "baz-1", downSchema, "baz")
+	st1.AddTable("foo", "baz-2", downSchema, "baz")
+	_, err := optimism.PutSourceTables(etcdTestCli, st1)
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Assert(o.Start(ctx, etcdTestCli), IsNil)
+	defer o.Close()
+	c.Assert(o.PendingDDLs(task), HasLen, 0)
+
+	// PUT i11 and i21, will create two locks with different pending DDLs.
+	rev1, err := optimism.PutInfo(etcdTestCli, i11)
+	c.Assert(err, IsNil)
+	op11, err := watchExactOneOperation(ctx, etcdTestCli, i11.Task, i11.Source, i11.UpSchema, i11.UpTable, rev1)
+	c.Assert(err, IsNil)
+	c.Assert(op11.DDLs, DeepEquals, DDLs1)
+	rev2, err := optimism.PutInfo(etcdTestCli, i21)
+	c.Assert(err, IsNil)
+	op21, err := watchExactOneOperation(ctx, etcdTestCli, i21.Task, i21.Source, i21.UpSchema, i21.UpTable, rev2)
+	c.Assert(err, IsNil)
+	c.Assert(op21.DDLs, DeepEquals, DDLs2)
+
+	c.Assert(o.PendingDDLs(task), DeepEquals, map[string][]string{
+		lockID1: DDLs1,
+		lockID2: DDLs2,
+	})
+	c.Assert(o.PendingDDLs("not-exist-task"), HasLen, 0)
+
+	// the operation of i11 is done, no DDLs pending for the lock now.
+	op11.Done = true
+	_, putted, err := optimism.PutOperation(etcdTestCli, false, op11, 0)
+	c.Assert(err, IsNil)
+	c.Assert(putted, IsTrue)
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		return o.Locks()[lockID1].IsDone(i11.Source, i11.UpSchema, i11.UpTable)
+	}), IsTrue)
+	c.Assert(o.PendingDDLs(task), DeepEquals, map[string][]string{
+		lockID2: DDLs2,
+	})
+}
+
+func (t *testOptimist) TestOptimistWaitForRevision(c *C) {
+	defer clearOptimistTestSourceInfoOperation(c)
+
+	var (
+		logger           = log.L()
+		o                = NewOptimist(&logger, getDownstreamMeta)
+		task             = "task-test-optimist-wait-for-revision"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+	_, err := optimism.PutSourceTables(etcdTestCli, st1)
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Assert(o.Start(ctx, etcdTestCli), IsNil)
+	defer o.Close()
+
+	// revisions before started have been processed.
+	resp, err := etcdTestCli.Get(ctx, "not-exist-key")
+	c.Assert(err, IsNil)
+	c.Assert(o.WaitForRevision(ctx, resp.Header.Revision), IsNil)
+
+	// PUT i11, the lock is created after waiting for the revision.
+	rev1, err := optimism.PutInfo(etcdTestCli, i11)
+	c.Assert(err, IsNil)
+	waitCtx, waitCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer waitCancel()
+	c.Assert(o.WaitForRevision(waitCtx, rev1), IsNil)
+	c.Assert(o.Locks(), HasKey, lockID)
+	c.Assert(o.Locks()[lockID].Ready()[source1]["foo"], DeepEquals, map[string]bool{"bar-1": true, "bar-2": false})
+
+	// wait for a revision not reached yet.
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer timeoutCancel()
+	c.Assert(o.WaitForRevision(timeoutCtx, rev1+100), Equals, context.DeadlineExceeded)
+}
+
+func (t *testOptimist) TestOptimistApproveOperation(c *C) {
+	defer clearOptimistTestSourceInfoOperation(c)
+
+	var (
+		logger           = log.L()
+		o                = NewOptimist(&logger, getDownstreamMeta)
+		task             = "task-test-optimist-approve"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		table            = fmt.Sprintf("%s-`%s`.`%s`", source1, "foo", "bar-1")
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c2 INT"}
+		DDLs2            = []string{"ALTER TABLE bar DROP COLUMN c1"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT, c2 INT)`)
+		ti2              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c2 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i12              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs2, ti1, []*model.TableInfo{ti2})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	_, err := optimism.PutSourceTables(etcdTestCli, st1)
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	o.SetRiskyDDLFunc(func(info optimism.Info) bool {
+		for _, ddl := range info.DDLs {
+			if strings.Contains(strings.ToUpper(ddl), "DROP") {
+				return true
+			}
+		}
+		return false
+	})
+	c.Assert(o.ApproveOperation(lockID, table), NotNil) // not started.
+	c.Assert(o.Start(ctx, etcdTestCli), IsNil)
+	defer o.Close()
+
+	// PUT i11, the operation is emitted directly.
+	rev1, err := optimism.PutInfo(etcdTestCli, i11)
+	c.Assert(err, IsNil)
+	op11, err := watchExactOneOperation(ctx, etcdTestCli, i11.Task, i11.Source, i11.UpSchema, i11.UpTable, rev1)
+	c.Assert(err, IsNil)
+	c.Assert(op11.DDLs, DeepEquals, DDLs1)
+	c.Assert(o.PendingApprovals(), HasLen, 0)
+
+	// PUT i12, the operation with DROP is held for the approval.
+	rev2, err := optimism.PutInfo(etcdTestCli, i12)
+	c.Assert(err, IsNil)
+	c.Assert(o.WaitForRevision(ctx, rev2), IsNil)
+	c.Assert(o.PendingApprovals(), DeepEquals, []PendingApproval{{LockID: lockID, Table: table, DDLs: DDLs2}})
+	ctx2, cancel2 := context.WithTimeout(ctx, time.Second)
+	_, err = watchExactOneOperation(ctx2, etcdTestCli, i12.Task, i12.Source, i12.UpSchema, i12.UpTable, rev2)
+	cancel2()
+	c.Assert(err, Equals, context.DeadlineExceeded)
+
+	// approve a table without pending operation.
+	c.Assert(terror.ErrMasterOptimisticApprovalNotFound.Equal(o.ApproveOperation(lockID, "not-exist")), IsTrue)
+
+	// approve it, the held operation is emitted.
+	c.Assert(o.ApproveOperation(lockID, table), IsNil)
+	op12, err := watchExactOneOperation(ctx, etcdTestCli, i12.Task, i12.Source, i12.UpSchema, i12.UpTable, rev2)
+	c.Assert(err, IsNil)
+	c.Assert(op12.DDLs, DeepEquals, DDLs2)
+	c.Assert(o.PendingApprovals(), HasLen, 0)
+}
+
+func (t *testOptimist) TestOptimistReport(c *C) {
+	defer clearOptimistTestSourceInfoOperation(c)
+
+	var (
+		logger           = log.L()
+		o                = NewOptimist(&logger, getDownstreamMeta)
+		task             = "task-test-optimist-report"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 TEXT"}
+		DDLs2            = []string{"ALTER TABLE bar ADD COLUMN c1 DATETIME"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 TEXT)`)
+		ti2              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 DATETIME)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i12              = optimism.NewInfo(task, source1, "foo", "bar-2", downSchema, downTable, DDLs2, ti0, []*model.TableInfo{ti2})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+	_, err := optimism.PutSourceTables(etcdTestCli, st1)
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Assert(o.Start(ctx, etcdTestCli), IsNil)
+	defer o.Close()
+	c.Assert(o.Report(), Equals, "0 shard DDL lock(s), 0 synced, 0 unsynced, 0 with conflicts\n")
+
+	// PUT i11, a lock is created but not synced.
+	rev1, err := optimism.PutInfo(etcdTestCli, i11)
+	c.Assert(err, IsNil)
+	c.Assert(o.WaitForRevision(ctx, rev1), IsNil)
+	report := o.Report()
+	c.Assert(strings.HasPrefix(report, "1 shard DDL lock(s), 0 synced, 1 unsynced, 0 with conflicts\n"), IsTrue, Commentf("%s", report))
+	c.Assert(strings.Contains(report, "oldest lock: "+lockID), IsTrue, Commentf("%s", report))
+	c.Assert(strings.Contains(report, "conflict:"), IsFalse, Commentf("%s", report))
+
+	// PUT i12, a conflict is detected.
+	rev2, err := optimism.PutInfo(etcdTestCli, i12)
+	c.Assert(err, IsNil)
+	c.Assert(o.WaitForRevision(ctx, rev2), IsNil)
+	report = o.Report()
+	c.Assert(strings.Contains(report, "1 with conflicts"), IsTrue, Commentf("%s", report))
+	c.Assert(strings.Contains(report, fmt.Sprintf("conflict: lock %s, table %s-`foo`.`bar-2`: ", lockID, source1)), IsTrue, Commentf("%s", report))
+}
+
+func (t *testOptimist) TestOptimistHandoff(c *C) {
+	defer clearOptimistTestSourceInfoOperation(c)
+
+	var (
+		logger           = log.L()
+		o1               = NewOptimist(&logger, getDownstreamMeta)
+		o2               = NewOptimist(&logger, getDownstreamMeta)
+		task             = "task-test-optimist-handoff"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+	_, err := optimism.PutSourceTables(etcdTestCli, st1)
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// o1 is the leader, it emits the operation.
+	c.Assert(o1.Start(ctx, etcdTestCli), IsNil)
+	defer o1.Close()
+	rev, err := optimism.PutInfo(etcdTestCli, i11)
+	c.Assert(err, IsNil)
+	c.Assert(o1.WaitForRevision(ctx, rev), IsNil)
+	c.Assert(o1.Locks(), HasKey, lockID)
+	_, ops, _, err := optimism.GetInfosOperationsByTask(etcdTestCli, task)
+	c.Assert(err, IsNil)
+	c.Assert(ops, HasLen, 1)
+	c.Assert(o1.ReemitOperation(lockID, source1), IsNil)
+
+	// o2 takes over the coordination while o1 is still running, e.g. o1 has not noticed the leader change.
+	c.Assert(o2.Start(ctx, etcdTestCli), IsNil)
+	defer o2.Close()
+	c.Assert(o2.Epoch(), Greater, o1.Epoch())
+	c.Assert(o2.Locks(), HasKey, lockID)
+
+	// the operation is done by the DM-worker.
+	op11 := ops[0]
+	op11.Done = true
+	_, _, err = optimism.PutOperation(etcdTestCli, false, op11, 0)
+	c.Assert(err, IsNil)
+
+	// only the current leader emits operations, the old one is fenced.
+	err = o1.ReemitOperation(lockID, source1)
+	c.Assert(terror.ErrMasterOptimisticLeaderFenced.Equal(err), IsTrue)
+	_, ops, _, err = optimism.GetInfosOperationsByTask(etcdTestCli, task)
+	c.Assert(err, IsNil)
+	c.Assert(ops, HasLen, 1)
+	c.Assert(ops[0].Done, IsTrue)
+
+	c.Assert(o2.ReemitOperation(lockID, source1), IsNil)
+	_, ops, _, err = optimism.GetInfosOperationsByTask(etcdTestCli, task)
+	c.Assert(err, IsNil)
+	c.Assert(ops, HasLen, 1)
+	c.Assert(ops[0].Done, IsFalse)
+	c.Assert(ops[0].DDLs, DeepEquals, DDLs1)
+}
+
+func (t *testOptimist) TestOptimistLockHeartbeat(c *C) {
+	defer clearOptimistTestSourceInfoOperation(c)
+
+	oldInterval, oldTTL := lockHeartbeatInterval, lockHeartbeatTTL
+	lockHeartbeatInterval, lockHeartbeatTTL = 200*time.Millisecond, 2
+	defer func() {
+		lockHeartbeatInterval, lockHeartbeatTTL = oldInterval, oldTTL
+	}()
+
+	var (
+		backOff          = 30
+		waitTime         = 100 * time.Millisecond
+		logger           = log.L()
+		o                = NewOptimist(&logger, getDownstreamMeta)
+		task             = "task-test-optimist-heartbeat"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+	_, err := optimism.PutSourceTables(etcdTestCli, st1)
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Assert(o.Start(ctx, etcdTestCli), IsNil)
+	defer o.Close()
+
+	// PUT i11, will create a lock but not synced.
+	rev1, err := optimism.PutInfo(etcdTestCli, i11)
+	c.Assert(err, IsNil)
+	_, err = watchExactOneOperation(ctx, etcdTestCli, i11.Task, i11.Source, i11.UpSchema, i11.UpTable, rev1)
+	c.Assert(err, IsNil)
+	lock := o.Locks()[lockID]
+	c.Assert(lock, NotNil)
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		return !lock.LastHeartbeat().IsZero()
+	}), IsTrue)
+	started, exist, err := optimism.GetLockHeartbeat(etcdTestCli, lockID)
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsTrue)
+
+	// the lease is kept alive past its TTL.
+	time.Sleep(time.Duration(3*lockHeartbeatTTL) * time.Second)
+	started2, exist, err := optimism.GetLockHeartbeat(etcdTestCli, lockID)
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsTrue)
+	c.Assert(started2.Equal(started), IsTrue)
+	c.Assert(time.Since(lock.LastHeartbeat()), Less, time.Second)
+
+	// the heartbeat is stopped after the lock removed.
+	o.mu.Lock()
+	deleted, err := o.removeLock(lock)
+	o.mu.Unlock()
+	c.Assert(err, IsNil)
+	c.Assert(deleted, IsTrue)
+	_, exist, err = optimism.GetLockHeartbeat(etcdTestCli, lockID)
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+}
+
+func (t *testOptimist) TestOptimistInfoEvents(c *C) {
+	defer clearOptimistTestSourceInfoOperation(c)
+
+	var (
+		logger           = log.L()
+		o                = NewOptimist(&logger, getDownstreamMeta)
+		task             = "task-test-optimist-info-events"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+	_, err := optimism.PutSourceTables(etcdTestCli, st1)
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Assert(o.Start(ctx, etcdTestCli), IsNil)
+	defer o.Close()
+
+	waitInfoEvent := func() InfoEvent {
+		select {
+		case ev := <-o.InfoEvents():
+			return ev
+		case <-time.After(3 * time.Second):
+			c.Fatal("no info event received")
+		}
+		return InfoEvent{}
+	}
+
+	// PUT i11, will create a lock.
+	_, err = optimism.PutInfo(etcdTestCli, i11)
+	c.Assert(err, IsNil)
+	ev := waitInfoEvent()
+	c.Assert(ev.LockID, Equals, lockID)
+	c.Assert(ev.Result, Equals, InfoResultCreated)
+	c.Assert(ev.Info.UpTable, Equals, i11.UpTable)
+
+	// PUT i11 again, it matches the current state of the lock.
+	_, err = optimism.PutInfo(etcdTestCli, i11)
+	c.Assert(err, IsNil)
+	ev = waitInfoEvent()
+	c.Assert(ev.LockID, Equals, lockID)
+	c.Assert(ev.Result, Equals, InfoResultNoop)
+}
+
+func (t *testOptimist) TestOptimistCompact(c *C) {
+	defer clearOptimistTestSourceInfoOperation(c)
+
+	var (
+		logger            = log.L()
+		o                 = NewOptimist(&logger, getDownstreamMeta)
+		task              = "task-test-optimist-compact"
+		source1           = "mysql-replica-1"
+		downSchema        = "foo"
+		p                 = parser.New()
+		se                = mock.NewContext()
+		tblID       int64 = 111
+		DDLs1             = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0               = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1               = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		resolutions       = 20
+		auditSize         = 5
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Assert(o.Start(ctx, etcdTestCli), IsNil)
+	defer o.Close()
+	o.SetResolvedLockAuditSize(auditSize)
+
+	// resolve many locks.
+	for i := 0; i < resolutions; i++ {
+		info := optimism.NewInfo(task, source1, "foo", "bar", downSchema, fmt.Sprintf("bar-%d", i), DDLs1, ti0, []*model.TableInfo{ti1})
+		lockID, _, _, err := o.lk.TrySync(etcdTestCli, info, nil)
+		c.Assert(err, IsNil)
+		lock := o.lk.FindLock(lockID)
+		c.Assert(lock, NotNil)
+		c.Assert(lock.TryMarkDone(info.Source, info.UpSchema, info.UpTable), IsTrue)
+		c.Assert(lock.IsResolved(), IsTrue)
+
+		o.mu.Lock()
+		deleted, err := o.removeLock(lock)
+		o.mu.Unlock()
+		c.Assert(err, IsNil)
+		c.Assert(deleted, IsTrue)
+	}
+	c.Assert(o.ResolvedLocks(), HasLen, resolutions)
+	c.Assert(o.resolvedTasks, HasKey, task)
+
+	// the audit is bounded after compacted, and only the newest records are kept.
+	o.Compact()
+	resolved := o.ResolvedLocks()
+	c.Assert(resolved, HasLen, auditSize)
+	for i, r := range resolved {
+		c.Assert(r.Task, Equals, task)
+		c.Assert(r.ID, Equals, fmt.Sprintf("%s-`%s`.`bar-%d`", task, downSchema, resolutions-auditSize+i))
+	}
+	// no lock and source table exist for the task, the metrics are pruned.
+	c.Assert(o.resolvedTasks, HasLen, 0)
+
+	// compact again is a no-op.
+	o.Compact()
+	c.Assert(o.ResolvedLocks(), DeepEquals, resolved)
 }
 
 func getDownstreamMeta(string) (*config.DBConfig, string) {
 	return nil, ""
 }
+
+// slowOptimistStore is a memOptimistStore whose PutOperation blocks until `unblock` is closed.
+type slowOptimistStore struct {
+	*memOptimistStore
+	unblock chan struct{}
+}
+
+func (s *slowOptimistStore) PutOperation(skipDone bool, op optimism.Operation, infoModRev int64) (int64, bool, error) {
+	<-s.unblock
+	return s.memOptimistStore.PutOperation(skipDone, op, infoModRev)
+}
+
+func (t *testOptimist) TestOptimistSaturated(c *C) {
+	defer func(size int) {
+		infoQueueSize = size
+	}(infoQueueSize)
+	infoQueueSize = 2
+
+	var (
+		backOff          = 30
+		waitTime         = 100 * time.Millisecond
+		logger           = log.L()
+		o                = NewOptimist(&logger, getDownstreamMeta)
+		store            = &slowOptimistStore{memOptimistStore: newMemOptimistStore(), unblock: make(chan struct{})}
+		task             = "task-test-optimist-saturated"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		tables           = []string{"bar-1", "bar-2", "bar-3", "bar-4", "bar-5"}
+	)
+
+	for _, table := range tables {
+		st1.AddTable("foo", table, downSchema, downTable)
+	}
+	store.putSourceTables(st1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Assert(o.Saturated(), IsFalse) // not started.
+	c.Assert(o.StartWithStore(ctx, store), IsNil)
+	defer o.Close()
+	c.Assert(o.Saturated(), IsFalse)
+
+	// the first info blocks in putting its operation, the others fill the queue.
+	var rev int64
+	for _, table := range tables {
+		rev = store.putInfo(optimism.NewInfo(task, source1, "foo", table, downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1}))
+	}
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		return o.Saturated()
+	}), IsTrue)
+
+	// the backend recovers, all infos are handled and the optimist is not saturated anymore.
+	close(store.unblock)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	c.Assert(o.Saturated(), IsFalse)
+	for _, table := range tables {
+		_, ok := store.getOperation(task, source1, "foo", table)
+		c.Assert(ok, IsTrue)
+	}
+}
+
+func (t *testOptimist) TestOptimistUnknownTablePolicy(c *C) {
+	var (
+		backOff          = 30
+		waitTime         = 100 * time.Millisecond
+		task             = "task-test-optimist-unknown-table-policy"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	run := func(policy UnknownTablePolicy, check func(o *Optimist, store *memOptimistStore)) {
+		o, store := newMemOptimist()
+		o.SetUnknownTablePolicy(policy)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		startMemOptimist(c, ctx, o, store)
+		defer o.Close()
+
+		// PUT i11 before its upstream table is registered in the source tables.
+		rev := store.putInfo(i11)
+		c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+		check(o, store)
+	}
+
+	// register: the upstream table is registered and the lock is created.
+	run(UnknownTableRegister, func(o *Optimist, store *memOptimistStore) {
+		c.Assert(o.Locks(), HasKey, lockID)
+		op11, ok := store.getOperation(task, source1, "foo", "bar-1")
+		c.Assert(ok, IsTrue)
+		c.Assert(op11.DDLs, DeepEquals, DDLs1)
+		c.Assert(op11.ConflictStage, Equals, optimism.ConflictNone)
+	})
+
+	// reject: no lock is created and a conflict operation is put for the info.
+	run(UnknownTableReject, func(o *Optimist, store *memOptimistStore) {
+		c.Assert(o.Locks(), HasLen, 0)
+		op11, ok := store.getOperation(task, source1, "foo", "bar-1")
+		c.Assert(ok, IsTrue)
+		c.Assert(op11.DDLs, HasLen, 0)
+		c.Assert(op11.ConflictStage, Equals, optimism.ConflictDetected)
+		c.Assert(op11.ConflictMsg, Matches, ".*is not in the source tables of task.*")
+	})
+
+	// queue: the info waits until its upstream table is registered in the source tables.
+	run(UnknownTableQueue, func(o *Optimist, store *memOptimistStore) {
+		c.Assert(o.Locks(), HasLen, 0)
+		_, ok := store.getOperation(task, source1, "foo", "bar-1")
+		c.Assert(ok, IsFalse)
+
+		st1 := optimism.NewSourceTables(task, source1)
+		st1.AddTable("foo", "bar-1", downSchema, downTable)
+		store.putSourceTables(st1)
+		c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+			_, ok = store.getOperation(task, source1, "foo", "bar-1")
+			return ok
+		}), IsTrue)
+		c.Assert(o.Locks(), HasKey, lockID)
+		op11, _ := store.getOperation(task, source1, "foo", "bar-1")
+		c.Assert(op11.DDLs, DeepEquals, DDLs1)
+		c.Assert(op11.ConflictStage, Equals, optimism.ConflictNone)
+	})
+}
+
+func (t *testOptimist) TestOptimistPreviewResolution(c *C) {
+	var (
+		backOff          = 30
+		waitTime         = 100 * time.Millisecond
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-preview-resolution"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i12              = optimism.NewInfo(task, source1, "foo", "bar-2", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+
+	// not started.
+	_, err := o.PreviewResolution(lockID)
+	c.Assert(terror.ErrMasterOptimistNotStarted.Equal(err), IsTrue)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store, st1)
+	defer o.Close()
+
+	_, err = o.PreviewResolution(lockID)
+	c.Assert(terror.ErrMasterLockNotFound.Equal(err), IsTrue)
+
+	// PUT i11 and i12, the lock is synced.
+	store.putInfo(i11)
+	rev := store.putInfo(i12)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	synced, _ := o.Locks()[lockID].IsSynced()
+	c.Assert(synced, IsTrue)
+
+	// the previewed operations match the emitted ones.
+	previewed, err := o.PreviewResolution(lockID)
+	c.Assert(err, IsNil)
+	c.Assert(previewed, HasLen, 2)
+	for i, table := range []string{"bar-1", "bar-2"} {
+		op, ok := store.getOperation(task, source1, "foo", table)
+		c.Assert(ok, IsTrue)
+		c.Assert(previewed[i].ID, Equals, op.ID)
+		c.Assert(previewed[i].Task, Equals, op.Task)
+		c.Assert(previewed[i].Source, Equals, op.Source)
+		c.Assert(previewed[i].UpSchema, Equals, op.UpSchema)
+		c.Assert(previewed[i].UpTable, Equals, op.UpTable)
+		c.Assert(previewed[i].DDLs, DeepEquals, op.DDLs)
+		c.Assert(previewed[i].ConflictStage, Equals, op.ConflictStage)
+		c.Assert(previewed[i].Done, Equals, op.Done)
+	}
+
+	// previewing emits nothing.
+	opm, _, err := store.GetAllOperations()
+	c.Assert(err, IsNil)
+	c.Assert(opm[task][source1]["foo"], HasLen, 2)
+
+	// the operation for bar-1 is done, only bar-2 is left.
+	op11, _ := store.getOperation(task, source1, "foo", "bar-1")
+	op11.Done = true
+	_, putted, err := store.PutOperation(false, op11, 0)
+	c.Assert(err, IsNil)
+	c.Assert(putted, IsTrue)
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		return o.Locks()[lockID].IsDone(i11.Source, i11.UpSchema, i11.UpTable)
+	}), IsTrue)
+	previewed, err = o.PreviewResolution(lockID)
+	c.Assert(err, IsNil)
+	c.Assert(previewed, HasLen, 1)
+	c.Assert(previewed[0].UpTable, Equals, "bar-2")
+}
+
+func (t *testOptimist) TestOptimistLocksByAge(c *C) {
+	var (
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-locks-by-age"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		// locks are created in the order different from the order of their IDs.
+		downTables = []string{"bar-b", "bar-c", "bar-a"}
+	)
+
+	for _, downTable := range downTables {
+		st1.AddTable("foo", downTable+"-1", downSchema, downTable)
+		st1.AddTable("foo", downTable+"-2", downSchema, downTable)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store, st1)
+	defer o.Close()
+	c.Assert(o.LocksByAge(), HasLen, 0)
+
+	for _, downTable := range downTables {
+		rev := store.putInfo(optimism.NewInfo(task, source1, "foo", downTable+"-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1}))
+		c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	locks := o.LocksByAge()
+	c.Assert(locks, HasLen, len(downTables))
+	for i, downTable := range downTables {
+		c.Assert(locks[i].ID, Equals, fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable))
+		if i > 0 {
+			c.Assert(locks[i].CreatedAt().After(locks[i-1].CreatedAt()), IsTrue)
+		}
+	}
+}
+
+func (t *testOptimist) TestOptimistConflictResolver(c *C) {
+	var (
+		o, store         = newMemOptimist()
+		task1            = "task-test-optimist-conflict-resolver-1"
+		task2            = "task-test-optimist-conflict-resolver-2"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		DDLs2            = []string{"ALTER TABLE bar ADD COLUMN c1 BIGINT"}
+		resolved         = []string{"ALTER TABLE bar MODIFY COLUMN c1 BIGINT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		ti2              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 BIGINT)`)
+	)
+
+	// widen INT to BIGINT only.
+	o.SetConflictResolver(func(a, b optimism.ColumnType) ([]string, bool) {
+		if a.Name == "c1" && a.Type.Tp == mysql.TypeLong && b.Type.Tp == mysql.TypeLonglong {
+			return resolved, true
+		}
+		return nil, false
+	})
+
+	for _, task := range []string{task1, task2} {
+		st := optimism.NewSourceTables(task, source1)
+		st.AddTable("foo", "bar-1", downSchema, downTable)
+		st.AddTable("foo", "bar-2", downSchema, downTable)
+		store.putSourceTables(st)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store)
+	defer o.Close()
+
+	// bar-1 adds c1 INT, bar-2 adds c1 BIGINT, the conflict is resolved by widening c1 to BIGINT.
+	store.putInfo(optimism.NewInfo(task1, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1}))
+	rev := store.putInfo(optimism.NewInfo(task1, source1, "foo", "bar-2", downSchema, downTable, DDLs2, ti0, []*model.TableInfo{ti2}))
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op12, ok := store.getOperation(task1, source1, "foo", "bar-2")
+	c.Assert(ok, IsTrue)
+	c.Assert(op12.ConflictStage, Equals, optimism.ConflictNone)
+	c.Assert(op12.DDLs, DeepEquals, resolved)
+
+	// without the resolver, the conflict is detected.
+	o.SetConflictResolver(nil)
+	store.putInfo(optimism.NewInfo(task2, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1}))
+	rev = store.putInfo(optimism.NewInfo(task2, source1, "foo", "bar-2", downSchema, downTable, DDLs2, ti0, []*model.TableInfo{ti2}))
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op22, ok := store.getOperation(task2, source1, "foo", "bar-2")
+	c.Assert(ok, IsTrue)
+	c.Assert(op22.ConflictStage, Equals, optimism.ConflictDetected)
+}
+
+func (t *testOptimist) TestOptimistDownstreamSchemaResolver(c *C) {
+	var (
+		o, store         = newMemOptimist()
+		task1            = "task-test-optimist-downstream-schema-1"
+		task2            = "task-test-optimist-downstream-schema-2"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		DDLs2            = []string{"ALTER TABLE bar ADD COLUMN c1 BIGINT", "ALTER TABLE bar ADD COLUMN c2 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		ti2_1            = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 BIGINT)`)
+		ti2              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 BIGINT, c2 INT)`)
+		tiText           = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 TEXT)`)
+		downstream       = map[string]*model.TableInfo{task1: ti1, task2: tiText}
+	)
+
+	// the mock downstream table has c1 INT for task1, and c1 TEXT for task2.
+	o.SetDownstreamSchemaResolver(func(lock *optimism.Lock) (*model.TableInfo, error) {
+		return downstream[lock.Task], nil
+	})
+
+	for _, task := range []string{task1, task2} {
+		st := optimism.NewSourceTables(task, source1)
+		st.AddTable("foo", "bar-1", downSchema, downTable)
+		st.AddTable("foo", "bar-2", downSchema, downTable)
+		store.putSourceTables(st)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store)
+	defer o.Close()
+
+	// bar-1 adds c1 INT, bar-2 adds c1 BIGINT and c2 INT, the conflict is resolved by c1 INT in the downstream,
+	// so only c2 is added.
+	store.putInfo(optimism.NewInfo(task1, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1}))
+	rev := store.putInfo(optimism.NewInfo(task1, source1, "foo", "bar-2", downSchema, downTable, DDLs2, ti0, []*model.TableInfo{ti2_1, ti2}))
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op12, ok := store.getOperation(task1, source1, "foo", "bar-2")
+	c.Assert(ok, IsTrue)
+	c.Assert(op12.ConflictStage, Equals, optimism.ConflictNone)
+	c.Assert(op12.DDLs, DeepEquals, DDLs2[1:])
+
+	// the downstream type is none of the conflicting types, the conflict is detected.
+	store.putInfo(optimism.NewInfo(task2, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1}))
+	rev = store.putInfo(optimism.NewInfo(task2, source1, "foo", "bar-2", downSchema, downTable, DDLs2, ti0, []*model.TableInfo{ti2_1, ti2}))
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op22, ok := store.getOperation(task2, source1, "foo", "bar-2")
+	c.Assert(ok, IsTrue)
+	c.Assert(op22.ConflictStage, Equals, optimism.ConflictDetected)
+}
+
+func (t *testOptimist) TestOptimistShadowMode(c *C) {
+	var (
+		o, store          = newMemOptimist()
+		task              = "task-test-optimist-shadow-mode"
+		source1           = "mysql-replica-1"
+		downSchema        = "foo"
+		downTable         = "bar"
+		lockID            = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1               = optimism.NewSourceTables(task, source1)
+		p                 = parser.New()
+		se                = mock.NewContext()
+		tblID       int64 = 111
+		DDLs1             = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0               = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1               = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11               = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i12               = optimism.NewInfo(task, source1, "foo", "bar-2", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		divergences []Divergence
+	)
+
+	o.SetShadowMode(func(d Divergence) {
+		divergences = append(divergences, d)
+	})
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store, st1)
+	defer o.Close()
+
+	// the schema without c1 is applied externally.
+	o.RecordAppliedSchema(lockID, ti0)
+	store.putInfo(i11)
+	rev := store.putInfo(i12)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	synced, _ := o.Locks()[lockID].IsSynced()
+	c.Assert(synced, IsTrue)
+
+	// the joins are computed, but no operations are emitted.
+	opm, _, err := store.GetAllOperations()
+	c.Assert(err, IsNil)
+	c.Assert(opm, HasLen, 0)
+
+	// the divergence is reported.
+	o.mu.Lock()
+	c.Assert(divergences, Not(HasLen), 0)
+	d := divergences[len(divergences)-1]
+	o.mu.Unlock()
+	c.Assert(d.LockID, Equals, lockID)
+	c.Assert(d.Computed, Not(Equals), d.Applied)
+
+	// no divergence after the joined schema is applied.
+	o.mu.Lock()
+	divergences = nil
+	o.mu.Unlock()
+	o.RecordAppliedSchema(lockID, ti1)
+	c.Assert(divergences, HasLen, 0)
+}
+
+func (t *testOptimist) TestOptimistTargetSchemaForSource(c *C) {
+	var (
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-target-schema"
+		source1          = "mysql-replica-1"
+		source2          = "mysql-replica-2"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		st2              = optimism.NewSourceTables(task, source2)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st2.AddTable("foo", "bar-1", downSchema, downTable)
+
+	// not started.
+	_, err := o.TargetSchemaForSource(lockID, source2)
+	c.Assert(terror.ErrMasterOptimistNotStarted.Equal(err), IsTrue)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store, st1, st2)
+	defer o.Close()
+
+	_, err = o.TargetSchemaForSource(lockID, source2)
+	c.Assert(terror.ErrMasterLockNotFound.Equal(err), IsTrue)
+
+	// only source1 adds c1, source2 is lagging.
+	rev := store.putInfo(i11)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	lock := o.Locks()[lockID]
+	synced, remain := lock.IsSynced()
+	c.Assert(synced, IsFalse)
+	c.Assert(remain, Equals, 1)
+
+	// source2 must reach the joined schema with c1.
+	ti, err := o.TargetSchemaForSource(lockID, source2)
+	c.Assert(err, IsNil)
+	c.Assert(ti.Name.O, Equals, downTable)
+	c.Assert(ti.Columns, HasLen, 2)
+	c.Assert(ti.Columns[1].Name.O, Equals, "c1")
+	cmp, err := schemacmp.Encode(ti).Compare(lock.Joined())
+	c.Assert(err, IsNil)
+	c.Assert(cmp, Equals, 0)
+
+	_, err = o.TargetSchemaForSource(lockID, "mysql-replica-3")
+	c.Assert(terror.ErrMasterOptimisticSourceNotInLock.Equal(err), IsTrue)
+}
+
+func (t *testOptimist) TestOptimistQuorum(c *C) {
+	var (
+		backOff          = 30
+		waitTime         = 100 * time.Millisecond
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-quorum"
+		sources          = []string{"mysql-replica-1", "mysql-replica-2", "mysql-replica-3"}
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+	)
+
+	o.SetQuorum(2.0 / 3)
+	for _, source := range sources {
+		st := optimism.NewSourceTables(task, source)
+		st.AddTable("foo", "bar-1", downSchema, downTable)
+		store.putSourceTables(st)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store)
+	defer o.Close()
+
+	// two of the three sources add c1 and done.
+	for _, source := range sources[:2] {
+		rev := store.putInfo(optimism.NewInfo(task, source, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1}))
+		c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+		c.Assert(o.Locks(), HasKey, lockID)
+		op, ok := store.getOperation(task, source, "foo", "bar-1")
+		c.Assert(ok, IsTrue)
+		c.Assert(op.DDLs, DeepEquals, DDLs1)
+		op.Done = true
+		_, putted, err := store.PutOperation(false, op, 0)
+		c.Assert(err, IsNil)
+		c.Assert(putted, IsTrue)
+	}
+
+	// the lock is resolved by the quorum without the third source.
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		_, ok := o.Locks()[lockID]
+		return !ok
+	}), IsTrue)
+
+	// the straggler reaches the joined schema later, it's reconciled without executing DDLs again.
+	rev := store.putInfo(optimism.NewInfo(task, sources[2], "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1}))
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op, ok := store.getOperation(task, sources[2], "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.DDLs, HasLen, 0)
+	c.Assert(op.ConflictStage, Equals, optimism.ConflictNone)
+	c.Assert(o.Locks(), Not(HasKey), lockID)
+}
+
+// delayedOptimistStore is a memOptimistStore whose reads and writes are delayed.
+type delayedOptimistStore struct {
+	*memOptimistStore
+	delay time.Duration
+}
+
+func (s *delayedOptimistStore) GetAllInfo() (map[string]map[string]map[string]map[string]optimism.Info, int64, error) {
+	time.Sleep(s.delay)
+	return s.memOptimistStore.GetAllInfo()
+}
+
+func (s *delayedOptimistStore) PutOperation(skipDone bool, op optimism.Operation, infoModRev int64) (int64, bool, error) {
+	time.Sleep(s.delay)
+	return s.memOptimistStore.PutOperation(skipDone, op, infoModRev)
+}
+
+func (s *delayedOptimistStore) DeleteInfosOperationsColumns(infos []optimism.Info, ops []optimism.Operation, lockID string) (int64, bool, error) {
+	time.Sleep(s.delay)
+	return s.memOptimistStore.DeleteInfosOperationsColumns(infos, ops, lockID)
+}
+
+// etcdDurationSamples returns the sample count and sum of the latency histogram of the store operation type.
+func etcdDurationSamples(c *C, opType string) (uint64, float64) {
+	metric := &dto.Metric{}
+	c.Assert(metrics.ShardDDLEtcdDurationHistogram.WithLabelValues(opType).(prometheus.Metric).Write(metric), IsNil)
+	return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+}
+
+func (t *testOptimist) TestOptimistEtcdDurationMetrics(c *C) {
+	var (
+		backOff          = 30
+		waitTime         = 100 * time.Millisecond
+		delay            = 20 * time.Millisecond
+		logger           = log.L()
+		o                = NewOptimist(&logger, getDownstreamMeta)
+		store            = &delayedOptimistStore{memOptimistStore: newMemOptimistStore(), delay: delay}
+		task             = "task-test-optimist-etcd-duration-metrics"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+
+		opTypes = []string{
+			storeOpGetAllSourceTables, storeOpGetAllInfo, storeOpGetAllOperations, storeOpGetAllDroppedColumns,
+			storeOpAcquireLeaderEpoch, storeOpWatchSourceTables, storeOpWatchInfo, storeOpWatchOperationPut,
+			storeOpPutOperation, storeOpDeleteInfosOperationsColumns,
+		}
+		delayedOpTypes = []string{storeOpGetAllInfo, storeOpPutOperation, storeOpDeleteInfosOperationsColumns}
+		counts         = make(map[string]uint64, len(opTypes))
+		sums           = make(map[string]float64, len(opTypes))
+	)
+	// the histograms are global, so only the samples observed in this test are checked.
+	for _, opType := range opTypes {
+		counts[opType], sums[opType] = etcdDurationSamples(c, opType)
+	}
+	observed := func(opType string) bool {
+		count, _ := etcdDurationSamples(c, opType)
+		return count > counts[opType]
+	}
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	store.putSourceTables(st1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Assert(o.StartWithStore(ctx, store), IsNil)
+	defer o.Close()
+
+	// the source tables are put again after started.
+	store.putSourceTables(st1)
+
+	// PUT i11, the lock is synced as the only table of the lock.
+	rev := store.putInfo(i11)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op11, ok := store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+
+	// the operation is done, the lock is resolved and removed.
+	op11.Done = true
+	_, putted, err := store.memOptimistStore.PutOperation(false, op11, 0)
+	c.Assert(err, IsNil)
+	c.Assert(putted, IsTrue)
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		return len(o.Locks()) == 0
+	}), IsTrue)
+
+	for _, opType := range opTypes {
+		opType := opType
+		c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+			return observed(opType)
+		}), IsTrue, Commentf("operation type %s", opType))
+	}
+	// the delays of the backend are observed.
+	for _, opType := range delayedOpTypes {
+		count, sum := etcdDurationSamples(c, opType)
+		c.Assert(sum-sums[opType], GreaterEqual, delay.Seconds()*float64(count-counts[opType]), Commentf("operation type %s", opType))
+	}
+}
+
+func (t *testOptimist) TestOptimistTruncateTablePolicy(c *C) {
+	var (
+		backOff          = 30
+		waitTime         = 100 * time.Millisecond
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"TRUNCATE TABLE `foo`.`bar`"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+	)
+	c.Assert(optimism.IsTruncateTableDDLs(DDLs1), IsTrue)
+	c.Assert(optimism.IsTruncateTableDDLs([]string{"ALTER TABLE bar ADD COLUMN c1 INT"}), IsFalse)
+	c.Assert(optimism.IsTruncateTableDDLs(nil), IsFalse)
+
+	for _, tc := range []struct {
+		policy TruncateTablePolicy
+		ddls   []string
+	}{
+		{policy: TruncateTablePassThrough, ddls: DDLs1},
+		{policy: TruncateTableSkip, ddls: nil},
+	} {
+		var (
+			o, store = newMemOptimist()
+			task     = "task-test-optimist-truncate-table-" + string(tc.policy)
+			lockID   = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+			st1      = optimism.NewSourceTables(task, source1)
+			i11      = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti0})
+		)
+		st1.AddTable("foo", "bar-1", downSchema, downTable)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		if tc.policy != TruncateTablePassThrough {
+			o.SetTruncateTablePolicy(tc.policy)
+		}
+		startMemOptimist(c, ctx, o, store, st1)
+
+		// PUT i11, the TRUNCATE TABLE is handled by the policy without changing the schema.
+		rev := store.putInfo(i11)
+		c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+		c.Assert(o.Locks(), HasKey, lockID)
+		cmp, err := o.Locks()[lockID].Joined().Compare(schemacmp.Encode(ti0))
+		c.Assert(err, IsNil)
+		c.Assert(cmp, Equals, 0)
+		synced, remain := o.Locks()[lockID].IsSynced()
+		c.Assert(synced, IsTrue)
+		c.Assert(remain, Equals, 0)
+		op11, ok := store.getOperation(task, source1, "foo", "bar-1")
+		c.Assert(ok, IsTrue, Commentf("policy %s", tc.policy))
+		c.Assert(op11.ConflictStage, Equals, optimism.ConflictNone)
+		c.Assert(op11.DDLs, DeepEquals, tc.ddls, Commentf("policy %s", tc.policy))
+		c.Assert(op11.Cols, HasLen, 0)
+
+		// the operation is done, the lock is resolved.
+		op11.Done = true
+		_, putted, err := store.PutOperation(false, op11, 0)
+		c.Assert(err, IsNil)
+		c.Assert(putted, IsTrue)
+		c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+			return len(o.Locks()) == 0
+		}), IsTrue, Commentf("policy %s", tc.policy))
+
+		o.Close()
+		cancel()
+	}
+}
+
+func (t *testOptimist) TestOptimistSafeMode(c *C) {
+	var (
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-safe-mode"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i12              = optimism.NewInfo(task, source1, "foo", "bar-2", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Assert(o.ConfirmReady(), NotNil) // not started.
+	o.SetSafeMode(true)
+	startMemOptimist(c, ctx, o, store, st1)
+	defer o.Close()
+
+	// the infos are handled and the lock is synced, but no operations are emitted.
+	rev := store.putInfo(i11)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	rev = store.putInfo(i12)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	c.Assert(o.Locks(), HasKey, lockID)
+	synced, remain := o.Locks()[lockID].IsSynced()
+	c.Assert(synced, IsTrue)
+	c.Assert(remain, Equals, 0)
+	opm, _, err := store.GetAllOperations()
+	c.Assert(err, IsNil)
+	c.Assert(opm, HasLen, 0)
+
+	// the held operations are emitted once confirmed.
+	c.Assert(o.ConfirmReady(), IsNil)
+	for _, table := range []string{"bar-1", "bar-2"} {
+		op, ok := store.getOperation(task, source1, "foo", table)
+		c.Assert(ok, IsTrue)
+		c.Assert(op.DDLs, DeepEquals, DDLs1)
+	}
+	c.Assert(o.ConfirmReady(), IsNil) // confirm again.
+
+	// the safe mode is armed again after restarted.
+	o.Close()
+	store = newMemOptimistStore()
+	startMemOptimist(c, ctx, o, store, st1)
+	rev = store.putInfo(i11)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	_, ok := store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsFalse)
+	c.Assert(o.ConfirmReady(), IsNil)
+	_, ok = store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+}
+
+func (t *testOptimist) TestOptimistHoldsLostAfterRestart(c *C) {
+	var (
+		task             = "task-test-optimist-holds-lost-after-restart"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i12              = optimism.NewInfo(task, source1, "foo", "bar-2", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, safeMode := range []bool{false, true} {
+		o, store := newMemOptimist()
+		startMemOptimist(c, ctx, o, store, st1)
+
+		// freeze the lock, the operation of i12 is held.
+		rev := store.putInfo(i11)
+		c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+		c.Assert(o.FreezeLock(lockID), IsNil)
+		rev = store.putInfo(i12)
+		c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+		_, ok := store.getOperation(task, source1, "foo", "bar-2")
+		c.Assert(ok, IsFalse)
+
+		if !safeMode {
+			// the frozen lock isn't persisted, the rebuilt operation is emitted after restarted.
+			o = restartMemOptimist(c, ctx, o, store)
+			c.Assert(o.frozen, HasLen, 0)
+			op, ok := store.getOperation(task, source1, "foo", "bar-2")
+			c.Assert(ok, IsTrue)
+			c.Assert(op.DDLs, DeepEquals, DDLs1)
+			o.Close()
+			continue
+		}
+
+		// an optimist restarted in the safe mode holds the rebuilt operation until confirmed.
+		o.Close()
+		logger := log.L()
+		o = NewOptimist(&logger, getDownstreamMeta)
+		o.SetSafeMode(true)
+		c.Assert(o.StartWithStore(ctx, store), IsNil)
+		_, ok = store.getOperation(task, source1, "foo", "bar-2")
+		c.Assert(ok, IsFalse)
+		c.Assert(o.ConfirmReady(), IsNil)
+		op, ok := store.getOperation(task, source1, "foo", "bar-2")
+		c.Assert(ok, IsTrue)
+		c.Assert(op.DDLs, DeepEquals, DDLs1)
+		o.Close()
+	}
+}
+
+func (t *testOptimist) TestOptimistApplyTimeout(c *C) {
+	defer func(interval time.Duration) {
+		applyTimeoutCheckInterval = interval
+	}(applyTimeoutCheckInterval)
+	applyTimeoutCheckInterval = 10 * time.Millisecond
+
+	var (
+		backOff          = 30
+		waitTime         = 100 * time.Millisecond
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-apply-timeout"
+		source1          = "mysql-replica-1"
+		source2          = "mysql-replica-2"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		st2              = optimism.NewSourceTables(task, source2)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i21              = optimism.NewInfo(task, source2, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st2.AddTable("foo", "bar-1", downSchema, downTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	o.SetApplyTimeout(100 * time.Millisecond)
+	startMemOptimist(c, ctx, o, store, st1, st2)
+	defer o.Close()
+
+	// both sources receive their operations.
+	rev := store.putInfo(i11)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	rev = store.putInfo(i21)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op11, ok := store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	_, ok = store.getOperation(task, source2, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+
+	// source1 applies its operation in time, but source2 never does.
+	op11.Done = true
+	_, putted, err := store.PutOperation(false, op11, 0)
+	c.Assert(err, IsNil)
+	c.Assert(putted, IsTrue)
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		sources := o.LaggingSources()[lockID]
+		return len(sources) == 1 && sources[0] == source2
+	}), IsTrue)
+	c.Assert(o.LaggingSources(), DeepEquals, map[string][]string{lockID: {source2}})
+	c.Assert(o.Report(), Matches, "(?s).*lagging: lock "+regexp.QuoteMeta(lockID)+", source "+source2+",.*")
+	// the operation is not skipped.
+	c.Assert(o.Locks(), HasKey, lockID)
+	op21, ok := store.getOperation(task, source2, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op21.Done, IsFalse)
+
+	// source2 catches up at last.
+	op21.Done = true
+	_, putted, err = store.PutOperation(false, op21, 0)
+	c.Assert(err, IsNil)
+	c.Assert(putted, IsTrue)
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		return len(o.LaggingSources()) == 0
+	}), IsTrue)
+}
+
+func (t *testOptimist) TestOptimistConflictStageAfterRestart(c *C) {
+	var (
+		o, store            = newMemOptimist()
+		task                = "task-test-optimist-conflict-stage-after-restart"
+		source1             = "mysql-replica-1"
+		downSchema          = "foo"
+		downTable           = "bar"
+		lockID              = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1                 = optimism.NewSourceTables(task, source1)
+		p                   = parser.New()
+		se                  = mock.NewContext()
+		tblID         int64 = 222
+		DDLs1               = []string{"ALTER TABLE bar ADD COLUMN c1 TEXT"}
+		DDLs2               = []string{"ALTER TABLE bar ADD COLUMN c1 DATETIME"}
+		ti0                 = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1                 = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 TEXT)`)
+		ti2                 = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 DATETIME)`)
+		i1                  = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i2                  = optimism.NewInfo(task, source1, "foo", "bar-2", downSchema, downTable, DDLs2, ti0, []*model.TableInfo{ti2})
+		conflictTable       = fmt.Sprintf("%s-%s", source1, "`foo`.`bar-2`")
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store, st1)
+
+	// the conflict is detected for i2, while the operation for i1 is done.
+	rev := store.putInfo(i1)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op1, ok := store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op1.ConflictStage, Equals, optimism.ConflictNone)
+	op1.Done = true
+	_, _, err := store.PutOperation(false, op1, 0)
+	c.Assert(err, IsNil)
+	rev = store.putInfo(i2)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op2, ok := store.getOperation(task, source1, "foo", "bar-2")
+	c.Assert(ok, IsTrue)
+	c.Assert(op2.ConflictStage, Equals, optimism.ConflictDetected)
+	c.Assert(o.Report(), Matches, "(?s).*conflict: lock "+regexp.QuoteMeta(lockID)+", table "+regexp.QuoteMeta(conflictTable)+".*")
+
+	// restart a new instance, the conflict stage is rebuilt rather than reset.
+	o = restartMemOptimist(c, ctx, o, store)
+	defer o.Close()
+	op2, ok = store.getOperation(task, source1, "foo", "bar-2")
+	c.Assert(ok, IsTrue)
+	c.Assert(op2.ConflictStage, Equals, optimism.ConflictDetected)
+	c.Assert(op2.DDLs, DeepEquals, []string{})
+	op1, ok = store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op1.ConflictStage, Equals, optimism.ConflictNone)
+	c.Assert(op1.Done, IsTrue)
+	c.Assert(o.Report(), Matches, "(?s).*conflict: lock "+regexp.QuoteMeta(lockID)+", table "+regexp.QuoteMeta(conflictTable)+".*")
+
+	// infos with the same revision are recovered in the order of their tables.
+	i1.Revision, i2.Revision = 1, 1
+	ifm := map[string]map[string]map[string]map[string]optimism.Info{
+		task: {source1: {"foo": {"bar-2": i2, "bar-1": i1}}},
+	}
+	for i := 0; i < 10; i++ {
+		infos := sortInfos(ifm)
+		c.Assert(infos, HasLen, 2)
+		c.Assert(infos[0].UpTable, Equals, "bar-1")
+		c.Assert(infos[1].UpTable, Equals, "bar-2")
+	}
+}
+
+func (t *testOptimist) TestOptimistMixedAlter(c *C) {
+	var (
+		backOff          = 30
+		waitTime         = 100 * time.Millisecond
+		task             = "task-test-optimist-mixed-alter"
+		source1          = "mysql-replica-1"
+		source2          = "mysql-replica-2"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		st2              = optimism.NewSourceTables(task, source2)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT, DROP COLUMN c2"}
+		addDDL           = "ALTER TABLE `bar` ADD COLUMN `c1` INT"
+		dropDDL          = "ALTER TABLE `bar` DROP COLUMN `c2`"
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c2 INT)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i1               = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i2               = optimism.NewInfo(task, source2, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st2.AddTable("foo", "bar-1", downSchema, downTable)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the mixed ALTER TABLE is rejected by the policy.
+	o, store := newMemOptimist()
+	o.SetMixedAlterPolicy(MixedAlterReject)
+	startMemOptimist(c, ctx, o, store, st1, st2)
+	rev := store.putInfo(i1)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op1, ok := store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op1.ConflictStage, Equals, optimism.ConflictDetected)
+	o.Close()
+
+	// the mixed ALTER TABLE is split by default.
+	o, store = newMemOptimist()
+	startMemOptimist(c, ctx, o, store, st1, st2)
+	defer o.Close()
+
+	// the first source adds the column, but the dropped one is kept until dropped by all sources.
+	rev = store.putInfo(i1)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op1, ok = store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op1.ConflictStage, Equals, optimism.ConflictNone)
+	c.Assert(op1.DDLs, DeepEquals, []string{addDDL})
+	c.Assert(op1.Cols, DeepEquals, []string{"c2"})
+	synced, remain := o.Locks()[lockID].IsSynced()
+	c.Assert(synced, IsFalse)
+	c.Assert(remain, Equals, 1)
+
+	// the last source adds and drops the columns, the lock is synced.
+	rev = store.putInfo(i2)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op2, ok := store.getOperation(task, source2, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op2.ConflictStage, Equals, optimism.ConflictNone)
+	c.Assert(op2.DDLs, DeepEquals, []string{addDDL, dropDDL})
+	synced, remain = o.Locks()[lockID].IsSynced()
+	c.Assert(synced, IsTrue)
+	c.Assert(remain, Equals, 0)
+	joined, err := o.Locks()[lockID].JoinedTableInfo()
+	c.Assert(err, IsNil)
+	c.Assert(model.FindColumnInfo(joined.Columns, "c1"), NotNil)
+	c.Assert(model.FindColumnInfo(joined.Columns, "c2"), IsNil)
+
+	// the lock is resolved once the operations are done.
+	for _, op := range []optimism.Operation{op1, op2} {
+		op.Done = true
+		_, _, err = store.PutOperation(false, op, 0)
+		c.Assert(err, IsNil)
+	}
+	c.Assert(utils.WaitSomething(backOff, waitTime, func() bool {
+		return len(o.Locks()) == 0
+	}), IsTrue)
+}
+
+func (t *testOptimist) TestOptimistMetricsText(c *C) {
+	var (
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-metrics-text"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 222
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i1               = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		labels           = fmt.Sprintf(`{task="%s",lock="%s"}`, task, lockID)
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store, st1)
+	defer o.Close()
+
+	text := o.MetricsText()
+	c.Assert(text, Matches, "(?s).*\ndm_master_shard_ddl_locks 0\n.*")
+	c.Assert(strings.HasSuffix(text, "# EOF\n"), IsTrue)
+
+	rev := store.putInfo(i1)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	c.Assert(o.Locks(), HasKey, lockID)
+	text = o.MetricsText()
+	c.Assert(text, Matches, "(?s)# TYPE dm_master_shard_ddl_locks gauge\n.*")
+	c.Assert(text, Matches, "(?s).*\ndm_master_shard_ddl_locks 1\n.*")
+	c.Assert(text, Matches, "(?s).*\n# TYPE dm_master_shard_ddl_lock_unsynced_tables gauge\n.*")
+	c.Assert(text, Matches, "(?s).*\ndm_master_shard_ddl_lock_unsynced_tables"+regexp.QuoteMeta(labels)+" 1\n.*")
+	c.Assert(text, Matches, "(?s).*\ndm_master_shard_ddl_lock_conflicts"+regexp.QuoteMeta(labels)+" 0\n.*")
+	c.Assert(text, Matches, "(?s).*\ndm_master_shard_ddl_lock_age_seconds"+regexp.QuoteMeta(labels)+" [0-9.e-]+\n.*")
+	c.Assert(strings.HasSuffix(text, "# EOF\n"), IsTrue)
+}
+
+func (t *testOptimist) TestOptimistWaitForAppliedRevision(c *C) {
+	var (
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-wait-for-applied-revision"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 223
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		DDLs2            = []string{"ALTER TABLE bar ADD COLUMN c2 INT"}
+		DDLs3            = []string{"ALTER TABLE bar ADD COLUMN c3 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		ti2              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT, c2 INT)`)
+		ti3              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT, c2 INT, c3 INT)`)
+		i11              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i12              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs2, ti1, []*model.TableInfo{ti2})
+		i13              = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs3, ti2, []*model.TableInfo{ti3})
+		i21              = optimism.NewInfo(task, source1, "foo", "bar-2", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store)
+	defer o.Close()
+
+	// the PUT of the source tables.
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+	rev := store.putSourceTables(st1)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	c.Assert(o.tk.SourceTableExist(task, source1, "foo", "bar-1", downSchema, downTable), IsTrue)
+	rev = store.putInfo(i11)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+
+	// the revisions after the info held back are not applied until it's released.
+	i13.Version, i13.Revision = 3, rev+1
+	o.applyInfo(i13)
+	rev = store.putInfo(i21)
+	ctx2, cancel2 := context.WithTimeout(ctx, 100*time.Millisecond)
+	c.Assert(o.WaitForRevision(ctx2, rev), Equals, context.DeadlineExceeded)
+	cancel2()
+	i12.Version, i12.Revision = 2, rev
+	o.applyInfo(i12)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+
+	// the DELETE of the infos and the source tables.
+	rev, err := store.DeleteInfosOperationsTablesByTaskAndSource(task, []string{source1}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+}
+
+func (t *testOptimist) TestOptimistReorderedInfos(c *C) {
+	var (
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-reordered-infos"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 222
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		DDLs2            = []string{"ALTER TABLE bar ADD COLUMN c2 INT"}
+		DDLs3            = []string{"ALTER TABLE bar ADD COLUMN c3 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		ti2              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT, c2 INT)`)
+		ti3              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT, c2 INT, c3 INT)`)
+		i1               = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i2               = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs2, ti1, []*model.TableInfo{ti2})
+		i3               = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs3, ti2, []*model.TableInfo{ti3})
+	)
+
+	joinedEquals := func(ti *model.TableInfo) bool {
+		cmp, err := o.Locks()[lockID].Joined().Compare(schemacmp.Encode(ti))
+		return err == nil && cmp == 0
+	}
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store, st1)
+	defer o.Close()
+
+	rev := store.putInfo(i1)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	c.Assert(joinedEquals(ti1), IsTrue)
+
+	// the later info arrives before the earlier one, it's held until the earlier one arrives.
+	i2.Version, i2.Revision = 2, rev+1
+	i3.Version, i3.Revision = 3, rev+2
+	o.applyInfo(i3)
+	c.Assert(joinedEquals(ti1), IsTrue)
+	op, ok := store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.DDLs, DeepEquals, DDLs1)
+
+	o.applyInfo(i2)
+	c.Assert(joinedEquals(ti3), IsTrue)
+	op, ok = store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.DDLs, DeepEquals, DDLs3)
+
+	// the stale info is dropped.
+	o.applyInfo(i2)
+	c.Assert(joinedEquals(ti3), IsTrue)
+	op, ok = store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.DDLs, DeepEquals, DDLs3)
+}
+
+func (t *testOptimist) TestOptimistConflictFallback(c *C) {
+	var (
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-conflict-fallback"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		owner            = fmt.Sprintf("%s-%s", source1, dbutil.TableName("foo", "bar-2"))
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 333
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		DDLs2            = []string{"ALTER TABLE bar ADD COLUMN c1 BIGINT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		ti2              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 BIGINT)`)
+		i1               = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i2               = optimism.NewInfo(task, source1, "foo", "bar-2", downSchema, downTable, DDLs2, ti0, []*model.TableInfo{ti2})
+		i3               = optimism.NewInfo(task, source1, "foo", "bar-3", downSchema, downTable, DDLs2, ti0, []*model.TableInfo{ti2})
+	)
+
+	o.SetConflictFallback(2)
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+	st1.AddTable("foo", "bar-3", downSchema, downTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store, st1)
+	defer o.Close()
+
+	// the first conflict is detected as usual.
+	store.putInfo(i1)
+	rev := store.putInfo(i2)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op, ok := store.getOperation(task, source1, "foo", "bar-2")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.ConflictStage, Equals, optimism.ConflictDetected)
+	locks := o.ShowLocks(task, nil)
+	c.Assert(locks, HasLen, 1)
+	c.Assert(locks[0].Mode, Equals, config.ShardOptimistic)
+	c.Assert(locks[0].Owner, Equals, "")
+
+	// the conflict repeats when the task is resumed, and the lock falls back to the pessimistic coordination.
+	rev = store.putInfo(i2)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op, ok = store.getOperation(task, source1, "foo", "bar-2")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.ConflictStage, Equals, optimism.ConflictNone)
+	c.Assert(op.DDLs, DeepEquals, DDLs2)
+	locks = o.ShowLocks(task, nil)
+	c.Assert(locks, HasLen, 1)
+	c.Assert(locks[0].Mode, Equals, config.ShardPessimistic)
+	c.Assert(locks[0].Owner, Equals, owner)
+	c.Assert(locks[0].DDLs, DeepEquals, DDLs2)
+	c.Assert(o.Report(), Matches, fmt.Sprintf("(?s).*fallback: lock %s, coordinated pessimistically by owner %s\n.*",
+		regexp.QuoteMeta(lockID), regexp.QuoteMeta(owner)))
+
+	// the conflict of a non-owner table is resolved by skipping its DDLs, after the owner's operation is done.
+	rev = store.putInfo(i3)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	_, ok = store.getOperation(task, source1, "foo", "bar-3")
+	c.Assert(ok, IsFalse)
+	op.Done = true
+	o.applyOperation(op)
+	op, ok = store.getOperation(task, source1, "foo", "bar-3")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.ConflictStage, Equals, optimism.ConflictNone)
+	c.Assert(op.DDLs, HasLen, 0)
+}
+
+func (t *testOptimist) TestOptimistApproveOperationHeldForFallback(c *C) {
+	var (
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-approve-held-for-fallback"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		table3           = fmt.Sprintf("%s-%s", source1, dbutil.TableName("foo", "bar-3"))
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 333
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		DDLs2            = []string{"ALTER TABLE bar ADD COLUMN c1 BIGINT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		ti2              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 BIGINT)`)
+		i1               = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i2               = optimism.NewInfo(task, source1, "foo", "bar-2", downSchema, downTable, DDLs2, ti0, []*model.TableInfo{ti2})
+		i3               = optimism.NewInfo(task, source1, "foo", "bar-3", downSchema, downTable, DDLs2, ti0, []*model.TableInfo{ti2})
+	)
+
+	o.SetConflictFallback(2)
+	o.SetRiskyDDLFunc(func(info optimism.Info) bool {
+		return info.UpTable == "bar-3"
+	})
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+	st1.AddTable("foo", "bar-3", downSchema, downTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store, st1)
+	defer o.Close()
+
+	// the lock falls back to the pessimistic coordination with bar-2 as the owner.
+	store.putInfo(i1)
+	store.putInfo(i2)
+	rev := store.putInfo(i2)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op, ok := store.getOperation(task, source1, "foo", "bar-2")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.ConflictStage, Equals, optimism.ConflictNone)
+
+	// the operation of the non-owner table is held for the approval.
+	rev = store.putInfo(i3)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	c.Assert(o.PendingApprovals(), HasLen, 1)
+
+	// once approved, it's still held until the owner's operation is done.
+	c.Assert(o.ApproveOperation(lockID, table3), IsNil)
+	c.Assert(o.PendingApprovals(), HasLen, 0)
+	_, ok = store.getOperation(task, source1, "foo", "bar-3")
+	c.Assert(ok, IsFalse)
+	op.Done = true
+	o.applyOperation(op)
+	op, ok = store.getOperation(task, source1, "foo", "bar-3")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.DDLs, HasLen, 0)
+}
+
+func (t *testOptimist) TestOptimistSeedJoinedSchema(c *C) {
+	var (
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-seed-joined-schema"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 444
+		seedSQL          = `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT, c2 INT)`
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		DDLs2            = []string{"ALTER TABLE bar ADD COLUMN c3 INT"}
+		DDLs3            = []string{"ALTER TABLE bar ADD COLUMN c3 BIGINT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		tiSeed           = createTableInfo(c, p, se, tblID, seedSQL)
+		ti2              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT, c2 INT, c3 INT)`)
+		ti3              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT, c2 INT, c3 BIGINT)`)
+	)
+
+	joinedEquals := func(ti *model.TableInfo) bool {
+		cmp, err := o.Locks()[lockID].Joined().Compare(schemacmp.Encode(ti))
+		return err == nil && cmp == 0
+	}
+
+	c.Assert(terror.ErrMasterOptimistNotStarted.Equal(o.SeedJoinedSchema(lockID, seedSQL)), IsTrue)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store, st1)
+	defer func() {
+		o.Close()
+	}()
+	restart := func() {
+		o = restartMemOptimist(c, ctx, o, store)
+	}
+
+	c.Assert(terror.ErrMasterLockNotFound.Equal(o.SeedJoinedSchema(lockID, seedSQL)), IsTrue)
+	rev := store.putInfo(optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1}))
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	c.Assert(joinedEquals(ti1), IsTrue)
+
+	// only a CREATE TABLE statement can be seeded.
+	c.Assert(terror.ErrMasterOptimisticInvalidJoinedSchema.Equal(o.SeedJoinedSchema(lockID, "CREATE TABLE")), IsTrue)
+	c.Assert(terror.ErrMasterOptimisticInvalidJoinedSchema.Equal(o.SeedJoinedSchema(lockID, "DROP TABLE bar")), IsTrue)
+	c.Assert(joinedEquals(ti1), IsTrue)
+
+	// all tables converge to the seeded schema.
+	c.Assert(o.SeedJoinedSchema(lockID, seedSQL), IsNil)
+	c.Assert(joinedEquals(tiSeed), IsTrue)
+	synced, remain := o.Locks()[lockID].IsSynced()
+	c.Assert(synced, IsTrue)
+	c.Assert(remain, Equals, 0)
+
+	// the seed survives the restart.
+	restart()
+	c.Assert(joinedEquals(tiSeed), IsTrue)
+	seeds, _, err := store.GetAllLockSeeds()
+	c.Assert(err, IsNil)
+	c.Assert(seeds[lockID].CreateSQL, Equals, seedSQL)
+
+	// the later infos are validated against the seeded schema.
+	rev = store.putInfo(optimism.NewInfo(task, source1, "foo", "bar-2", downSchema, downTable, DDLs2, tiSeed, []*model.TableInfo{ti2}))
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op, ok := store.getOperation(task, source1, "foo", "bar-2")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.ConflictStage, Equals, optimism.ConflictNone)
+	c.Assert(op.DDLs, DeepEquals, DDLs2)
+	c.Assert(joinedEquals(ti2), IsTrue)
+
+	rev = store.putInfo(optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs3, tiSeed, []*model.TableInfo{ti3}))
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op, ok = store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.ConflictStage, Equals, optimism.ConflictDetected)
+	c.Assert(joinedEquals(ti2), IsTrue)
+
+	// the infos put after the seed are synced on top of it after the restart.
+	restart()
+	c.Assert(joinedEquals(ti2), IsTrue)
+}
+
+func (t *testOptimist) TestOptimistLockNote(c *C) {
+	var (
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-lock-note"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		note             = "waiting for the DBA to confirm the column type"
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 555
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i1               = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	c.Assert(terror.ErrMasterOptimistNotStarted.Equal(o.SetLockNote(lockID, note)), IsTrue)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store, st1)
+
+	c.Assert(terror.ErrMasterLockNotFound.Equal(o.SetLockNote(lockID, note)), IsTrue)
+	rev := store.putInfo(i1)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	c.Assert(o.SetLockNote(lockID, note), IsNil)
+
+	locks := o.ShowLocks("", nil)
+	c.Assert(locks, HasLen, 1)
+	c.Assert(locks[0].Note, Equals, note)
+	c.Assert(o.Report(), Matches, "(?s).*note: lock "+regexp.QuoteMeta(lockID)+": "+note+".*")
+
+	// the note survives the restart.
+	o = restartMemOptimist(c, ctx, o, store)
+	defer o.Close()
+	locks = o.ShowLocks("", nil)
+	c.Assert(locks, HasLen, 1)
+	c.Assert(locks[0].Note, Equals, note)
+
+	// an empty note clears the existing one.
+	c.Assert(o.SetLockNote(lockID, ""), IsNil)
+	c.Assert(o.ShowLocks("", nil)[0].Note, Equals, "")
+	notes, _, err := store.GetAllLockNotes()
+	c.Assert(err, IsNil)
+	c.Assert(notes, HasLen, 0)
+}
+
+func (t *testOptimist) TestOptimistReemitOperationHeld(c *C) {
+	var (
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-reemit-held"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 666
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i1               = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store, st1)
+	defer o.Close()
+
+	// the operation is consumed and done by the DM-worker.
+	rev := store.putInfo(i1)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	op, ok := store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	op.Done = true
+	_, _, err := store.PutOperation(false, op, 0)
+	c.Assert(err, IsNil)
+
+	// the re-emitted operation is held by the frozen lock.
+	c.Assert(o.FreezeLock(lockID), IsNil)
+	c.Assert(o.ReemitOperation(lockID, source1), IsNil)
+	op, ok = store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.Done, IsTrue)
+	c.Assert(o.UnfreezeLock(lockID), IsNil)
+	op, ok = store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.Done, IsFalse)
+
+	// the re-emitted operation of the risky DDL waits for the approval.
+	op.Done = true
+	_, _, err = store.PutOperation(false, op, 0)
+	c.Assert(err, IsNil)
+	o.SetRiskyDDLFunc(func(info optimism.Info) bool { return true })
+	c.Assert(o.ReemitOperation(lockID, source1), IsNil)
+	c.Assert(o.PendingApprovals(), HasLen, 1)
+	op, ok = store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.Done, IsTrue)
+	c.Assert(o.ApproveOperation(lockID, fmt.Sprintf("%s-%s", source1, dbutil.TableName("foo", "bar-1"))), IsNil)
+	op, ok = store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op.Done, IsFalse)
+}
@@ -0,0 +1,123 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shardddl
+
+import (
+	"sort"
+
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tiflow/dm/dm/master/metrics"
+	"github.com/pingcap/tiflow/dm/pkg/shardddl/optimism"
+	"github.com/pingcap/tiflow/dm/pkg/terror"
+)
+
+// DiscrepancyKind is the kind of the discrepancy between the in-memory shard DDL lock and the one rebuilt from etcd.
+type DiscrepancyKind string
+
+const (
+	// DiscrepancyMissing means the lock is rebuilt from etcd but not found in memory.
+	DiscrepancyMissing DiscrepancyKind = "missing"
+	// DiscrepancyUnexpected means the lock is found in memory but not rebuilt from etcd.
+	DiscrepancyUnexpected DiscrepancyKind = "unexpected"
+	// DiscrepancyMismatched means the lock in memory differs from the one rebuilt from etcd.
+	DiscrepancyMismatched DiscrepancyKind = "mismatched"
+)
+
+// Discrepancy is a shard DDL lock which differs between the memory and etcd.
+type Discrepancy struct {
+	LockID string
+	Kind   DiscrepancyKind
+	// Diff is the difference from the lock rebuilt from etcd to the one in memory, only set for `DiscrepancyMismatched`.
+	Diff optimism.LockStateDiff
+}
+
+// readOnlyOptimistStore is an OptimistStore discarding all writes, used to rebuild the locks offline.
+type readOnlyOptimistStore struct {
+	OptimistStore
+}
+
+func (s readOnlyOptimistStore) AcquireLeaderEpoch() (int64, error) {
+	return 0, nil
+}
+
+func (s readOnlyOptimistStore) PutOperation(bool, optimism.Operation, int64) (int64, bool, error) {
+	return 0, false, nil
+}
+
+func (s readOnlyOptimistStore) DeleteInfosOperationsColumns([]optimism.Info, []optimism.Operation, string) (int64, bool, error) {
+	return 0, false, nil
+}
+
+func (s readOnlyOptimistStore) DeleteInfosOperationsTablesByTask(string, map[string]struct{}) (int64, error) {
+	return 0, nil
+}
+
+func (s readOnlyOptimistStore) DeleteInfosOperationsTablesByTaskAndSource(string, []string, map[string][]string) (int64, error) {
+	return 0, nil
+}
+
+// VerifyAgainstEtcd rebuilds the shard DDL locks offline from the state persisted in the store as if the optimist is
+// restarted, and returns the locks in memory which differ from the rebuilt ones, sorted by the lock IDs.
+// NOTE: the infos and operations not received by the optimist yet are reported as discrepancies too,
+// so a discrepancy is only suspicious if it persists across several checks.
+func (o *Optimist) VerifyAgainstEtcd() ([]Discrepancy, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return nil, terror.ErrMasterOptimistNotStarted.Generate()
+	}
+
+	// the locks are rebuilt by another optimist with the same policies, but it never writes to the store.
+	shadow := NewOptimist(&o.logger, o.getDownstreamMeta)
+	shadow.logger = o.logger.WithFields(zap.String("verify", "offline"))
+	shadow.store = readOnlyOptimistStore{OptimistStore: o.store}
+	shadow.quorum = o.quorum
+	shadow.conflictResolver = o.conflictResolver
+	shadow.fallbackThreshold = o.fallbackThreshold
+	shadow.unknownTablePolicy = o.unknownTablePolicy
+	shadow.truncateTablePolicy = o.truncateTablePolicy
+	shadow.mixedAlterPolicy = o.mixedAlterPolicy
+	if _, _, _, err := shadow.rebuildLocks(); err != nil {
+		return nil, err
+	}
+	rebuilt := shadow.lk.LockStates()
+	// revert the pending DDL metrics reported by the rebuilt locks.
+	for _, lock := range shadow.lk.Locks() {
+		if synced, _ := lock.IsSynced(); synced {
+			metrics.ReportDDLPending(lock.Task, metrics.DDLPendingSynced, metrics.DDLPendingNone)
+		} else {
+			metrics.ReportDDLPending(lock.Task, metrics.DDLPendingUnSynced, metrics.DDLPendingNone)
+		}
+	}
+
+	diff := optimism.DiffLockStates(rebuilt, o.lk.LockStates())
+	discrepancies := make([]Discrepancy, 0, len(diff.AddedLocks)+len(diff.RemovedLocks)+len(diff.ChangedLocks))
+	for _, id := range diff.RemovedLocks {
+		discrepancies = append(discrepancies, Discrepancy{LockID: id, Kind: DiscrepancyMissing})
+	}
+	for _, id := range diff.AddedLocks {
+		discrepancies = append(discrepancies, Discrepancy{LockID: id, Kind: DiscrepancyUnexpected})
+	}
+	for _, d := range diff.ChangedLocks {
+		discrepancies = append(discrepancies, Discrepancy{LockID: d.ID, Kind: DiscrepancyMismatched, Diff: d})
+	}
+	sort.SliceStable(discrepancies, func(i, j int) bool {
+		return discrepancies[i].LockID < discrepancies[j].LockID
+	})
+	if len(discrepancies) > 0 {
+		o.logger.Warn("the shard DDL locks in memory differ from etcd", zap.Int("discrepancies", len(discrepancies)))
+	}
+	return discrepancies, nil
+}
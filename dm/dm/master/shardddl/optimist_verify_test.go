@@ -0,0 +1,86 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shardddl
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb/parser"
+	"github.com/pingcap/tidb/parser/model"
+	"github.com/pingcap/tidb/util/mock"
+
+	"github.com/pingcap/tiflow/dm/pkg/shardddl/optimism"
+	"github.com/pingcap/tiflow/dm/pkg/terror"
+)
+
+func (t *testOptimist) TestOptimistVerifyAgainstEtcd(c *C) {
+	var (
+		o, store         = newMemOptimist()
+		task             = "task-test-optimist-verify-against-etcd"
+		source1          = "mysql-replica-1"
+		downSchema       = "foo"
+		downTable        = "bar"
+		lockID           = fmt.Sprintf("%s-`%s`.`%s`", task, downSchema, downTable)
+		st1              = optimism.NewSourceTables(task, source1)
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 222
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		i1               = optimism.NewInfo(task, source1, "foo", "bar-1", downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		table1           = fmt.Sprintf("%s-%s", source1, "`foo`.`bar-1`")
+	)
+
+	st1.AddTable("foo", "bar-1", downSchema, downTable)
+	st1.AddTable("foo", "bar-2", downSchema, downTable)
+
+	// not started.
+	_, err := o.VerifyAgainstEtcd()
+	c.Assert(terror.ErrMasterOptimistNotStarted.Equal(err), IsTrue)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startMemOptimist(c, ctx, o, store, st1)
+	defer o.Close()
+
+	// no discrepancies in the steady state.
+	rev := store.putInfo(i1)
+	c.Assert(o.WaitForRevision(ctx, rev), IsNil)
+	c.Assert(o.Locks(), HasKey, lockID)
+	discrepancies, err := o.VerifyAgainstEtcd()
+	c.Assert(err, IsNil)
+	c.Assert(discrepancies, HasLen, 0)
+	// nothing is written to the store by the verification.
+	op1, ok := store.getOperation(task, source1, "foo", "bar-1")
+	c.Assert(ok, IsTrue)
+	c.Assert(op1.Done, IsFalse)
+
+	// the table is marked done in memory only.
+	c.Assert(o.lk.FindLock(lockID).TryMarkDone(source1, "foo", "bar-1"), IsTrue)
+	discrepancies, err = o.VerifyAgainstEtcd()
+	c.Assert(err, IsNil)
+	c.Assert(discrepancies, HasLen, 1)
+	c.Assert(discrepancies[0].LockID, Equals, lockID)
+	c.Assert(discrepancies[0].Kind, Equals, DiscrepancyMismatched)
+	c.Assert(discrepancies[0].Diff.ChangedTables, DeepEquals, []string{table1})
+
+	// the lock is removed in memory only.
+	c.Assert(o.lk.RemoveLock(lockID), IsTrue)
+	discrepancies, err = o.VerifyAgainstEtcd()
+	c.Assert(err, IsNil)
+	c.Assert(discrepancies, DeepEquals, []Discrepancy{{LockID: lockID, Kind: DiscrepancyMissing}})
+}
@@ -721,14 +721,18 @@ func (m *ShowDDLLocksRequest) GetSources() []string {
 // DDL: DDL statement
 // synced: already synced dm-workers
 // unsynced: pending to sync dm-workers
+// advisories: non-blocking warnings for the optimistic mode, e.g. columns differ in default values
+// note: free-text note attached by operators, e.g. why the lock is stuck or being held
 type DDLLock struct {
-	ID       string   `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
-	Task     string   `protobuf:"bytes,2,opt,name=task,proto3" json:"task,omitempty"`
-	Mode     string   `protobuf:"bytes,3,opt,name=mode,proto3" json:"mode,omitempty"`
-	Owner    string   `protobuf:"bytes,4,opt,name=owner,proto3" json:"owner,omitempty"`
-	DDLs     []string `protobuf:"bytes,5,rep,name=DDLs,proto3" json:"DDLs,omitempty"`
-	Synced   []string `protobuf:"bytes,6,rep,name=synced,proto3" json:"synced,omitempty"`
-	Unsynced []string `protobuf:"bytes,7,rep,name=unsynced,proto3" json:"unsynced,omitempty"`
+	ID         string   `protobuf:"bytes,1,opt,name=ID,proto3" json:"ID,omitempty"`
+	Task       string   `protobuf:"bytes,2,opt,name=task,proto3" json:"task,omitempty"`
+	Mode       string   `protobuf:"bytes,3,opt,name=mode,proto3" json:"mode,omitempty"`
+	Owner      string   `protobuf:"bytes,4,opt,name=owner,proto3" json:"owner,omitempty"`
+	DDLs       []string `protobuf:"bytes,5,rep,name=DDLs,proto3" json:"DDLs,omitempty"`
+	Synced     []string `protobuf:"bytes,6,rep,name=synced,proto3" json:"synced,omitempty"`
+	Unsynced   []string `protobuf:"bytes,7,rep,name=unsynced,proto3" json:"unsynced,omitempty"`
+	Advisories []string `protobuf:"bytes,8,rep,name=advisories,proto3" json:"advisories,omitempty"`
+	Note       string   `protobuf:"bytes,9,opt,name=note,proto3" json:"note,omitempty"`
 }
 
 func (m *DDLLock) Reset()         { *m = DDLLock{} }
@@ -813,6 +817,20 @@ func (m *DDLLock) GetUnsynced() []string {
 	return nil
 }
 
+func (m *DDLLock) GetAdvisories() []string {
+	if m != nil {
+		return m.Advisories
+	}
+	return nil
+}
+
+func (m *DDLLock) GetNote() string {
+	if m != nil {
+		return m.Note
+	}
+	return ""
+}
+
 type ShowDDLLocksResponse struct {
 	Result bool       `protobuf:"varint,1,opt,name=result,proto3" json:"result,omitempty"`
 	Msg    string     `protobuf:"bytes,2,opt,name=msg,proto3" json:"msg,omitempty"`
@@ -3230,140 +3248,140 @@ func init() {
 func init() { proto.RegisterFile("dmmaster.proto", fileDescriptor_f9bef11f2a341f03) }
 
 var fileDescriptor_f9bef11f2a341f03 = []byte{
-	// 2120 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xcc, 0x59, 0x5f, 0x6f, 0xe3, 0xc6,
-	0x11, 0x17, 0x25, 0xff, 0x91, 0x47, 0xb6, 0x22, 0xaf, 0x65, 0x99, 0xc7, 0xf3, 0xe9, 0x9c, 0x6d,
-	0x12, 0x18, 0x46, 0x71, 0xc6, 0xb9, 0x7d, 0x0a, 0x90, 0x02, 0x39, 0xe9, 0x72, 0x31, 0xea, 0x8b,
-	0x53, 0xda, 0x97, 0x22, 0x28, 0x50, 0x94, 0x92, 0x56, 0xb2, 0x60, 0x8a, 0xe4, 0x91, 0x94, 0x5d,
-	0xe3, 0x90, 0x3e, 0xf4, 0xa9, 0x4f, 0xfd, 0x83, 0x14, 0xcd, 0x63, 0x1f, 0xfa, 0x4d, 0xfa, 0xd4,
-	0xc7, 0x00, 0x7d, 0xe9, 0x63, 0x71, 0xd7, 0x0f, 0x52, 0xec, 0xec, 0x2e, 0xb9, 0xa4, 0x28, 0xa7,
-	0x3a, 0xa0, 0x46, 0xde, 0x38, 0x33, 0xab, 0x99, 0xdf, 0xce, 0xcc, 0xce, 0xcc, 0xae, 0xa0, 0x3e,
-	0x98, 0x4c, 0x9c, 0x28, 0x66, 0xe1, 0xa3, 0x20, 0xf4, 0x63, 0x9f, 0x94, 0x83, 0x9e, 0x55, 0x1f,
-	0x4c, 0xae, 0xfd, 0xf0, 0x52, 0xf1, 0xac, 0xdd, 0x91, 0xef, 0x8f, 0x5c, 0x76, 0xe8, 0x04, 0xe3,
-	0x43, 0xc7, 0xf3, 0xfc, 0xd8, 0x89, 0xc7, 0xbe, 0x17, 0x09, 0x29, 0xfd, 0x0d, 0x34, 0xce, 0x62,
-	0x27, 0x8c, 0xcf, 0x9d, 0xe8, 0xd2, 0x66, 0x2f, 0xa7, 0x2c, 0x8a, 0x09, 0x81, 0xa5, 0xd8, 0x89,
-	0x2e, 0x4d, 0x63, 0xcf, 0xd8, 0x5f, 0xb3, 0xf1, 0x9b, 0x98, 0xb0, 0x1a, 0xf9, 0xd3, 0xb0, 0xcf,
-	0x22, 0xb3, 0xbc, 0x57, 0xd9, 0x5f, 0xb3, 0x15, 0x49, 0xda, 0x00, 0x21, 0x9b, 0xf8, 0x57, 0xec,
-	0x39, 0x8b, 0x1d, 0xb3, 0xb2, 0x67, 0xec, 0x57, 0x6d, 0x8d, 0x43, 0x76, 0x61, 0x2d, 0x42, 0x0b,
-	0xe3, 0x09, 0x33, 0x97, 0x50, 0x65, 0xca, 0xa0, 0x5f, 0x1b, 0xb0, 0xa9, 0x01, 0x88, 0x02, 0xdf,
-	0x8b, 0x18, 0x69, 0xc1, 0x4a, 0xc8, 0xa2, 0xa9, 0x1b, 0x23, 0x86, 0xaa, 0x2d, 0x29, 0xd2, 0x80,
-	0xca, 0x24, 0x1a, 0x99, 0x65, 0xd4, 0xc2, 0x3f, 0xc9, 0x51, 0x8a, 0xab, 0xb2, 0x57, 0xd9, 0xaf,
-	0x1d, 0x99, 0x8f, 0x82, 0xde, 0xa3, 0x8e, 0x3f, 0x99, 0xf8, 0xde, 0xcf, 0xd1, 0x0d, 0x4a, 0x69,
-	0x8a, 0x78, 0x0f, 0x6a, 0xfd, 0x0b, 0xd6, 0xe7, 0xe6, 0xb8, 0x09, 0x81, 0x49, 0x67, 0xd1, 0x5f,
-	0x02, 0x39, 0x0d, 0x58, 0xe8, 0xc4, 0x4c, 0xf7, 0x8b, 0x05, 0x65, 0x3f, 0x40, 0x44, 0xf5, 0x23,
-	0xe0, 0x66, 0xb8, 0xf0, 0x34, 0xb0, 0xcb, 0x7e, 0xc0, 0x7d, 0xe6, 0x39, 0x13, 0x26, 0xa1, 0xe1,
-	0xb7, 0xee, 0xb3, 0x4a, 0xc6, 0x67, 0xf4, 0x0f, 0x06, 0x6c, 0x65, 0x0c, 0xc8, 0x7d, 0xdf, 0x66,
-	0x21, 0xf5, 0x49, 0xb9, 0xc8, 0x27, 0x95, 0x42, 0x9f, 0x2c, 0xfd, 0x8f, 0x3e, 0xa1, 0x1f, 0xc3,
-	0xe6, 0x8b, 0x60, 0x90, 0xdb, 0xf0, 0x42, 0x89, 0x40, 0xff, 0x6c, 0x00, 0xd1, 0x75, 0x7c, 0x4f,
-	0x62, 0xf9, 0x09, 0xb4, 0x7e, 0x36, 0x65, 0xe1, 0xcd, 0x59, 0xec, 0xc4, 0xd3, 0xe8, 0x64, 0x1c,
-	0xc5, 0xda, 0xf6, 0x30, 0x66, 0x46, 0x71, 0xcc, 0x72, 0xdb, 0xbb, 0x82, 0x9d, 0x19, 0x3d, 0x0b,
-	0x6f, 0xf1, 0x71, 0x7e, 0x8b, 0x3b, 0x7c, 0x8b, 0x9a, 0xde, 0xd9, 0xc8, 0x74, 0x60, 0xeb, 0xec,
-	0xc2, 0xbf, 0xee, 0x76, 0x4f, 0x4e, 0xfc, 0xfe, 0x65, 0xf4, 0x76, 0xb1, 0xf9, 0xab, 0x01, 0xab,
-	0x52, 0x03, 0xa9, 0x43, 0xf9, 0xb8, 0x2b, 0x7f, 0x57, 0x3e, 0xee, 0x26, 0x9a, 0xca, 0x9a, 0x26,
-	0x02, 0x4b, 0x13, 0x7f, 0xc0, 0x64, 0x56, 0xe1, 0x37, 0x69, 0xc2, 0xb2, 0x7f, 0xed, 0xb1, 0x50,
-	0x3a, 0x59, 0x10, 0x7c, 0x65, 0xb7, 0x7b, 0x12, 0x99, 0xcb, 0x68, 0x10, 0xbf, 0xb9, 0x3f, 0xa2,
-	0x1b, 0xaf, 0xcf, 0x06, 0xe6, 0x0a, 0x72, 0x25, 0x45, 0x2c, 0xa8, 0x4e, 0x3d, 0x29, 0x59, 0x45,
-	0x49, 0x42, 0xd3, 0x3e, 0x34, 0xb3, 0xdb, 0x5c, 0xd8, 0xb7, 0xef, 0xc2, 0xb2, 0xcb, 0x7f, 0x2a,
-	0x3d, 0x5b, 0xe3, 0x9e, 0x95, 0xea, 0x6c, 0x21, 0xa1, 0x2e, 0x34, 0x5f, 0x78, 0xfc, 0x53, 0xf1,
-	0xa5, 0x33, 0xf3, 0x2e, 0xa1, 0xb0, 0x1e, 0xb2, 0xc0, 0x75, 0xfa, 0xec, 0x14, 0x77, 0x2c, 0xac,
-	0x64, 0x78, 0x3c, 0xf3, 0x86, 0x7e, 0xd8, 0x67, 0x36, 0x96, 0x3a, 0x59, 0xf8, 0x74, 0x16, 0xfd,
-	0x18, 0xb6, 0x73, 0xd6, 0x16, 0xdd, 0x13, 0xb5, 0xe1, 0x9e, 0xac, 0x13, 0xea, 0x00, 0xb8, 0xce,
-	0x8d, 0x42, 0x7d, 0x5f, 0xab, 0x16, 0xb8, 0x5b, 0x94, 0xca, 0x72, 0x31, 0x3f, 0x17, 0xbe, 0x31,
-	0xc0, 0x2a, 0x52, 0x2a, 0xc1, 0xdd, 0xaa, 0xf5, 0xff, 0x5b, 0x84, 0xbe, 0x31, 0x60, 0xe7, 0xf3,
-	0x69, 0x38, 0x2a, 0xda, 0xac, 0xb6, 0x1f, 0x23, 0xdb, 0x80, 0x2c, 0xa8, 0x8e, 0x3d, 0xa7, 0x1f,
-	0x8f, 0xaf, 0x98, 0x44, 0x95, 0xd0, 0x98, 0xdb, 0xbc, 0xef, 0x70, 0x60, 0x15, 0x1b, 0xbf, 0xf9,
-	0xfa, 0xe1, 0xd8, 0x65, 0x78, 0xf4, 0x45, 0x2a, 0x27, 0x34, 0x66, 0xee, 0xb4, 0xd7, 0x1d, 0x87,
-	0xe6, 0x32, 0x4a, 0x24, 0x45, 0x7f, 0x0d, 0xe6, 0x2c, 0xb0, 0xbb, 0x28, 0x70, 0xf4, 0x0a, 0x1a,
-	0x1d, 0x5e, 0xcd, 0xbe, 0xab, 0x2e, 0xb7, 0x60, 0x85, 0x85, 0x61, 0xc7, 0x13, 0x91, 0xa9, 0xd8,
-	0x92, 0xe2, 0x7e, 0xbb, 0x76, 0x42, 0x8f, 0x0b, 0x84, 0x13, 0x14, 0xf9, 0x1d, 0x8d, 0xf9, 0x23,
-	0xd8, 0xd4, 0xec, 0x2e, 0x9c, 0xb8, 0xbf, 0x33, 0xa0, 0x29, 0x93, 0xec, 0x0c, 0x77, 0xa2, 0xb0,
-	0xef, 0x6a, 0xe9, 0xb5, 0xce, 0xb7, 0x2f, 0xc4, 0x69, 0x7e, 0xf5, 0x7d, 0x6f, 0x38, 0x1e, 0xc9,
-	0xa4, 0x95, 0x14, 0x8f, 0x99, 0x70, 0xc8, 0x71, 0x57, 0xf6, 0xd2, 0x84, 0xe6, 0x03, 0x88, 0x18,
-	0x78, 0x3e, 0x4b, 0x23, 0xaa, 0x71, 0xe8, 0x14, 0xb6, 0x73, 0x48, 0xee, 0x24, 0x70, 0x4f, 0x61,
-	0xdb, 0x66, 0xa3, 0x31, 0x9f, 0xce, 0xd4, 0x92, 0x5b, 0xdb, 0x8e, 0x33, 0x18, 0x84, 0x2c, 0x8a,
-	0xa4, 0x59, 0x45, 0xd2, 0x27, 0xd0, 0xca, 0xab, 0x59, 0x38, 0x18, 0x3f, 0x81, 0xe6, 0xe9, 0x70,
-	0xe8, 0x8e, 0x3d, 0xf6, 0x9c, 0x4d, 0x7a, 0x19, 0x24, 0xf1, 0x4d, 0x90, 0x20, 0xe1, 0xdf, 0x45,
-	0x83, 0x0c, 0x2f, 0x64, 0xb9, 0xdf, 0x2f, 0x0c, 0xe1, 0xc7, 0x49, 0x3a, 0x9c, 0x30, 0x67, 0x90,
-	0x42, 0x98, 0x49, 0x07, 0x21, 0x16, 0xe9, 0x80, 0x86, 0xb3, 0xbf, 0x5a, 0xd8, 0xf0, 0xef, 0x0d,
-	0x80, 0xe7, 0x38, 0x23, 0x1f, 0x7b, 0x43, 0xbf, 0xd0, 0xf9, 0x16, 0x54, 0x27, 0xb8, 0xaf, 0xe3,
-	0x2e, 0xfe, 0x72, 0xc9, 0x4e, 0x68, 0xde, 0xf4, 0x1c, 0x77, 0x9c, 0xd4, 0x77, 0x41, 0xf0, 0x5f,
-	0x04, 0x8c, 0x85, 0x2f, 0xec, 0x13, 0x51, 0xdd, 0xd6, 0xec, 0x84, 0xe6, 0xe9, 0xd8, 0x77, 0xc7,
-	0xcc, 0x8b, 0x51, 0x2a, 0xda, 0xa2, 0xc6, 0xa1, 0x3d, 0x00, 0x11, 0xc8, 0xb9, 0x78, 0x08, 0x2c,
-	0xf1, 0xe8, 0xab, 0x10, 0xf0, 0x6f, 0x8e, 0x23, 0x8a, 0x9d, 0x91, 0xea, 0xc8, 0x82, 0xc0, 0x72,
-	0x85, 0xe9, 0x26, 0xd3, 0x5e, 0x52, 0xf4, 0x04, 0x1a, 0x7c, 0x40, 0x11, 0x4e, 0x13, 0x31, 0x53,
-	0xae, 0x31, 0xd2, 0xac, 0x2e, 0x9a, 0x59, 0x95, 0xed, 0x4a, 0x6a, 0x9b, 0x7e, 0x26, 0xb4, 0x09,
-	0x2f, 0xce, 0xd5, 0xb6, 0x0f, 0xab, 0xe2, 0x2e, 0x22, 0x1a, 0x4e, 0xed, 0xa8, 0xce, 0xc3, 0x99,
-	0xba, 0xde, 0x56, 0x62, 0xa5, 0x4f, 0x78, 0xe1, 0x36, 0x7d, 0xe2, 0x10, 0x67, 0xf4, 0xa5, 0xae,
-	0xb3, 0x95, 0x98, 0xfe, 0xcd, 0x80, 0x55, 0xa1, 0x26, 0x22, 0x8f, 0x60, 0xc5, 0xc5, 0x5d, 0xa3,
-	0xaa, 0xda, 0x51, 0x13, 0x73, 0x2a, 0xe7, 0x8b, 0x4f, 0x4b, 0xb6, 0x5c, 0xc5, 0xd7, 0x0b, 0x58,
-	0xe8, 0x05, 0x6d, 0xbd, 0xbe, 0x5b, 0xbe, 0x5e, 0xac, 0xe2, 0xeb, 0x85, 0x59, 0xf4, 0x90, 0xb6,
-	0x5e, 0xdf, 0x0d, 0x5f, 0x2f, 0x56, 0x3d, 0xa9, 0xc2, 0x8a, 0xc8, 0x25, 0xfa, 0x12, 0x36, 0x51,
-	0x6f, 0xe6, 0x04, 0xb6, 0x32, 0x70, 0xab, 0x09, 0xac, 0x56, 0x06, 0x56, 0x35, 0x31, 0xdf, 0xca,
-	0x98, 0xaf, 0x2a, 0x33, 0x3c, 0x3d, 0x78, 0xf8, 0x54, 0x36, 0x0a, 0x82, 0x32, 0x20, 0xba, 0xc9,
-	0x85, 0xcb, 0xde, 0xfb, 0xb0, 0x2a, 0xc0, 0x67, 0x66, 0x2a, 0xe9, 0x6a, 0x5b, 0xc9, 0xe8, 0x5f,
-	0xca, 0x69, 0xad, 0xef, 0x5f, 0xb0, 0x89, 0x33, 0xbf, 0xd6, 0xa3, 0x38, 0xbd, 0x32, 0xcd, 0xcc,
-	0x9d, 0x73, 0xaf, 0x4c, 0xfc, 0xc8, 0x0d, 0x9c, 0xd8, 0xe9, 0x39, 0x51, 0xd2, 0xb5, 0x15, 0xcd,
-	0x77, 0x1f, 0x3b, 0x3d, 0x97, 0xc9, 0xa6, 0x2d, 0x08, 0x3c, 0x1c, 0x68, 0xcf, 0x5c, 0x91, 0x87,
-	0x03, 0x29, 0xbe, 0x7a, 0xe8, 0x4e, 0xa3, 0x0b, 0x73, 0x55, 0x1c, 0x69, 0x24, 0x38, 0x1a, 0x3e,
-	0x89, 0x9a, 0x55, 0x64, 0xe2, 0x37, 0x3f, 0xca, 0xc3, 0xd0, 0x9f, 0x88, 0xb6, 0x61, 0xae, 0x89,
-	0xab, 0x6d, 0xca, 0x51, 0xf2, 0x73, 0x27, 0x1c, 0xb1, 0xd8, 0x84, 0x54, 0x2e, 0x38, 0x7a, 0xe7,
-	0x91, 0x7e, 0xb9, 0x93, 0xce, 0x73, 0x00, 0xcd, 0x67, 0x2c, 0x3e, 0x9b, 0xf6, 0x78, 0xef, 0xee,
-	0x0c, 0x47, 0xb7, 0x34, 0x1e, 0xfa, 0x02, 0xb6, 0x73, 0x6b, 0x17, 0x86, 0x48, 0x60, 0xa9, 0x3f,
-	0x1c, 0xa9, 0x80, 0xe1, 0x37, 0xed, 0xc2, 0xc6, 0x33, 0x16, 0x6b, 0xb6, 0x1f, 0x6a, 0xad, 0x46,
-	0xce, 0x95, 0x9d, 0xe1, 0xe8, 0xfc, 0x26, 0x60, 0xb7, 0xf4, 0x9d, 0x13, 0xa8, 0x2b, 0x2d, 0x0b,
-	0xa3, 0x6a, 0x40, 0xa5, 0x3f, 0x4c, 0x26, 0xd2, 0xfe, 0x70, 0x44, 0xb7, 0x61, 0xeb, 0x19, 0x93,
-	0xe7, 0x3a, 0x45, 0x46, 0xf7, 0xd1, 0x5b, 0x1a, 0x5b, 0x9a, 0x92, 0x0a, 0x8c, 0x54, 0xc1, 0x9f,
-	0x0c, 0x20, 0x9f, 0x3a, 0xde, 0xc0, 0x65, 0x4f, 0xc3, 0xd0, 0x0f, 0xe7, 0x8e, 0xe1, 0x28, 0x7d,
-	0xab, 0x24, 0xdf, 0x85, 0xb5, 0xde, 0xd8, 0x73, 0xfd, 0xd1, 0xe7, 0x7e, 0xa4, 0x46, 0xb2, 0x84,
-	0x81, 0x29, 0xfa, 0xd2, 0x4d, 0xae, 0x5a, 0xfc, 0x9b, 0x46, 0xb0, 0x95, 0x81, 0x74, 0x27, 0x09,
-	0xf6, 0x0c, 0xb6, 0xcf, 0x43, 0xc7, 0x8b, 0x86, 0x2c, 0xcc, 0x0e, 0x77, 0x69, 0x3f, 0x32, 0xf4,
-	0x7e, 0xa4, 0x95, 0x2d, 0x61, 0x59, 0x52, 0x7c, 0xb8, 0xc9, 0x2b, 0x5a, 0xb8, 0xc1, 0x0f, 0x92,
-	0xa7, 0x94, 0xcc, 0x7d, 0xe1, 0x81, 0x16, 0x95, 0x0d, 0xed, 0x1a, 0xf3, 0xc5, 0x91, 0x1a, 0x34,
-	0x25, 0xd2, 0xf2, 0x1c, 0xa4, 0x22, 0x34, 0x0a, 0x69, 0x9c, 0x94, 0xb8, 0x3b, 0x1c, 0xfe, 0x0f,
-	0x7a, 0x50, 0x55, 0xe3, 0x31, 0xd9, 0x82, 0x77, 0x8e, 0xbd, 0x2b, 0xc7, 0x1d, 0x0f, 0x14, 0xab,
-	0x51, 0x22, 0xef, 0x40, 0x0d, 0x5f, 0xcf, 0x04, 0xab, 0x61, 0x90, 0x06, 0xac, 0x8b, 0x37, 0x18,
-	0xc9, 0x29, 0x93, 0x3a, 0xc0, 0x59, 0xec, 0x07, 0x92, 0xae, 0x20, 0x7d, 0xe1, 0x5f, 0x4b, 0x7a,
-	0xe9, 0xe0, 0xa7, 0x50, 0x55, 0x33, 0x97, 0x66, 0x43, 0xb1, 0x1a, 0x25, 0xb2, 0x09, 0x1b, 0x4f,
-	0xaf, 0xc6, 0xfd, 0x38, 0x61, 0x19, 0x64, 0x07, 0xb6, 0x3a, 0x8e, 0xd7, 0x67, 0x6e, 0x56, 0x50,
-	0x3e, 0xf0, 0x60, 0x55, 0x1e, 0x6b, 0x0e, 0x4d, 0xea, 0xe2, 0x64, 0xa3, 0x44, 0xd6, 0xa1, 0xca,
-	0x8b, 0x0c, 0x52, 0x06, 0x87, 0x21, 0xce, 0x1c, 0xd2, 0x08, 0x53, 0x78, 0x01, 0x69, 0x01, 0x13,
-	0x21, 0x22, 0xbd, 0x44, 0x9a, 0xd0, 0xc0, 0x5f, 0xb3, 0x49, 0xe0, 0x3a, 0xb1, 0xe0, 0x2e, 0x1f,
-	0x74, 0x61, 0x2d, 0x89, 0x2b, 0x5f, 0x22, 0x2d, 0x26, 0xbc, 0x46, 0x89, 0x7b, 0x04, 0x5d, 0x84,
-	0xbc, 0x2f, 0x8e, 0x1a, 0x86, 0x70, 0x9a, 0x1f, 0x28, 0x46, 0xf9, 0xe8, 0xef, 0x75, 0x58, 0x11,
-	0x60, 0xc8, 0x97, 0xb0, 0x96, 0x3c, 0x47, 0x12, 0x6c, 0xee, 0xf9, 0xe7, 0x51, 0x6b, 0x3b, 0xc7,
-	0x15, 0x41, 0xa3, 0x0f, 0x7f, 0xfb, 0xcf, 0xff, 0x7c, 0x5d, 0xbe, 0x47, 0x9b, 0x87, 0x4e, 0x30,
-	0x8e, 0x0e, 0xaf, 0x1e, 0x3b, 0x6e, 0x70, 0xe1, 0x3c, 0x3e, 0xe4, 0x47, 0x3e, 0xfa, 0xd0, 0x38,
-	0x20, 0x43, 0xa8, 0x69, 0x6f, 0x7e, 0xa4, 0xc5, 0xd5, 0xcc, 0xbe, 0x32, 0x5a, 0x3b, 0x33, 0x7c,
-	0x69, 0xe0, 0x03, 0x34, 0xb0, 0x67, 0xdd, 0x2f, 0x32, 0x70, 0xf8, 0x8a, 0x57, 0xcc, 0xaf, 0xb8,
-	0x9d, 0x8f, 0x00, 0xd2, 0x67, 0x38, 0x82, 0x68, 0x67, 0x9e, 0xf6, 0xac, 0x56, 0x9e, 0x2d, 0x8d,
-	0x94, 0x88, 0x0b, 0x35, 0xed, 0x3d, 0x8a, 0x58, 0xb9, 0x07, 0x2a, 0xed, 0x01, 0xcd, 0xba, 0x5f,
-	0x28, 0x93, 0x9a, 0xde, 0x43, 0xb8, 0x6d, 0xb2, 0x9b, 0x83, 0x1b, 0xe1, 0x52, 0x89, 0x97, 0x74,
-	0x60, 0x5d, 0x7f, 0xf6, 0x21, 0xb8, 0xfb, 0x82, 0xf7, 0x2e, 0xcb, 0x9c, 0x15, 0x24, 0x90, 0x3f,
-	0x81, 0x8d, 0xcc, 0x43, 0x0b, 0xc1, 0xc5, 0x45, 0x2f, 0x3d, 0xd6, 0xbd, 0x02, 0x49, 0xa2, 0xe7,
-	0x4b, 0x68, 0xcd, 0x3e, 0x8c, 0xa0, 0x17, 0x1f, 0x68, 0x41, 0x99, 0x7d, 0x9c, 0xb0, 0xda, 0xf3,
-	0xc4, 0x89, 0xea, 0x53, 0x68, 0xe4, 0x1f, 0x10, 0x08, 0xba, 0x6f, 0xce, 0x7b, 0x87, 0xb5, 0x5b,
-	0x2c, 0x4c, 0x14, 0x7e, 0x08, 0x6b, 0xc9, 0xfd, 0x5c, 0x24, 0x6a, 0xfe, 0x99, 0x40, 0x24, 0xea,
-	0xcc, 0x25, 0x9e, 0x96, 0xc8, 0x08, 0x36, 0x32, 0x37, 0x62, 0xe1, 0xaf, 0xa2, 0xeb, 0xba, 0xf0,
-	0x57, 0xe1, 0xf5, 0x99, 0xbe, 0x8b, 0x01, 0xbe, 0x6f, 0xb5, 0xf2, 0x01, 0x16, 0xc5, 0x8b, 0xa7,
-	0xe2, 0x31, 0xd4, 0xb3, 0x97, 0x57, 0x72, 0x4f, 0x94, 0xe2, 0x82, 0x7b, 0xb1, 0x65, 0x15, 0x89,
-	0x12, 0xcc, 0x21, 0x6c, 0x64, 0xee, 0xa0, 0x12, 0x73, 0xc1, 0xb5, 0x56, 0x62, 0x2e, 0xba, 0xb0,
-	0xd2, 0x1f, 0x22, 0xe6, 0x0f, 0x0e, 0xde, 0xcb, 0x61, 0x96, 0xa3, 0xec, 0xe1, 0x2b, 0x3e, 0x8b,
-	0x7c, 0xa5, 0x92, 0xf3, 0x32, 0xf1, 0x93, 0x28, 0x71, 0x19, 0x3f, 0x65, 0xee, 0xb1, 0x19, 0x3f,
-	0x65, 0xef, 0xaa, 0xf4, 0x7d, 0xb4, 0xf9, 0xd0, 0xb2, 0x72, 0x36, 0xc5, 0xa8, 0x7f, 0xf8, 0xca,
-	0x0f, 0xf0, 0xd8, 0xfe, 0x02, 0x20, 0x1d, 0xd6, 0xc5, 0xb1, 0x9d, 0xb9, 0x2f, 0x88, 0x63, 0x3b,
-	0x3b, 0xd3, 0xd3, 0x36, 0xda, 0x30, 0x49, 0xab, 0x78, 0x5f, 0x64, 0x98, 0x46, 0x5c, 0x0c, 0xc1,
-	0x99, 0x88, 0xeb, 0x43, 0x7b, 0x36, 0xe2, 0x99, 0xb1, 0x95, 0xee, 0xa1, 0x15, 0xcb, 0xda, 0xce,
-	0x47, 0x1c, 0x97, 0xf1, 0x4d, 0xb8, 0x38, 0xf7, 0xa5, 0xe3, 0xa4, 0xb0, 0x53, 0x34, 0x8d, 0x0a,
-	0x3b, 0x85, 0xb3, 0xa7, 0xaa, 0x74, 0xa4, 0x9d, 0xb7, 0x33, 0xed, 0xe9, 0xc5, 0x8e, 0x9c, 0xc3,
-	0x8a, 0x98, 0x0f, 0xc9, 0xa6, 0x54, 0xa6, 0xe9, 0x27, 0x3a, 0x4b, 0x2a, 0xfe, 0x01, 0x2a, 0x7e,
-	0x40, 0x6e, 0x2b, 0xa1, 0xe4, 0x57, 0x50, 0xd3, 0x46, 0x2a, 0x51, 0xa7, 0x67, 0xc7, 0x3e, 0x51,
-	0xa7, 0x0b, 0x66, 0xaf, 0xb9, 0x5e, 0x62, 0x7c, 0x15, 0x1e, 0x8b, 0x0e, 0xac, 0xeb, 0x23, 0xa7,
-	0x28, 0x7a, 0x05, 0xb3, 0xa9, 0x65, 0xce, 0x0a, 0x92, 0x03, 0x71, 0x0c, 0xf5, 0xec, 0xec, 0x24,
-	0xce, 0x56, 0xe1, 0x60, 0x26, 0xce, 0x56, 0xf1, 0xa8, 0x45, 0x4b, 0x1c, 0x8f, 0x3e, 0xdc, 0x10,
-	0xbd, 0x05, 0x65, 0x8a, 0x92, 0x39, 0x2b, 0x50, 0x4a, 0x9e, 0x98, 0xff, 0x78, 0xdd, 0x36, 0xbe,
-	0x7d, 0xdd, 0x36, 0xfe, 0xfd, 0xba, 0x6d, 0xfc, 0xf1, 0x4d, 0xbb, 0xf4, 0xed, 0x9b, 0x76, 0xe9,
-	0x5f, 0x6f, 0xda, 0xa5, 0xde, 0x0a, 0xfe, 0xd5, 0xf8, 0xa3, 0xff, 0x06, 0x00, 0x00, 0xff, 0xff,
-	0xa6, 0x01, 0xc1, 0xf0, 0xae, 0x1c, 0x00, 0x00,
+	// 2125 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x03, 0xcd, 0x59, 0x5f, 0x6f, 0x1b, 0xc7,
+	0x11, 0xf7, 0x91, 0xb2, 0x44, 0x0d, 0x2d, 0x45, 0x5a, 0x49, 0x14, 0x7d, 0x96, 0x65, 0xe5, 0x9a,
+	0x04, 0x86, 0x50, 0x58, 0xb0, 0xda, 0xa7, 0x00, 0x29, 0x50, 0x4b, 0x4e, 0x62, 0x54, 0x89, 0x53,
+	0x4a, 0x6e, 0x11, 0x14, 0x28, 0x7a, 0x24, 0x97, 0x34, 0xe1, 0xe3, 0x1d, 0x7d, 0x77, 0x94, 0x6b,
+	0x18, 0xe9, 0x43, 0x9f, 0xfa, 0xd4, 0x3f, 0x48, 0xd1, 0x7e, 0x80, 0x7e, 0x93, 0x3e, 0xf5, 0x31,
+	0x40, 0x5e, 0xfa, 0x58, 0xb4, 0xfd, 0x20, 0x9d, 0x9d, 0xd9, 0xbd, 0xdb, 0x3b, 0x1e, 0x95, 0x32,
+	0x40, 0x85, 0x3e, 0x10, 0xd8, 0x99, 0xd9, 0x9b, 0xf9, 0xed, 0xcc, 0xec, 0xec, 0xec, 0x12, 0xd6,
+	0xfb, 0xe3, 0xb1, 0x9f, 0xa4, 0x32, 0x7e, 0x30, 0x89, 0xa3, 0x34, 0x12, 0xb5, 0x49, 0xd7, 0x45,
+	0xde, 0xab, 0x28, 0x7e, 0x61, 0x78, 0xee, 0xde, 0x30, 0x8a, 0x86, 0x81, 0x3c, 0xf2, 0x27, 0xa3,
+	0x23, 0x3f, 0x0c, 0xa3, 0xd4, 0x4f, 0x47, 0x51, 0x98, 0xb0, 0xd4, 0xfb, 0x15, 0x6c, 0x9c, 0xa7,
+	0x7e, 0x9c, 0x5e, 0xf8, 0xc9, 0x8b, 0x8e, 0x7c, 0x39, 0x95, 0x49, 0x2a, 0x04, 0x2c, 0xa5, 0x48,
+	0xb6, 0x9d, 0x03, 0xe7, 0xfe, 0x6a, 0x87, 0xc6, 0xa2, 0x0d, 0x2b, 0x49, 0x34, 0x8d, 0x7b, 0x32,
+	0x69, 0xd7, 0x0e, 0xea, 0xc8, 0x36, 0xa4, 0xd8, 0x07, 0x88, 0xe5, 0x38, 0xba, 0x94, 0x9f, 0xc8,
+	0xd4, 0x6f, 0xd7, 0xf1, 0x9b, 0x46, 0xc7, 0xe2, 0x88, 0x3d, 0x58, 0x4d, 0xc8, 0xc2, 0x68, 0x2c,
+	0xdb, 0x4b, 0xa4, 0x32, 0x67, 0x78, 0x5f, 0x3a, 0xb0, 0x69, 0x01, 0x48, 0x26, 0x08, 0x4d, 0x8a,
+	0x16, 0x2c, 0xc7, 0x32, 0x99, 0x06, 0x29, 0x61, 0x68, 0x74, 0x34, 0x25, 0x36, 0xa0, 0x3e, 0x4e,
+	0x86, 0x88, 0x40, 0x69, 0x51, 0x43, 0x71, 0x9c, 0xe3, 0xaa, 0x23, 0xae, 0xe6, 0x71, 0xfb, 0xc1,
+	0xa4, 0xfb, 0xe0, 0x24, 0x1a, 0x8f, 0xa3, 0xf0, 0xa7, 0xe4, 0x06, 0xa3, 0x34, 0x47, 0x7c, 0x00,
+	0xcd, 0xde, 0x73, 0xd9, 0x53, 0xe6, 0x94, 0x09, 0xc6, 0x64, 0xb3, 0xbc, 0x9f, 0x83, 0x78, 0x3a,
+	0x91, 0xb1, 0x9f, 0x4a, 0xdb, 0x2f, 0x2e, 0xd4, 0xa2, 0x09, 0x21, 0x5a, 0x3f, 0x06, 0x65, 0x46,
+	0x09, 0x9f, 0x4e, 0x3a, 0xc8, 0x55, 0x3e, 0x0b, 0x7d, 0x5c, 0x20, 0x43, 0xa3, 0xb1, 0xed, 0xb3,
+	0x7a, 0xc1, 0x67, 0xde, 0xef, 0x1c, 0xd8, 0x2a, 0x18, 0xd0, 0xeb, 0xbe, 0xca, 0x42, 0xee, 0x93,
+	0x5a, 0x95, 0x4f, 0xea, 0x95, 0x3e, 0x59, 0xfa, 0x2f, 0x7d, 0xe2, 0xfd, 0x10, 0x36, 0x9f, 0x4d,
+	0xfa, 0xa5, 0x05, 0x2f, 0x94, 0x08, 0xde, 0x1f, 0x1d, 0x10, 0xb6, 0x8e, 0xff, 0x93, 0x58, 0x7e,
+	0x08, 0xad, 0x1f, 0x4f, 0x65, 0xfc, 0x1a, 0xb3, 0x2c, 0x9d, 0x26, 0x67, 0xa3, 0x24, 0xb5, 0x96,
+	0x47, 0x31, 0x73, 0xaa, 0x63, 0x56, 0x5a, 0xde, 0x25, 0xec, 0xce, 0xe8, 0x59, 0x78, 0x89, 0x0f,
+	0xcb, 0x4b, 0xdc, 0x55, 0x4b, 0xb4, 0xf4, 0xce, 0x46, 0xe6, 0x04, 0xb6, 0xce, 0x9f, 0x47, 0xaf,
+	0x4e, 0x4f, 0xcf, 0xce, 0xa2, 0xde, 0x8b, 0xe4, 0xdb, 0xc5, 0xe6, 0x6b, 0x07, 0x56, 0xb4, 0x06,
+	0xb1, 0x0e, 0xb5, 0x27, 0xa7, 0xfa, 0x3b, 0x1c, 0x65, 0x9a, 0x6a, 0x96, 0x26, 0xe4, 0x8d, 0xa3,
+	0xbe, 0xd4, 0x59, 0x45, 0x63, 0xb1, 0x0d, 0x37, 0xa3, 0x57, 0xa1, 0x8c, 0xb5, 0x93, 0x99, 0x50,
+	0x33, 0x51, 0x71, 0xd2, 0xbe, 0x49, 0x06, 0x69, 0xac, 0xfc, 0x91, 0xbc, 0x0e, 0x7b, 0xb2, 0xdf,
+	0x5e, 0x26, 0xae, 0xa6, 0x30, 0xbd, 0x1b, 0xd3, 0x50, 0x4b, 0x56, 0x48, 0x92, 0xd1, 0xaa, 0x8c,
+	0xf8, 0xfd, 0xcb, 0x51, 0x12, 0xc5, 0x23, 0x84, 0xdf, 0x20, 0xa9, 0xc5, 0xa1, 0x60, 0x45, 0xa9,
+	0x6c, 0xaf, 0xea, 0x60, 0xe1, 0xd8, 0xeb, 0xc1, 0x76, 0xd1, 0x35, 0x0b, 0xc7, 0xe3, 0x6d, 0xb8,
+	0x19, 0xa8, 0x4f, 0x75, 0x34, 0x9a, 0x2a, 0x1a, 0x5a, 0x5d, 0x87, 0x25, 0x5e, 0x00, 0xdb, 0xcf,
+	0x42, 0x35, 0x34, 0x7c, 0x1d, 0x80, 0xb2, 0x1b, 0x3d, 0xb8, 0x15, 0xcb, 0x49, 0xe0, 0xf7, 0xe4,
+	0x53, 0xf2, 0x12, 0x5b, 0x29, 0xf0, 0x54, 0xb6, 0x0e, 0x22, 0x0c, 0x48, 0x87, 0xca, 0xa3, 0x2e,
+	0x96, 0x36, 0x0b, 0xf7, 0xe1, 0x4e, 0xc9, 0xda, 0xa2, 0x6b, 0xf2, 0x3a, 0x70, 0x5b, 0xd7, 0x16,
+	0xb3, 0x69, 0x02, 0xff, 0xb5, 0x41, 0x7d, 0xc7, 0xaa, 0x30, 0xb4, 0x5a, 0x92, 0xea, 0x12, 0x33,
+	0x3f, 0x7f, 0xfe, 0xec, 0x80, 0x5b, 0xa5, 0x54, 0x83, 0xbb, 0x52, 0xeb, 0xff, 0xb6, 0x70, 0x21,
+	0xb2, 0xdd, 0xcf, 0xa6, 0xf1, 0xb0, 0x6a, 0xb1, 0xd6, 0x7a, 0x9c, 0xe2, 0xa1, 0x85, 0x99, 0x38,
+	0x0a, 0xfd, 0x5e, 0x3a, 0xba, 0x94, 0x1a, 0x55, 0x46, 0xd3, 0x7e, 0x50, 0x67, 0x95, 0x02, 0x56,
+	0xef, 0xd0, 0x58, 0xcd, 0x1f, 0x8c, 0x02, 0x49, 0xe5, 0x82, 0xd3, 0x3f, 0xa3, 0x29, 0xdb, 0xa7,
+	0xdd, 0xd3, 0x51, 0x8c, 0x7b, 0xc0, 0xa1, 0x6c, 0x27, 0xca, 0xfb, 0x25, 0xb4, 0x67, 0x81, 0x5d,
+	0x47, 0x51, 0xc4, 0x52, 0xb5, 0x71, 0xa2, 0x2a, 0xe0, 0x37, 0xd5, 0x72, 0x44, 0x21, 0xe3, 0xf8,
+	0x24, 0xe4, 0xc8, 0xd4, 0x3b, 0x9a, 0x52, 0x7e, 0x7b, 0xe5, 0xc7, 0xa1, 0x12, 0xb0, 0x13, 0x0c,
+	0xf9, 0x0d, 0x87, 0xf9, 0x07, 0xb0, 0x69, 0xd9, 0x5d, 0x38, 0x71, 0x7f, 0xe3, 0xc0, 0xb6, 0x4e,
+	0xb2, 0x73, 0x5a, 0x89, 0xc1, 0xbe, 0x67, 0xa5, 0xd7, 0x2d, 0xb5, 0x7c, 0x16, 0xe7, 0xf9, 0xd5,
+	0x8b, 0xc2, 0xc1, 0x68, 0xa8, 0x93, 0x56, 0x53, 0x2a, 0x66, 0xec, 0x10, 0xdc, 0xa6, 0x7c, 0xfe,
+	0x66, 0xb4, 0xaa, 0x36, 0xdc, 0x24, 0x7d, 0x9a, 0x47, 0xd4, 0xe2, 0x78, 0x53, 0xd8, 0x29, 0x21,
+	0xb9, 0x96, 0xc0, 0x3d, 0x86, 0x9d, 0x8e, 0x1c, 0x8e, 0x54, 0x47, 0x67, 0xa6, 0x5c, 0x79, 0x54,
+	0xf9, 0xfd, 0x3e, 0xda, 0x4f, 0xb4, 0x59, 0x43, 0x7a, 0x8f, 0xa0, 0x55, 0x56, 0xb3, 0x70, 0x30,
+	0x7e, 0x80, 0xb1, 0x18, 0x0c, 0x82, 0x51, 0x88, 0x5d, 0xdc, 0xb8, 0x5b, 0x40, 0x92, 0xbe, 0x9e,
+	0x64, 0x48, 0xd4, 0xb8, 0xaa, 0xf9, 0x51, 0x85, 0xac, 0xf4, 0xfd, 0xc2, 0x10, 0xbe, 0x9f, 0xa5,
+	0xc3, 0x99, 0xf4, 0xfb, 0x39, 0x84, 0x99, 0x74, 0x60, 0x31, 0xa7, 0x03, 0x19, 0x2e, 0x7e, 0xb5,
+	0xb0, 0xe1, 0xdf, 0x3a, 0x00, 0x9f, 0x50, 0x5f, 0xfd, 0x24, 0x1c, 0x44, 0x95, 0xce, 0xc7, 0xe4,
+	0x1a, 0xd3, 0xba, 0x30, 0xb9, 0xd4, 0x97, 0x4b, 0x9d, 0x8c, 0x56, 0x07, 0xa5, 0x1f, 0x8c, 0xb2,
+	0xfa, 0xce, 0x84, 0xfa, 0x62, 0x22, 0x65, 0xfc, 0xac, 0x73, 0xc6, 0xd5, 0x0d, 0xd3, 0xd1, 0xd0,
+	0x2a, 0x1d, 0x7b, 0xc1, 0x48, 0x86, 0x29, 0x49, 0xf9, 0x28, 0xb5, 0x38, 0x5e, 0x17, 0x80, 0x03,
+	0x39, 0x17, 0x0f, 0xf2, 0x54, 0xf4, 0x4d, 0x08, 0xd4, 0x58, 0xe1, 0xc0, 0xbd, 0x39, 0x34, 0xa7,
+	0x38, 0x13, 0x54, 0xae, 0x28, 0xdd, 0x74, 0xda, 0x6b, 0xca, 0x3b, 0x83, 0x0d, 0xd5, 0xd4, 0xb0,
+	0xd3, 0x38, 0x66, 0xc6, 0x35, 0x4e, 0x9e, 0xd5, 0x55, 0x7d, 0xae, 0xb1, 0x5d, 0xcf, 0x6d, 0x7b,
+	0x9f, 0xb2, 0x36, 0xf6, 0xe2, 0x5c, 0x6d, 0xf7, 0x61, 0x85, 0xef, 0x2f, 0x7c, 0xe0, 0x34, 0x8f,
+	0xd7, 0x55, 0x38, 0x73, 0xd7, 0x77, 0x8c, 0xd8, 0xe8, 0x63, 0x2f, 0x5c, 0xa5, 0x8f, 0x37, 0x71,
+	0x41, 0x5f, 0xee, 0xba, 0x8e, 0x11, 0x7b, 0x7f, 0xc1, 0x86, 0x88, 0xd5, 0x24, 0xe2, 0x01, 0x2c,
+	0x07, 0xb4, 0x6a, 0x52, 0xd5, 0x3c, 0xde, 0xa6, 0x9c, 0x2a, 0xf9, 0xe2, 0xe3, 0x1b, 0x1d, 0x3d,
+	0x4b, 0xcd, 0x67, 0x58, 0xe4, 0x05, 0x6b, 0xbe, 0xbd, 0x5a, 0x35, 0x9f, 0x67, 0xa9, 0xf9, 0x6c,
+	0x96, 0x3c, 0x64, 0xcd, 0xb7, 0x57, 0xa3, 0xe6, 0xf3, 0xac, 0x47, 0x0d, 0xd4, 0x4f, 0x3c, 0xef,
+	0x25, 0x6c, 0x92, 0xde, 0xc2, 0x0e, 0x6c, 0x15, 0xe0, 0x36, 0x32, 0x58, 0xad, 0x02, 0xac, 0x46,
+	0x66, 0xbe, 0x55, 0x30, 0xdf, 0x30, 0x66, 0x54, 0x7a, 0xa8, 0xf0, 0x99, 0x6c, 0x64, 0xc2, 0x93,
+	0x20, 0x6c, 0x93, 0x0b, 0x97, 0xbd, 0x77, 0x31, 0xa4, 0xec, 0x57, 0xbb, 0xa7, 0xd2, 0xae, 0xee,
+	0x18, 0x99, 0xf7, 0xa7, 0x5a, 0x5e, 0xeb, 0xb1, 0x5b, 0x1f, 0xfb, 0xf3, 0x6b, 0x3d, 0x89, 0xf3,
+	0x6b, 0xd6, 0x4c, 0xaf, 0x3a, 0xf7, 0x9a, 0xa5, 0xb6, 0x1c, 0x5e, 0x47, 0xfc, 0xae, 0x9f, 0x64,
+	0xa7, 0xb6, 0xa1, 0xd5, 0xea, 0x71, 0x14, 0x48, 0x7d, 0x68, 0x33, 0x41, 0x9b, 0x83, 0xec, 0x61,
+	0xe7, 0xca, 0x9b, 0x83, 0x28, 0x35, 0x7b, 0x10, 0x4c, 0x93, 0xe7, 0xd8, 0xb6, 0xd2, 0x96, 0x26,
+	0x42, 0xa1, 0x51, 0xdd, 0x2b, 0x76, 0xab, 0x8a, 0x49, 0x63, 0xb5, 0x95, 0x07, 0x71, 0x34, 0xe6,
+	0x63, 0x83, 0xba, 0x55, 0xbc, 0x0e, 0xe7, 0x1c, 0x23, 0xbf, 0xf0, 0xb1, 0x33, 0x48, 0xdb, 0x90,
+	0xcb, 0x99, 0x63, 0x9f, 0x3c, 0xda, 0x2f, 0xd7, 0x72, 0xf2, 0x1c, 0xc2, 0xf6, 0x47, 0x32, 0x3d,
+	0x9f, 0x76, 0xd5, 0xd9, 0x7d, 0x32, 0x18, 0x5e, 0x71, 0xf0, 0x78, 0xcf, 0x60, 0xa7, 0x34, 0x77,
+	0x61, 0x88, 0xa8, 0xb6, 0x37, 0x18, 0x9a, 0x80, 0xd1, 0xd8, 0x3b, 0x85, 0x35, 0x54, 0x6b, 0xd9,
+	0xbe, 0x67, 0x1d, 0x35, 0xba, 0xaf, 0x44, 0xe9, 0x05, 0xb2, 0xae, 0x38, 0x77, 0xce, 0x60, 0xdd,
+	0x68, 0x59, 0x18, 0x15, 0x72, 0x10, 0x89, 0xe9, 0x48, 0x71, 0xe8, 0xed, 0xc0, 0x16, 0x6a, 0xe3,
+	0x7d, 0x9d, 0x23, 0xf3, 0xee, 0x93, 0xb7, 0x2c, 0xb6, 0x36, 0xa5, 0x15, 0x38, 0xb9, 0x82, 0x3f,
+	0xe0, 0xa5, 0xf8, 0x63, 0x3f, 0xec, 0x07, 0xf2, 0x71, 0x1c, 0x47, 0xf1, 0xdc, 0x36, 0x9c, 0xa4,
+	0xdf, 0x2a, 0xc9, 0xb1, 0x25, 0xeb, 0x8e, 0xf0, 0xca, 0x30, 0xfc, 0x2c, 0x4a, 0x4c, 0x4b, 0x96,
+	0x31, 0x28, 0x45, 0x5f, 0x06, 0xd9, 0xf5, 0x4c, 0x8d, 0xbd, 0x04, 0xb6, 0x0a, 0x90, 0xae, 0x25,
+	0xc1, 0x3e, 0x82, 0x9d, 0x8b, 0xd8, 0x0f, 0x93, 0x81, 0x8c, 0x8b, 0xcd, 0x5d, 0x7e, 0x1e, 0x39,
+	0xf6, 0x79, 0x64, 0x95, 0x2d, 0xb6, 0xac, 0x29, 0xd5, 0xdc, 0x94, 0x15, 0x2d, 0x7c, 0xc0, 0xf7,
+	0xb3, 0xe7, 0x97, 0xc2, 0x7d, 0xe1, 0xae, 0x15, 0x95, 0x35, 0xeb, 0x1a, 0xf3, 0x93, 0x63, 0xd3,
+	0x68, 0x6a, 0xa4, 0xb5, 0x39, 0x48, 0x39, 0x34, 0x06, 0x69, 0x9a, 0x95, 0xb8, 0x6b, 0x6c, 0xfe,
+	0x0f, 0xbb, 0xd0, 0x30, 0xed, 0xb1, 0xd8, 0x82, 0xb7, 0x9e, 0x84, 0x97, 0xd8, 0x7f, 0xf4, 0x0d,
+	0x6b, 0xe3, 0x86, 0x78, 0x0b, 0x9a, 0xf4, 0xe2, 0xc6, 0xac, 0x0d, 0x07, 0xed, 0xde, 0xe2, 0x77,
+	0x1b, 0xcd, 0xa9, 0xe1, 0xdd, 0x16, 0xce, 0xd3, 0x68, 0xa2, 0xe9, 0x3a, 0xd1, 0x78, 0xd1, 0xd6,
+	0xf4, 0xd2, 0xe1, 0x8f, 0xa0, 0x61, 0x7a, 0x2e, 0xcb, 0x86, 0x61, 0xa1, 0x8d, 0x4d, 0x58, 0x7b,
+	0x7c, 0x39, 0xea, 0xa5, 0x19, 0xcb, 0x11, 0xbb, 0xb0, 0x75, 0xe2, 0xe3, 0x55, 0x3f, 0x28, 0x0a,
+	0x6a, 0x87, 0x21, 0xac, 0xe8, 0x6d, 0xad, 0xa0, 0x69, 0x5d, 0x8a, 0x44, 0x3d, 0xb7, 0xa0, 0xa1,
+	0x8a, 0x0c, 0x51, 0x8e, 0x82, 0xc1, 0x7b, 0x8e, 0x68, 0x82, 0xc9, 0x5e, 0x20, 0x9a, 0x61, 0x12,
+	0x44, 0xa2, 0x97, 0xb0, 0x6a, 0x6f, 0xd0, 0xd7, 0x72, 0x8c, 0x77, 0xf0, 0x94, 0xb9, 0x37, 0x0f,
+	0x4f, 0x61, 0x35, 0x8b, 0xab, 0x9a, 0xa2, 0x2d, 0x66, 0x3c, 0x34, 0x8b, 0x1e, 0x21, 0x17, 0x11,
+	0x0f, 0x39, 0x0e, 0x3b, 0x2d, 0x9a, 0x18, 0x46, 0xed, 0xf8, 0xaf, 0xeb, 0xb0, 0xcc, 0x60, 0xc4,
+	0xe7, 0xb0, 0x9a, 0x3d, 0x61, 0x0a, 0x3a, 0xdc, 0xcb, 0x4f, 0xaa, 0xee, 0x4e, 0x89, 0xcb, 0x41,
+	0xf3, 0xee, 0xfd, 0xfa, 0xeb, 0x7f, 0x7f, 0x59, 0xbb, 0xed, 0x6d, 0xab, 0xd7, 0xd9, 0xe4, 0xe8,
+	0xf2, 0xa1, 0x1f, 0x4c, 0x9e, 0xfb, 0x0f, 0x8f, 0xd4, 0x96, 0x4f, 0xde, 0x77, 0x0e, 0xc5, 0x00,
+	0x9a, 0xd6, 0x3b, 0xa1, 0x68, 0x29, 0x35, 0xb3, 0x2f, 0x93, 0xee, 0xee, 0x0c, 0x5f, 0x1b, 0x78,
+	0x8f, 0x0c, 0x1c, 0xb8, 0x77, 0xaa, 0x0c, 0x1c, 0xbd, 0x51, 0x15, 0xf3, 0x0b, 0x65, 0xe7, 0x03,
+	0x80, 0xfc, 0xe9, 0x4e, 0x10, 0xda, 0x99, 0xe7, 0x40, 0xb7, 0x55, 0x66, 0x6b, 0x23, 0x37, 0x44,
+	0x00, 0x4d, 0xeb, 0x0d, 0x4b, 0xb8, 0xa5, 0x47, 0x2d, 0xeb, 0xd1, 0xcd, 0xbd, 0x53, 0x29, 0xd3,
+	0x9a, 0xde, 0x21, 0xb8, 0xfb, 0x62, 0xaf, 0x04, 0x37, 0xa1, 0xa9, 0x1a, 0xaf, 0x38, 0xc1, 0xe8,
+	0x58, 0xcf, 0x3e, 0x82, 0x56, 0x5f, 0xf1, 0x46, 0xe6, 0xb6, 0x67, 0x05, 0x19, 0xe4, 0x0f, 0x61,
+	0xad, 0xf0, 0xd0, 0x22, 0x68, 0x72, 0xd5, 0x4b, 0x8f, 0x7b, 0xbb, 0x42, 0x92, 0xe9, 0xf9, 0x1c,
+	0x5a, 0xb3, 0x0f, 0x23, 0xe4, 0xc5, 0xbb, 0x56, 0x50, 0x66, 0x1f, 0x27, 0xdc, 0xfd, 0x79, 0xe2,
+	0x4c, 0xf5, 0x53, 0xd8, 0x28, 0x3f, 0x20, 0x08, 0x72, 0xdf, 0x9c, 0xf7, 0x0e, 0x77, 0xaf, 0x5a,
+	0x98, 0x29, 0x7c, 0x1f, 0x56, 0xb3, 0xfb, 0x39, 0x27, 0x6a, 0xf9, 0x99, 0x80, 0x13, 0x75, 0xe6,
+	0x12, 0x8f, 0xdf, 0x0e, 0x61, 0xad, 0x70, 0x23, 0x66, 0x7f, 0x55, 0x5d, 0xd7, 0xd9, 0x5f, 0x95,
+	0xd7, 0x67, 0xef, 0x6d, 0x0a, 0xf0, 0x1d, 0xb7, 0x55, 0x0e, 0x30, 0x17, 0x2f, 0x95, 0x8a, 0x4f,
+	0x60, 0xbd, 0x78, 0x79, 0x15, 0xb7, 0xb9, 0x14, 0x57, 0xdc, 0x8b, 0x5d, 0xb7, 0x4a, 0x94, 0x61,
+	0x8e, 0x11, 0xb3, 0x7d, 0x07, 0xd5, 0x98, 0x2b, 0xae, 0xb5, 0x1a, 0x73, 0xd5, 0x85, 0xd5, 0xfb,
+	0x2e, 0x61, 0x7e, 0xef, 0xf0, 0x9d, 0x12, 0x66, 0xdd, 0xca, 0x1e, 0xbd, 0x51, 0xbd, 0xc8, 0x17,
+	0x26, 0x39, 0x5f, 0x64, 0x7e, 0xe2, 0x12, 0x57, 0xf0, 0x53, 0xe1, 0x1e, 0x5b, 0xf0, 0x53, 0xf1,
+	0xae, 0xea, 0xbd, 0x4b, 0x36, 0xef, 0xb9, 0x6e, 0xc9, 0x26, 0xb7, 0xfa, 0x47, 0x6f, 0xa2, 0x09,
+	0x6d, 0xdb, 0x9f, 0x01, 0xe4, 0xcd, 0x3a, 0x6f, 0xdb, 0x99, 0xfb, 0x02, 0x6f, 0xdb, 0xd9, 0x9e,
+	0xde, 0xdb, 0x27, 0x1b, 0x6d, 0xd1, 0xaa, 0x5e, 0x17, 0xd6, 0x9e, 0xb5, 0x42, 0x27, 0x5a, 0x8c,
+	0xb8, 0xdd, 0xb4, 0x17, 0x23, 0x5e, 0x68, 0x5b, 0xbd, 0x03, 0xb2, 0xe2, 0xba, 0x3b, 0xe5, 0x88,
+	0xd3, 0x34, 0xb5, 0x88, 0x80, 0xfa, 0xbe, 0xbc, 0x9d, 0x64, 0x3b, 0x55, 0xdd, 0x28, 0xdb, 0xa9,
+	0xec, 0x3d, 0x4d, 0xa5, 0x13, 0xfb, 0x65, 0x3b, 0xd3, 0xae, 0x5d, 0xec, 0xc4, 0x05, 0x2c, 0x73,
+	0x7f, 0x28, 0x36, 0xb5, 0x32, 0x4b, 0xbf, 0xb0, 0x59, 0x5a, 0xf1, 0x77, 0x48, 0xf1, 0x5d, 0x71,
+	0x55, 0x09, 0x15, 0xbf, 0x80, 0xa6, 0xd5, 0x52, 0x71, 0x9d, 0x9e, 0x6d, 0xfb, 0xb8, 0x4e, 0x57,
+	0xf4, 0x5e, 0x73, 0xbd, 0x24, 0xd5, 0x2c, 0xda, 0x16, 0x58, 0xf4, 0xec, 0x96, 0x93, 0x8b, 0x5e,
+	0x45, 0x6f, 0xea, 0xb6, 0x67, 0x05, 0xd9, 0x86, 0xc0, 0xbd, 0x55, 0xec, 0x9d, 0x78, 0x6f, 0x55,
+	0x36, 0x66, 0xbc, 0xb7, 0xaa, 0x5b, 0x2d, 0x54, 0x85, 0x78, 0xec, 0xe6, 0x46, 0xd8, 0x47, 0x50,
+	0xa1, 0x28, 0xb5, 0x67, 0x05, 0x46, 0xc9, 0xa3, 0xf6, 0xdf, 0xfe, 0xb9, 0xef, 0x7c, 0x85, 0xbf,
+	0x7f, 0xe0, 0xef, 0xf7, 0xff, 0xda, 0xbf, 0xf1, 0x15, 0xfe, 0xfe, 0x8e, 0xbf, 0xee, 0x32, 0xfd,
+	0x3d, 0xf9, 0xbd, 0xff, 0x00, 0x4f, 0xbf, 0x6f, 0x42, 0xe2, 0x1c, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -4664,6 +4682,22 @@ func (m *DDLLock) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Note) > 0 {
+		i -= len(m.Note)
+		copy(dAtA[i:], m.Note)
+		i = encodeVarintDmmaster(dAtA, i, uint64(len(m.Note)))
+		i--
+		dAtA[i] = 0x4a
+	}
+	if len(m.Advisories) > 0 {
+		for iNdEx := len(m.Advisories) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Advisories[iNdEx])
+			copy(dAtA[i:], m.Advisories[iNdEx])
+			i = encodeVarintDmmaster(dAtA, i, uint64(len(m.Advisories[iNdEx])))
+			i--
+			dAtA[i] = 0x42
+		}
+	}
 	if len(m.Unsynced) > 0 {
 		for iNdEx := len(m.Unsynced) - 1; iNdEx >= 0; iNdEx-- {
 			i -= len(m.Unsynced[iNdEx])
@@ -6864,6 +6898,16 @@ func (m *DDLLock) Size() (n int) {
 			n += 1 + l + sovDmmaster(uint64(l))
 		}
 	}
+	if len(m.Advisories) > 0 {
+		for _, s := range m.Advisories {
+			l = len(s)
+			n += 1 + l + sovDmmaster(uint64(l))
+		}
+	}
+	l = len(m.Note)
+	if l > 0 {
+		n += 1 + l + sovDmmaster(uint64(l))
+	}
 	return n
 }
 
@@ -9230,6 +9274,70 @@ func (m *DDLLock) Unmarshal(dAtA []byte) error {
 			}
 			m.Unsynced = append(m.Unsynced, string(dAtA[iNdEx:postIndex]))
 			iNdEx = postIndex
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Advisories", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDmmaster
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDmmaster
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthDmmaster
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Advisories = append(m.Advisories, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Note", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowDmmaster
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthDmmaster
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthDmmaster
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Note = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipDmmaster(dAtA[iNdEx:])
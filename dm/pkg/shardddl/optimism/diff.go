@@ -0,0 +1,122 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimism
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+)
+
+// LockState is the snapshot of a shard DDL lock, captured by `Lock.State`.
+// it can be persisted and compared with another snapshot by `DiffLockStates`.
+type LockState struct {
+	ID         string `json:"id"`
+	Task       string `json:"task"`
+	DownSchema string `json:"down-schema"`
+	DownTable  string `json:"down-table"`
+	Joined     string `json:"joined"`
+	// source-`schema`.`table` -> the state of the upstream table.
+	Tables map[string]TableState `json:"tables"`
+}
+
+// TableState is the state of an upstream table in a shard DDL lock.
+type TableState struct {
+	Schema string `json:"schema"`
+	Done   bool   `json:"done"`
+}
+
+// LockStatesDiff is the difference between two snapshots of shard DDL locks, all IDs and tables are sorted.
+type LockStatesDiff struct {
+	AddedLocks   []string
+	RemovedLocks []string
+	ChangedLocks []LockStateDiff
+}
+
+// Empty returns whether there is no difference.
+func (d LockStatesDiff) Empty() bool {
+	return len(d.AddedLocks) == 0 && len(d.RemovedLocks) == 0 && len(d.ChangedLocks) == 0
+}
+
+// LockStateDiff is the difference of a shard DDL lock in both snapshots.
+type LockStateDiff struct {
+	ID string
+	// the joined schemas in both snapshots, they're empty if the joined schema is not changed.
+	JoinedBefore string
+	JoinedAfter  string
+	// the upstream tables in the format of source-`schema`.`table`,
+	// a table is changed if its schema or done status is changed.
+	AddedTables   []string
+	RemovedTables []string
+	ChangedTables []string
+}
+
+// tableStateKey returns the key of the upstream table in `LockState.Tables`.
+func tableStateKey(source, schema, table string) string {
+	return fmt.Sprintf("%s-%s", source, dbutil.TableName(schema, table))
+}
+
+// DiffLockStates returns the difference from the snapshot `a` to the snapshot `b`, both are lock ID -> lock state.
+func DiffLockStates(a, b map[string]LockState) LockStatesDiff {
+	var diff LockStatesDiff
+	for id := range b {
+		if _, ok := a[id]; !ok {
+			diff.AddedLocks = append(diff.AddedLocks, id)
+		}
+	}
+	for id, before := range a {
+		after, ok := b[id]
+		if !ok {
+			diff.RemovedLocks = append(diff.RemovedLocks, id)
+			continue
+		}
+		if d, changed := diffLockState(before, after); changed {
+			diff.ChangedLocks = append(diff.ChangedLocks, d)
+		}
+	}
+	sort.Strings(diff.AddedLocks)
+	sort.Strings(diff.RemovedLocks)
+	sort.Slice(diff.ChangedLocks, func(i, j int) bool {
+		return diff.ChangedLocks[i].ID < diff.ChangedLocks[j].ID
+	})
+	return diff
+}
+
+// diffLockState returns the difference of the lock in both snapshots, and whether it's changed.
+func diffLockState(a, b LockState) (LockStateDiff, bool) {
+	d := LockStateDiff{ID: a.ID}
+	if a.Joined != b.Joined {
+		d.JoinedBefore, d.JoinedAfter = a.Joined, b.Joined
+	}
+	for table := range b.Tables {
+		if _, ok := a.Tables[table]; !ok {
+			d.AddedTables = append(d.AddedTables, table)
+		}
+	}
+	for table, before := range a.Tables {
+		after, ok := b.Tables[table]
+		switch {
+		case !ok:
+			d.RemovedTables = append(d.RemovedTables, table)
+		case before != after:
+			d.ChangedTables = append(d.ChangedTables, table)
+		}
+	}
+	sort.Strings(d.AddedTables)
+	sort.Strings(d.RemovedTables)
+	sort.Strings(d.ChangedTables)
+	changed := d.JoinedBefore != d.JoinedAfter || len(d.AddedTables) > 0 || len(d.RemovedTables) > 0 || len(d.ChangedTables) > 0
+	return d, changed
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimism
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/tidb-tools/pkg/schemacmp"
+	"github.com/pingcap/tidb/parser"
+	"github.com/pingcap/tidb/parser/model"
+	"github.com/pingcap/tidb/util/mock"
+
+	"github.com/pingcap/tiflow/dm/pkg/utils"
+)
+
+type testDiff struct{}
+
+var _ = Suite(&testDiff{})
+
+func (t *testDiff) TestDiffLockStates(c *C) {
+	var (
+		task             = "test-diff-lock-states"
+		source           = "mysql-replica-1"
+		downSchema       = "foo"
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		newLock          = func(downTable string, tables ...string) *Lock {
+			tbls := make(map[string]struct{})
+			for _, tbl := range tables {
+				tbls[tbl] = struct{}{}
+			}
+			tts := []TargetTable{newTargetTable(task, source, downSchema, downTable, map[string]map[string]struct{}{"foo": tbls})}
+			return NewLock(etcdTestCli, utils.GenDDLLockID(task, downSchema, downTable), task, downSchema, downTable, schemacmp.Encode(ti0), tts, nil)
+		}
+		l1 = newLock("bar", "bar-1", "bar-2")
+		l2 = newLock("baz", "baz-1")
+		l3 = newLock("qux", "qux-1")
+	)
+
+	before := map[string]LockState{l1.ID: l1.State(), l2.ID: l2.State()}
+	c.Assert(before[l1.ID].Tables, HasLen, 2)
+	c.Assert(before[l1.ID].Tables["mysql-replica-1-`foo`.`bar-1`"], DeepEquals, TableState{Schema: schemacmp.Encode(ti0).String()})
+	c.Assert(DiffLockStates(before, before).Empty(), IsTrue)
+
+	// ADD COLUMN for bar-1, and a new table for bar.
+	info := NewInfo(task, source, "foo", "bar-1", downSchema, "bar", DDLs1, ti0, []*model.TableInfo{ti1})
+	tts := []TargetTable{newTargetTable(task, source, downSchema, "bar", map[string]map[string]struct{}{
+		"foo": {"bar-1": struct{}{}, "bar-2": struct{}{}, "bar-3": struct{}{}},
+	})}
+	_, _, err := l1.TrySync(info, tts)
+	c.Assert(err, IsNil)
+	after := map[string]LockState{l1.ID: l1.State(), l3.ID: l3.State()}
+
+	diff := DiffLockStates(before, after)
+	c.Assert(diff.Empty(), IsFalse)
+	c.Assert(diff.AddedLocks, DeepEquals, []string{l3.ID})
+	c.Assert(diff.RemovedLocks, DeepEquals, []string{l2.ID})
+	c.Assert(diff.ChangedLocks, HasLen, 1)
+	c.Assert(diff.ChangedLocks[0], DeepEquals, LockStateDiff{
+		ID:            l1.ID,
+		JoinedBefore:  schemacmp.Encode(ti0).String(),
+		JoinedAfter:   schemacmp.Encode(ti1).String(),
+		AddedTables:   []string{"mysql-replica-1-`foo`.`bar-3`"},
+		ChangedTables: []string{"mysql-replica-1-`foo`.`bar-1`"},
+	})
+
+	// the reversed diff.
+	diff = DiffLockStates(after, before)
+	c.Assert(diff.AddedLocks, DeepEquals, []string{l2.ID})
+	c.Assert(diff.RemovedLocks, DeepEquals, []string{l3.ID})
+	c.Assert(diff.ChangedLocks, HasLen, 1)
+	c.Assert(diff.ChangedLocks[0].JoinedBefore, Equals, schemacmp.Encode(ti1).String())
+	c.Assert(diff.ChangedLocks[0].RemovedTables, DeepEquals, []string{"mysql-replica-1-`foo`.`bar-3`"})
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimism
+
+import (
+	"context"
+	"strconv"
+
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/clientv3/clientv3util"
+
+	"github.com/pingcap/tiflow/dm/dm/common"
+	"github.com/pingcap/tiflow/dm/pkg/etcdutil"
+)
+
+// AcquireLeaderEpoch increases the leader epoch in etcd and returns the new one,
+// lock operations put with the older epochs by `PutOperationWithEpoch` are fenced since then.
+// This function should often be called by DM-master when it becomes the leader.
+func AcquireLeaderEpoch(cli *clientv3.Client) (int64, error) {
+	ctx, cancel := context.WithTimeout(cli.Ctx(), etcdutil.DefaultRequestTimeout)
+	defer cancel()
+
+	key := common.ShardDDLOptimismLeaderEpochKey
+	for {
+		resp, err := cli.Get(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		var (
+			epoch int64
+			cmp   = clientv3util.KeyMissing(key)
+		)
+		if resp.Count > 0 {
+			if epoch, err = strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64); err != nil {
+				return 0, err
+			}
+			cmp = clientv3.Compare(clientv3.ModRevision(key), "=", resp.Kvs[0].ModRevision)
+		}
+		epoch++
+
+		// retry if another DM-master has increased the epoch concurrently.
+		txnResp, err := cli.Txn(ctx).If(cmp).Then(clientv3.OpPut(key, strconv.FormatInt(epoch, 10))).Commit()
+		if err != nil {
+			return 0, err
+		}
+		if txnResp.Succeeded {
+			return epoch, nil
+		}
+	}
+}
+
+// GetLeaderEpoch gets the current leader epoch in etcd, it's 0 if no leader has acquired it.
+func GetLeaderEpoch(cli *clientv3.Client) (int64, error) {
+	respTxn, _, err := etcdutil.DoOpsInOneTxnWithRetry(cli, clientv3.OpGet(common.ShardDDLOptimismLeaderEpochKey))
+	if err != nil {
+		return 0, err
+	}
+	resp := respTxn.Responses[0].GetResponseRange()
+	if resp.Count == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
+}
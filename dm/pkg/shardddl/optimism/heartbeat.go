@@ -0,0 +1,78 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimism
+
+import (
+	"context"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+
+	"github.com/pingcap/tiflow/dm/dm/common"
+	"github.com/pingcap/tiflow/dm/pkg/etcdutil"
+)
+
+// putLockHeartbeat grants a lease with `ttl` (in seconds) and puts the heartbeat of the lock into etcd with it.
+func putLockHeartbeat(cli *clientv3.Client, lockID string, ttl int64, t time.Time) (clientv3.LeaseID, error) {
+	ctx, cancel := context.WithTimeout(cli.Ctx(), etcdutil.DefaultRequestTimeout)
+	defer cancel()
+
+	lease, err := cli.Grant(ctx, ttl)
+	if err != nil {
+		return 0, err
+	}
+	key := common.ShardDDLOptimismLockHeartbeatKeyAdapter.Encode(lockID)
+	_, err = cli.Put(ctx, key, t.Format(time.RFC3339Nano), clientv3.WithLease(lease.ID))
+	if err != nil {
+		return 0, err
+	}
+	return lease.ID, nil
+}
+
+// keepLockHeartbeatOnce refreshes the lease of the lock's heartbeat once.
+func keepLockHeartbeatOnce(cli *clientv3.Client, leaseID clientv3.LeaseID) error {
+	ctx, cancel := context.WithTimeout(cli.Ctx(), etcdutil.DefaultRequestTimeout)
+	defer cancel()
+
+	_, err := cli.KeepAliveOnce(ctx, leaseID)
+	return err
+}
+
+// revokeLockHeartbeat revokes the lease of the lock's heartbeat, the heartbeat key is deleted with it.
+func revokeLockHeartbeat(cli *clientv3.Client, leaseID clientv3.LeaseID) error {
+	ctx, cancel := context.WithTimeout(cli.Ctx(), etcdutil.DefaultRevokeLeaseTimeout)
+	defer cancel()
+
+	_, err := cli.Revoke(ctx, leaseID)
+	return err
+}
+
+// GetLockHeartbeat gets the time when the heartbeat of the lock started,
+// it returns false if the heartbeat not exists or has expired.
+func GetLockHeartbeat(cli *clientv3.Client, lockID string) (time.Time, bool, error) {
+	key := common.ShardDDLOptimismLockHeartbeatKeyAdapter.Encode(lockID)
+	respTxn, _, err := etcdutil.DoOpsInOneTxnWithRetry(cli, clientv3.OpGet(key))
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	resp := respTxn.Responses[0].GetResponseRange()
+	if resp.Count == 0 {
+		return time.Time{}, false, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, string(resp.Kvs[0].Value))
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return t, true, nil
+}
@@ -258,6 +258,8 @@ func WatchInfo(ctx context.Context, cli *clientv3.Client, revision int64,
 				case mvccpb.DELETE:
 					info, err = infoFromJSON(string(ev.PrevKv.Value))
 					info.IsDeleted = true
+					// the revision of the DELETE.
+					info.Revision = ev.Kv.ModRevision
 				default:
 					// this should not happen.
 					err = fmt.Errorf("unsupported ectd event type %v", ev.Type)
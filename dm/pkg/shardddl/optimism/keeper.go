@@ -43,6 +43,10 @@ type LockKeeper struct {
 	getDownstreamMetaFunc func(string) (*config.DBConfig, string)
 	// lockID -> column name -> source -> upSchema -> upTable -> int
 	dropColumns map[string]map[string]map[string]map[string]map[string]DropColumnStage
+	// the maximum number of applied DDLs kept in the history of each lock.
+	maxAppliedDDLs int
+	// the fraction of sources whose tables must be synced and done to resolve each lock.
+	quorum float64
 }
 
 // NewLockKeeper creates a new LockKeeper instance.
@@ -59,6 +63,30 @@ func (lk *LockKeeper) SetDropColumns(dropColumns map[string]map[string]map[strin
 	lk.dropColumns = dropColumns
 }
 
+// SetMaxAppliedDDLs sets the maximum number of applied DDLs kept in the history of each lock,
+// it takes effect for both the existing and the newly created locks.
+func (lk *LockKeeper) SetMaxAppliedDDLs(maxAppliedDDLs int) {
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+
+	lk.maxAppliedDDLs = maxAppliedDDLs
+	for _, l := range lk.locks {
+		l.SetMaxAppliedDDLs(maxAppliedDDLs)
+	}
+}
+
+// SetQuorum sets the fraction of sources whose tables must be synced and done to resolve each lock,
+// it takes effect for both the existing and the newly created locks.
+func (lk *LockKeeper) SetQuorum(quorum float64) {
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+
+	lk.quorum = quorum
+	for _, l := range lk.locks {
+		l.SetQuorum(quorum)
+	}
+}
+
 // getDownstreamMeta gets and cached downstream meta.
 func (lk *LockKeeper) getDownstreamMeta(task string) (*DownstreamMeta, error) {
 	if downstreamMeta, ok := lk.downstreamMetaMap[task]; ok {
@@ -102,6 +130,10 @@ func (lk *LockKeeper) TrySync(cli *clientv3.Client, info Info, tts []TargetTable
 
 		lk.locks[lockID] = NewLock(cli, lockID, info.Task, info.DownSchema, info.DownTable, schemacmp.Encode(info.TableInfoBefore), tts, downstreamMeta)
 		l = lk.locks[lockID]
+		if lk.maxAppliedDDLs > 0 {
+			l.SetMaxAppliedDDLs(lk.maxAppliedDDLs)
+		}
+		l.SetQuorum(lk.quorum)
 
 		// set drop columns, only when recover locks
 		if lk.dropColumns != nil {
@@ -171,6 +203,16 @@ func (lk *LockKeeper) Locks() map[string]*Lock {
 	return locks
 }
 
+// LockStates captures the states of all Locks, lock ID -> lock state.
+func (lk *LockKeeper) LockStates() map[string]LockState {
+	locks := lk.Locks()
+	states := make(map[string]LockState, len(locks))
+	for id, l := range locks {
+		states[id] = l.State()
+	}
+	return states
+}
+
 // Clear clears all Locks.
 func (lk *LockKeeper) Clear() {
 	lk.mu.Lock()
@@ -199,19 +241,28 @@ func NewTableKeeper() *TableKeeper {
 }
 
 // Init (re-)initializes the keeper with initial source tables.
-func (tk *TableKeeper) Init(stm map[string]map[string]SourceTables) {
+// it returns an error if any upstream table is routed to inconsistent downstream tables in a task,
+// but all the source tables are still kept.
+func (tk *TableKeeper) Init(stm map[string]map[string]SourceTables) error {
 	tk.mu.Lock()
 	defer tk.mu.Unlock()
 
+	var err error
 	tk.tables = make(map[string]map[string]SourceTables)
 	for task, sts := range stm {
 		if _, ok := tk.tables[task]; !ok {
 			tk.tables[task] = make(map[string]SourceTables)
 		}
+		stl := make([]SourceTables, 0, len(sts))
 		for source, st := range sts {
 			tk.tables[task][source] = st
+			stl = append(stl, st)
+		}
+		if err2 := checkTargetsConsistent(stl...); err2 != nil && err == nil {
+			err = err2
 		}
 	}
+	return err
 }
 
 // Update adds/updates tables into the keeper or removes tables from the keeper.
@@ -299,6 +350,14 @@ func (tk *TableKeeper) RemoveTable(task, source, upSchema, upTable, downSchema,
 	return removed
 }
 
+// HasTask returns whether any source tables exist for the task.
+func (tk *TableKeeper) HasTask(task string) bool {
+	tk.mu.RLock()
+	defer tk.mu.RUnlock()
+
+	return len(tk.tables[task]) > 0
+}
+
 // RemoveTableByTask removes tables from the source tables through task name.
 // it returns whether removed (exit before).
 func (tk *TableKeeper) RemoveTableByTask(task string) bool {
@@ -299,11 +299,11 @@ func (t *testKeeper) TestTableKeeper(c *C) {
 	}
 
 	// Init with `nil` is fine.
-	tk.Init(nil)
+	c.Assert(tk.Init(nil), IsNil)
 	c.Assert(tk.FindTables(task1, downSchema, downTable), IsNil)
 
 	// tables for task1 exit after Init.
-	tk.Init(stm)
+	c.Assert(tk.Init(stm), IsNil)
 	tts := tk.FindTables(task1, downSchema, downTable)
 	c.Assert(tts, HasLen, 2)
 	c.Assert(tts[0], DeepEquals, tt11)
@@ -401,6 +401,41 @@ func (t *testKeeper) TestTableKeeper(c *C) {
 	c.Assert(tts[0].UpTables["db-2"], HasKey, "tbl-3")
 }
 
+func (t *testKeeper) TestTableKeeperInconsistentTargets(c *C) {
+	var (
+		tk      = NewTableKeeper()
+		task1   = "task1"
+		task2   = "task2"
+		source1 = "mysql-replica-1"
+		source2 = "mysql-replica-2"
+		st11    = NewSourceTables(task1, source1)
+		st12    = NewSourceTables(task1, source2)
+		st21    = NewSourceTables(task2, source1)
+		st22    = NewSourceTables(task2, source2)
+		stm     = map[string]map[string]SourceTables{
+			task1: {source1: st11, source2: st12},
+			task2: {source1: st21, source2: st22},
+		}
+	)
+
+	// the same upstream table in different tasks can be routed to different downstream tables.
+	st11.AddTable("foo", "bar-1", "foo", "bar")
+	st12.AddTable("foo", "bar-1", "foo", "bar")
+	st21.AddTable("foo", "bar-1", "foo", "rab")
+	st22.AddTable("foo", "bar-2", "foo", "bar")
+	c.Assert(tk.Init(stm), IsNil)
+
+	// the same upstream table is routed to different downstream tables in two sources.
+	st22.AddTable("foo", "bar-1", "foo", "bar")
+	err := tk.Init(stm)
+	c.Assert(terror.ErrShardDDLOptimismInconsistentTargets.Equal(err), IsTrue)
+	c.Assert(err, ErrorMatches, ".*upstream table `foo`.`bar-1` is routed to inconsistent downstream tables: "+
+		"`foo`.`bar` in mysql-replica-2; `foo`.`rab` in mysql-replica-1.*")
+	// all source tables are still kept.
+	c.Assert(tk.FindTables(task2, "foo", "bar"), HasLen, 1)
+	c.Assert(tk.FindTables(task2, "foo", "rab"), HasLen, 1)
+}
+
 func (t *testKeeper) TestTargetTablesForTask(c *C) {
 	var (
 		tk         = NewTableKeeper()
@@ -448,7 +483,7 @@ func (t *testKeeper) TestTargetTablesForTask(c *C) {
 		tt22.TargetTable(downSchema, downTable1),
 	})
 
-	tk.Init(stm)
+	c.Assert(tk.Init(stm), IsNil)
 	tts = tk.FindTables(task1, downSchema, downTable1)
 	c.Assert(tts, DeepEquals, []TargetTable{
 		tt11.TargetTable(downSchema, downTable1),
@@ -529,3 +564,64 @@ func (t *testKeeper) TestGetDownstreamMeta(c *C) {
 	lk.Clear()
 	c.Assert(lk.downstreamMetaMap, HasLen, 0)
 }
+
+func (t *testKeeper) TestLockKeeperRecreateLock(c *C) {
+	var (
+		lk         = NewLockKeeper(getDownstreamMeta)
+		upSchema   = "foo_1"
+		upTable    = "bar_1"
+		downSchema = "foo"
+		downTable  = "bar"
+		DDLs1      = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		DDLs2      = []string{"ALTER TABLE bar ADD COLUMN c2 INT"}
+		task       = "task"
+		source1    = "mysql-replica-1"
+		source2    = "mysql-replica-2"
+
+		p         = parser.New()
+		se        = mock.NewContext()
+		tblID     = int64(111)
+		ti0       = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1       = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		ti2       = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT, c2 INT)`)
+		i11       = NewInfo(task, source1, upSchema, upTable, downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i12       = NewInfo(task, source2, upSchema, upTable, downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1})
+		i21       = NewInfo(task, source1, upSchema, upTable, downSchema, downTable, DDLs2, ti1, []*model.TableInfo{ti2})
+		targetsOf = func(sources ...string) []TargetTable {
+			tts := make([]TargetTable, 0, len(sources))
+			for _, source := range sources {
+				tts = append(tts, newTargetTable(task, source, downSchema, downTable, map[string]map[string]struct{}{upSchema: {upTable: struct{}{}}}))
+			}
+			return tts
+		}
+	)
+
+	// the lock is resolved and removed.
+	lockID, _, _, err := lk.TrySync(etcdTestCli, i11, targetsOf(source1, source2))
+	c.Assert(err, IsNil)
+	_, _, _, err = lk.TrySync(etcdTestCli, i12, targetsOf(source1, source2))
+	c.Assert(err, IsNil)
+	lock1 := lk.FindLock(lockID)
+	c.Assert(lock1.TryMarkDone(source1, upSchema, upTable), IsTrue)
+	c.Assert(lock1.TryMarkDone(source2, upSchema, upTable), IsTrue)
+	c.Assert(lock1.IsResolved(), IsTrue)
+	c.Assert(lk.RemoveLock(lockID), IsTrue)
+	c.Assert(lk.FindLock(lockID), IsNil)
+
+	// the lock with the same ID is re-created immediately, a new lock is allocated with a fresh state,
+	// and the removed one which may still be referenced by others is left untouched.
+	lockID2, newDDLs, _, err := lk.TrySync(etcdTestCli, i21, targetsOf(source1))
+	c.Assert(err, IsNil)
+	c.Assert(lockID2, Equals, lockID)
+	c.Assert(newDDLs, DeepEquals, DDLs2)
+	lock2 := lk.FindLock(lockID)
+	c.Assert(lock2, Not(Equals), lock1) // compare pointer
+	c.Assert(lock2.Ready(), HasLen, 1)
+	c.Assert(lock2.TableExist(source2, upSchema, upTable), IsFalse)
+	c.Assert(lock2.IsDone(source1, upSchema, upTable), IsFalse)
+	synced, remain := lock2.IsSynced()
+	c.Assert(synced, IsTrue)
+	c.Assert(remain, Equals, 0)
+	c.Assert(lock1.IsResolved(), IsTrue)
+	c.Assert(lock1.TableExist(source2, upSchema, upTable), IsTrue)
+}
@@ -17,14 +17,21 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/pingcap/tidb-tools/pkg/dbutil"
 	"github.com/pingcap/tidb-tools/pkg/schemacmp"
+	"github.com/pingcap/tidb/ddl"
 	"github.com/pingcap/tidb/parser"
 	"github.com/pingcap/tidb/parser/ast"
 	"github.com/pingcap/tidb/parser/model"
+	"github.com/pingcap/tidb/parser/mysql"
+	"github.com/pingcap/tidb/parser/types"
 	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/etcdserver/api/v3rpc/rpctypes"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
 
@@ -32,7 +39,9 @@ import (
 	"github.com/pingcap/tiflow/dm/pkg/conn"
 	"github.com/pingcap/tiflow/dm/pkg/cputil"
 	"github.com/pingcap/tiflow/dm/pkg/log"
+	dmparser "github.com/pingcap/tiflow/dm/pkg/parser"
 	"github.com/pingcap/tiflow/dm/pkg/terror"
+	"github.com/pingcap/tiflow/dm/pkg/utils"
 )
 
 // DropColumnStage represents whether drop column done for a sharding table.
@@ -47,6 +56,9 @@ const (
 	DropDone
 )
 
+// DefaultMaxAppliedDDLs is the default maximum number of applied DDLs kept in the history of a lock.
+const DefaultMaxAppliedDDLs = 1024
+
 // Lock represents the shard DDL lock in memory.
 // This information does not need to be persistent, and can be re-constructed from the shard DDL info.
 type Lock struct {
@@ -66,6 +78,9 @@ type Lock struct {
 	// upstream source ID -> upstream schema name -> upstream table name -> table info.
 	// if all of them are the same, then we call the lock `synced`.
 	tables map[string]map[string]map[string]schemacmp.Table
+	// per-table's latest known table info, used to detect the compatible but differing columns.
+	// upstream source ID -> upstream schema name -> upstream table name -> table info.
+	tableInfos map[string]map[string]map[string]*model.TableInfo
 
 	synced bool
 
@@ -76,6 +91,20 @@ type Lock struct {
 	// and mark `done` to `true` after received the done status of the DDLs operation.
 	done map[string]map[string]map[string]bool
 
+	// the DDLs of the not-done operation for each table.
+	// upstream source ID -> upstream schema name -> upstream table name -> DDLs.
+	pendingDDLs map[string]map[string]map[string][]string
+
+	// the DDLs of the done operations, only the latest `maxAppliedDDLs` ones are kept,
+	// and the number of the elided older ones is recorded in `elidedDDLs`.
+	appliedDDLs    []string
+	elidedDDLs     int
+	maxAppliedDDLs int
+
+	// the fraction of sources whose tables must be synced and done to resolve the lock,
+	// a non-positive quorum or not less than 1 requires all sources.
+	quorum float64
+
 	// upstream source ID -> upstream schema name -> upstream table name -> info version.
 	versions map[string]map[string]map[string]int64
 
@@ -84,6 +113,14 @@ type Lock struct {
 	columns map[string]map[string]map[string]map[string]DropColumnStage
 
 	downstreamMeta *DownstreamMeta
+
+	// the time when the lock is created, or rebuilt after DM-master restarted.
+	createdAt time.Time
+
+	// the lease of the lock's heartbeat in etcd, and the time of the last successful heartbeat.
+	heartbeatLease   clientv3.LeaseID
+	lastHeartbeat    time.Time
+	heartbeatStopped bool
 }
 
 // NewLock creates a new Lock instance.
@@ -96,11 +133,15 @@ func NewLock(cli *clientv3.Client, id, task, downSchema, downTable string, joine
 		DownTable:      downTable,
 		joined:         joined,
 		tables:         make(map[string]map[string]map[string]schemacmp.Table),
+		tableInfos:     make(map[string]map[string]map[string]*model.TableInfo),
 		done:           make(map[string]map[string]map[string]bool),
+		pendingDDLs:    make(map[string]map[string]map[string][]string),
+		maxAppliedDDLs: DefaultMaxAppliedDDLs,
 		synced:         true,
 		versions:       make(map[string]map[string]map[string]int64),
 		columns:        make(map[string]map[string]map[string]map[string]DropColumnStage),
 		downstreamMeta: downstreamMeta,
+		createdAt:      time.Now(),
 	}
 	l.addTables(tts)
 	metrics.ReportDDLPending(task, metrics.DDLPendingNone, metrics.DDLPendingSynced)
@@ -144,6 +185,46 @@ func (l *Lock) FetchTableInfos(task, source, schema, table string) (*model.Table
 	return ti, nil
 }
 
+// FetchDownstreamTableInfo fetches the current table info of the downstream table of the lock.
+func (l *Lock) FetchDownstreamTableInfo() (*model.TableInfo, error) {
+	if l.downstreamMeta == nil {
+		return nil, terror.ErrMasterOptimisticDownstreamMetaNotFound.Generate(l.Task)
+	}
+
+	db, err := conn.DefaultDBProvider.Apply(l.downstreamMeta.dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), dbutil.DefaultTimeout)
+	defer cancel()
+
+	dbConn, err := db.DB.Conn(ctx)
+	if err != nil {
+		return nil, terror.DBErrorAdapt(err, terror.ErrDBDriverError)
+	}
+	defer dbConn.Close()
+	createSQL, err := utils.GetTableCreateSQL(ctx, dbConn, dbutil.TableName(l.DownSchema, l.DownTable))
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := parser.New().ParseOneStmt(createSQL, "", "")
+	if err != nil {
+		return nil, err
+	}
+	createStmt, ok := stmt.(*ast.CreateTableStmt)
+	if !ok {
+		return nil, terror.ErrShardDDLOptimismTrySyncFail.Generate(l.ID, fmt.Sprintf("invalid downstream schema %s", createSQL))
+	}
+	ti, err := ddl.BuildTableInfoFromAST(createStmt)
+	if err != nil {
+		return nil, err
+	}
+	ti.State = model.StatePublic
+	return ti, nil
+}
+
 // joinTable join tables for a lock and update l.joined.
 func (l *Lock) joinTable() {
 	var (
@@ -201,7 +282,9 @@ func (l *Lock) TrySync(info Info, tts []TargetTable) (newDDLs []string, cols []s
 		if len(newDDLs) > 0 {
 			// revert the `done` status if need to wait for the new operation to be done.
 			// Now, we wait for the new operation to be done if any DDLs returned.
-			l.tryRevertDone(callerSource, callerSchema, callerTable)
+			if l.tryRevertDone(callerSource, callerSchema, callerTable) {
+				l.setPendingDDLs(callerSource, callerSchema, callerTable, newDDLs)
+			}
 		}
 		l.mu.Unlock()
 	}()
@@ -265,6 +348,7 @@ func (l *Lock) TrySync(info Info, tts []TargetTable) (newDDLs []string, cols []s
 			log.L().Info("update table info", zap.String("lock", l.ID), zap.String("source", callerSource), zap.String("schema", callerSchema), zap.String("table", callerTable),
 				zap.Stringer("from", l.tables[callerSource][callerSchema][callerTable]), zap.Stringer("to", lastTableInfo), zap.Strings("ddls", ddls))
 			l.tables[callerSource][callerSchema][callerTable] = lastTableInfo
+			l.setTableInfo(callerSource, callerSchema, callerTable, newTIs[len(newTIs)-1])
 		}
 	}()
 
@@ -459,9 +543,11 @@ func (l *Lock) TryRemoveTable(source, schema, table string) bool {
 	}
 
 	delete(l.tables[source][schema], table)
+	delete(l.tableInfos[source][schema], table)
 	_, remain := l.syncStatus()
 	l.synced = remain == 0
 	delete(l.done[source][schema], table)
+	delete(l.pendingDDLs[source][schema], table)
 	delete(l.versions[source][schema], table)
 	log.L().Info("table removed from the lock", zap.String("lock", l.ID),
 		zap.String("source", source), zap.String("schema", schema), zap.String("table", table),
@@ -492,9 +578,11 @@ func (l *Lock) TryRemoveTableBySources(sources []string) []string {
 		}
 
 		delete(l.tables, source)
+		delete(l.tableInfos, source)
 		_, remain := l.syncStatus()
 		l.synced = remain == 0
 		delete(l.done, source)
+		delete(l.pendingDDLs, source)
 		delete(l.versions, source)
 		for _, sourceColumns := range l.columns {
 			delete(sourceColumns, source)
@@ -549,6 +637,252 @@ func (l *Lock) Joined() schemacmp.Table {
 	return l.joined
 }
 
+// JoinedTableInfo returns the table info of the joined schema, which all source tables of the lock should converge to.
+func (l *Lock) JoinedTableInfo() (*model.TableInfo, error) {
+	joined := l.Joined()
+	stmt, err := parser.New().ParseOneStmt(joined.String(), "", "")
+	if err != nil {
+		return nil, err
+	}
+	createStmt, ok := stmt.(*ast.CreateTableStmt)
+	if !ok {
+		return nil, terror.ErrShardDDLOptimismTrySyncFail.Generate(l.ID, fmt.Sprintf("invalid joined schema %s", joined))
+	}
+	ti, err := ddl.BuildTableInfoFromAST(createStmt)
+	if err != nil {
+		return nil, err
+	}
+	ti.Name = model.NewCIStr(l.DownTable)
+	ti.State = model.StatePublic
+	return ti, nil
+}
+
+// SeedJoined forcibly installs the joined schema, and resets the schemas of all tables in the lock to it
+// as if they have been synced, so the later shard DDL infos are validated against it.
+// it's used to recover the lock whose state in etcd is partially lost.
+func (l *Lock) SeedJoined(ti *model.TableInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	joined := schemacmp.Encode(ti)
+	l.joined = joined
+	for source, schemaTables := range l.tables {
+		for schema, tables := range schemaTables {
+			for table := range tables {
+				tables[table] = joined
+				l.setTableInfo(source, schema, table, ti)
+			}
+		}
+	}
+
+	oldSynced := l.synced
+	_, remain := l.syncStatus()
+	l.synced = remain == 0
+	if oldSynced != l.synced {
+		if oldSynced {
+			metrics.ReportDDLPending(l.Task, metrics.DDLPendingSynced, metrics.DDLPendingUnSynced)
+		} else {
+			metrics.ReportDDLPending(l.Task, metrics.DDLPendingUnSynced, metrics.DDLPendingSynced)
+		}
+	}
+}
+
+// Advisories returns the non-blocking advisories for the columns which are compatible
+// but differ in nullability or default value between the source tables,
+// e.g. `ADD COLUMN c1 INT` in one table and `ADD COLUMN c1 INT DEFAULT 1` in another.
+// these differences do not cause a conflict but may surprise users after merged.
+func (l *Lock) Advisories() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	// column name -> nullability/default value -> tables.
+	nullability := make(map[string]map[string][]string)
+	defaults := make(map[string]map[string][]string)
+	record := func(m map[string]map[string][]string, col, value, table string) {
+		if _, ok := m[col]; !ok {
+			m[col] = make(map[string][]string)
+		}
+		m[col][value] = append(m[col][value], table)
+	}
+	for source, schemaTables := range l.tableInfos {
+		for schema, tables := range schemaTables {
+			for table, ti := range tables {
+				name := fmt.Sprintf("%s-%s", source, dbutil.TableName(schema, table))
+				for _, col := range ti.Columns {
+					colName := col.Name.L
+					if mysql.HasNotNullFlag(col.Flag) {
+						record(nullability, colName, "NOT NULL", name)
+					} else {
+						record(nullability, colName, "NULL", name)
+					}
+					if def := col.GetDefaultValue(); def != nil {
+						record(defaults, colName, fmt.Sprintf("DEFAULT %v", def), name)
+					} else {
+						record(defaults, colName, "no DEFAULT", name)
+					}
+				}
+			}
+		}
+	}
+
+	var advisories []string
+	advise := func(m map[string]map[string][]string, kind string) {
+		for col, values := range m {
+			if len(values) < 2 {
+				continue
+			}
+			details := make([]string, 0, len(values))
+			for value, tables := range values {
+				sort.Strings(tables)
+				details = append(details, fmt.Sprintf("%s in %s", value, strings.Join(tables, ", ")))
+			}
+			sort.Strings(details)
+			advisories = append(advisories, fmt.Sprintf("column `%s` has different %s in source tables: %s", col, kind, strings.Join(details, "; ")))
+		}
+	}
+	advise(nullability, "nullability")
+	advise(defaults, "default values")
+	sort.Strings(advisories)
+	return advisories
+}
+
+// ColumnType represents the type of a column in a source table of the lock.
+type ColumnType struct {
+	Source string
+	Schema string
+	Table  string
+	Name   string
+	Type   *types.FieldType
+}
+
+// ColumnTypeConflicts returns the columns in `ti` whose types differ from the same named columns in the other source tables,
+// each conflict is a pair of the column in another source table and the column in `ti`.
+func (l *Lock) ColumnTypeConflicts(source, schema, table string, ti *model.TableInfo) [][2]ColumnType {
+	if ti == nil {
+		return nil
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var conflicts [][2]ColumnType
+	for otherSource, schemaTables := range l.tableInfos {
+		for otherSchema, tables := range schemaTables {
+			for otherTable, otherTi := range tables {
+				if otherSource == source && otherSchema == schema && otherTable == table {
+					continue
+				}
+				for _, col := range ti.Columns {
+					otherCol := model.FindColumnInfo(otherTi.Columns, col.Name.L)
+					if otherCol == nil || otherCol.FieldType.CompactStr() == col.FieldType.CompactStr() {
+						continue
+					}
+					conflicts = append(conflicts, [2]ColumnType{
+						{Source: otherSource, Schema: otherSchema, Table: otherTable, Name: otherCol.Name.O, Type: &otherCol.FieldType},
+						{Source: source, Schema: schema, Table: table, Name: col.Name.O, Type: &col.FieldType},
+					})
+				}
+			}
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		a, b := conflicts[i][0], conflicts[j][0]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Schema != b.Schema {
+			return a.Schema < b.Schema
+		}
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		return a.Name < b.Name
+	})
+	return conflicts
+}
+
+// Heartbeat refreshes the lease of the lock's heartbeat in etcd,
+// a new lease with `ttl` (in seconds) is granted if no lease exists or the previous one has expired.
+// the requests to etcd are sent without holding the lock, and it should not be called concurrently by itself.
+func (l *Lock) Heartbeat(ttl int64) error {
+	l.mu.RLock()
+	stopped, leaseID := l.heartbeatStopped, l.heartbeatLease
+	l.mu.RUnlock()
+
+	if stopped {
+		return nil
+	}
+	now := time.Now()
+	if leaseID != 0 {
+		err := keepLockHeartbeatOnce(l.cli, leaseID)
+		if err == nil {
+			l.mu.Lock()
+			l.lastHeartbeat = now
+			l.mu.Unlock()
+			return nil
+		}
+		if err != rpctypes.ErrLeaseNotFound {
+			return err
+		}
+		log.L().Warn("the heartbeat lease of the lock has expired, grant a new one", zap.String("lock", l.ID))
+	}
+
+	leaseID, err := putLockHeartbeat(l.cli, l.ID, ttl, now)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	stopped = l.heartbeatStopped
+	if !stopped {
+		l.heartbeatLease = leaseID
+		l.lastHeartbeat = now
+	}
+	l.mu.Unlock()
+
+	// the heartbeat is stopped while granting, revoke the new lease as `StopHeartbeat` doesn't know it.
+	if stopped {
+		if err = revokeLockHeartbeat(l.cli, leaseID); err != nil && err != rpctypes.ErrLeaseNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreatedAt returns the time when the lock is created, or rebuilt after DM-master restarted.
+func (l *Lock) CreatedAt() time.Time {
+	return l.createdAt
+}
+
+// LastHeartbeat returns the time of the last successful heartbeat, it's zero if no heartbeat succeeded.
+func (l *Lock) LastHeartbeat() time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.lastHeartbeat
+}
+
+// StopHeartbeat revokes the lease of the lock's heartbeat, no more heartbeat will be sent after stopped.
+func (l *Lock) StopHeartbeat() error {
+	l.mu.Lock()
+	l.heartbeatStopped = true
+	leaseID := l.heartbeatLease
+	l.heartbeatLease = 0
+	l.mu.Unlock()
+
+	if leaseID == 0 {
+		return nil
+	}
+	err := revokeLockHeartbeat(l.cli, leaseID)
+	if err != nil && err != rpctypes.ErrLeaseNotFound {
+		// keep the lease to be revoked by the next try.
+		l.mu.Lock()
+		if l.heartbeatLease == 0 {
+			l.heartbeatLease = leaseID
+		}
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
 // TryMarkDone tries to mark the operation of the source table as done.
 // it returns whether marked done.
 // NOTE: this method can always mark a existing table as done,
@@ -570,6 +904,11 @@ func (l *Lock) TryMarkDone(source, schema, table string) bool {
 
 	// always mark it as `true` now.
 	l.done[source][schema][table] = true
+	if ddls, ok := l.pendingDDLs[source][schema][table]; ok {
+		l.appliedDDLs = append(l.appliedDDLs, ddls...)
+		l.trimAppliedDDLs()
+		delete(l.pendingDDLs[source][schema], table)
+	}
 	return true
 }
 
@@ -614,6 +953,61 @@ func (l *Lock) IsResolved() bool {
 	return true
 }
 
+// ResolvedSources returns the sources whose tables all have the joined schema and have done their DDLs operations,
+// and the other straggling sources in the lock, both are sorted.
+func (l *Lock) ResolvedSources() (resolved, stragglers []string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	ready, _ := l.syncStatus()
+	for source, schemaTables := range ready {
+		sourceResolved := true
+		for schema, tables := range schemaTables {
+			for table, tableReady := range tables {
+				if !tableReady || !l.done[source][schema][table] {
+					sourceResolved = false
+				}
+			}
+		}
+		if sourceResolved {
+			resolved = append(resolved, source)
+		} else {
+			stragglers = append(stragglers, source)
+		}
+	}
+	sort.Strings(resolved)
+	sort.Strings(stragglers)
+	return resolved, stragglers
+}
+
+// SetQuorum sets the fraction of sources, e.g. 2/3, whose tables must be synced and done to resolve the lock.
+func (l *Lock) SetQuorum(quorum float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.quorum = quorum
+}
+
+// MinimalResolvingSources returns the smallest set of straggling sources whose sync would resolve the lock, sorted.
+// it's all the straggling sources if the quorum requires all sources, and it's empty if the lock has resolved.
+func (l *Lock) MinimalResolvingSources() []string {
+	resolved, stragglers := l.ResolvedSources()
+
+	l.mu.RLock()
+	quorum := l.quorum
+	l.mu.RUnlock()
+	if quorum <= 0 || quorum >= 1 {
+		return stragglers
+	}
+	total := len(resolved) + len(stragglers)
+	for n := 0; n < len(stragglers); n++ {
+		if float64(len(resolved)+n)/float64(total) >= quorum {
+			return stragglers[:n]
+		}
+	}
+	return stragglers
+}
+
 // syncedStatus returns the current tables' sync status (<Ready, remain>).
 func (l *Lock) syncStatus() (map[string]map[string]map[string]bool, int) {
 	ready := make(map[string]map[string]map[string]bool)
@@ -639,18 +1033,136 @@ func (l *Lock) syncStatus() (map[string]map[string]map[string]bool, int) {
 	return ready, remain
 }
 
+// PendingDDLs returns the DDLs of the not-done operations in the lock,
+// DDLs are ordered by source, schema and table, and the duplicate ones are removed.
+func (l *Lock) PendingDDLs() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	type tableDDLs struct {
+		tableID string
+		ddls    []string
+	}
+	pending := make([]tableDDLs, 0)
+	for source, schemaTables := range l.pendingDDLs {
+		for schema, tables := range schemaTables {
+			for table, ddls := range tables {
+				pending = append(pending, tableDDLs{
+					tableID: fmt.Sprintf("%s-%s", source, dbutil.TableName(schema, table)),
+					ddls:    ddls,
+				})
+			}
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].tableID < pending[j].tableID
+	})
+
+	var (
+		ddls = make([]string, 0)
+		seen = make(map[string]struct{})
+	)
+	for _, p := range pending {
+		for _, ddl := range p.ddls {
+			if _, ok := seen[ddl]; ok {
+				continue
+			}
+			seen[ddl] = struct{}{}
+			ddls = append(ddls, ddl)
+		}
+	}
+	return ddls
+}
+
+// PendingOperations returns the not-done operations of the tables in the lock, which are emitted until the lock
+// is resolved, operations are ordered by source, schema and table. NOTE: `Cols` of the operations are not kept in the lock.
+func (l *Lock) PendingOperations() []Operation {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	ops := make([]Operation, 0)
+	for source, schemaTables := range l.pendingDDLs {
+		for schema, tables := range schemaTables {
+			for table, ddls := range tables {
+				ops = append(ops, NewOperation(l.ID, l.Task, source, schema, table, ddls, ConflictNone, "", false, nil))
+			}
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		return fmt.Sprintf("%s-%s", ops[i].Source, dbutil.TableName(ops[i].UpSchema, ops[i].UpTable)) <
+			fmt.Sprintf("%s-%s", ops[j].Source, dbutil.TableName(ops[j].UpSchema, ops[j].UpTable))
+	})
+	return ops
+}
+
+// AppliedDDLs returns the DDLs of the done operations in the lock,
+// and the number of the older ones elided because the history exceeds the maximum size.
+func (l *Lock) AppliedDDLs() ([]string, int) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	ddls := make([]string, len(l.appliedDDLs))
+	copy(ddls, l.appliedDDLs)
+	return ddls, l.elidedDDLs
+}
+
+// SetMaxAppliedDDLs sets the maximum number of applied DDLs kept in the history of the lock,
+// a non-positive value resets it to `DefaultMaxAppliedDDLs`.
+func (l *Lock) SetMaxAppliedDDLs(maxAppliedDDLs int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if maxAppliedDDLs <= 0 {
+		maxAppliedDDLs = DefaultMaxAppliedDDLs
+	}
+	l.maxAppliedDDLs = maxAppliedDDLs
+	l.trimAppliedDDLs()
+}
+
+// trimAppliedDDLs keeps the latest `maxAppliedDDLs` applied DDLs.
+func (l *Lock) trimAppliedDDLs() {
+	if n := len(l.appliedDDLs) - l.maxAppliedDDLs; n > 0 {
+		l.elidedDDLs += n
+		l.appliedDDLs = append(l.appliedDDLs[:0:0], l.appliedDDLs[n:]...)
+	}
+}
+
 // tryRevertDone tries to revert the done status when the table's schema changed.
-func (l *Lock) tryRevertDone(source, schema, table string) {
+// it returns whether the done status has been reverted.
+func (l *Lock) tryRevertDone(source, schema, table string) bool {
 	if _, ok := l.done[source]; !ok {
-		return
+		return false
 	}
 	if _, ok := l.done[source][schema]; !ok {
-		return
+		return false
 	}
 	if _, ok := l.done[source][schema][table]; !ok {
-		return
+		return false
 	}
 	l.done[source][schema][table] = false
+	return true
+}
+
+// setPendingDDLs records the DDLs of the not-done operation for the table.
+func (l *Lock) setPendingDDLs(source, schema, table string, ddls []string) {
+	if _, ok := l.pendingDDLs[source]; !ok {
+		l.pendingDDLs[source] = make(map[string]map[string][]string)
+	}
+	if _, ok := l.pendingDDLs[source][schema]; !ok {
+		l.pendingDDLs[source][schema] = make(map[string][]string)
+	}
+	l.pendingDDLs[source][schema][table] = ddls
+}
+
+// setTableInfo records the latest table info of the source table.
+func (l *Lock) setTableInfo(source, schema, table string, ti *model.TableInfo) {
+	if _, ok := l.tableInfos[source]; !ok {
+		l.tableInfos[source] = make(map[string]map[string]*model.TableInfo)
+	}
+	if _, ok := l.tableInfos[source][schema]; !ok {
+		l.tableInfos[source][schema] = make(map[string]*model.TableInfo)
+	}
+	l.tableInfos[source][schema][table] = ti
 }
 
 // addTables adds any not-existing tables into the lock.
@@ -678,6 +1190,7 @@ func (l *Lock) addTables(tts []TargetTable) {
 						t := schemacmp.Encode(ti)
 						log.L().Debug("get source table info", zap.String("task", tt.Task), zap.String("source", tt.Source), zap.String("schema", schema), zap.String("table", table), zap.Stringer("info", t))
 						l.tables[tt.Source][schema][table] = t
+						l.setTableInfo(tt.Source, schema, table, ti)
 					}
 					l.done[tt.Source][schema][table] = false
 					l.versions[tt.Source][schema][table] = 0
@@ -723,9 +1236,12 @@ func (l *Lock) AddDroppedColumn(info Info, col string) error {
 	}
 	log.L().Info("add partially dropped columns", zap.String("column", col), zap.String("info", info.ShortString()))
 
-	_, _, err := PutDroppedColumn(l.cli, genDDLLockID(info), col, info.Source, info.UpSchema, info.UpTable, DropNotDone)
-	if err != nil {
-		return err
+	// no etcd client if the lock is not coordinated through etcd, keep the column only in memory.
+	if l.cli != nil {
+		_, _, err := PutDroppedColumn(l.cli, genDDLLockID(info), col, info.Source, info.UpSchema, info.UpTable, DropNotDone)
+		if err != nil {
+			return err
+		}
 	}
 
 	if _, ok := l.columns[col]; !ok {
@@ -769,10 +1285,12 @@ func (l *Lock) DeleteColumnsByOp(op Operation) error {
 				done = DropDone
 			}
 			// mark col PartiallyDone/Done
-			_, _, err := PutDroppedColumn(l.cli, op.ID, col, op.Source, op.UpSchema, op.UpTable, done)
-			if err != nil {
-				log.L().Error("cannot put drop column to etcd", log.ShortError(err))
-				return err
+			if l.cli != nil {
+				_, _, err := PutDroppedColumn(l.cli, op.ID, col, op.Source, op.UpSchema, op.UpTable, done)
+				if err != nil {
+					log.L().Error("cannot put drop column to etcd", log.ShortError(err))
+					return err
+				}
 			}
 			l.columns[col][op.Source][op.UpSchema][op.UpTable] = done
 		}
@@ -802,9 +1320,11 @@ func (l *Lock) DeleteColumnsByOp(op Operation) error {
 		log.L().Info("delete partially dropped columns",
 			zap.String("lockID", l.ID), zap.Strings("columns", colsToDelete))
 
-		_, _, err := DeleteDroppedColumns(l.cli, op.ID, colsToDelete...)
-		if err != nil {
-			return err
+		if l.cli != nil {
+			_, _, err := DeleteDroppedColumns(l.cli, op.ID, colsToDelete...)
+			if err != nil {
+				return err
+			}
 		}
 
 		for _, col := range colsToDelete {
@@ -829,6 +1349,19 @@ func (l *Lock) TableExist(source, schema, table string) bool {
 	return true
 }
 
+// IsTableInfoSame returns whether the table info of the source table in the lock is the same with `ti`.
+func (l *Lock) IsTableInfoSame(source, schema, table string, ti *model.TableInfo) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	t, ok := l.tables[source][schema][table]
+	if !ok || ti == nil {
+		return false
+	}
+	cmp, err := t.Compare(schemacmp.Encode(ti))
+	return err == nil && cmp == 0
+}
+
 // AddDifferentFieldLenColumns checks whether dm adds columns with different field lengths.
 func AddDifferentFieldLenColumns(lockID, ddl string, oldJoined, newJoined schemacmp.Table) (string, error) {
 	col, err := GetColumnName(lockID, ddl, ast.AlterTableAddColumns)
@@ -849,6 +1382,183 @@ func AddDifferentFieldLenColumns(lockID, ddl string, oldJoined, newJoined schema
 	return col, nil
 }
 
+// State captures the state of the lock, see `DiffLockStates`.
+func (l *Lock) State() LockState {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	tables := make(map[string]TableState)
+	for source, schemaTables := range l.tables {
+		for schema, tbls := range schemaTables {
+			for table, ti := range tbls {
+				tables[tableStateKey(source, schema, table)] = TableState{
+					Schema: ti.String(),
+					Done:   l.done[source][schema][table],
+				}
+			}
+		}
+	}
+	return LockState{
+		ID:         l.ID,
+		Task:       l.Task,
+		DownSchema: l.DownSchema,
+		DownTable:  l.DownTable,
+		Joined:     l.joined.String(),
+		Tables:     tables,
+	}
+}
+
+// IsTruncateTableDDLs returns whether the DDLs are all TRUNCATE TABLE, which change the data but not the schema.
+func IsTruncateTableDDLs(ddls []string) bool {
+	if len(ddls) == 0 {
+		return false
+	}
+	p := parser.New()
+	for _, ddl := range ddls {
+		stmt, err := p.ParseOneStmt(ddl, "", "")
+		if err != nil {
+			return false
+		}
+		if _, ok := stmt.(*ast.TruncateTableStmt); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// SplitMixedAlterDDLs splits each ALTER TABLE statement of the info which both adds and drops columns,
+// e.g. `ALTER TABLE bar ADD COLUMN c1 INT, DROP COLUMN c2`, into statements of single columns with the table infos
+// after each of them, so that every DDL either enlarges or shrinks the schema, which `TrySync` relies on to compute
+// the joined schema and the synced status of the lock. The info is returned as is if no statements are split.
+func SplitMixedAlterDDLs(info Info) (Info, error) {
+	if len(info.DDLs) != len(info.TableInfosAfter) || info.TableInfoBefore == nil {
+		return info, nil // reported by `TrySync`.
+	}
+	var (
+		p     = parser.New()
+		split bool
+		ddls  = make([]string, 0, len(info.DDLs))
+		tis   = make([]*model.TableInfo, 0, len(info.TableInfosAfter))
+		prev  = info.TableInfoBefore
+	)
+	for i, ddl := range info.DDLs {
+		after := info.TableInfosAfter[i]
+		stmt, err := p.ParseOneStmt(ddl, "", "")
+		if err != nil {
+			return info, terror.ErrShardDDLOptimismTrySyncFail.Delegate(err, genDDLLockID(info), fmt.Sprintf("fail to parse ddl %s", ddl))
+		}
+		alter, ok := stmt.(*ast.AlterTableStmt)
+		if !ok || !isMixedAlter(alter) {
+			ddls = append(ddls, ddl)
+			tis = append(tis, after)
+			prev = after
+			continue
+		}
+
+		// every column added or dropped is split into a statement in order.
+		type columnChange struct {
+			name  string
+			added bool
+		}
+		var changes []columnChange
+		for _, spec := range alter.Specs {
+			if spec.Tp == ast.AlterTableDropColumn {
+				changes = append(changes, columnChange{name: spec.OldColumnName.Name.L})
+				continue
+			}
+			for _, col := range spec.NewColumns {
+				changes = append(changes, columnChange{name: col.Name.Name.L, added: true})
+			}
+		}
+		sqls, err := dmparser.SplitDDL(alter, "")
+		if err != nil {
+			return info, err
+		}
+		if len(sqls) != len(changes) {
+			return info, terror.ErrShardDDLOptimismTrySyncFail.Generate(genDDLLockID(info),
+				fmt.Sprintf("fail to split ddl %s, got %d statements for %d columns", ddl, len(sqls), len(changes)))
+		}
+		ti := prev
+		for j, change := range changes {
+			if ti, err = changeColumn(ti, after, change.name, change.added); err != nil {
+				return info, terror.ErrShardDDLOptimismTrySyncFail.Delegate(err, genDDLLockID(info), fmt.Sprintf("fail to split ddl %s", ddl))
+			}
+			ddls = append(ddls, sqls[j])
+			tis = append(tis, ti)
+		}
+		// the table info after the last split statement is exactly the one after the whole statement.
+		tis[len(tis)-1] = after
+		prev = after
+		split = true
+	}
+	if !split {
+		return info, nil
+	}
+	log.L().Info("split mixed ALTER TABLE statements", zap.String("info", info.ShortString()), zap.Strings("ddls", ddls))
+	info.DDLs = ddls
+	info.TableInfosAfter = tis
+	return info, nil
+}
+
+// isMixedAlter returns whether the ALTER TABLE statement both adds and drops columns, and does nothing else.
+func isMixedAlter(alter *ast.AlterTableStmt) bool {
+	var add, drop bool
+	for _, spec := range alter.Specs {
+		switch spec.Tp {
+		case ast.AlterTableAddColumns:
+			add = true
+		case ast.AlterTableDropColumn:
+			drop = true
+		default:
+			return false
+		}
+	}
+	return add && drop
+}
+
+// changeColumn returns the table info with the column added from `after` or dropped,
+// indices on the dropped column are dropped too.
+func changeColumn(ti, after *model.TableInfo, name string, added bool) (*model.TableInfo, error) {
+	ti = ti.Clone()
+	if added {
+		col := model.FindColumnInfo(after.Columns, name)
+		if col == nil {
+			return nil, fmt.Errorf("added column %s not found in the table info after", name)
+		}
+		ti.Columns = append(ti.Columns, col.Clone())
+	} else {
+		columns := ti.Columns[:0]
+		for _, col := range ti.Columns {
+			if col.Name.L != name {
+				columns = append(columns, col)
+			}
+		}
+		ti.Columns = columns
+		indices := ti.Indices[:0]
+	NEXT:
+		for _, idx := range ti.Indices {
+			for _, idxCol := range idx.Columns {
+				if idxCol.Name.L == name {
+					continue NEXT
+				}
+			}
+			indices = append(indices, idx)
+		}
+		ti.Indices = indices
+	}
+	offsets := make(map[string]int, len(ti.Columns))
+	for i, col := range ti.Columns {
+		col.Offset = i
+		offsets[col.Name.L] = i
+	}
+	for _, idx := range ti.Indices {
+		for _, idxCol := range idx.Columns {
+			idxCol.Offset = offsets[idxCol.Name.L]
+		}
+	}
+	return ti, nil
+}
+
 // GetColumnName checks whether dm adds/drops a column, and return this column's name.
 func GetColumnName(lockID, ddl string, tp ast.AlterTableType) (string, error) {
 	if stmt, err := parser.New().ParseOneStmt(ddl, "", ""); err != nil {
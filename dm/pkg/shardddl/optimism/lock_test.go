@@ -449,6 +449,76 @@ func (t *testLock) TestLockTrySyncIndex(c *C) {
 	t.checkLockSynced(c, l)
 }
 
+func (t *testLock) TestLockTrySyncPrimaryKey(c *C) {
+	// nolint:dupl
+	var (
+		ID               = "test_lock_try_sync_primary_key-`foo`.`bar`"
+		task             = "test_lock_try_sync_primary_key"
+		source           = "mysql-replica-1"
+		downSchema       = "db"
+		downTable        = "bar"
+		db               = "db"
+		tbls             = []string{"bar1", "bar2"}
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar DROP PRIMARY KEY"}
+		DDLs2            = []string{"ALTER TABLE bar ADD PRIMARY KEY(id, c1)"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id VARCHAR(10) NOT NULL, c1 INT NOT NULL, PRIMARY KEY (id))`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id VARCHAR(10) NOT NULL, c1 INT NOT NULL)`)
+		ti2              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id VARCHAR(10) NOT NULL, c1 INT NOT NULL, PRIMARY KEY (id, c1))`)
+		tables           = map[string]map[string]struct{}{
+			db: {tbls[0]: struct{}{}, tbls[1]: struct{}{}},
+		}
+		tts = []TargetTable{
+			newTargetTable(task, source, downSchema, downTable, tables),
+		}
+
+		l = NewLock(etcdTestCli, ID, task, downSchema, downTable, schemacmp.Encode(ti0), tts, nil)
+
+		vers = map[string]map[string]map[string]int64{
+			source: {
+				db: {tbls[0]: 0, tbls[1]: 0},
+			},
+		}
+	)
+
+	// the lock is keyed by the downstream table only, changing the primary key is handled like
+	// `DROP INDEX` and then `ADD INDEX`, so the lock keeps tracking all tables without stalling.
+	for _, tbl := range tbls {
+		info := newInfoWithVersion(task, source, db, tbl, downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1}, vers)
+		DDLs, cols, err := l.TrySync(info, tts)
+		c.Assert(err, IsNil)
+		c.Assert(DDLs, DeepEquals, DDLs1)
+		c.Assert(cols, DeepEquals, []string{})
+		c.Assert(l.TryMarkDone(source, db, tbl), IsTrue)
+	}
+	t.checkLockSynced(c, l)
+	c.Assert(l.IsResolved(), IsTrue)
+
+	// `ADD PRIMARY KEY` is not returned until all tables have added it.
+	info := newInfoWithVersion(task, source, db, tbls[0], downSchema, downTable, DDLs2, ti1, []*model.TableInfo{ti2}, vers)
+	DDLs, cols, err := l.TrySync(info, tts)
+	c.Assert(err, IsNil)
+	c.Assert(DDLs, DeepEquals, []string{})
+	c.Assert(cols, DeepEquals, []string{})
+	c.Assert(l.TryMarkDone(source, db, tbls[0]), IsTrue)
+	synced, remain := l.IsSynced()
+	c.Assert(synced, IsFalse)
+	c.Assert(remain, Equals, 1)
+	c.Assert(l.IsResolved(), IsFalse)
+
+	info = newInfoWithVersion(task, source, db, tbls[1], downSchema, downTable, DDLs2, ti1, []*model.TableInfo{ti2}, vers)
+	DDLs, cols, err = l.TrySync(info, tts)
+	c.Assert(err, IsNil)
+	c.Assert(DDLs, DeepEquals, DDLs2)
+	c.Assert(cols, DeepEquals, []string{})
+	c.Assert(l.TryMarkDone(source, db, tbls[1]), IsTrue)
+	t.checkLockSynced(c, l)
+	c.Assert(l.IsResolved(), IsTrue)
+	c.Assert(l.ID, Equals, ID)
+}
+
 func (t *testLock) TestLockTrySyncNullNotNull(c *C) {
 	// nolint:dupl
 	var (
@@ -1352,6 +1422,80 @@ func (t *testLock) TestLockTrySyncMultipleChangeDDL(c *C) {
 	t.checkLockNoDone(c, l)
 }
 
+func (t *testLock) TestLockAppliedDDLs(c *C) {
+	var (
+		ID         = "test_lock_applied_ddls-`foo`.`bar`"
+		task       = "test_lock_applied_ddls"
+		source     = "mysql-replica-1"
+		downSchema = "foo"
+		downTable  = "bar"
+		db         = "foo"
+		tbl        = "bar1"
+		p          = parser.New()
+		se         = mock.NewContext()
+		tblID      = int64(111)
+		tis        = []*model.TableInfo{createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)}
+		ddls       = make([]string, 0)
+
+		tables = map[string]map[string]struct{}{db: {tbl: struct{}{}}}
+		tts    = []TargetTable{newTargetTable(task, source, downSchema, downTable, tables)}
+		l      = NewLock(etcdTestCli, ID, task, downSchema, downTable, schemacmp.Encode(tis[0]), tts, nil)
+
+		vers = map[string]map[string]map[string]int64{
+			source: {
+				db: {tbl: 0},
+			},
+		}
+	)
+	applied, elided := l.AppliedDDLs()
+	c.Assert(applied, HasLen, 0)
+	c.Assert(elided, Equals, 0)
+
+	l.SetMaxAppliedDDLs(3)
+	for i := 1; i <= 5; i++ {
+		ddl := fmt.Sprintf("ALTER TABLE bar ADD COLUMN c%d INT", i)
+		ddls = append(ddls, ddl)
+		createSQL := "CREATE TABLE bar (id INT PRIMARY KEY"
+		for j := 1; j <= i; j++ {
+			createSQL += fmt.Sprintf(", c%d INT", j)
+		}
+		tis = append(tis, createTableInfo(c, p, se, tblID, createSQL+")"))
+		info := newInfoWithVersion(task, source, db, tbl, downSchema, downTable, []string{ddl}, tis[i-1], []*model.TableInfo{tis[i]}, vers)
+		DDLs, _, err := l.TrySync(info, tts)
+		c.Assert(err, IsNil)
+		c.Assert(DDLs, DeepEquals, []string{ddl})
+
+		// the DDL is applied after the operation is done.
+		applied, _ = l.AppliedDDLs()
+		if i <= 3 {
+			c.Assert(applied, HasLen, i-1)
+		} else {
+			c.Assert(applied, DeepEquals, ddls[i-4:i-1])
+		}
+		c.Assert(l.TryMarkDone(source, db, tbl), IsTrue)
+		applied, elided = l.AppliedDDLs()
+		if i <= 3 {
+			c.Assert(applied, DeepEquals, ddls)
+			c.Assert(elided, Equals, 0)
+		} else {
+			c.Assert(applied, DeepEquals, ddls[i-3:])
+			c.Assert(elided, Equals, i-3)
+		}
+	}
+
+	// shrink the history.
+	l.SetMaxAppliedDDLs(1)
+	applied, elided = l.AppliedDDLs()
+	c.Assert(applied, DeepEquals, ddls[4:])
+	c.Assert(elided, Equals, 4)
+
+	// mark done again without pending DDLs takes no effect on the history.
+	c.Assert(l.TryMarkDone(source, db, tbl), IsTrue)
+	applied, elided = l.AppliedDDLs()
+	c.Assert(applied, DeepEquals, ddls[4:])
+	c.Assert(elided, Equals, 4)
+}
+
 func (t *testLock) TestTryRemoveTable(c *C) {
 	var (
 		ID               = "test_lock_try_remove_table-`foo`.`bar`"
@@ -2013,6 +2157,100 @@ func (t *testLock) TestLockTrySyncDifferentIndex(c *C) {
 	t.checkLockSynced(c, l)
 }
 
+func (t *testLock) TestLockMinimalResolvingSources(c *C) {
+	var (
+		ID               = "test_lock_minimal_resolving_sources-`foo`.`bar`"
+		task             = "test_lock_minimal_resolving_sources"
+		sources          = []string{"mysql-replica-1", "mysql-replica-2", "mysql-replica-3", "mysql-replica-4"}
+		downSchema       = "foo"
+		downTable        = "bar"
+		db               = "foo"
+		tbl              = "bar"
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		DDLs1            = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT)`)
+		tables           = map[string]map[string]struct{}{db: {tbl: struct{}{}}}
+		tts              = make([]TargetTable, 0, len(sources))
+		vers             = make(map[string]map[string]map[string]int64, len(sources))
+	)
+	for _, source := range sources {
+		tts = append(tts, newTargetTable(task, source, downSchema, downTable, tables))
+		vers[source] = map[string]map[string]int64{db: {tbl: 0}}
+	}
+	l := NewLock(etcdTestCli, ID, task, downSchema, downTable, schemacmp.Encode(ti0), tts, nil)
+
+	syncSource := func(source string) {
+		info := newInfoWithVersion(task, source, db, tbl, downSchema, downTable, DDLs1, ti0, []*model.TableInfo{ti1}, vers)
+		_, _, err := l.TrySync(info, tts)
+		c.Assert(err, IsNil)
+		c.Assert(l.TryMarkDone(source, db, tbl), IsTrue)
+	}
+
+	// only the first source adds c1 and done, all the other sources are required without the quorum.
+	syncSource(sources[0])
+	_, stragglers := l.ResolvedSources()
+	c.Assert(stragglers, DeepEquals, sources[1:])
+	c.Assert(l.MinimalResolvingSources(), DeepEquals, sources[1:])
+
+	// with the quorum of 3/4, two more sources are enough.
+	l.SetQuorum(0.75)
+	minimal := l.MinimalResolvingSources()
+	c.Assert(minimal, DeepEquals, sources[1:3])
+	c.Assert(len(minimal), Less, len(stragglers))
+
+	// the lock is resolved by the quorum once they're synced.
+	for _, source := range minimal {
+		syncSource(source)
+	}
+	c.Assert(l.MinimalResolvingSources(), HasLen, 0)
+	_, stragglers = l.ResolvedSources()
+	c.Assert(stragglers, DeepEquals, sources[3:])
+
+	// all the stragglers are required again without the quorum.
+	l.SetQuorum(0)
+	c.Assert(l.MinimalResolvingSources(), DeepEquals, sources[3:])
+}
+
+func (t *testLock) TestLockHeartbeat(c *C) {
+	var (
+		ID         = "test_lock_heartbeat-`foo`.`bar`"
+		task       = "test_lock_heartbeat"
+		source     = "mysql-replica-1"
+		downSchema = "foo"
+		downTable  = "bar"
+		p          = parser.New()
+		se         = mock.NewContext()
+		ti0        = createTableInfo(c, p, se, 111, `CREATE TABLE bar (id INT PRIMARY KEY)`)
+		tts        = []TargetTable{newTargetTable(task, source, downSchema, downTable, map[string]map[string]struct{}{"foo": {"bar": struct{}{}}})}
+		l          = NewLock(etcdTestCli, ID, task, downSchema, downTable, schemacmp.Encode(ti0), tts, nil)
+	)
+
+	// a lease is granted by the first heartbeat, and refreshed by the next one.
+	c.Assert(l.LastHeartbeat().IsZero(), IsTrue)
+	c.Assert(l.Heartbeat(10), IsNil)
+	last := l.LastHeartbeat()
+	c.Assert(last.IsZero(), IsFalse)
+	_, exist, err := GetLockHeartbeat(etcdTestCli, ID)
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsTrue)
+	c.Assert(l.Heartbeat(10), IsNil)
+	c.Assert(l.LastHeartbeat().Before(last), IsFalse)
+
+	// the lease is revoked after stopped, and no more heartbeat is sent.
+	c.Assert(l.StopHeartbeat(), IsNil)
+	_, exist, err = GetLockHeartbeat(etcdTestCli, ID)
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+	c.Assert(l.Heartbeat(10), IsNil)
+	_, exist, err = GetLockHeartbeat(etcdTestCli, ID)
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+	c.Assert(l.StopHeartbeat(), IsNil)
+}
+
 func (t *testLock) TestFetchTableInfo(c *C) {
 	var (
 		meta             = "meta"
@@ -2071,3 +2309,51 @@ func (t *testLock) TestFetchTableInfo(c *C) {
 	c.Assert(mock.ExpectationsWereMet(), IsNil)
 	c.Assert(ti, DeepEquals, ti0)
 }
+
+func (t *testLock) TestSplitMixedAlterDDLs(c *C) {
+	var (
+		task             = "test-split-mixed-alter-ddls"
+		source           = "mysql-replica-1"
+		downSchema       = "db"
+		downTable        = "bar"
+		p                = parser.New()
+		se               = mock.NewContext()
+		tblID      int64 = 111
+		ti0              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c2 INT, INDEX idx_c2 (c2))`)
+		ti1              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT, c3 INT)`)
+		ti2              = createTableInfo(c, p, se, tblID, `CREATE TABLE bar (id INT PRIMARY KEY, c1 INT, c3 INT, c4 INT)`)
+		DDLs             = []string{
+			"ALTER TABLE bar ADD COLUMN (c1 INT, c3 INT), DROP COLUMN c2",
+			"ALTER TABLE bar ADD COLUMN c4 INT",
+		}
+		info = NewInfo(task, source, "foo", "bar-1", downSchema, downTable, DDLs, ti0, []*model.TableInfo{ti1, ti2})
+	)
+
+	split, err := SplitMixedAlterDDLs(info)
+	c.Assert(err, IsNil)
+	c.Assert(split.DDLs, DeepEquals, []string{
+		"ALTER TABLE `bar` ADD COLUMN `c1` INT",
+		"ALTER TABLE `bar` ADD COLUMN `c3` INT",
+		"ALTER TABLE `bar` DROP COLUMN `c2`",
+		"ALTER TABLE bar ADD COLUMN c4 INT",
+	})
+	c.Assert(split.TableInfosAfter, HasLen, 4)
+	c.Assert(split.TableInfosAfter[2], Equals, ti1)
+	c.Assert(split.TableInfosAfter[3], Equals, ti2)
+
+	// every split DDL either enlarges or shrinks the schema.
+	prev := schemacmp.Encode(ti0)
+	for i, cmp := range []int{-1, -1, 1, -1} {
+		next := schemacmp.Encode(split.TableInfosAfter[i])
+		res, err := prev.Compare(next)
+		c.Assert(err, IsNil)
+		c.Assert(res, Equals, cmp)
+		prev = next
+	}
+
+	// infos without mixed ALTER TABLE are kept as is.
+	info = NewInfo(task, source, "foo", "bar-1", downSchema, downTable, DDLs[1:], ti1, []*model.TableInfo{ti2})
+	split, err = SplitMixedAlterDDLs(info)
+	c.Assert(err, IsNil)
+	c.Assert(split, DeepEquals, info)
+}
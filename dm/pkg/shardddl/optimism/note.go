@@ -0,0 +1,56 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimism
+
+import (
+	"go.etcd.io/etcd/clientv3"
+
+	"github.com/pingcap/tiflow/dm/dm/common"
+	"github.com/pingcap/tiflow/dm/pkg/etcdutil"
+)
+
+// GetAllLockNotes gets the notes of all shard DDL locks, lock-ID -> note.
+func GetAllLockNotes(cli *clientv3.Client) (map[string]string, int64, error) {
+	notes := make(map[string]string)
+	op := clientv3.OpGet(common.ShardDDLOptimismLockNoteKeyAdapter.Path(), clientv3.WithPrefix())
+	respTxn, rev, err := etcdutil.DoOpsInOneTxnWithRetry(cli, op)
+	if err != nil {
+		return notes, 0, err
+	}
+	resp := respTxn.Responses[0].GetResponseRange()
+	for _, kv := range resp.Kvs {
+		keys, err := common.ShardDDLOptimismLockNoteKeyAdapter.Decode(string(kv.Key))
+		if err != nil {
+			return notes, 0, err
+		}
+		notes[keys[0]] = string(kv.Value)
+	}
+	return notes, rev, nil
+}
+
+// PutLockNote puts the note of the shard DDL lock into etcd, an empty note deletes the existing one.
+// This function should often be called by DM-master when operators annotate the lock.
+func PutLockNote(cli *clientv3.Client, lockID, note string) (int64, error) {
+	op := deleteLockNoteOp(lockID)
+	if note != "" {
+		op = clientv3.OpPut(common.ShardDDLOptimismLockNoteKeyAdapter.Encode(lockID), note)
+	}
+	_, rev, err := etcdutil.DoOpsInOneTxnWithRetry(cli, op)
+	return rev, err
+}
+
+// deleteLockNoteOp returns a DELETE etcd operation for the note of the specified lock.
+func deleteLockNoteOp(lockID string) clientv3.Op {
+	return clientv3.OpDelete(common.ShardDDLOptimismLockNoteKeyAdapter.Encode(lockID))
+}
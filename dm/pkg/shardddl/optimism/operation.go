@@ -16,6 +16,7 @@ package optimism
 import (
 	"context"
 	"encoding/json"
+	"strconv"
 
 	"go.etcd.io/etcd/clientv3"
 	"go.etcd.io/etcd/clientv3/clientv3util"
@@ -23,6 +24,7 @@ import (
 
 	"github.com/pingcap/tiflow/dm/dm/common"
 	"github.com/pingcap/tiflow/dm/pkg/etcdutil"
+	"github.com/pingcap/tiflow/dm/pkg/terror"
 )
 
 // ConflictStage represents the current shard DDL conflict stage in the optimistic mode.
@@ -101,6 +103,29 @@ func operationFromJSON(s string) (o Operation, err error) {
 
 // PutOperation puts the shard DDL operation into etcd.
 func PutOperation(cli *clientv3.Client, skipDone bool, op Operation, infoModRev int64) (rev int64, putted bool, err error) {
+	return putOperation(cli, nil, skipDone, op, infoModRev)
+}
+
+// PutOperationWithEpoch puts the shard DDL operation into etcd only if the leader epoch is still the specified one,
+// see `PutOperation` for `skipDone` and `infoModRev`. It returns an error if the epoch is outdated.
+func PutOperationWithEpoch(cli *clientv3.Client, epoch int64, skipDone bool, op Operation, infoModRev int64) (rev int64, putted bool, err error) {
+	fence := clientv3.Compare(clientv3.Value(common.ShardDDLOptimismLeaderEpochKey), "=", strconv.FormatInt(epoch, 10))
+	rev, putted, err = putOperation(cli, []clientv3.Cmp{fence}, skipDone, op, infoModRev)
+	if err != nil || putted {
+		return rev, putted, err
+	}
+	current, err := GetLeaderEpoch(cli)
+	if err != nil {
+		return 0, false, err
+	}
+	if current != epoch {
+		return 0, false, terror.ErrMasterOptimisticLeaderFenced.Generate(epoch)
+	}
+	return rev, putted, nil
+}
+
+// putOperation puts the shard DDL operation into etcd if all the fences are satisfied.
+func putOperation(cli *clientv3.Client, fences []clientv3.Cmp, skipDone bool, op Operation, infoModRev int64) (rev int64, putted bool, err error) {
 	value, err := op.toJSON()
 	if err != nil {
 		return 0, false, err
@@ -108,9 +133,9 @@ func PutOperation(cli *clientv3.Client, skipDone bool, op Operation, infoModRev
 	key := common.ShardDDLOptimismOperationKeyAdapter.Encode(op.Task, op.Source, op.UpSchema, op.UpTable)
 	opPut := clientv3.OpPut(key, value)
 
-	cmpsNotExist := make([]clientv3.Cmp, 0, 1)
-	cmpsNotDone := make([]clientv3.Cmp, 0, 1)
-	cmpsLessRev := make([]clientv3.Cmp, 0, 1)
+	cmpsNotExist := append(make([]clientv3.Cmp, 0, len(fences)+1), fences...)
+	cmpsNotDone := append(make([]clientv3.Cmp, 0, len(fences)+1), fences...)
+	cmpsLessRev := append(make([]clientv3.Cmp, 0, len(fences)+1), fences...)
 	if skipDone {
 		opDone := op
 		opDone.Done = true // set `done` to `true`.
@@ -15,9 +15,14 @@ package optimism
 
 import (
 	"context"
+	"fmt"
+	"runtime"
+	"sync"
 	"time"
 
 	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tiflow/dm/pkg/utils"
 )
 
 func (t *testForEtcd) TestOperationJSON(c *C) {
@@ -158,3 +163,83 @@ func (t *testForEtcd) TestOperationEtcd(c *C) {
 	c.Assert(succ, IsFalse)
 	c.Assert(rev9, Equals, rev8)
 }
+
+func (t *testForEtcd) TestOperationWatcher(c *C) {
+	defer clearTestInfoOperation(c)
+
+	var (
+		tables   = 200
+		task     = "test-operation-watcher"
+		source   = "mysql-replica-1"
+		upSchema = "foo"
+		DDLs     = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		w        = NewOperationWatcher(etcdTestCli, task, source)
+		results  = make(chan Operation, tables)
+	)
+	upTable := func(i int) string {
+		return fmt.Sprintf("bar_%d", i)
+	}
+	watching := func() (int, int) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		waiters := 0
+		for _, ws := range w.waiters {
+			waiters += len(ws)
+		}
+		return waiters, w.running
+	}
+
+	// an operation of another source is put, it's never received.
+	other := NewOperation("test-ID", task, "mysql-replica-10", upSchema, upTable(0), DDLs, ConflictNone, "", false, []string{})
+	rev, _, err := PutOperation(etcdTestCli, false, other, 0)
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	goroutines := runtime.NumGoroutine()
+	var wg sync.WaitGroup
+	for i := 0; i < tables; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			op, err2 := w.Wait(ctx, upSchema, upTable(i), rev)
+			c.Check(err2, IsNil)
+			results <- op
+		}(i)
+	}
+	c.Assert(utils.WaitSomething(30, 100*time.Millisecond, func() bool {
+		waiters, _ := watching()
+		return waiters == tables
+	}), IsTrue)
+	// only one watch goroutine for all tables, besides the waiting ones.
+	_, running := watching()
+	c.Assert(running, Equals, 1)
+	c.Assert(runtime.NumGoroutine()-goroutines, LessEqual, tables+20)
+
+	// all operations are received by their tables.
+	for i := 0; i < tables; i++ {
+		op := NewOperation("test-ID", task, source, upSchema, upTable(i), DDLs, ConflictNone, "", false, []string{})
+		_, _, err = PutOperation(etcdTestCli, false, op, 0)
+		c.Assert(err, IsNil)
+	}
+	wg.Wait()
+	close(results)
+	received := make(map[string]struct{}, tables)
+	for op := range results {
+		c.Assert(op.Source, Equals, source)
+		received[op.UpTable] = struct{}{}
+	}
+	c.Assert(received, HasLen, tables)
+
+	// the watch is stopped without waiters.
+	c.Assert(utils.WaitSomething(30, 100*time.Millisecond, func() bool {
+		_, running = watching()
+		return running == 0
+	}), IsTrue)
+
+	// the waiting is canceled.
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel2()
+	_, err = w.Wait(ctx2, upSchema, upTable(tables), rev)
+	c.Assert(err, Equals, context.DeadlineExceeded)
+}
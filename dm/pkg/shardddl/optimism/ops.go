@@ -47,7 +47,7 @@ func PutSourceTablesDeleteInfo(cli *clientv3.Client, st SourceTables, info Info)
 	return rev, err
 }
 
-// DeleteInfosOperationsColumns deletes the shard DDL infos, operations, and dropped columns in etcd.
+// DeleteInfosOperationsColumns deletes the shard DDL infos, operations, dropped columns, the note and the seed of the lock in etcd.
 // This function should often be called by DM-master when removing the lock.
 // Only delete when all info's version are greater or equal to etcd's version, otherwise it means new info was putted into etcd before.
 func DeleteInfosOperationsColumns(cli *clientv3.Client, infos []Info, ops []Operation, lockID string) (int64, bool, error) {
@@ -61,7 +61,7 @@ func DeleteInfosOperationsColumns(cli *clientv3.Client, infos []Info, ops []Oper
 	for _, op := range ops {
 		opsDel = append(opsDel, deleteOperationOp(op))
 	}
-	opsDel = append(opsDel, deleteDroppedColumnsByLockOp(lockID))
+	opsDel = append(opsDel, deleteDroppedColumnsByLockOp(lockID), deleteLockNoteOp(lockID), deleteLockSeedOp(lockID))
 	resp, rev, err := etcdutil.DoOpsInOneCmpsTxnWithRetry(cli, cmps, opsDel, []clientv3.Op{})
 	if err != nil {
 		return 0, false, err
@@ -69,6 +69,25 @@ func DeleteInfosOperationsColumns(cli *clientv3.Client, infos []Info, ops []Oper
 	return rev, resp.Succeeded, nil
 }
 
+// EstimateTaskSize estimates the etcd space in bytes used by the shard DDL infos, operations and source tables
+// of the task, by summing the sizes of their keys and values. The storage overhead of etcd itself is not counted.
+func EstimateTaskSize(cli *clientv3.Client, task string) (int64, error) {
+	respTxn, _, err := etcdutil.DoOpsInOneTxnWithRetry(cli,
+		clientv3.OpGet(common.ShardDDLOptimismInfoKeyAdapter.Encode(task), clientv3.WithPrefix()),
+		clientv3.OpGet(common.ShardDDLOptimismOperationKeyAdapter.Encode(task), clientv3.WithPrefix()),
+		clientv3.OpGet(common.ShardDDLOptimismSourceTablesKeyAdapter.Encode(task), clientv3.WithPrefix()))
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, resp := range respTxn.Responses {
+		for _, kv := range resp.GetResponseRange().Kvs {
+			size += int64(len(kv.Key) + len(kv.Value))
+		}
+	}
+	return size, nil
+}
+
 // DeleteInfosOperationsTablesByTask deletes the shard DDL infos and operations in etcd.
 // This function should often be called by DM-master when stop a task for all sources.
 func DeleteInfosOperationsTablesByTask(cli *clientv3.Client, task string, lockIDSet map[string]struct{}) (int64, error) {
@@ -78,6 +97,7 @@ func DeleteInfosOperationsTablesByTask(cli *clientv3.Client, task string, lockID
 	opsDel = append(opsDel, clientv3.OpDelete(common.ShardDDLOptimismSourceTablesKeyAdapter.Encode(task), clientv3.WithPrefix()))
 	for lockID := range lockIDSet {
 		opsDel = append(opsDel, clientv3.OpDelete(common.ShardDDLOptimismDroppedColumnsKeyAdapter.Encode(lockID), clientv3.WithPrefix()))
+		opsDel = append(opsDel, deleteLockNoteOp(lockID), deleteLockSeedOp(lockID))
 	}
 	_, rev, err := etcdutil.DoOpsInOneTxnWithRetry(cli, opsDel...)
 	return rev, err
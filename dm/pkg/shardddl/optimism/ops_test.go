@@ -15,6 +15,8 @@ package optimism
 
 import (
 	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tiflow/dm/dm/common"
 )
 
 func (t *testForEtcd) TestDeleteInfosOperationsSchema(c *C) {
@@ -140,3 +142,57 @@ func (t *testForEtcd) TestSourceTablesInfo(c *C) {
 	c.Assert(rev6, Equals, rev4)
 	c.Assert(ifm, HasLen, 0)
 }
+
+func (t *testForEtcd) TestEstimateTaskSize(c *C) {
+	defer clearTestInfoOperation(c)
+
+	var (
+		task       = "test-estimate-size"
+		task2      = "test-estimate-size-2"
+		source     = "mysql-replica-1"
+		upSchema   = "foo-1"
+		upTable    = "bar-1"
+		downSchema = "foo"
+		downTable  = "bar"
+		DDLs       = []string{"ALTER TABLE bar ADD COLUMN c1 INT"}
+		info       = NewInfo(task, source, upSchema, upTable, downSchema, downTable, DDLs, nil, nil)
+		op         = NewOperation("test-ID", task, source, upSchema, upTable, DDLs, ConflictNone, "", false, []string{})
+		st         = NewSourceTables(task, source)
+		info2      = NewInfo(task2, source, upSchema, upTable, downSchema, downTable, DDLs, nil, nil)
+	)
+	st.AddTable(upSchema, upTable, downSchema, downTable)
+
+	// nothing in etcd.
+	size, err := EstimateTaskSize(etcdTestCli, task)
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(0))
+
+	// seed the info, operation and source tables of the task, and an info of another task.
+	_, err = PutInfo(etcdTestCli, info)
+	c.Assert(err, IsNil)
+	_, _, err = PutOperation(etcdTestCli, false, op, 0)
+	c.Assert(err, IsNil)
+	_, err = PutSourceTables(etcdTestCli, st)
+	c.Assert(err, IsNil)
+	_, err = PutInfo(etcdTestCli, info2)
+	c.Assert(err, IsNil)
+
+	infoValue, err := info.toJSON()
+	c.Assert(err, IsNil)
+	opValue, err := op.toJSON()
+	c.Assert(err, IsNil)
+	stValue, err := st.toJSON()
+	c.Assert(err, IsNil)
+	expected := len(common.ShardDDLOptimismInfoKeyAdapter.Encode(task, source, upSchema, upTable)) + len(infoValue) +
+		len(common.ShardDDLOptimismOperationKeyAdapter.Encode(task, source, upSchema, upTable)) + len(opValue) +
+		len(common.ShardDDLOptimismSourceTablesKeyAdapter.Encode(task, source)) + len(stValue)
+
+	// the estimate is within 10% of the seeded size, and the other task is not counted.
+	size, err = EstimateTaskSize(etcdTestCli, task)
+	c.Assert(err, IsNil)
+	diff := size - int64(expected)
+	if diff < 0 {
+		diff = -diff
+	}
+	c.Assert(diff*10 <= int64(expected), IsTrue, Commentf("estimated %d, expected %d", size, expected))
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimism
+
+import (
+	"go.etcd.io/etcd/clientv3"
+
+	"github.com/pingcap/tiflow/dm/dm/common"
+	"github.com/pingcap/tiflow/dm/pkg/etcdutil"
+)
+
+// LockSeed is the joined schema seeded to the shard DDL lock by operators.
+type LockSeed struct {
+	// CreateSQL is the CREATE TABLE statement of the seeded schema.
+	CreateSQL string
+	// Revision is the ModRevision of the seed in etcd, the shard DDL infos with larger revisions are put after it.
+	Revision int64
+}
+
+// GetAllLockSeeds gets the seeded joined schemas of all shard DDL locks, lock-ID -> seed.
+func GetAllLockSeeds(cli *clientv3.Client) (map[string]LockSeed, int64, error) {
+	seeds := make(map[string]LockSeed)
+	op := clientv3.OpGet(common.ShardDDLOptimismLockSeedKeyAdapter.Path(), clientv3.WithPrefix())
+	respTxn, rev, err := etcdutil.DoOpsInOneTxnWithRetry(cli, op)
+	if err != nil {
+		return seeds, 0, err
+	}
+	resp := respTxn.Responses[0].GetResponseRange()
+	for _, kv := range resp.Kvs {
+		keys, err := common.ShardDDLOptimismLockSeedKeyAdapter.Decode(string(kv.Key))
+		if err != nil {
+			return seeds, 0, err
+		}
+		seeds[keys[0]] = LockSeed{CreateSQL: string(kv.Value), Revision: kv.ModRevision}
+	}
+	return seeds, rev, nil
+}
+
+// PutLockSeed puts the seeded joined schema of the shard DDL lock into etcd, it replaces the existing one.
+// This function should often be called by DM-master when operators seed the joined schema of the lock.
+func PutLockSeed(cli *clientv3.Client, lockID, createSQL string) (int64, error) {
+	op := clientv3.OpPut(common.ShardDDLOptimismLockSeedKeyAdapter.Encode(lockID), createSQL)
+	_, rev, err := etcdutil.DoOpsInOneTxnWithRetry(cli, op)
+	return rev, err
+}
+
+// deleteLockSeedOp returns a DELETE etcd operation for the seeded joined schema of the specified lock.
+func deleteLockSeedOp(lockID string) clientv3.Op {
+	return clientv3.OpDelete(common.ShardDDLOptimismLockSeedKeyAdapter.Encode(lockID))
+}
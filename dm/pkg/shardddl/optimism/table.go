@@ -17,12 +17,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
 
 	"go.etcd.io/etcd/clientv3"
 	"go.etcd.io/etcd/mvcc/mvccpb"
 
 	"github.com/pingcap/tiflow/dm/dm/common"
 	"github.com/pingcap/tiflow/dm/pkg/etcdutil"
+	"github.com/pingcap/tiflow/dm/pkg/terror"
 )
 
 // SourceTables represents the upstream/sources tables for a data migration **subtask**.
@@ -44,6 +49,9 @@ type SourceTables struct {
 	// only used to report to the caller of the watcher, do not marsh it.
 	// if it's true, it means the SourceTables has been deleted in etcd.
 	IsDeleted bool `json:"-"`
+	// only used to report to the caller of the watcher, do not marsh it.
+	// it's the revision of the PUT or DELETE in etcd.
+	Revision int64 `json:"-"`
 }
 
 // TargetTable represents some upstream/sources tables for **one** target table.
@@ -175,6 +183,47 @@ func (st *SourceTables) TargetTable(downSchema, downTable string) TargetTable {
 	return newTargetTable(st.Task, st.Source, downSchema, downTable, tables)
 }
 
+// checkTargetsConsistent checks whether every upstream table is routed to only one downstream table,
+// the upstream tables with the same name in different sources are treated as the same one.
+func checkTargetsConsistent(sts ...SourceTables) error {
+	// upstream table -> downstream table -> upstream source IDs.
+	targets := make(map[string]map[string][]string)
+	for _, st := range sts {
+		for downSchema, downTables := range st.Tables {
+			for downTable, upSchemas := range downTables {
+				down := dbutil.TableName(downSchema, downTable)
+				for upSchema, upTables := range upSchemas {
+					for upTable := range upTables {
+						up := dbutil.TableName(upSchema, upTable)
+						if _, ok := targets[up]; !ok {
+							targets[up] = make(map[string][]string)
+						}
+						targets[up][down] = append(targets[up][down], st.Source)
+					}
+				}
+			}
+		}
+	}
+
+	ups := make([]string, 0, len(targets))
+	for up, downs := range targets {
+		if len(downs) > 1 {
+			ups = append(ups, up)
+		}
+	}
+	if len(ups) == 0 {
+		return nil
+	}
+	sort.Strings(ups)
+	downs := make([]string, 0, len(targets[ups[0]]))
+	for down, sources := range targets[ups[0]] {
+		sort.Strings(sources)
+		downs = append(downs, fmt.Sprintf("%s in %s", down, strings.Join(sources, ", ")))
+	}
+	sort.Strings(downs)
+	return terror.ErrShardDDLOptimismInconsistentTargets.Generate(ups[0], strings.Join(downs, "; "))
+}
+
 // sourceTablesFromJSON constructs SourceTables from its JSON represent.
 func sourceTablesFromJSON(s string) (st SourceTables, err error) {
 	err = json.Unmarshal([]byte(s), &st)
@@ -183,7 +232,11 @@ func sourceTablesFromJSON(s string) (st SourceTables, err error) {
 
 // PutSourceTables puts source tables into etcd.
 // This function should often be called by DM-worker.
+// it returns an error without putting if any upstream table is routed to more than one downstream tables.
 func PutSourceTables(cli *clientv3.Client, st SourceTables) (int64, error) {
+	if err := checkTargetsConsistent(st); err != nil {
+		return 0, err
+	}
 	op, err := putSourceTablesOp(st)
 	if err != nil {
 		return 0, err
@@ -275,6 +328,7 @@ func WatchSourceTables(ctx context.Context, cli *clientv3.Client, revision int64
 						return
 					}
 				} else {
+					st.Revision = ev.Kv.ModRevision
 					select {
 					case outCh <- st:
 					case <-ctx.Done():
@@ -18,6 +18,8 @@ import (
 	"time"
 
 	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tiflow/dm/pkg/terror"
 )
 
 func (t *testForEtcd) TestSourceTablesJSON(c *C) {
@@ -152,3 +154,20 @@ func (t *testForEtcd) TestSourceTablesEtcd(c *C) {
 	c.Assert(std.Source, Equals, st2.Source)
 	c.Assert(len(ech), Equals, 0)
 }
+
+func (t *testForEtcd) TestPutSourceTablesInconsistentTargets(c *C) {
+	defer clearTestInfoOperation(c)
+
+	st := NewSourceTables("task", "mysql-replica-1")
+	st.AddTable("db", "tbl-1", "db", "tbl")
+	st.AddTable("db", "tbl-1", "db", "tbl2")
+	_, err := PutSourceTables(etcdTestCli, st)
+	c.Assert(terror.ErrShardDDLOptimismInconsistentTargets.Equal(err), IsTrue)
+	c.Assert(err, ErrorMatches, ".*upstream table `db`.`tbl-1` is routed to inconsistent downstream tables: "+
+		"`db`.`tbl` in mysql-replica-1; `db`.`tbl2` in mysql-replica-1.*")
+
+	// nothing putted.
+	stm, _, err := GetAllSourceTables(etcdTestCli)
+	c.Assert(err, IsNil)
+	c.Assert(stm, HasLen, 0)
+}
@@ -0,0 +1,213 @@
+// Copyright 2022 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimism
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pingcap/tidb-tools/pkg/dbutil"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/mvcc/mvccpb"
+
+	"github.com/pingcap/tiflow/dm/dm/common"
+)
+
+// OperationWatcher multiplexes the watches of shard DDL lock operations for all upstream tables of a source,
+// so at most one watch goroutine is running no matter how many tables are waiting for their operations.
+// The watch is only running while there are waiters.
+type OperationWatcher struct {
+	cli    *clientv3.Client
+	task   string
+	source string
+
+	mu sync.Mutex
+	// the revision the running watch started from, and the function to stop it, it's nil if not running.
+	startRev int64
+	cancel   context.CancelFunc
+	// the number of the running watch goroutines, including the stopped ones not exited yet.
+	running int
+	// `schema`.`table` -> the waiters of the operation of the upstream table.
+	waiters map[string][]*operationWaiter
+	// `schema`.`table` -> the latest operation of the upstream table received by the running watch.
+	latest map[string]revisionedOperation
+}
+
+type operationWaiter struct {
+	revision int64
+	ch       chan operationResult
+}
+
+type operationResult struct {
+	op  Operation
+	err error
+}
+
+type revisionedOperation struct {
+	op       Operation
+	revision int64
+}
+
+// NewOperationWatcher creates a new OperationWatcher instance.
+func NewOperationWatcher(cli *clientv3.Client, task, source string) *OperationWatcher {
+	return &OperationWatcher{
+		cli:     cli,
+		task:    task,
+		source:  source,
+		waiters: make(map[string][]*operationWaiter),
+		latest:  make(map[string]revisionedOperation),
+	}
+}
+
+// Wait waits for the shard DDL lock operation of the upstream table PUT since the revision,
+// it's the same as `WatchOperationPut` for the table but shares the watch with other tables.
+func (w *OperationWatcher) Wait(ctx context.Context, upSchema, upTable string, revision int64) (Operation, error) {
+	key := dbutil.TableName(upSchema, upTable)
+	w.mu.Lock()
+	if latest, ok := w.latest[key]; ok && latest.revision >= revision {
+		w.mu.Unlock()
+		return latest.op, nil
+	}
+	waiter := &operationWaiter{revision: revision, ch: make(chan operationResult, 1)}
+	w.waiters[key] = append(w.waiters[key], waiter)
+	// the running watch can't go back to the revision, so it's restarted from the revision.
+	if w.cancel == nil || revision < w.startRev {
+		w.restart(revision)
+	}
+	w.mu.Unlock()
+	defer w.removeWaiter(key, waiter)
+
+	select {
+	case res := <-waiter.ch:
+		return res.op, res.err
+	case <-ctx.Done():
+		return Operation{}, ctx.Err()
+	}
+}
+
+// restart (re)starts the watch from the revision, the caller should hold the lock.
+func (w *OperationWatcher) restart(revision int64) {
+	w.stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	w.startRev = revision
+	w.cancel = cancel
+	w.running++
+	go func() {
+		defer func() {
+			w.mu.Lock()
+			w.running--
+			w.mu.Unlock()
+		}()
+		w.watch(ctx, revision)
+	}()
+}
+
+// stop stops the running watch, the caller should hold the lock.
+func (w *OperationWatcher) stop() {
+	if w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+	}
+	w.startRev = 0
+	w.latest = make(map[string]revisionedOperation)
+}
+
+// removeWaiter removes the waiter, and stops the watch if there are no waiters.
+func (w *OperationWatcher) removeWaiter(key string, waiter *operationWaiter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	waiters := w.waiters[key]
+	for i := range waiters {
+		if waiters[i] == waiter {
+			w.waiters[key] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(w.waiters[key]) == 0 {
+		delete(w.waiters, key)
+	}
+	if len(w.waiters) == 0 {
+		w.stop()
+	}
+}
+
+func (w *OperationWatcher) watch(ctx context.Context, revision int64) {
+	ch := w.cli.Watch(ctx, common.ShardDDLOptimismOperationKeyAdapter.Encode(w.task, w.source),
+		clientv3.WithPrefix(), clientv3.WithRev(revision))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case resp, ok := <-ch:
+			if !ok {
+				return
+			}
+			if resp.Canceled {
+				w.fail(ctx, resp.Err())
+				return
+			}
+			for _, ev := range resp.Events {
+				if ev.Type != mvccpb.PUT {
+					continue
+				}
+				op, err := operationFromJSON(string(ev.Kv.Value))
+				if err != nil {
+					w.fail(ctx, err)
+					return
+				}
+				w.dispatch(ctx, op, ev.Kv.ModRevision)
+			}
+		}
+	}
+}
+
+// dispatch sends the operation to the waiters of its upstream table waiting since a revision not after it.
+func (w *OperationWatcher) dispatch(ctx context.Context, op Operation, revision int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if ctx.Err() != nil {
+		return // the watch has been stopped or restarted.
+	}
+	key := dbutil.TableName(op.UpSchema, op.UpTable)
+	w.latest[key] = revisionedOperation{op: op, revision: revision}
+	waiters := w.waiters[key][:0]
+	for _, waiter := range w.waiters[key] {
+		if waiter.revision <= revision {
+			waiter.ch <- operationResult{op: op}
+			continue
+		}
+		waiters = append(waiters, waiter)
+	}
+	if len(waiters) == 0 {
+		delete(w.waiters, key)
+	} else {
+		w.waiters[key] = waiters
+	}
+}
+
+// fail sends the error to all waiters and stops the watch.
+func (w *OperationWatcher) fail(ctx context.Context, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	for key, waiters := range w.waiters {
+		for _, waiter := range waiters {
+			waiter.ch <- operationResult{err: err}
+		}
+		delete(w.waiters, key)
+	}
+	w.stop()
+}
@@ -191,6 +191,9 @@ const (
 
 	// pkg/binlog.
 	codeBinlogNotLogColumn
+
+	// pkg/shardddl/optimism.
+	codeShardDDLOptimismInconsistentTargets
 )
 
 // Config related error code list.
@@ -501,6 +504,13 @@ const (
 	codeMasterOptimisticTableInfobeforeNotExist
 	codeMasterOptimisticDownstreamMetaNotFound
 	codeMasterInvalidClusterID
+	codeMasterOptimisticOperationNotFound
+	codeMasterOptimisticApprovalNotFound
+	codeMasterOptimisticUnknownSourceTable
+	codeMasterOptimisticLeaderFenced
+	codeMasterOptimisticSourceNotInLock
+	codeMasterOptimisticInvalidRecordedEvent
+	codeMasterOptimisticInvalidJoinedSchema
 )
 
 // DM-worker error code.
@@ -857,6 +867,9 @@ var (
 	// pkg/binlog.
 	ErrBinlogNotLogColumn = New(codeBinlogNotLogColumn, ClassBinlogOp, ScopeUpstream, LevelHigh, "upstream didn't log enough columns in binlog", "Please check if session `binlog_row_image` variable is not FULL, restart task to the location from where FULL binlog_row_image is used.")
 
+	// pkg/shardddl/optimism.
+	ErrShardDDLOptimismInconsistentTargets = New(codeShardDDLOptimismInconsistentTargets, ClassFunctional, ScopeInternal, LevelHigh, "upstream table %s is routed to inconsistent downstream tables: %s", "Please check the `routes` config of the task, an upstream table should be routed to only one downstream table.")
+
 	// Config related error.
 	ErrConfigCheckItemNotSupport    = New(codeConfigCheckItemNotSupport, ClassConfig, ScopeInternal, LevelMedium, "checking item %s is not supported\n%s", "Please check `ignore-checking-items` config in task configuration file, which can be set including `all`/`dump_privilege`/`replication_privilege`/`version`/`binlog_enable`/`binlog_format`/`binlog_row_image`/`table_schema`/`schema_of_shard_tables`/`auto_increment_ID`.")
 	ErrConfigTomlTransform          = New(codeConfigTomlTransform, ClassConfig, ScopeInternal, LevelMedium, "%s", "Please check the configuration file has correct TOML format.")
@@ -1154,6 +1167,13 @@ var (
 	ErrMasterOptimisticTableInfoBeforeNotExist = New(codeMasterOptimisticTableInfobeforeNotExist, ClassDMMaster, ScopeInternal, LevelHigh, "table-info-before not exist in optimistic ddls: %v", "")
 	ErrMasterOptimisticDownstreamMetaNotFound  = New(codeMasterOptimisticDownstreamMetaNotFound, ClassDMMaster, ScopeInternal, LevelHigh, "downstream database config and meta for task %s not found", "")
 	ErrMasterInvalidClusterID                  = New(codeMasterInvalidClusterID, ClassDMMaster, ScopeInternal, LevelHigh, "invalid cluster id: %v", "")
+	ErrMasterOptimisticOperationNotFound       = New(codeMasterOptimisticOperationNotFound, ClassDMMaster, ScopeInternal, LevelHigh, "shard DDL lock operation of lock %s for source %s not found", "Please use show-ddl-locks command to see the synced and unsynced sources of the lock.")
+	ErrMasterOptimisticApprovalNotFound        = New(codeMasterOptimisticApprovalNotFound, ClassDMMaster, ScopeInternal, LevelHigh, "no shard DDL lock operation of lock %s for table %s is pending approval", "")
+	ErrMasterOptimisticUnknownSourceTable      = New(codeMasterOptimisticUnknownSourceTable, ClassDMMaster, ScopeInternal, LevelHigh, "upstream table %s of source %s is not in the source tables of task %s", "Please check whether the table should be migrated, or change the policy for unknown source tables.")
+	ErrMasterOptimisticLeaderFenced            = New(codeMasterOptimisticLeaderFenced, ClassDMMaster, ScopeInternal, LevelHigh, "shard DDL lock operation is fenced because the leader epoch %d is outdated", "Please check whether another DM-master has become the leader.")
+	ErrMasterOptimisticSourceNotInLock         = New(codeMasterOptimisticSourceNotInLock, ClassDMMaster, ScopeInternal, LevelHigh, "source %s is not in shard DDL lock %s", "Please use show-ddl-locks command to see the sources of the lock.")
+	ErrMasterOptimisticInvalidRecordedEvent    = New(codeMasterOptimisticInvalidRecordedEvent, ClassDMMaster, ScopeInternal, LevelHigh, "recorded event %d should have exactly one of source tables, shard DDL info and lock operation", "Please check whether the recorded events are corrupted.")
+	ErrMasterOptimisticInvalidJoinedSchema     = New(codeMasterOptimisticInvalidJoinedSchema, ClassDMMaster, ScopeInternal, LevelHigh, "invalid joined schema %s for shard DDL lock %s", "Please specify the joined schema in a CREATE TABLE statement.")
 
 	// DM-worker error.
 	ErrWorkerParseFlagSet            = New(codeWorkerParseFlagSet, ClassDMWorker, ScopeInternal, LevelMedium, "parse dm-worker config flag set", "")
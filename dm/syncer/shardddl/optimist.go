@@ -36,6 +36,8 @@ type Optimist struct {
 	source string
 
 	tables optimism.SourceTables
+	// the operations of all upstream tables are received by the watcher, which shares one watch among them.
+	opWatcher *optimism.OperationWatcher
 
 	// the shard DDL info which is pending to handle.
 	pendingInfo *optimism.Info
@@ -46,10 +48,11 @@ type Optimist struct {
 // NewOptimist creates a new Optimist instance.
 func NewOptimist(pLogger *log.Logger, cli *clientv3.Client, task, source string) *Optimist {
 	return &Optimist{
-		logger: pLogger.WithFields(zap.String("component", "shard DDL optimist")),
-		cli:    cli,
-		task:   task,
-		source: source,
+		logger:    pLogger.WithFields(zap.String("component", "shard DDL optimist")),
+		cli:       cli,
+		task:      task,
+		source:    source,
+		opWatcher: optimism.NewOperationWatcher(cli, task, source),
 	}
 }
 
@@ -145,24 +148,14 @@ func (o *Optimist) DeleteInfoRemoveTable(info optimism.Info) (int64, error) {
 
 // GetOperation gets the shard DDL lock operation relative to the shard DDL info.
 func (o *Optimist) GetOperation(ctx context.Context, info optimism.Info, rev int64) (optimism.Operation, error) {
-	ctx2, cancel2 := context.WithCancel(ctx)
-	defer cancel2()
-
-	ch := make(chan optimism.Operation, 1)
-	errCh := make(chan error, 1)
-	go optimism.WatchOperationPut(ctx2, o.cli, o.task, o.source, info.UpSchema, info.UpTable, rev, ch, errCh)
-
-	select {
-	case op := <-ch:
-		o.mu.Lock()
-		o.pendingOp = &op
-		o.mu.Unlock()
-		return op, nil
-	case err := <-errCh:
+	op, err := o.opWatcher.Wait(ctx, info.UpSchema, info.UpTable, rev)
+	if err != nil {
 		return optimism.Operation{}, err
-	case <-ctx.Done():
-		return optimism.Operation{}, ctx.Err()
 	}
+	o.mu.Lock()
+	o.pendingOp = &op
+	o.mu.Unlock()
+	return op, nil
 }
 
 // DoneOperation marks the shard DDL lock operation as done.